@@ -0,0 +1,119 @@
+// Package archive packs generated files into reproducible zip, tar and
+// tar.gz archives. It is the packer behind oapi2proto's archive -out and
+// reads any fs.FS: a directory via os.DirFS, files held in memory
+// (fstest.MapFS, embed.FS), ... The archive can go to any writer, such as
+// an HTTP response.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// modTime is the timestamp of every zip entry (the earliest a zip can hold).
+var modTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Pack writes every file of files to w as a zip, tar or tar.gz (.tgz)
+// archive, picked by the extension of name. Entries are sorted by path and
+// carry a fixed timestamp, so identical files give identical bytes. A
+// non-empty comment is stored as the zip comment or in a leading PAX global
+// header of a tar; Comment reads it back.
+func Pack(w io.Writer, name, comment string, files fs.FS) error {
+	var names []string
+	err := fs.WalkDir(files, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		names = append(names, p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return packZip(w, files, names, comment)
+	case strings.HasSuffix(lower, ".tar"):
+		return packTar(w, files, names, comment)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		gz := gzip.NewWriter(w)
+		if err := packTar(gz, files, names, comment); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+	return fmt.Errorf("archive: %s: not a .zip, .tar, .tar.gz or .tgz name", name)
+}
+
+// Comment returns the comment Pack stored in an archive, or "" when data
+// holds no such comment (or is no archive).
+func Comment(data []byte) string {
+	if zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+		return zr.Comment
+	}
+	var src io.Reader = bytes.NewReader(data)
+	if gz, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+		defer gz.Close()
+		src = gz
+	}
+	h, err := tar.NewReader(src).Next()
+	if err != nil || h.Typeflag != tar.TypeXGlobalHeader {
+		return ""
+	}
+	return h.PAXRecords["comment"]
+}
+
+func packZip(w io.Writer, files fs.FS, names []string, comment string) error {
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		h := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+		h.SetMode(0o644)
+		f, err := zw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := zw.SetComment(comment); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func packTar(w io.Writer, files fs.FS, names []string, comment string) error {
+	tw := tar.NewWriter(w)
+	if comment != "" {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": comment}}); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+const marker = "Code generated by oapi2proto. DO NOT EDIT."
+
+func readZip(data []byte) (map[string][]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[f.Name] = content
+	}
+	return files, nil
+}
+
+func readTar(data []byte) (map[string][]byte, error) {
+	var src io.Reader = bytes.NewReader(data)
+	if gz, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+		defer gz.Close()
+		src = gz
+	}
+	r := tar.NewReader(src)
+	files := map[string][]byte{}
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		files[h.Name] = content
+	}
+}
+
+func TestPackArchive(t *testing.T) {
+	files := fstest.MapFS{
+		"api/v1/pet.proto":           {Data: []byte("syntax = \"proto3\";\n")},
+		"oapi2proto/options.proto":   {Data: []byte("// options\n")},
+		"buf.yaml":                   {Data: []byte("version: v2\n")},
+		"api/v1/pet_http.yaml":       {Data: nil},
+		"api/v1/nested/deep/x.proto": {Data: []byte("x")},
+	}
+	for _, name := range []string{"out.zip", "out.tar", "out.tar.gz", "out.tgz"} {
+		t.Run(name, func(t *testing.T) {
+			var first, second bytes.Buffer
+			if err := Pack(&first, name, marker, files); err != nil {
+				t.Fatal(err)
+			}
+			if err := Pack(&second, name, marker, files); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(first.Bytes(), second.Bytes()) {
+				t.Error("packing the same files twice gave different bytes")
+			}
+			read := readTar
+			if name == "out.zip" {
+				read = readZip
+			}
+			got, err := read(first.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c := Comment(first.Bytes()); c != marker {
+				t.Errorf("comment = %q, want %q", c, marker)
+			}
+			if len(got) != len(files) {
+				t.Errorf("archive holds %d files, want %d", len(got), len(files))
+			}
+			for p, f := range files {
+				if !bytes.Equal(got[p], f.Data) {
+					t.Errorf("%s = %q, want %q", p, got[p], f.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestPackUnknownName(t *testing.T) {
+	var b bytes.Buffer
+	if err := Pack(&b, "out.rar", marker, fstest.MapFS{}); err == nil {
+		t.Error("packed an unsupported archive name")
+	}
+	if c := Comment([]byte("not an archive")); c != "" {
+		t.Errorf("comment of plain data = %q", c)
+	}
+}
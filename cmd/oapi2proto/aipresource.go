@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const resourceImport = "google/api/resource.proto"
+
+// AIPResource is the `x-aip-resource` (alias `x-google-resource`) extension
+// of a schema, rendered as the google.api.resource message option.
+type AIPResource struct {
+	Type      string       `json:"type" yaml:"type"`
+	Pattern   stringOrList `json:"pattern" yaml:"pattern"`
+	Plural    string       `json:"plural" yaml:"plural"`
+	Singular  string       `json:"singular" yaml:"singular"`
+	NameField string       `json:"nameField" yaml:"nameField"`
+}
+
+// stringOrList accepts a single string or a list of them.
+type stringOrList []string
+
+func (p *stringOrList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*p = stringOrList{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(p))
+}
+
+func (p *stringOrList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*p = stringOrList{node.Value}
+		return nil
+	}
+	return node.Decode((*[]string)(p))
+}
+
+// aipResource returns the resource extension of s, preferring x-aip-resource.
+func aipResource(s *Schema) *AIPResource {
+	if s.AIPResource != nil {
+		return s.AIPResource
+	}
+	return s.GoogleResource
+}
+
+// resourceOption renders `option (google.api.resource) = {...};` for a
+// schema carrying x-aip-resource. A type that is not `{service}/{Kind}`
+// is reported and dropped, since AIP tooling rejects it.
+func (g *genContext) resourceOption(msgName string, s *Schema) string {
+	r := aipResource(s)
+	if r == nil {
+		return ""
+	}
+	if svc, kind, ok := strings.Cut(r.Type, "/"); !ok || svc == "" || kind == "" || strings.Contains(kind, "/") {
+		g.diag(severityWarning, "aip-resource", msgName, fmt.Sprintf("x-aip-resource type %q is not {service}/{Kind}; option dropped", r.Type))
+		return ""
+	}
+	pairs := []string{"type: " + textQuote(r.Type)}
+	for _, p := range r.Pattern {
+		pairs = append(pairs, "pattern: "+textQuote(p))
+	}
+	for _, kv := range [][2]string{{"name_field", r.NameField}, {"plural", r.Plural}, {"singular", r.Singular}} {
+		if kv[1] != "" {
+			pairs = append(pairs, kv[0]+": "+textQuote(kv[1]))
+		}
+	}
+	g.useImport(resourceImport)
+	return fmt.Sprintf("option (google.api.resource) = %s;", aggregate(pairs))
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cstcen/oapi2proto/archive"
+)
+
+// Archive inputs: -in bundle.zip (or .tar / .tar.gz / .tgz, local or remote)
+// reads the root spec from the archive, bundle.zip//path/openapi.yaml names
+// it explicitly. Relative $refs of the spec resolve to other members.
+
+// archivePathRe splits <archive>[//<member>].
+var archivePathRe = regexp.MustCompile(`(?i)^(.*?\.(?:zip|tar|tar\.gz|tgz))(?://(.*))?$`)
+
+// maxArchiveSize bounds the decompressed content read from one archive.
+const maxArchiveSize = 256 << 20
+
+// rootSpecNames are picked, in this order, among the shallowest specs when
+// no member is named.
+var rootSpecNames = []string{"openapi.yaml", "openapi.yml", "openapi.json", "swagger.yaml", "swagger.yml", "swagger.json", "asyncapi.yaml", "asyncapi.yml", "asyncapi.json"}
+
+// archives memoizes decoded archives by path for the whole run.
+var archives = struct {
+	mu sync.Mutex
+	m  map[string]map[string][]byte
+}{m: map[string]map[string][]byte{}}
+
+// splitArchivePath returns the archive and member of an archive input.
+func splitArchivePath(p string) (archive, member string, ok bool) {
+	m := archivePathRe.FindStringSubmatch(p)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+func isArchiveSpec(p string) bool {
+	_, _, ok := splitArchivePath(p)
+	return ok
+}
+
+// openArchive 读取 (并缓存) zip / tar / tar.gz 归档, 返回成员路径 -> 内容
+func (o *genOptions) openArchive(p string) (map[string][]byte, error) {
+	archives.mu.Lock()
+	defer archives.mu.Unlock()
+	if files, ok := archives.m[p]; ok {
+		return files, nil
+	}
+	data, err := o.readFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var files map[string][]byte
+	if strings.HasSuffix(strings.ToLower(p), ".zip") {
+		files, err = readZip(data)
+	} else {
+		files, err = readTar(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	archives.m[p] = files
+	return files, nil
+}
+
+// memberName cleans an archive entry name; "" for entries to skip.
+func memberName(name string) string {
+	name = path.Clean(strings.TrimLeft(strings.ReplaceAll(name, `\`, "/"), "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") || strings.HasPrefix(name, "__MACOSX/") {
+		return ""
+	}
+	return name
+}
+
+func readZip(data []byte) (map[string][]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	budget := int64(maxArchiveSize)
+	for _, f := range r.File {
+		name := memberName(f.Name)
+		if name == "" || f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		content, err := readLimited(rc, &budget)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		files[name] = content
+	}
+	return files, nil
+}
+
+func readTar(data []byte) (map[string][]byte, error) {
+	var src io.Reader = bytes.NewReader(data)
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		src = gz
+	}
+	r := tar.NewReader(src)
+	files := map[string][]byte{}
+	budget := int64(maxArchiveSize)
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := memberName(h.Name)
+		if name == "" || h.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := readLimited(r, &budget)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", h.Name, err)
+		}
+		files[name] = content
+	}
+}
+
+// readLimited reads r, charging the bytes to the archive-wide budget.
+func readLimited(r io.Reader, budget *int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, *budget+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > *budget {
+		return nil, fmt.Errorf("归档解压后超过 %d MiB", maxArchiveSize>>20)
+	}
+	*budget -= int64(len(data))
+	return data, nil
+}
+
+// archiveRoot names the root spec of an archive input: the given member, an
+// openapi / swagger / asyncapi file at the shallowest level, or the only
+// spec file at that level. Deeper openapi.yaml files (vendored specs) are
+// never picked over the top level.
+func (o *genOptions) archiveRoot(p string) (string, error) {
+	archive, member, _ := splitArchivePath(p)
+	if member != "" {
+		return archive + "//" + path.Clean(member), nil
+	}
+	files, err := o.openArchive(archive)
+	if err != nil {
+		return "", err
+	}
+	var specs []string
+	for name := range files {
+		if specExt(name) {
+			specs = append(specs, name)
+		}
+	}
+	if len(specs) == 0 {
+		return "", errors.New("归档中没有 json/yaml spec")
+	}
+	depth := func(name string) int { return strings.Count(name, "/") }
+	sort.Slice(specs, func(i, j int) bool {
+		if di, dj := depth(specs[i]), depth(specs[j]); di != dj {
+			return di < dj
+		}
+		return specs[i] < specs[j]
+	})
+	var top []string
+	for _, name := range specs {
+		if depth(name) == depth(specs[0]) {
+			top = append(top, name)
+		}
+	}
+	for _, want := range rootSpecNames {
+		for _, name := range top {
+			if strings.EqualFold(path.Base(name), want) {
+				return archive + "//" + name, nil
+			}
+		}
+	}
+	if len(top) == 1 {
+		return archive + "//" + top[0], nil
+	}
+	return "", fmt.Errorf("无法确定根 spec (%s), 请用 %s//<path> 指定", strings.Join(top, ", "), archive)
+}
+
+func specExt(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// readArchiveMember returns one member of an archive input.
+func (o *genOptions) readArchiveMember(p string) ([]byte, error) {
+	root, err := o.archiveRoot(p)
+	if err != nil {
+		return nil, err
+	}
+	archive, member, _ := splitArchivePath(root)
+	files, err := o.openArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := files[member]
+	if !ok {
+		return nil, fmt.Errorf("%s: 归档中没有 %s", archive, member)
+	}
+	return data, nil
+}
+
+// isArchiveOutput reports whether -out names an archive to pack the
+// generated files into.
+func isArchiveOutput(p string) bool {
+	lower := strings.ToLower(p)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeArchive 将 files 中的全部文件打包为 out (zip / tar / tar.gz); 已有的 out
+// 不是 oapi2proto 生成的归档时同样需要 -force
+func (o *genOptions) writeArchive(out string, files fs.FS) error {
+	var buf bytes.Buffer
+	if err := archive.Pack(&buf, out, generatedMarker, files); err != nil {
+		return err
+	}
+	if d := filepath.Dir(out); d != "" {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+	}
+	return o.writeOwned(out, buf.Bytes(), isGeneratedArchive)
+}
+
+// isGeneratedArchive reports whether an existing archive was packed by
+// writeArchive, i.e. carries generatedMarker as its comment.
+func isGeneratedArchive(data []byte) bool {
+	return archive.Comment(data) == generatedMarker
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cstcen/oapi2proto/archive"
+)
+
+func TestArchiveRoot(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		members []string
+		want    string
+	}{
+		{"named root", []string{"api.yaml", "openapi.yaml"}, "openapi.yaml"},
+		{"nested openapi.yaml", []string{"api.yaml", "vendor/openapi.yaml"}, "api.yaml"},
+		{"name order", []string{"swagger.json", "openapi.yml"}, "openapi.yml"},
+		{"only nested", []string{"spec/openapi.yaml", "spec/common.yaml", "spec/x/openapi.yaml"}, "spec/openapi.yaml"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := "test-" + tc.name + ".zip"
+			files := map[string][]byte{"README.md": nil}
+			for _, m := range tc.members {
+				files[m] = nil
+			}
+			archives.mu.Lock()
+			archives.m[p] = files
+			archives.mu.Unlock()
+			got, err := (&genOptions{}).archiveRoot(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := p + "//" + tc.want; got != want {
+				t.Errorf("archiveRoot = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// bundle is a spec registry bundle: the root spec refers to members in
+// other directories, which refer on to each other.
+var bundle = fstest.MapFS{
+	"openapi.yaml": {Data: []byte(`
+openapi: 3.0.0
+info: {title: Pets, version: "1"}
+paths: {}
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        owner: {$ref: 'schemas/owner.yaml#/Owner'}
+`)},
+	"schemas/owner.yaml": {Data: []byte(`
+Owner:
+  type: object
+  properties:
+    address: {$ref: '../common/address.yaml#/Address'}
+`)},
+	"common/address.yaml": {Data: []byte("Address: {type: object, properties: {city: {type: string}}}\n")},
+	"other/spec.yaml": {Data: []byte(`
+openapi: 3.0.0
+info: {title: Other, version: "1"}
+paths: {}
+components:
+  schemas:
+    Other: {$ref: '../common/address.yaml#/Address'}
+`)},
+	"__MACOSX/openapi.yaml": {Data: []byte("junk")},
+}
+
+func TestArchiveInput(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name, file, member string
+		want               []string
+	}{
+		{"zip", "bundle.zip", "", []string{"message Pet {", "message Owner {\n  Address address = 1;\n}", "message Address {\n  string city = 1;\n}"}},
+		{"tar", "bundle.tar", "", []string{"message Pet {", "message Address {"}},
+		{"tar.gz", "bundle.tar.gz", "", []string{"message Pet {", "message Address {"}},
+		{"tgz", "bundle.TGZ", "", []string{"message Pet {", "message Address {"}},
+		{"named member", "named.zip", "other/spec.yaml", []string{"message Other {\n  string city = 1;\n}"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := archive.Pack(&b, tc.file, "", bundle); err != nil {
+				t.Fatal(err)
+			}
+			p := filepath.Join(dir, tc.file)
+			if err := os.WriteFile(p, b.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			in := p
+			if tc.member != "" {
+				in += "//" + tc.member
+			}
+			opts := testOptions(t)
+			doc, err := loadDocument(in, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, ctx := renderFile(&doc, opts, opts.pkg, opts.goPkg, "")
+			if len(ctx.errors) > 0 {
+				t.Fatal(ctx.errors)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveErrors(t *testing.T) {
+	dir := t.TempDir()
+	pack := func(name string, files fstest.MapFS) string {
+		var b bytes.Buffer
+		if err := archive.Pack(&b, name, "", files); err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, b.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	escape := pack("escape.zip", fstest.MapFS{"openapi.yaml": {Data: []byte(`
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        owner: {$ref: '../outside.yaml#/Owner'}
+`)}})
+	if err := os.WriteFile(filepath.Join(dir, "outside.yaml"), []byte("Owner: {type: object, properties: {secret: {type: string}}}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("ref outside of the archive", func(t *testing.T) {
+		opts := testOptions(t)
+		doc, err := loadDocument(escape, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(doc.warnings) != 1 || doc.warnings[0].Kind != "external-ref" || !strings.Contains(doc.warnings[0].Message, "points outside of") {
+			t.Errorf("warnings = %v, want the ref kept as outside of the archive", doc.warnings)
+		}
+		if out, _ := renderFile(&doc, opts, opts.pkg, opts.goPkg, ""); strings.Contains(out, "secret") {
+			t.Errorf("read a file next to the archive:\n%s", out)
+		}
+	})
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{"missing member", pack("member.zip", bundle) + "//none.yaml", "归档中没有 none.yaml"},
+		{"no spec", pack("empty.tar", fstest.MapFS{"README.md": {Data: []byte("hi")}}), "归档中没有 json/yaml spec"},
+		{"ambiguous root", pack("two.zip", fstest.MapFS{"a.yaml": {}, "b.yaml": {}}), "无法确定根 spec (a.yaml, b.yaml)"},
+		{"not an archive", func() string {
+			p := filepath.Join(dir, "broken.zip")
+			if err := os.WriteFile(p, []byte("not a zip"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			return p
+		}(), "broken.zip"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadDocument(tc.in, testOptions(t))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestMemberName(t *testing.T) {
+	for in, want := range map[string]string{
+		"openapi.yaml":          "openapi.yaml",
+		"/spec/openapi.yaml":    "spec/openapi.yaml",
+		`spec\common.yaml`:      "spec/common.yaml",
+		"spec/./x/../a.yaml":    "spec/a.yaml",
+		"../etc/passwd":         "",
+		"spec/../../x.yaml":     "",
+		"__MACOSX/openapi.yaml": "",
+		"./":                    "",
+	} {
+		if got := memberName(in); got != want {
+			t.Errorf("memberName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const inputAsyncAPI = "asyncapi"
+
+// asyncAPIDocument is the subset of AsyncAPI 2.x / 3.x read by -input-format asyncapi.
+type asyncAPIDocument struct {
+	AsyncAPI   string                     `json:"asyncapi" yaml:"asyncapi"`
+	Info       Info                       `json:"info" yaml:"info"`
+	Channels   map[string]*asyncChannel   `json:"channels" yaml:"channels"`
+	Operations map[string]*asyncOperation `json:"operations" yaml:"operations"` // 3.x
+	Components struct {
+		Schemas  map[string]*Schema       `json:"schemas" yaml:"schemas"`
+		Messages map[string]*asyncMessage `json:"messages" yaml:"messages"`
+	} `json:"components" yaml:"components"`
+}
+
+type asyncChannel struct {
+	Address     string                   `json:"address" yaml:"address"` // 3.x
+	Description string                   `json:"description" yaml:"description"`
+	Publish     *asyncOperation          `json:"publish" yaml:"publish"`     // 2.x
+	Subscribe   *asyncOperation          `json:"subscribe" yaml:"subscribe"` // 2.x
+	Messages    map[string]*asyncMessage `json:"messages" yaml:"messages"`   // 3.x
+}
+
+type asyncOperation struct {
+	OperationID string          `json:"operationId" yaml:"operationId"`
+	Summary     string          `json:"summary" yaml:"summary"`
+	Description string          `json:"description" yaml:"description"`
+	Tags        []asyncTag      `json:"tags" yaml:"tags"`
+	Message     *asyncMessage   `json:"message" yaml:"message"`   // 2.x
+	Action      string          `json:"action" yaml:"action"`     // 3.x: send|receive
+	Channel     *asyncMessage   `json:"channel" yaml:"channel"`   // 3.x, only $ref is used
+	Messages    []*asyncMessage `json:"messages" yaml:"messages"` // 3.x
+}
+
+type asyncTag struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+type asyncMessage struct {
+	Ref     string          `json:"$ref" yaml:"$ref"`
+	Name    string          `json:"name" yaml:"name"`
+	Title   string          `json:"title" yaml:"title"`
+	Payload *Schema         `json:"payload" yaml:"payload"`
+	OneOf   []*asyncMessage `json:"oneOf" yaml:"oneOf"` // 2.x
+}
+
+// channelOp is an AsyncAPI operation mapped to an rpc. Operations the
+// application receives take the payload; operations it sends stream it.
+type channelOp struct {
+	name    string
+	channel string
+	op      *Operation
+	payload string // component schema name, "" for google.protobuf.Empty
+	stream  bool
+}
+
+// asyncConverter 累积 AsyncAPI 转换状态
+type asyncConverter struct {
+	src      *asyncAPIDocument
+	doc      *Document
+	messages map[string]*asyncMessage // pointer -> message
+	payloads map[*asyncMessage]string // message -> component schema name
+}
+
+// parseAsyncAPI 将 AsyncAPI 文档转换为 Document: components.schemas 原样保留,
+// message payload 成为 message (以 message 名命名), channel 上的 operation
+// 记录为 -services 使用的 rpc
+func parseAsyncAPI(data []byte) (Document, error) {
+	src := &asyncAPIDocument{}
+	if jErr := json.Unmarshal(data, src); jErr != nil {
+		if yErr := yaml.Unmarshal(data, src); yErr != nil {
+			return Document{}, fmt.Errorf("parse asyncapi (json/yaml) failed: jsonErr=%v yamlErr=%v", jErr, yErr)
+		}
+	}
+	if src.AsyncAPI == "" {
+		return Document{}, errors.New("missing asyncapi version field")
+	}
+	doc := Document{Info: src.Info}
+	doc.Components.Schemas = map[string]*Schema{}
+	for name, s := range src.Components.Schemas {
+		doc.Components.Schemas[name] = s
+		setOrigin(s, componentSchemasPrefix+escapePointer(name))
+	}
+	c := &asyncConverter{src: src, doc: &doc, messages: map[string]*asyncMessage{}, payloads: map[*asyncMessage]string{}}
+	for name, m := range src.Components.Messages {
+		c.messages["#/components/messages/"+escapePointer(name)] = m
+		if m != nil {
+			setOrigin(m.Payload, "#/components/messages/"+escapePointer(name)+"/payload")
+		}
+	}
+	for ch, channel := range src.Channels {
+		if channel == nil {
+			continue
+		}
+		for name, m := range channel.Messages {
+			c.messages["#/channels/"+escapePointer(ch)+"/messages/"+escapePointer(name)] = m
+			if m != nil {
+				setOrigin(m.Payload, "#/channels/"+escapePointer(ch)+"/messages/"+escapePointer(name)+"/payload")
+			}
+		}
+	}
+	for _, name := range sortedKeys(src.Components.Messages) {
+		c.payloadType(src.Components.Messages[name], name)
+	}
+
+	if strings.HasPrefix(src.AsyncAPI, "2.") {
+		for _, ch := range sortedKeys(src.Channels) {
+			channel := src.Channels[ch]
+			if channel == nil {
+				continue
+			}
+			// 2.x: publish = the application receives, subscribe = it sends
+			c.addOperation(ch, "publish", channel.Publish, []*asyncMessage{channel.Publish.message()}, false)
+			c.addOperation(ch, "subscribe", channel.Subscribe, []*asyncMessage{channel.Subscribe.message()}, true)
+		}
+	} else {
+		for _, id := range sortedKeys(src.Operations) {
+			op := src.Operations[id]
+			if op == nil {
+				continue
+			}
+			if op.OperationID == "" {
+				op.OperationID = id
+			}
+			ch := ""
+			var channel *asyncChannel
+			if op.Channel != nil {
+				ch = strings.TrimPrefix(op.Channel.Ref, "#/channels/")
+				ch = unescapePointer(ch)
+				channel = src.Channels[ch]
+			}
+			msgs := op.Messages
+			if len(msgs) == 0 && channel != nil {
+				for _, name := range sortedKeys(channel.Messages) {
+					msgs = append(msgs, channel.Messages[name])
+				}
+			}
+			if channel != nil && channel.Address != "" {
+				ch = channel.Address
+			}
+			c.addOperation(ch, op.Action, op, msgs, op.Action == "send")
+		}
+	}
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		rewriteMessageRefs(doc.Components.Schemas[name], c)
+	}
+	if doc.empty() && len(doc.channels) == 0 {
+		return Document{}, errors.New("no components.schemas, messages or channels found")
+	}
+	prepareDocument(&doc)
+	return doc, nil
+}
+
+// message returns the 2.x operation message (nil-safe).
+func (op *asyncOperation) message() *asyncMessage {
+	if op == nil {
+		return nil
+	}
+	return op.Message
+}
+
+// resolve follows message $refs.
+func (c *asyncConverter) resolve(m *asyncMessage) *asyncMessage {
+	for i := 0; m != nil && m.Ref != "" && i < 16; i++ {
+		m = c.messages[m.Ref]
+	}
+	return m
+}
+
+// payloadType registers the payload of a message as a component schema and
+// returns its name ("" when the message has no payload).
+func (c *asyncConverter) payloadType(m *asyncMessage, fallback string) string {
+	m = c.resolve(m)
+	if m == nil {
+		return ""
+	}
+	if name, ok := c.payloads[m]; ok {
+		return name
+	}
+	name := ""
+	switch {
+	case len(m.OneOf) > 0:
+		union := &Schema{}
+		for i, alt := range m.OneOf {
+			if t := c.payloadType(alt, fmt.Sprintf("%s_%d", fallback, i+1)); t != "" {
+				union.OneOf = append(union.OneOf, &Schema{Ref: componentSchemasPrefix + escapePointer(t)})
+			}
+		}
+		name = c.register(fallback, union)
+	case m.Payload == nil:
+	case strings.HasPrefix(m.Payload.Ref, componentSchemasPrefix):
+		name, _ = componentRefName(m.Payload.Ref)
+	default:
+		name = c.register(firstNonEmpty(fallback, m.Name, m.Title), m.Payload)
+	}
+	c.payloads[m] = name
+	return name
+}
+
+// register adds an inline payload schema under a free component name.
+func (c *asyncConverter) register(base string, s *Schema) string {
+	name := normalizeMessage(base)
+	for c.doc.Components.Schemas[name] != nil {
+		name += "Payload"
+	}
+	c.doc.Components.Schemas[name] = s
+	return name
+}
+
+// addOperation records one channel operation as an rpc.
+func (c *asyncConverter) addOperation(channel, action string, op *asyncOperation, msgs []*asyncMessage, stream bool) {
+	if op == nil {
+		return
+	}
+	o := &Operation{OperationID: op.OperationID, Summary: op.Summary, Description: op.Description}
+	for _, t := range op.Tags {
+		o.Tags = append(o.Tags, t.Name)
+	}
+	name := rpcName(o, action, strings.ReplaceAll(channel, ".", "/"))
+	var types []string
+	for i, m := range msgs {
+		fallback := name + "Message"
+		if i > 0 {
+			fallback = fmt.Sprintf("%sMessage%d", name, i+1)
+		}
+		if r := c.resolve(m); r != nil {
+			fallback = firstNonEmpty(r.Name, r.Title, fallback)
+		}
+		if t := c.payloadType(m, fallback); t != "" {
+			types = append(types, t)
+		}
+	}
+	payload := ""
+	switch len(types) {
+	case 0:
+	case 1:
+		payload = types[0]
+	default:
+		union := &Schema{}
+		for _, t := range types {
+			union.OneOf = append(union.OneOf, &Schema{Ref: componentSchemasPrefix + escapePointer(t)})
+		}
+		payload = c.register(name+"Payload", union)
+	}
+	c.doc.channels = append(c.doc.channels, &channelOp{name: name, channel: channel, op: o, payload: payload, stream: stream})
+}
+
+// rewriteMessageRefs points refs to message payloads at the registered schemas.
+func rewriteMessageRefs(s *Schema, c *asyncConverter) {
+	seen := map[*Schema]bool{}
+	var walk func(*Schema)
+	walk = func(s *Schema) {
+		if s == nil || seen[s] {
+			return
+		}
+		seen[s] = true
+		if base, ok := strings.CutSuffix(s.Ref, "/payload"); ok {
+			if m := c.messages[base]; m != nil {
+				if t := c.payloadType(m, refKey(base)); t != "" {
+					s.Ref = componentSchemasPrefix + escapePointer(t)
+				}
+			}
+		}
+		for _, p := range s.Properties {
+			walk(p)
+		}
+		walk(s.Items)
+		walk(s.AddlProps)
+		for _, list := range [][]*Schema{s.AllOf, s.OneOf, s.AnyOf, s.PrefixItems} {
+			for _, c := range list {
+				walk(c)
+			}
+		}
+	}
+	walk(s)
+}
+
+// channelMethods adds the rpcs recorded from AsyncAPI channels.
+func (g *genContext) channelMethods(byService map[string][]*rpcMethod, usedNames map[string]bool) {
+	for _, ch := range g.doc.channels {
+		m := &rpcMethod{path: ch.channel, op: ch.op, name: ch.name, channel: ch}
+		for i, base := 2, m.name; usedNames[m.name]; i++ {
+			m.name = fmt.Sprintf("%s%d", base, i)
+		}
+		usedNames[m.name] = true
+		m.serviceID = g.serviceFor(ch.op, ch.channel)
+		byService[m.serviceID] = append(byService[m.serviceID], m)
+	}
+}
+
+// channelSignature returns request / response types of a channel rpc.
+func (g *genContext) channelSignature(ch *channelOp) (string, string) {
+	g.useImport("google/protobuf/empty.proto")
+	empty := "google.protobuf.Empty"
+	payload := empty
+	if ch.payload != "" {
+		payload = normalizeMessage(ch.payload)
+	}
+	if ch.stream {
+		return empty, "stream " + payload
+	}
+	return payload, empty
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// benchPhases are the measured phases, in execution order.
+var benchPhases = []string{"Parse", "Resolve", "Emit"}
+
+// phaseStats accumulates the cost of one phase over all iterations.
+type phaseStats struct {
+	elapsed time.Duration
+	bytes   uint64
+	allocs  uint64
+}
+
+// measure runs fn and adds its wall time and heap allocations to st.
+func (st *phaseStats) measure(fn func() error) error {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	err := fn()
+	st.elapsed += time.Since(start)
+	runtime.ReadMemStats(&after)
+	st.bytes += after.TotalAlloc - before.TotalAlloc
+	st.allocs += after.Mallocs - before.Mallocs
+	return err
+}
+
+// runBench 实现 `oapi2proto bench`: 对语料目录中的每个 openapi 文件重复执行解析 /
+// 引用解析与规范化 / 生成三个阶段, 以 go test -bench 格式输出每阶段的耗时与分配,
+// 可直接交给 benchstat 比较
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	corpus := fs.String("corpus", "", "spec 语料: 目录 (递归收集 *.json|*.yaml|*.yml) 或单个文件")
+	iterations := fs.Int("iterations", 10, "每个 spec 的重复次数")
+	pkg := fs.String("pkg", "api.v1", "同生成命令的 -pkg")
+	configPath := fs.String("config", "", "同生成命令的 -config")
+	fs.Parse(args)
+
+	if *corpus == "" {
+		fatal(errors.New("bench 需要 -corpus"))
+	}
+	if *iterations < 1 {
+		fatal(fmt.Errorf("-iterations 需为正数: %d", *iterations))
+	}
+	files := []string{*corpus}
+	if info, err := os.Stat(*corpus); err != nil {
+		fatal(err)
+	} else if info.IsDir() {
+		if files, err = specFiles(*corpus); err != nil {
+			fatal(err)
+		}
+		if len(files) == 0 {
+			fatal(errors.New("目录下未找到 openapi 文件 (*.json|*.yaml|*.yml)"))
+		}
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+	setAcronyms("", cfg)
+	setInflections(cfg)
+	opts := &genOptions{
+		pkg:         *pkg,
+		presence:    presenceNullable,
+		anyOfMode:   "oneof",
+		sortFields:  true,
+		config:      cfg,
+		mapMode:     mapProto,
+		enumMode:    enumProto,
+		inlineNames: inlineNamesPath,
+		inputFormat: inputOpenAPI,
+		format:      formatProto,
+		print:       printOptions{indent: "  ", blankLines: blankLinesKeep, commentStyle: commentStyleLine},
+	}
+	fmt.Printf("goos: %s\ngoarch: %s\npkg: oapi2proto/bench\n", runtime.GOOS, runtime.GOARCH)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fatal(err)
+		}
+		stats, err := benchSpec(opts, file, data, *iterations)
+		if err != nil {
+			fatal(fmt.Errorf("%s: %w", file, err))
+		}
+		name := benchName(*corpus, file)
+		for i, phase := range benchPhases {
+			st := stats[i]
+			n := uint64(*iterations)
+			fmt.Printf("Benchmark%s/%s-%d\t%8d\t%12d ns/op\t%12d B/op\t%10d allocs/op\n",
+				phase, name, runtime.GOMAXPROCS(0), *iterations, st.elapsed.Nanoseconds()/int64(n), st.bytes/n, st.allocs/n)
+		}
+	}
+}
+
+// benchSpec runs the phases of one spec n times.
+func benchSpec(opts *genOptions, file string, data []byte, n int) ([]phaseStats, error) {
+	stats := make([]phaseStats, len(benchPhases))
+	read := func(p string) ([]byte, error) {
+		if p == file {
+			return data, nil
+		}
+		return os.ReadFile(p)
+	}
+	for i := 0; i < n; i++ {
+		var doc Document
+		err := stats[0].measure(func() (err error) {
+			doc, err = decodeDocument(data)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = stats[1].measure(func() error {
+			bundleExternalRefs(&doc, file, read)
+			prepareDocument(&doc)
+			return opts.finishDocument(&doc, file)
+		})
+		if err != nil {
+			return nil, err
+		}
+		doc.source = file
+		err = stats[2].measure(func() error {
+			if _, ctx := renderFile(&doc, opts, opts.pkg, "", ""); len(ctx.errors) > 0 {
+				return errors.New(ctx.errors[0])
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// benchName is the sub-benchmark name of a corpus file: its path below the
+// corpus directory, without spaces (benchstat splits names on them).
+func benchName(corpus, file string) string {
+	rel, err := filepath.Rel(corpus, file)
+	if err != nil || rel == "." {
+		rel = filepath.Base(file)
+	}
+	return strings.ReplaceAll(filepath.ToSlash(rel), " ", "_")
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Breaking-change handling modes for -breaking.
+const (
+	breakingOff  = "off"
+	breakingWarn = "warn"
+	breakingFail = "fail"
+	breakingBump = "bump"
+)
+
+// detectBreaking compares a previous generation with the new one and returns
+// wire/API incompatibilities: removed types, fields, enum values or rpcs, and
+// changed field types, labels, enum numbers or rpc signatures. Removals that
+// the new file marks as reserved are not reported.
+func detectBreaking(prev, next *protoAST) []string {
+	var issues []string
+	nextMsgs := indexMessages(next.messages, "")
+	prevMsgs := indexMessages(prev.messages, "")
+	for _, name := range sortedKeys(prevMsgs) {
+		pm := prevMsgs[name]
+		nm, ok := nextMsgs[name]
+		if !ok {
+			issues = append(issues, fmt.Sprintf("message %s removed", name))
+			continue
+		}
+		nf := map[int]*protoField{}
+		for _, f := range nm.fields {
+			nf[f.number] = f
+		}
+		for _, f := range pm.fields {
+			n, ok := nf[f.number]
+			switch {
+			case !ok && !isReservedNumber(nm.reserved, f.number):
+				issues = append(issues, fmt.Sprintf("field %s.%s (= %d) removed", name, f.name, f.number))
+			case !ok:
+			case n.typ != f.typ:
+				issues = append(issues, fmt.Sprintf("field %s.%s (= %d) type changed: %s -> %s", name, f.name, f.number, f.typ, n.typ))
+			case (n.label == "repeated") != (f.label == "repeated"):
+				issues = append(issues, fmt.Sprintf("field %s.%s (= %d) label changed: %q -> %q", name, f.name, f.number, f.label, n.label))
+			case n.oneof != f.oneof:
+				issues = append(issues, fmt.Sprintf("field %s.%s (= %d) moved between oneofs", name, f.name, f.number))
+			case n.name != f.name:
+				issues = append(issues, fmt.Sprintf("field %s.%s (= %d) renamed to %s (JSON incompatible)", name, f.name, f.number, n.name))
+			}
+		}
+	}
+	nextEnums := indexEnums(next.messages, next.enums, "")
+	prevEnums := indexEnums(prev.messages, prev.enums, "")
+	for _, name := range sortedKeys(prevEnums) {
+		ne, ok := nextEnums[name]
+		if !ok {
+			issues = append(issues, fmt.Sprintf("enum %s removed", name))
+			continue
+		}
+		nv := map[string]int{}
+		for _, v := range ne.values {
+			nv[v.name] = v.number
+		}
+		for _, v := range prevEnums[name].values {
+			n, ok := nv[v.name]
+			switch {
+			case !ok && !isReservedNumber(ne.reserved, v.number):
+				issues = append(issues, fmt.Sprintf("enum value %s.%s (= %d) removed", name, v.name, v.number))
+			case ok && n != v.number:
+				issues = append(issues, fmt.Sprintf("enum value %s.%s number changed: %d -> %d", name, v.name, v.number, n))
+			}
+		}
+	}
+	nextSvcs := map[string]*protoService{}
+	for _, s := range next.services {
+		nextSvcs[s.name] = s
+	}
+	for _, ps := range prev.services {
+		ns, ok := nextSvcs[ps.name]
+		if !ok {
+			issues = append(issues, fmt.Sprintf("service %s removed", ps.name))
+			continue
+		}
+		nm := map[string]*protoMethod{}
+		for _, m := range ns.methods {
+			nm[m.name] = m
+		}
+		for _, m := range ps.methods {
+			n, ok := nm[m.name]
+			if !ok {
+				issues = append(issues, fmt.Sprintf("rpc %s.%s removed", ps.name, m.name))
+				continue
+			}
+			if n.input != m.input || n.output != m.output || n.clientStream != m.clientStream || n.serverStream != m.serverStream {
+				issues = append(issues, fmt.Sprintf("rpc %s.%s signature changed: (%s) -> (%s) became (%s) -> (%s)", ps.name, m.name, m.input, m.output, n.input, n.output))
+			}
+		}
+	}
+	return issues
+}
+
+func indexMessages(msgs []*protoMessage, prefix string) map[string]*protoMessage {
+	out := map[string]*protoMessage{}
+	for _, m := range msgs {
+		full := prefix + m.name
+		out[full] = m
+		for k, v := range indexMessages(m.messages, full+".") {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func indexEnums(msgs []*protoMessage, enums []*protoEnum, prefix string) map[string]*protoEnum {
+	out := map[string]*protoEnum{}
+	for _, e := range enums {
+		out[prefix+e.name] = e
+	}
+	for _, m := range msgs {
+		for k, v := range indexEnums(m.messages, m.enums, prefix+m.name+".") {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func isReservedNumber(ranges []protoRange, n int) bool {
+	for _, r := range ranges {
+		if n >= r.start && n <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var pkgVersionRe = regexp.MustCompile(`^v(\d+)`)
+
+// bumpPackage increments the trailing version segment: api.v1 -> api.v2,
+// api.v1beta1 -> api.v2. Packages without one gain ".v2". It returns the new
+// package plus the old and new version segments.
+func bumpPackage(pkg string) (string, string, string) {
+	segs := strings.Split(pkg, ".")
+	last := segs[len(segs)-1]
+	if m := pkgVersionRe.FindStringSubmatch(last); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		segs[len(segs)-1] = fmt.Sprintf("v%d", n+1)
+		return strings.Join(segs, "."), last, segs[len(segs)-1]
+	}
+	return pkg + ".v2", "", "v2"
+}
+
+// bumpPath places the bumped output side by side with the original: a path
+// segment equal to the old version is replaced, otherwise a <new>/ directory
+// is inserted next to the file.
+func bumpPath(outFile, oldVer, newVer string) string {
+	dir, base := filepath.Split(outFile)
+	if oldVer != "" {
+		segs := strings.Split(filepath.ToSlash(filepath.Clean(dir)), "/")
+		for i := len(segs) - 1; i >= 0; i-- {
+			if segs[i] == oldVer {
+				segs[i] = newVer
+				return filepath.Join(filepath.FromSlash(strings.Join(segs, "/")), base)
+			}
+		}
+	}
+	return filepath.Join(dir, newVer, base)
+}
+
+// bumpGoPackage rewrites version path segments and the alias of a go_package value.
+func bumpGoPackage(goPkg, oldVer, newVer string) string {
+	if oldVer == "" {
+		return goPkg
+	}
+	path, alias, hasAlias := strings.Cut(goPkg, ";")
+	segs := strings.Split(path, "/")
+	for i, s := range segs {
+		if s == oldVer {
+			segs[i] = newVer
+		}
+	}
+	path = strings.Join(segs, "/")
+	if hasAlias {
+		alias = strings.Replace(alias, oldVer, newVer, 1)
+		return path + ";" + alias
+	}
+	return path
+}
+
+// checkBreaking compares content against the existing outFile (if any) and
+// records every incompatibility as a "breaking" diagnostic. In bump mode it
+// regenerates under the bumped package and checks again the side-by-side
+// file already there, bumping further (v2 -> v3, ...) until the new
+// generation is compatible with what it replaces; it returns the final path
+// and content. Otherwise the inputs are returned unchanged.
+func (g *genContext) checkBreaking(outFile, content, pkg, goPkg string, render func(pkg, goPkg string) string) (string, string, error) {
+	if g.breaking == breakingOff {
+		return outFile, content, nil
+	}
+	for {
+		issues, err := breakingIssues(outFile, content)
+		if err != nil {
+			return "", "", err
+		}
+		if len(issues) == 0 {
+			return outFile, content, nil
+		}
+		severity := severityWarning
+		if g.breaking == breakingFail {
+			severity = severityError
+		}
+		for _, is := range issues {
+			g.diag(severity, "breaking", outFile, is)
+		}
+		switch g.breaking {
+		case breakingFail:
+			return "", "", fmt.Errorf("%s: 检测到 %d 处不兼容变更", outFile, len(issues))
+		case breakingBump:
+			newPkg, oldVer, newVer := bumpPackage(pkg)
+			newGoPkg := bumpGoPackage(goPkg, oldVer, newVer)
+			if g.goPkgTemplate != nil {
+				if newGoPkg, err = g.goPackageFor(newPkg, outFile); err != nil {
+					return "", "", err
+				}
+			}
+			bumped := bumpPath(outFile, oldVer, newVer)
+			g.diag(severityInfo, "breaking-bump", outFile, fmt.Sprintf("generated into %s (package %s)", bumped, newPkg))
+			outFile, pkg, goPkg = bumped, newPkg, newGoPkg
+			content = render(pkg, goPkg)
+			continue
+		}
+		return outFile, content, nil
+	}
+}
+
+// breakingIssues lists the incompatibilities of content with the existing
+// outFile; none when there is no such file.
+func breakingIssues(outFile, content string) ([]string, error) {
+	prevSrc, err := os.ReadFile(outFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prev, err := parseProto(string(prevSrc))
+	if err != nil {
+		return nil, fmt.Errorf("解析已有输出 %s 失败: %w", outFile, err)
+	}
+	next, err := parseProto(content)
+	if err != nil {
+		return nil, fmt.Errorf("解析生成结果失败: %w", err)
+	}
+	return detectBreaking(prev, next), nil
+}
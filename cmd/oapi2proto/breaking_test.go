@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// petSpec is a one-message spec whose field x has the given type.
+func petSpec(typ string) string {
+	return `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        x: {type: ` + typ + `}
+`
+}
+
+func TestBreakingBump(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		mode     string
+		existing map[string]string // path below api/ -> type of x in that file
+		typ      string
+		written  string // path below api/ whose x must have the new type
+		wantErr  bool
+		issues   int
+	}{
+		{"no previous output", breakingBump, nil, "integer", "v1/pet.proto", false, 0},
+		{"compatible", breakingBump, map[string]string{"v1/pet.proto": "integer"}, "integer", "v1/pet.proto", false, 0},
+		{"warn writes in place", breakingWarn, map[string]string{"v1/pet.proto": "string"}, "integer", "v1/pet.proto", false, 1},
+		{"fail", breakingFail, map[string]string{"v1/pet.proto": "string"}, "integer", "", true, 1},
+		{"bump to v2", breakingBump, map[string]string{"v1/pet.proto": "string"}, "integer", "v2/pet.proto", false, 1},
+		{"v2 compatible", breakingBump, map[string]string{"v1/pet.proto": "string", "v2/pet.proto": "integer"}, "integer", "v2/pet.proto", false, 1},
+		{"v2 breaks too", breakingBump, map[string]string{"v1/pet.proto": "string", "v2/pet.proto": "integer"}, "boolean", "v3/pet.proto", false, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := testOptions(t)
+			opts.breaking = tc.mode
+			opts.diags = &diagnostics{}
+			for p, typ := range tc.existing {
+				pkg := "api." + filepath.Dir(p)
+				opts.pkg = pkg
+				content := renderSpec(t, opts, "pet.yaml", petSpec(typ))
+				path := filepath.Join(dir, "api", filepath.FromSlash(p))
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			opts.pkg = "api.v1"
+			doc := loadSpec(t, opts, "pet.yaml", petSpec(tc.typ))
+			err := writeProtoFile(doc, opts, "api.v1", filepath.Join(dir, "api", "v1", "pet.proto"), "")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("writeProtoFile: %v, want error %v", err, tc.wantErr)
+			}
+			issues := 0
+			for _, e := range opts.diags.sorted() {
+				if e.Kind == "breaking" {
+					issues++
+				}
+			}
+			if issues != tc.issues {
+				t.Errorf("%d breaking diagnostics, want %d: %+v", issues, tc.issues, opts.diags.sorted())
+			}
+			if tc.written == "" {
+				return
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "api", filepath.FromSlash(tc.written)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{"integer": "int64 x = 1;", "boolean": "bool x = 1;"}[tc.typ]
+			if !strings.Contains(string(data), want) || !strings.Contains(string(data), "package api."+filepath.Dir(tc.written)+";") {
+				t.Errorf("%s:\n%s", tc.written, data)
+			}
+		})
+	}
+}
+
+func TestBumpPackage(t *testing.T) {
+	for _, tc := range []struct{ pkg, want, oldVer, newVer string }{
+		{"api.v1", "api.v2", "v1", "v2"},
+		{"api.v1beta1", "api.v2", "v1beta1", "v2"},
+		{"api", "api.v2", "", "v2"},
+		{"pet.store.v9", "pet.store.v10", "v9", "v10"},
+	} {
+		got, oldVer, newVer := bumpPackage(tc.pkg)
+		if got != tc.want || oldVer != tc.oldVer || newVer != tc.newVer {
+			t.Errorf("bumpPackage(%s) = %s, %s, %s; want %s, %s, %s", tc.pkg, got, oldVer, newVer, tc.want, tc.oldVer, tc.newVer)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// cacheVersion changes whenever the cache layout or the generator output
+// changes in a way old fingerprints cannot see.
+const cacheVersion = 2
+
+// errUpToDate reports that an output was skipped because its inputs are
+// unchanged since the cached generation.
+var errUpToDate = errors.New("up to date")
+
+// genCache is the -cache file: fingerprints of the resolved inputs of every
+// generated file, so unchanged files are not regenerated.
+type genCache struct {
+	path string
+	mu   sync.Mutex
+
+	Version int `json:"version"`
+	// Options fingerprints the generation flags and the config file; a
+	// different value invalidates every entry.
+	Options string                 `json:"options"`
+	Files   map[string]*cacheEntry `json:"files"` // by input file
+
+	// written collects the files written for each input being generated
+	written map[string]map[string]bool
+	// customOptions lists the inputs whose files import options.proto
+	customOptions map[string]bool
+}
+
+type cacheEntry struct {
+	Fingerprint string            `json:"fingerprint"`
+	Schemas     map[string]string `json:"schemas"` // component schema -> fingerprint
+	// Outputs holds every file written for the input (sub-package protos,
+	// sidecars) with the hash of its content
+	Outputs map[string]string `json:"outputs"`
+	// CustomOptions is set when the outputs import oapi2proto/options.proto,
+	// which is written once per run
+	CustomOptions bool `json:"custom_options,omitempty"`
+}
+
+// loadGenCache 读取 -cache 文件 (不存在时为空); 选项或版本不同则丢弃旧条目
+func loadGenCache(path, options string) (*genCache, error) {
+	c := &genCache{path: path, Version: cacheVersion, Options: options, Files: map[string]*cacheEntry{},
+		written: map[string]map[string]bool{}, customOptions: map[string]bool{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var old genCache
+	if err := json.Unmarshal(data, &old); err != nil {
+		return nil, fmt.Errorf("cache %s: %w", path, err)
+	}
+	if old.Version == cacheVersion && old.Options == options && old.Files != nil {
+		c.Files = old.Files
+	}
+	return c, nil
+}
+
+// optionsFingerprint hashes every flag except those that do not affect the
+// generated files, plus the config file content.
+func optionsFingerprint(configPath string) (string, error) {
+	h := sha256.New()
+	skip := map[string]bool{"cache": true, "parallel": true, "report": true, "manifest": true}
+	flag.VisitAll(func(f *flag.Flag) {
+		if !skip[f.Name] {
+			fmt.Fprintf(h, "%s=%s\n", f.Name, f.Value.String())
+		}
+	})
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return "", err
+		}
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// fingerprint hashes the resolved document: every component schema on its
+// own, then the whole document (operations, info, ...). Without -sort the
+// property order matters too, which their JSON form does not show, so the
+// raw input is added.
+func (c *genCache) fingerprint(doc *Document, inFile string, sorted bool, read func(string) ([]byte, error)) (string, map[string]string, error) {
+	schemas := map[string]string{}
+	for name, s := range doc.Components.Schemas {
+		schemas[name] = hashString(literal(s))
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", c.Options)
+	for _, name := range sortedKeys(schemas) {
+		fmt.Fprintf(h, "%s %s\n", name, schemas[name])
+	}
+	h.Write([]byte(literal(doc)))
+	for _, ch := range doc.channels {
+		fmt.Fprintf(h, "\n%s %s %s %t %s", ch.name, ch.channel, ch.payload, ch.stream, literal(ch.op))
+	}
+	if !sorted {
+		for _, f := range sortedKeys(doc.files) {
+			data, err := read(doc.files[f])
+			if err != nil {
+				return "", nil, err
+			}
+			h.Write(data)
+		}
+		if len(doc.files) == 0 {
+			data, err := read(inFile)
+			if err != nil {
+				return "", nil, err
+			}
+			h.Write(data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), schemas, nil
+}
+
+// upToDate reports whether the outputs of inFile (outFile among them) were
+// generated from the same fingerprint and none of them was modified or
+// removed since.
+func (c *genCache) upToDate(inFile, outFile, fp string) bool {
+	c.mu.Lock()
+	e := c.Files[inFile]
+	c.mu.Unlock()
+	if e == nil || e.Fingerprint != fp {
+		return false
+	}
+	if _, ok := e.Outputs[outFile]; !ok {
+		return false
+	}
+	for _, path := range sortedKeys(e.Outputs) {
+		data, err := os.ReadFile(path)
+		if err != nil || hashString(string(data)) != e.Outputs[path] {
+			return false
+		}
+	}
+	return true
+}
+
+// changedSchemas lists the schemas that differ from the cached generation.
+func (c *genCache) changedSchemas(inFile string, schemas map[string]string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.Files[inFile]
+	if e == nil {
+		return nil
+	}
+	var changed []string
+	for name, fp := range schemas {
+		if e.Schemas[name] != fp {
+			changed = append(changed, name)
+		}
+	}
+	for name := range e.Schemas {
+		if _, ok := schemas[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// wrote notes files written while generating inFile; usesOptions is set
+// when they import the shared options.proto.
+func (c *genCache) wrote(inFile string, usesOptions bool, paths ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.written[inFile] == nil {
+		c.written[inFile] = map[string]bool{}
+	}
+	for _, p := range paths {
+		c.written[inFile][p] = true
+	}
+	if usesOptions {
+		c.customOptions[inFile] = true
+	}
+}
+
+// record stores the fingerprints of inFile and the hashes of every file
+// written for it.
+func (c *genCache) record(inFile, fp string, schemas map[string]string) error {
+	c.mu.Lock()
+	written, usesOptions := c.written[inFile], c.customOptions[inFile]
+	delete(c.written, inFile)
+	delete(c.customOptions, inFile)
+	c.mu.Unlock()
+	outputs := map[string]string{}
+	for path := range written {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		outputs[path] = hashString(string(data))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Files[inFile] = &cacheEntry{Fingerprint: fp, Schemas: schemas, Outputs: outputs, CustomOptions: usesOptions}
+	return nil
+}
+
+// save 写回 -cache 文件
+func (c *genCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(c.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(c.path, append(data, '\n'))
+}
+
+// cachedGenerate regenerates the outputs of inFile only when the fingerprint
+// of the resolved document changed or one of the files written for it last
+// time was modified or removed.
+func (o *genOptions) cachedGenerate(doc *Document, inFile, outFile string, generate func() error) error {
+	fp, schemas, err := o.cache.fingerprint(doc, inFile, o.sortFields, o.readSpec)
+	if err != nil {
+		return err
+	}
+	if o.cache.upToDate(inFile, outFile, fp) {
+		o.cache.mu.Lock()
+		usesOptions := o.cache.Files[inFile].CustomOptions
+		o.cache.mu.Unlock()
+		if usesOptions {
+			// options.proto is written at the end of the run, for every file
+			// importing it, skipped or not
+			o.customOptions.Store(true)
+		}
+		return errUpToDate
+	}
+	if changed := o.cache.changedSchemas(inFile, schemas); len(changed) > 0 {
+		fmt.Fprintf(os.Stderr, "[INFO] %s: 变更的 schema: %s\n", inFile, strings.Join(changed, ", "))
+	}
+	if err := generate(); err != nil {
+		return err
+	}
+	return o.cache.record(inFile, fp, schemas)
+}
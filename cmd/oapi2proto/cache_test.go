@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const cacheSpec = `
+openapi: 3.0.0
+info: {title: Pets, version: "1"}
+paths: {}
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        thing: {$ref: "#/components/schemas/Thing"}
+        n: {type: integer, default: 3}
+    Thing:
+      x-proto-package: shared.v1
+      type: object
+      properties:
+        id: {type: string}
+`
+
+func TestCacheCompanionOutputs(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(dir string) error
+		fresh  bool
+	}{
+		{"unchanged", func(string) error { return nil }, true},
+		{"main output removed", func(dir string) error { return os.Remove(filepath.Join(dir, "out", "pets.proto")) }, false},
+		{"sub-package output removed", func(dir string) error { return os.Remove(filepath.Join(dir, "out", "shared", "v1", "pets.proto")) }, false},
+		{"options.proto removed", func(dir string) error { return os.Remove(filepath.Join(dir, "out", "oapi2proto", "options.proto")) }, true},
+		{"source map removed", func(dir string) error { return os.Remove(filepath.Join(dir, "out", "pets.map.json")) }, false},
+		{"sub-package source map edited", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "out", "shared", "v1", "pets.map.json"), []byte(`{"generated": "`+generatedMarker+`"}`+"\n"), 0o644)
+		}, false},
+		{"spec changed", func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "pets.yaml"), []byte(cacheSpec+"    Extra: {type: object, properties: {x: {type: string}}}\n"), 0o644)
+		}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			in, out := filepath.Join(dir, "pets.yaml"), filepath.Join(dir, "out", "pets.proto")
+			if err := os.WriteFile(in, []byte(cacheSpec), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			generate := func() error {
+				opts := testOptions(t)
+				opts.sourceMap = true
+				opts.defaults = defaultsOption
+				opts.setOutRoot(filepath.Join(dir, "out"))
+				cache, err := loadGenCache(filepath.Join(dir, "cache.json"), "test")
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts.cache = cache
+				err = generateForFile(in, out, opts)
+				if werr := opts.writeCustomOptions(); werr != nil {
+					t.Fatal(werr)
+				}
+				if serr := cache.save(); serr != nil {
+					t.Fatal(serr)
+				}
+				return err
+			}
+			if err := generate(); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.change(dir); err != nil {
+				t.Fatal(err)
+			}
+			err := generate()
+			if skipped := errors.Is(err, errUpToDate); skipped != tc.fresh || (err != nil && !skipped) {
+				t.Fatalf("second run: %v, want skipped=%v", err, tc.fresh)
+			}
+			for _, p := range []string{"pets.proto", "pets.map.json", "shared/v1/pets.proto", "shared/v1/pets.map.json", "oapi2proto/options.proto"} {
+				if _, err := os.Stat(filepath.Join(dir, "out", filepath.FromSlash(p))); err != nil {
+					t.Errorf("%s missing after the second run: %v", p, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Policies for type names differing only in case (-case-conflict), which
+// break case-insensitive filesystems and some code generators.
+const (
+	caseConflictWarn   = "warn"
+	caseConflictRename = "rename"
+	caseConflictError  = "error"
+)
+
+// renameCaseConflicts renames component schemas whose message names differ
+// only in case: in key order the first keeps its name, the others get a
+// numeric suffix. Inline types are not renamed; checkCaseConflicts still
+// reports them.
+func (g *genContext) renameCaseConflicts() error {
+	groups := map[string][]string{}
+	for _, key := range sortedKeys(g.doc.Components.Schemas) {
+		folded := strings.ToLower(normalizeMessage(key))
+		groups[folded] = append(groups[folded], key)
+	}
+	renames := map[string]string{}
+	for _, folded := range sortedKeys(groups) {
+		keys := groups[folded]
+		for _, key := range keys[1:] {
+			to := key
+			for n := 2; groups[strings.ToLower(normalizeMessage(to))] != nil; n++ {
+				to = key + strconv.Itoa(n)
+			}
+			groups[strings.ToLower(normalizeMessage(to))] = []string{to}
+			renames[key] = to
+			g.diag(severityWarning, "case-conflict", normalizeMessage(key), fmt.Sprintf("differs only in case from %s; renamed to %s", normalizeMessage(keys[0]), normalizeMessage(to)))
+		}
+	}
+	return renameComponentSchemas(g.doc, renames, "-case-conflict")
+}
+
+// recordTypeNames collects the top-level message and enum names of a
+// rendered chunk for checkCaseConflicts. The emitter starts top-level
+// declarations at column 0, so a line scan is enough.
+func (g *genContext) recordTypeNames(chunk string) {
+	for rest := chunk; rest != ""; {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		decl, ok := strings.CutPrefix(line, "message ")
+		if !ok {
+			if decl, ok = strings.CutPrefix(line, "enum "); !ok {
+				continue
+			}
+		}
+		if name, _, _ := strings.Cut(decl, " "); name != "" {
+			g.typeNames = append(g.typeNames, name)
+		}
+	}
+}
+
+// checkCaseConflicts reports generated message / enum names that differ only
+// in case, as a warning or (-case-conflict=error) a failure.
+func (g *genContext) checkCaseConflicts() {
+	byFolded := map[string][]string{}
+	for _, name := range g.typeNames {
+		byFolded[strings.ToLower(name)] = append(byFolded[strings.ToLower(name)], name)
+	}
+	for _, folded := range sortedKeys(byFolded) {
+		names := byFolded[folded]
+		if len(names) < 2 {
+			continue
+		}
+		sort.Strings(names)
+		msg := "type names differ only in case: " + strings.Join(names, ", ")
+		if g.caseConflict == caseConflictError {
+			g.fail("case-conflict", names[0], msg)
+			continue
+		}
+		g.diag(severityWarning, "case-conflict", names[0], msg)
+	}
+}
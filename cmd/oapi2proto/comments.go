@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// commentDirectives are comment prefixes that tools act upon (buf and
+// protolint rule suppressions, Go directives copied into generated code).
+var commentDirectives = []string{"buf:", "protolint:", "go:", "+build", "nolint", "lint:"}
+
+// sanitizeComment makes spec text safe on one line of a // comment, in the
+// proto and in the code protoc copies comments into:
+//   - line breaks, tabs and other control characters become spaces, so text
+//     cannot end the comment and add declarations;
+//   - bidi overrides and other invisible format characters are dropped, so a
+//     comment cannot display differently from what it contains;
+//   - `*/` and `/*` are broken up (block comment style, /** */ docs);
+//   - leading slashes are removed and a line starting with a tool directive
+//     (buf:lint:ignore, protolint:disable, go:generate, ...) is quoted;
+//   - a trailing backslash, which continues a C++ line comment onto the next
+//     generated line, is followed by a period.
+//
+// Leading indentation is kept. The result is stable under repeated calls.
+func sanitizeComment(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case r == '\u2028' || r == '\u2029' || unicode.IsControl(r):
+			b.WriteByte(' ')
+		case unicode.Is(unicode.Cf, r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+	s = b.String()
+	if !strings.Contains(s, "*/") && !strings.Contains(s, "/*") && !strings.HasSuffix(strings.TrimRight(s, " "), `\`) {
+		if t := strings.TrimLeft(s, " "); !strings.HasPrefix(t, "/") && !hasDirective(t) {
+			return s
+		}
+	}
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "*/", "* /"), "/*", "/ *")
+	indent := s[:len(s)-len(strings.TrimLeft(s, " "))]
+	text := strings.TrimLeft(strings.TrimLeft(s[len(indent):], "/"), " ")
+	if hasDirective(text) {
+		text = "`" + text + "`"
+	}
+	if strings.HasSuffix(strings.TrimRight(text, " "), `\`) {
+		text = strings.TrimRight(text, " ") + "."
+	}
+	return indent + text
+}
+
+// hasDirective reports whether comment text starts with a tool directive.
+func hasDirective(text string) bool {
+	lower := strings.ToLower(text)
+	for _, d := range commentDirectives {
+		if strings.HasPrefix(lower, d) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// hostileTexts are spec strings trying to leave a generated // comment.
+var hostileTexts = []struct {
+	name, text string
+}{
+	{"block terminator", "end */ message Injected {}"},
+	{"block opener", "/* open"},
+	{"crlf", "first\r\nmessage Injected {}"},
+	{"bare cr", "first\rmessage Injected {}"},
+	{"line separator", "first\u2028message Injected {}"},
+	{"paragraph separator", "first\u2029message Injected {}"},
+	{"nul", "first\x00message Injected {}"},
+	{"leading slashes", "// a line that starts with slashes"},
+	{"directive", "buf:lint:ignore FIELD_LOWER_SNAKE_CASE"},
+	{"trailing backslash", `continued \`},
+	{"bidi override", "admin\u202e}{ resu"},
+}
+
+// checkCommentLines fails unless every line of out is a // comment (or
+// blank) that cannot end or continue the comment.
+func checkCommentLines(t *testing.T, out string) {
+	t.Helper()
+	for _, l := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		switch {
+		case l == "":
+		case !strings.HasPrefix(l, "//"):
+			t.Errorf("line outside the comment: %q", l)
+		case strings.ContainsAny(l, "\r\u2028\u2029\x00\u202e"):
+			t.Errorf("control character kept: %q", l)
+		case strings.Contains(l, "*/") || strings.Contains(l, "/*"):
+			t.Errorf("block comment marker kept: %q", l)
+		case strings.HasSuffix(l, `\`):
+			t.Errorf("trailing backslash kept: %q", l)
+		case l != "//" && strings.HasPrefix(strings.TrimPrefix(l, "// "), "/"):
+			t.Errorf("leading slash kept: %q", l)
+		}
+	}
+}
+
+func TestSanitizeComment(t *testing.T) {
+	for _, tc := range hostileTexts {
+		t.Run(tc.name, func(t *testing.T) {
+			got := sanitizeComment(tc.text)
+			checkCommentLines(t, "// "+got)
+			if again := sanitizeComment(got); again != got {
+				t.Errorf("not stable: %q -> %q", got, again)
+			}
+		})
+	}
+}
+
+func TestWriteDescription(t *testing.T) {
+	for _, tc := range hostileTexts {
+		t.Run(tc.name, func(t *testing.T) {
+			var b strings.Builder
+			writeDescription(&b, "intro\n\n"+tc.text+"\ntail")
+			checkCommentLines(t, b.String())
+		})
+	}
+}
+
+func TestInfoComment(t *testing.T) {
+	for _, tc := range hostileTexts {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := &Document{Servers: []*Server{{URL: tc.text, Description: tc.text}}}
+			doc.Info.Title = tc.text
+			doc.Info.Version = tc.text
+			doc.Info.Description = tc.text
+			doc.Info.Contact.Name = tc.text
+			doc.Info.Contact.Email = tc.text
+			checkCommentLines(t, infoComment(doc, tc.text))
+		})
+	}
+}
+
+func TestSampleHostileGolden(t *testing.T) {
+	spec, err := os.ReadFile("../../sample_hostile.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("../../sample_hostile.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions(t)
+	opts.exampleComments = true
+	opts.defaults = defaultsComment
+	if got := renderSpec(t, opts, "sample_hostile.yaml", string(spec)); got != string(want) {
+		t.Errorf("sample_hostile.proto is out of date; regenerate it with -example-comments -defaults comment\ngot:\n%s", got)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	pathpkg "path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config 是 -config 指定的 json/yaml 配置文件
+type Config struct {
+	// ServiceMap 显式指定 operation 所属 service, key 形式:
+	//   op:<operationId> | tag:<tag> | <path 前缀, 以 / 开头>
+	ServiceMap map[string]string `json:"service_map" yaml:"service_map"`
+	// SchemaNames 将 OpenAPI schema 名映射为期望的 proto message 名 (在命名规范化之前生效)
+	SchemaNames map[string]string `json:"schema_names" yaml:"schema_names"`
+	// FieldNames 覆盖生成的字段名, key 为 <Schema>.<property> (schema 名或生成的 message 名),
+	// json_name 保持原属性名
+	FieldNames map[string]string `json:"field_names" yaml:"field_names"`
+	// Acronyms 是转 snake_case 时整体保留的缩写词 (如 OAuth, IDs)
+	Acronyms []string `json:"acronyms" yaml:"acronyms"`
+	// Inflections 是 -plural-fields 的单数 -> 复数例外 (如 person: people); 两者相同表示不可数
+	Inflections map[string]string `json:"inflections" yaml:"inflections"`
+	// MessageOptions 为匹配的 message 追加 option, match 为 schema 名或生成的
+	// message 名 (支持 * ? [...] 通配)
+	MessageOptions []OptionRule `json:"message_options" yaml:"message_options"`
+	// FieldOptions 为匹配的字段追加 option, match 形如 <Schema>.<property> (同上, 支持通配)
+	FieldOptions []OptionRule `json:"field_options" yaml:"field_options"`
+	// TypeMap 将 schema 名映射为已有的 proto 类型 (well-known 或自有类型), 这些 schema
+	// 不再生成, 引用处改用映射类型并 import 其文件
+	TypeMap map[string]TypeMapping `json:"type_map" yaml:"type_map"`
+	// ServiceOptions 为生成的 service (按名称) 设置 default_host / oauth_scopes,
+	// 覆盖文档级 x-default-host / x-oauth-scopes
+	ServiceOptions map[string]ServiceClientOptions `json:"service_options" yaml:"service_options"`
+	// MethodSignatures 按 operationId 指定 (google.api.method_signature), 覆盖 x-method-signature
+	MethodSignatures map[string][]string `json:"method_signatures" yaml:"method_signatures"`
+}
+
+// ServiceClientOptions 是 google/api/client.proto 的 service option
+type ServiceClientOptions struct {
+	DefaultHost string   `json:"default_host" yaml:"default_host"`
+	OAuthScopes []string `json:"oauth_scopes" yaml:"oauth_scopes"`
+}
+
+// TypeMapping 是 type_map 的一项: 全限定 proto 类型及其 import; 可简写为类型字符串
+// (仅限 google.protobuf 下的 well-known 类型, import 自动推导)
+type TypeMapping struct {
+	Type   string `json:"type" yaml:"type"`
+	Import string `json:"import" yaml:"import"`
+	// enum marks an enum generated into another file of the same run
+	// (x-proto-package), for the descriptor output
+	enum bool
+}
+
+// UnmarshalYAML accepts the shorthand `Name: google.protobuf.Timestamp`.
+func (m *TypeMapping) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&m.Type)
+	}
+	type plain TypeMapping
+	return node.Decode((*plain)(m))
+}
+
+// OptionRule 将 options (name = value) 附加到名称匹配 match 的 message / 字段
+type OptionRule struct {
+	Match   string   `json:"match" yaml:"match"`
+	Options []string `json:"options" yaml:"options"`
+}
+
+// loadConfig 读取配置文件 (yaml 解析器同时兼容 json)
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	for _, rules := range []struct {
+		key   string
+		rules []OptionRule
+	}{{"message_options", cfg.MessageOptions}, {"field_options", cfg.FieldOptions}} {
+		for i := range rules.rules {
+			if err := rules.rules[i].normalize(); err != nil {
+				return nil, fmt.Errorf("config %s: %s[%d]: %w", path, rules.key, i, err)
+			}
+		}
+	}
+	for _, name := range sortedKeys(cfg.TypeMap) {
+		m := cfg.TypeMap[name]
+		if err := m.normalize(); err != nil {
+			return nil, fmt.Errorf("config %s: type_map[%s]: %w", path, name, err)
+		}
+		cfg.TypeMap[name] = m
+	}
+	return cfg, nil
+}
+
+// qualifiedTypeRe matches a fully-qualified proto type name.
+var qualifiedTypeRe = regexp.MustCompile(`^[A-Za-z_]\w*(\.[A-Za-z_]\w*)+$`)
+
+// normalize validates the mapping and derives the import of well-known types.
+func (m *TypeMapping) normalize() error {
+	m.Type = strings.TrimPrefix(m.Type, ".")
+	if !qualifiedTypeRe.MatchString(m.Type) {
+		return fmt.Errorf("type %q 需要全限定 proto 类型 (如 google.type.Money)", m.Type)
+	}
+	if m.Import == "" {
+		m.Import = wellKnownFile(m.Type)
+	}
+	if m.Import == "" {
+		return fmt.Errorf("%s 需要指定 import", m.Type)
+	}
+	if _, err := parseExtraImports([]string{m.Import}); err != nil {
+		return fmt.Errorf("import %q 需要 .proto 文件路径", m.Import)
+	}
+	return nil
+}
+
+// typeMapping returns the type_map entry of a schema name.
+func (c *Config) typeMapping(name string) (TypeMapping, bool) {
+	if c == nil {
+		return TypeMapping{}, false
+	}
+	m, ok := c.TypeMap[name]
+	return m, ok
+}
+
+// mappedType returns the type_map entry of a component schema, looked up by
+// its (renamed) name or its original name, or the mapping detected by
+// -google-types=apply.
+func (g *genContext) mappedType(name string) (TypeMapping, bool) {
+	if m, ok := g.config.typeMapping(name); ok {
+		return m, true
+	}
+	if orig, ok := g.doc.renamedFrom[name]; ok {
+		if m, ok := g.config.typeMapping(orig); ok {
+			return m, true
+		}
+	}
+	m, ok := g.doc.externalTypes[name]
+	return m, ok
+}
+
+// normalize validates the rule and rewrites its options as "name = value".
+func (r *OptionRule) normalize() error {
+	if _, err := pathpkg.Match(r.Match, ""); err != nil || r.Match == "" {
+		return fmt.Errorf("match %q 无效", r.Match)
+	}
+	for i, o := range r.Options {
+		name, value, err := splitOption(o)
+		if err == nil {
+			err = checkOptionValue(value, "")
+		}
+		if err != nil {
+			return fmt.Errorf("option %q: %w", o, err)
+		}
+		r.Options[i] = name + " = " + value
+	}
+	return nil
+}
+
+// matchOptions collects the options of all rules matching one of the keys,
+// in rule order.
+func matchOptions(rules []OptionRule, keys ...string) []string {
+	var out []string
+	for _, r := range rules {
+		for _, k := range keys {
+			if ok, _ := pathpkg.Match(r.Match, k); ok {
+				out = append(out, r.Options...)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// messageOptions returns the configured options of a message, matched by the
+// OpenAPI schema name or the generated message name.
+func (c *Config) messageOptions(schema, msgName string) []string {
+	if c == nil {
+		return nil
+	}
+	return matchOptions(c.MessageOptions, schema, msgName)
+}
+
+// fieldOptions returns the configured options of a field, matched like
+// field_names by <Schema>.<property> or <Message>.<property>.
+func (c *Config) fieldOptions(schema, msgName, prop string) []string {
+	if c == nil {
+		return nil
+	}
+	return matchOptions(c.FieldOptions, schema+"."+prop, msgName+"."+prop)
+}
+
+// renameSchemas 按 schema_names 重命名组件 schema, 并改写所有指向它们的 $ref
+func (c *Config) renameSchemas(doc *Document) error {
+	return renameComponentSchemas(doc, c.SchemaNames, "schema_names")
+}
+
+// stripSchemaSuffixes 去掉组件 schema 名末尾的 -strip-suffix 后缀 (不区分大小写, 如 PetDto -> Pet);
+// 去掉后为空、与其他 schema 冲突或已由 schema_names 显式命名的保持原名, 冲突时告警
+func stripSchemaSuffixes(doc *Document, suffixes []string) error {
+	if len(suffixes) == 0 {
+		return nil
+	}
+	taken := map[string]string{} // normalized message name -> schema
+	for name := range doc.Components.Schemas {
+		taken[normalizeMessage(name)] = name
+	}
+	renames := map[string]string{}
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		if _, explicit := doc.renamedFrom[name]; explicit {
+			continue
+		}
+		stripped := stripSuffix(name, suffixes)
+		if stripped == name {
+			continue
+		}
+		if other, ok := taken[normalizeMessage(stripped)]; ok {
+			doc.warn("strip-suffix", name, fmt.Sprintf("stripped name %s collides with schema %s; name kept", stripped, other))
+			continue
+		}
+		delete(taken, normalizeMessage(name))
+		taken[normalizeMessage(stripped)] = name
+		renames[name] = stripped
+	}
+	return renameComponentSchemas(doc, renames, "-strip-suffix")
+}
+
+// stripSuffix removes the first matching suffix (and separators left before
+// it); a name consisting only of the suffix is kept.
+func stripSuffix(name string, suffixes []string) string {
+	lower := strings.ToLower(name)
+	for _, suf := range suffixes {
+		if !strings.HasSuffix(lower, strings.ToLower(suf)) {
+			continue
+		}
+		if stripped := strings.TrimRight(name[:len(name)-len(suf)], "_-. "); stripped != "" {
+			return stripped
+		}
+	}
+	return name
+}
+
+// renameComponentSchemas 重命名组件 schema (from -> to), 并改写所有指向它们的 $ref
+func renameComponentSchemas(doc *Document, renames map[string]string, source string) error {
+	if len(renames) == 0 {
+		return nil
+	}
+	renamed := map[string]string{} // old ref prefix -> new ref prefix
+	for _, from := range sortedKeys(renames) {
+		to := renames[from]
+		s, ok := doc.Components.Schemas[from]
+		if !ok || to == from {
+			continue
+		}
+		if _, exists := doc.Components.Schemas[to]; exists {
+			return fmt.Errorf("%s: %q -> %q 与已有 schema 冲突", source, from, to)
+		}
+		delete(doc.Components.Schemas, from)
+		doc.Components.Schemas[to] = s
+		if doc.renamedFrom == nil {
+			doc.renamedFrom = map[string]string{}
+		}
+		orig := from
+		if o, ok := doc.renamedFrom[from]; ok {
+			orig = o
+			delete(doc.renamedFrom, from)
+		}
+		doc.renamedFrom[to] = orig
+		renamed[componentSchemasPrefix+escapePointer(from)] = componentSchemasPrefix + escapePointer(to)
+		for _, ch := range doc.channels {
+			if ch.payload == from {
+				ch.payload = to
+			}
+		}
+	}
+	walkSchemas(doc, func(s *Schema) {
+		for old, repl := range renamed {
+			if s.Ref == old || strings.HasPrefix(s.Ref, old+"/") {
+				s.Ref = repl + strings.TrimPrefix(s.Ref, old)
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// fieldName returns the configured field name of a property, looked up by the
+// OpenAPI schema name first, then the generated message name.
+func (c *Config) fieldName(schema, msgName, prop string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	for _, key := range []string{schema + "." + prop, msgName + "." + prop} {
+		if name, ok := c.FieldNames[key]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Custom options used by the generated files live in one shared file written
+// next to the outputs, so files of the same package never redeclare them.
+const (
+	customOptionsImport = "oapi2proto/options.proto"
+	customOptionsPkg    = "oapi2proto"
+)
+
+// customOptionsProto defines every extension the generator may reference.
+// Numbers are in the 50000-99999 range reserved for in-house options. The
+// go_package (%s) comes from customOptionsGoPackage.
+const customOptionsProto = `// Generated by oapi2proto: custom options referenced by generated files.
+syntax = "proto3";
+package oapi2proto;
+
+import "google/protobuf/descriptor.proto";
+
+option go_package = "%s";
+
+// Origin records the OpenAPI schema a message was generated from.
+message Origin {
+  // schema is the component name in the spec (before renames); empty for
+  // synthesized messages.
+  string schema = 1;
+  // source is the spec file and JSON pointer, e.g. openapi.yaml#/components/schemas/Pet.
+  string source = 2;
+  // spec_version is info.version of the spec.
+  string spec_version = 3;
+}
+
+extend google.protobuf.FieldOptions {
+  // default_json is the OpenAPI default value of the field, as JSON.
+  string default_json = 52001;
+}
+
+extend google.protobuf.MessageOptions {
+  // origin traces the message back to the spec.
+  Origin origin = 52002;
+}
+`
+
+// useCustomOption makes the current file import the shared options file and
+// returns the fully-qualified option name for use in [...] lists.
+func (g *genContext) useCustomOption(name string) string {
+	g.useImport(customOptionsImport)
+	g.customOptions.Store(true)
+	return "(" + customOptionsPkg + "." + name + ")"
+}
+
+// setOutRoot 设置输出根目录 (buf-module 布局下为模块根目录)
+func (o *genOptions) setOutRoot(dir string) {
+	o.outRoot = dir
+	if o.module != nil {
+		o.outRoot = o.module.root
+	}
+}
+
+// writeCustomOptions 在输出根目录写出 oapi2proto/options.proto (仅当有文件引用时)
+func (o *genOptions) writeCustomOptions() error {
+	if !o.customOptions.Load() {
+		return nil
+	}
+	path := filepath.Join(o.outRoot, filepath.FromSlash(customOptionsImport))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	goPkg, err := o.customOptionsGoPackage(path)
+	if err != nil {
+		return err
+	}
+	return o.writeGenerated(path, []byte(fmt.Sprintf(customOptionsProto, goPkg)))
+}
+
+// customOptionsGoPackage derives the go_package of the options file like
+// that of any other generated package: from -go-pkg-template when set,
+// otherwise as a sibling of the -go_pkg import path
+// (example.com/project/api/v1 -> example.com/project/oapi2proto).
+func (o *genOptions) customOptionsGoPackage(path string) (string, error) {
+	if o.goPkgTemplate != nil {
+		return o.goPackageFor(customOptionsPkg, path)
+	}
+	return subGoPackage(o.goPkg, o.pkg, customOptionsPkg), nil
+}
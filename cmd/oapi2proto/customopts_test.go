@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"text/template"
+)
+
+func TestCustomOptionsGoPackage(t *testing.T) {
+	for _, tc := range []struct {
+		name, pkg, goPkg, tmpl, want string
+	}{
+		{"sibling of go_pkg", "api.v1", "example.com/project/api/v1;v1", "", "example.com/project/oapi2proto;oapi2proto"},
+		{"unrelated go_pkg", "api.v1", "example.com/gen;gen", "", "example.com/gen/oapi2proto;oapi2proto"},
+		{"template", "api.v1", "example.com/project/api/v1;v1", "example.com/gen/{{.Package}};{{.Alias}}pb", "example.com/gen/oapi2proto;oapi2protopb"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := testOptions(t)
+			opts.pkg, opts.goPkg = tc.pkg, tc.goPkg
+			if tc.tmpl != "" {
+				opts.goPkgTemplate = template.Must(template.New("go_pkg").Parse(tc.tmpl))
+			}
+			got, err := opts.customOptionsGoPackage(filepath.FromSlash(customOptionsImport))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("go_package = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+// Ways to carry schema defaults (-defaults).
+const (
+	defaultsNone    = "none"
+	defaultsComment = "comment"
+	defaultsOption  = "option"
+)
+
+// defaultOption renders the (oapi2proto.default_json) field option.
+func (g *genContext) defaultOption(s *Schema) string {
+	if g.defaults != defaultsOption || s == nil || s.Default == nil {
+		return ""
+	}
+	return g.useCustomOption("default_json") + " = " + textQuote(literal(s.Default))
+}
+
+// defaultNote renders the `default: <json>` field comment.
+func (g *genContext) defaultNote(s *Schema) string {
+	if g.defaults != defaultsComment || s.Default == nil {
+		return ""
+	}
+	return "default: " + literal(s.Default)
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Output formats accepted by -format.
+const (
+	formatProto               = "proto"
+	formatTextprotoDescriptor = "textproto-descriptor"
+)
+
+// outputExt 返回 -format 对应的输出文件扩展名
+func (o *genOptions) outputExt() string {
+	if o.format == formatTextprotoDescriptor {
+		return ".txtpb"
+	}
+	return ".proto"
+}
+
+// descriptorFileName is the base name of the .proto file an output file
+// stands for (see protoFileName for the descriptor name).
+func descriptorFileName(outFile string) string {
+	base := filepath.Base(outFile)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + ".proto"
+}
+
+// scalarDescriptorTypes maps proto scalar types to FieldDescriptorProto.Type.
+var scalarDescriptorTypes = map[string]string{
+	"double": "TYPE_DOUBLE", "float": "TYPE_FLOAT",
+	"int64": "TYPE_INT64", "uint64": "TYPE_UINT64", "int32": "TYPE_INT32", "uint32": "TYPE_UINT32",
+	"fixed64": "TYPE_FIXED64", "fixed32": "TYPE_FIXED32", "sfixed32": "TYPE_SFIXED32", "sfixed64": "TYPE_SFIXED64",
+	"sint32": "TYPE_SINT32", "sint64": "TYPE_SINT64",
+	"bool": "TYPE_BOOL", "string": "TYPE_STRING", "bytes": "TYPE_BYTES",
+}
+
+// externalEnums lists enums of imported files; other imported types are messages.
+var externalEnums = map[string]bool{
+	"google.protobuf.NullValue": true,
+	"google.type.DayOfWeek":     true,
+	"google.type.Month":         true,
+}
+
+// Built-in options set directly on the *Options messages (everything else,
+// e.g. extensions, becomes an uninterpreted_option).
+var (
+	fileOptionNames = map[string]bool{
+		"go_package": true, "java_package": true, "java_outer_classname": true, "java_multiple_files": true,
+		"csharp_namespace": true, "objc_class_prefix": true, "php_namespace": true, "ruby_package": true,
+		"swift_prefix": true, "optimize_for": true, "cc_enable_arenas": true, "deprecated": true,
+	}
+	fieldOptionNames   = map[string]bool{"deprecated": true, "packed": true, "lazy": true}
+	messageOptionNames = map[string]bool{"deprecated": true}
+	enumOptionNames    = map[string]bool{"deprecated": true, "allow_alias": true}
+	valueOptionNames   = map[string]bool{"deprecated": true}
+	methodOptionNames  = map[string]bool{"deprecated": true, "idempotency_level": true}
+)
+
+// descriptorText 将生成的 proto 源码转换为 protobuf 文本格式的 FileDescriptorProto;
+// enums 为其他文件中定义的 enum 的全限定名 (其余外部类型视为 message)
+func descriptorText(src, fileName string, enums map[string]bool) (string, error) {
+	ast, err := parseProto(src)
+	if err != nil {
+		return "", fmt.Errorf("解析生成结果失败: %w", err)
+	}
+	w := &textWriter{}
+	d := &descriptorWriter{w: w, ast: ast, types: map[string]string{}, enums: enums}
+	d.indexTypes("", ast.messages, ast.enums)
+
+	w.line("# proto-file: google/protobuf/descriptor.proto")
+	w.line("# proto-message: google.protobuf.FileDescriptorProto")
+	w.line("# " + generatedMarker)
+	w.line("")
+	w.str("name", fileName)
+	if ast.pkg != "" {
+		w.str("package", ast.pkg)
+	}
+	for _, imp := range ast.imports {
+		w.str("dependency", imp.path)
+	}
+	for i, imp := range ast.imports {
+		if imp.public {
+			w.field("public_dependency", strconv.Itoa(i))
+		}
+	}
+	scope := ""
+	if ast.pkg != "" {
+		scope = "." + ast.pkg
+	}
+	for _, m := range ast.messages {
+		d.message(scope, m)
+	}
+	for _, e := range ast.enums {
+		d.enum(e)
+	}
+	for _, s := range ast.services {
+		d.service(s)
+	}
+	d.options(ast.options, fileOptionNames)
+	if ast.syntax != "" && ast.syntax != "proto2" {
+		w.str("syntax", ast.syntax)
+	}
+	return w.b.String(), nil
+}
+
+// textWriter writes indented protobuf text format.
+type textWriter struct {
+	b     strings.Builder
+	depth int
+}
+
+func (w *textWriter) line(s string) {
+	if s != "" {
+		w.b.WriteString(strings.Repeat("  ", w.depth))
+	}
+	w.b.WriteString(s + "\n")
+}
+
+func (w *textWriter) field(name, value string) { w.line(name + ": " + value) }
+
+func (w *textWriter) str(name, value string) { w.field(name, textQuote(value)) }
+
+func (w *textWriter) open(name string) {
+	w.line(name + " {")
+	w.depth++
+}
+
+func (w *textWriter) close() {
+	w.depth--
+	w.line("}")
+}
+
+// textQuote quotes a string for text format, keeping UTF-8 as is.
+func textQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\%03o`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+type descriptorWriter struct {
+	w   *textWriter
+	ast *protoAST
+	// types maps fully-qualified local type names (".pkg.Msg") to
+	// TYPE_MESSAGE / TYPE_ENUM
+	types map[string]string
+	// enums lists the enums of other files of the run ("pkg.Enum")
+	enums map[string]bool
+}
+
+func (d *descriptorWriter) indexTypes(prefix string, msgs []*protoMessage, enums []*protoEnum) {
+	if prefix == "" && d.ast.pkg != "" {
+		prefix = "." + d.ast.pkg
+	}
+	for _, m := range msgs {
+		d.types[prefix+"."+m.name] = "TYPE_MESSAGE"
+		d.indexTypes(prefix+"."+m.name, m.messages, m.enums)
+	}
+	for _, e := range enums {
+		d.types[prefix+"."+e.name] = "TYPE_ENUM"
+	}
+}
+
+// resolveType resolves a type reference from scope like protoc (innermost
+// scope first) and returns its descriptor type and fully-qualified name.
+func (d *descriptorWriter) resolveType(scope, typ string) (string, string) {
+	if t, ok := scalarDescriptorTypes[typ]; ok {
+		return t, ""
+	}
+	if strings.HasPrefix(typ, ".") {
+		return d.kindOf(typ), typ
+	}
+	for s := scope; ; {
+		if t, ok := d.types[s+"."+typ]; ok {
+			return t, s + "." + typ
+		}
+		if s == "" {
+			break
+		}
+		s = s[:strings.LastIndex(s, ".")]
+	}
+	return d.kindOf("." + typ), "." + typ
+}
+
+func (d *descriptorWriter) kindOf(full string) string {
+	if t, ok := d.types[full]; ok {
+		return t
+	}
+	if name := strings.TrimPrefix(full, "."); externalEnums[name] || d.enums[name] {
+		return "TYPE_ENUM"
+	}
+	return "TYPE_MESSAGE"
+}
+
+func (d *descriptorWriter) message(scope string, m *protoMessage) {
+	w := d.w
+	full := scope + "." + m.name
+	w.open("message_type")
+	w.str("name", m.name)
+	oneofIndex := map[string]int{}
+	for i, o := range m.oneofs {
+		oneofIndex[o] = i
+	}
+	var synthetic []string
+	var entries []*protoField
+	for _, f := range m.fields {
+		w.open("field")
+		w.str("name", f.name)
+		w.field("number", strconv.Itoa(f.number))
+		switch {
+		case f.keyType != "":
+			w.field("label", "LABEL_REPEATED")
+			w.field("type", "TYPE_MESSAGE")
+			w.str("type_name", full+"."+mapEntryName(f.name))
+			entries = append(entries, f)
+		default:
+			label := "LABEL_OPTIONAL"
+			if f.label == "repeated" {
+				label = "LABEL_REPEATED"
+			} else if f.label == "required" {
+				label = "LABEL_REQUIRED"
+			}
+			w.field("label", label)
+			t, name := d.resolveType(full, f.typ)
+			w.field("type", t)
+			if name != "" {
+				w.str("type_name", name)
+			}
+		}
+		switch {
+		case f.oneof != "":
+			w.field("oneof_index", strconv.Itoa(oneofIndex[f.oneof]))
+		case f.label == "optional" && d.ast.syntax == "proto3":
+			w.field("oneof_index", strconv.Itoa(len(m.oneofs)+len(synthetic)))
+			synthetic = append(synthetic, "_"+f.name)
+		}
+		jsonName := protoJSONName(f.name)
+		var rest []protoOption
+		for _, o := range f.options {
+			if o.name == "json_name" {
+				jsonName, _ = strconv.Unquote(o.value)
+				continue
+			}
+			rest = append(rest, o)
+		}
+		w.str("json_name", jsonName)
+		d.options(rest, fieldOptionNames)
+		if f.label == "optional" && d.ast.syntax == "proto3" {
+			w.field("proto3_optional", "true")
+		}
+		w.close()
+	}
+	for _, nested := range m.messages {
+		d.message(full, nested)
+	}
+	for _, f := range entries {
+		w.open("nested_type")
+		w.str("name", mapEntryName(f.name))
+		for i, t := range []string{f.keyType, f.valType} {
+			w.open("field")
+			w.str("name", []string{"key", "value"}[i])
+			w.field("number", strconv.Itoa(i+1))
+			w.field("label", "LABEL_OPTIONAL")
+			kind, name := d.resolveType(full, t)
+			w.field("type", kind)
+			if name != "" {
+				w.str("type_name", name)
+			}
+			w.str("json_name", []string{"key", "value"}[i])
+			w.close()
+		}
+		w.open("options")
+		w.field("map_entry", "true")
+		w.close()
+		w.close()
+	}
+	for _, e := range m.enums {
+		d.enum(e)
+	}
+	for _, o := range append(append([]string{}, m.oneofs...), synthetic...) {
+		w.open("oneof_decl")
+		w.str("name", o)
+		w.close()
+	}
+	d.options(m.options, messageOptionNames)
+	for _, r := range m.reserved {
+		w.open("reserved_range")
+		w.field("start", strconv.Itoa(r.start))
+		w.field("end", strconv.Itoa(r.end+1)) // exclusive
+		w.close()
+	}
+	for _, n := range m.reservedNames {
+		w.str("reserved_name", n)
+	}
+	w.close()
+}
+
+func (d *descriptorWriter) enum(e *protoEnum) {
+	w := d.w
+	w.open("enum_type")
+	w.str("name", e.name)
+	for _, v := range e.values {
+		w.open("value")
+		w.str("name", v.name)
+		w.field("number", strconv.Itoa(v.number))
+		d.options(v.options, valueOptionNames)
+		w.close()
+	}
+	d.options(e.options, enumOptionNames)
+	for _, r := range e.reserved {
+		w.open("reserved_range")
+		w.field("start", strconv.Itoa(r.start))
+		w.field("end", strconv.Itoa(r.end)) // inclusive
+		w.close()
+	}
+	w.close()
+}
+
+func (d *descriptorWriter) service(s *protoService) {
+	w := d.w
+	scope := ""
+	if d.ast.pkg != "" {
+		scope = "." + d.ast.pkg
+	}
+	w.open("service")
+	w.str("name", s.name)
+	for _, m := range s.methods {
+		w.open("method")
+		w.str("name", m.name)
+		_, in := d.resolveType(scope, m.input)
+		_, out := d.resolveType(scope, m.output)
+		w.str("input_type", in)
+		w.str("output_type", out)
+		d.options(m.options, methodOptionNames)
+		if m.clientStream {
+			w.field("client_streaming", "true")
+		}
+		if m.serverStream {
+			w.field("server_streaming", "true")
+		}
+		w.close()
+	}
+	d.options(s.options, map[string]bool{"deprecated": true})
+	w.close()
+}
+
+// options writes an options block; builtin names are set directly, the
+// rest (custom extensions) are kept as uninterpreted_option like protoc
+// does before option interpretation.
+func (d *descriptorWriter) options(opts []protoOption, builtin map[string]bool) {
+	if len(opts) == 0 {
+		return
+	}
+	w := d.w
+	w.open("options")
+	for _, o := range opts {
+		if builtin[o.name] {
+			w.field(o.name, o.value)
+			continue
+		}
+		w.open("uninterpreted_option")
+		for _, part := range optionNameParts(o.name) {
+			w.open("name")
+			w.str("name_part", part.name)
+			w.field("is_extension", strconv.FormatBool(part.ext))
+			w.close()
+		}
+		v := o.value
+		switch {
+		case strings.HasPrefix(v, "{"):
+			w.str("aggregate_value", strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(v, "{"), "}")))
+		case strings.HasPrefix(v, `"`):
+			s, err := strconv.Unquote(v)
+			if err != nil {
+				s = strings.Trim(v, `"`)
+			}
+			w.str("string_value", s)
+		case strings.HasPrefix(v, "-"):
+			if _, err := strconv.ParseInt(v, 0, 64); err == nil {
+				w.field("negative_int_value", v)
+			} else {
+				w.field("double_value", v)
+			}
+		case v != "" && v[0] >= '0' && v[0] <= '9':
+			if _, err := strconv.ParseUint(v, 0, 64); err == nil {
+				w.field("positive_int_value", v)
+			} else {
+				w.field("double_value", v)
+			}
+		default:
+			w.str("identifier_value", v)
+		}
+		w.close()
+	}
+	w.close()
+}
+
+type optionNamePart struct {
+	name string
+	ext  bool
+}
+
+// optionNameParts splits `(buf.validate.field).string.min_len` into name parts.
+func optionNameParts(name string) []optionNamePart {
+	var parts []optionNamePart
+	for name != "" {
+		name = strings.TrimPrefix(name, ".")
+		if strings.HasPrefix(name, "(") {
+			end := strings.Index(name, ")")
+			if end < 0 {
+				end = len(name) - 1
+			}
+			parts = append(parts, optionNamePart{name: strings.TrimPrefix(name[1:end], "."), ext: true})
+			name = name[end+1:]
+			continue
+		}
+		next := strings.IndexAny(name, ".(")
+		if next < 0 {
+			next = len(name)
+		}
+		parts = append(parts, optionNamePart{name: name[:next]})
+		name = name[next:]
+	}
+	return parts
+}
+
+// protoJSONName is protoc's default json_name: underscores removed, the
+// following letter upper-cased.
+func protoJSONName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper && r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// mapEntryName is the synthesized map entry message name (foo_bar -> FooBarEntry).
+func mapEntryName(field string) string {
+	j := protoJSONName(field)
+	if j == "" {
+		return "Entry"
+	}
+	return strings.ToUpper(j[:1]) + j[1:] + "Entry"
+}
+
+// writeOutput 按 -format 写出单个输出文件; enums 见 descriptorText
+func (o *genOptions) writeOutput(outFile, content string, enums map[string]bool) error {
+	if o.module != nil {
+		o.module.recordImports(content)
+	}
+	if o.format == formatTextprotoDescriptor {
+		var err error
+		if content, err = descriptorText(content, o.protoFileName(outFile), enums); err != nil {
+			return fmt.Errorf("%s: %w", outFile, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(outFile), 0o755); err != nil {
+		return err
+	}
+	return o.writeGenerated(outFile, []byte(content))
+}
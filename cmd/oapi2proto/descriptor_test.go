@@ -0,0 +1,108 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const subPackageSpec = `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Color:
+      type: string
+      enum: [red, green]
+      x-proto-package: shared.v1
+    Thing:
+      type: object
+      x-proto-package: shared.v1
+      properties: {a: {type: string}}
+    Holder:
+      type: object
+      properties:
+        color: {$ref: '#/components/schemas/Color'}
+        thing: {$ref: '#/components/schemas/Thing'}
+`
+
+// TestDescriptorSubPackages checks the descriptors of a spec split by
+// x-proto-package: each file is named by the path other files import it
+// with, and types of sibling files keep their kind.
+func TestDescriptorSubPackages(t *testing.T) {
+	opts := testOptions(t)
+	opts.outRoot = t.TempDir()
+	outFile := filepath.Join(opts.outRoot, "api.txtpb")
+	doc := loadSpec(t, opts, "sub.yaml", subPackageSpec)
+	parts, err := opts.splitPackages(doc, opts.pkg, outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, part := range parts {
+		src, ctx := renderFile(part.doc, opts, part.pkg, opts.goPkg, "")
+		if len(ctx.errors) > 0 {
+			t.Fatal(ctx.errors)
+		}
+		text, err := descriptorText(src, opts.protoFileName(part.outFile), ctx.siblingEnums())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[part.pkg] = text
+	}
+	for _, tc := range []struct {
+		pkg  string
+		want []string
+	}{
+		{"shared.v1", []string{`name: "shared/v1/api.proto"`, `name: "Color"`, `name: "Thing"`}},
+		{"api.v1", []string{
+			`name: "api.proto"`,
+			`dependency: "shared/v1/api.proto"`,
+			"type: TYPE_ENUM\n    type_name: \".shared.v1.Color\"",
+			"type: TYPE_MESSAGE\n    type_name: \".shared.v1.Thing\"",
+		}},
+	} {
+		t.Run(tc.pkg, func(t *testing.T) {
+			text, ok := got[tc.pkg]
+			if !ok {
+				t.Fatalf("no file for %s in %v", tc.pkg, got)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("missing %q in\n%s", want, text)
+				}
+			}
+		})
+	}
+}
+
+func TestDescriptorKinds(t *testing.T) {
+	src := `syntax = "proto3";
+package api.v1;
+message Local {}
+enum Mode { MODE_UNSPECIFIED = 0; }
+message Holder {
+  Local local = 1;
+  Mode mode = 2;
+  other.v1.Msg msg = 3;
+  other.v1.Kind kind = 4;
+  google.type.DayOfWeek day = 5;
+}
+`
+	text, err := descriptorText(src, "api.proto", map[string]bool{"other.v1.Kind": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ typeName, kind string }{
+		{".api.v1.Local", "TYPE_MESSAGE"},
+		{".api.v1.Mode", "TYPE_ENUM"},
+		{".other.v1.Msg", "TYPE_MESSAGE"},
+		{".other.v1.Kind", "TYPE_ENUM"},
+		{".google.type.DayOfWeek", "TYPE_ENUM"},
+	} {
+		if want := "type: " + tc.kind + "\n    type_name: \"" + tc.typeName + "\""; !strings.Contains(text, want) {
+			t.Errorf("%s: missing %q in\n%s", tc.typeName, want, text)
+		}
+	}
+}
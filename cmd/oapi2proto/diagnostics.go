@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Diagnostic severities.
+const (
+	severityInfo    = "info"
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+// diagnostic records a place where the generated proto does not (fully)
+// represent the OpenAPI contract.
+type diagnostic struct {
+	File     string `json:"file"`
+	Subject  string `json:"subject"`
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	// Origin is the spec location (file#pointer) of the subject, when known.
+	Origin string `json:"origin,omitempty"`
+	// specPath and pointer resolve Origin to a line for pretty output.
+	specPath, pointer string
+}
+
+// diagnostics collects entries from all (possibly parallel) generations.
+type diagnostics struct {
+	mu      sync.Mutex
+	entries []diagnostic
+	// pretty / color select the grouped terminal rendering (-diag-style, -color)
+	pretty, color bool
+	// showInfo also prints info entries (lint)
+	showInfo bool
+}
+
+func (d *diagnostics) add(e diagnostic) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = append(d.entries, e)
+}
+
+// addDocument records the parse-time warnings of a document.
+func (d *diagnostics) addDocument(doc *Document) {
+	if d == nil {
+		return
+	}
+	for _, w := range doc.warnings {
+		w.File = doc.source
+		if w.Origin == "" {
+			doc.locate(&w, doc.subjectOrigin(w.Subject))
+		}
+		d.add(w)
+	}
+}
+
+func (d *diagnostics) sorted() []diagnostic {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := append([]diagnostic(nil), d.entries...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].File != out[j].File {
+			return out[i].File < out[j].File
+		}
+		return out[i].Subject < out[j].Subject
+	})
+	return out
+}
+
+// print writes warnings and errors to stderr; info entries only go to the
+// report unless showInfo is set.
+func (d *diagnostics) print() {
+	if d.pretty {
+		d.printPretty(os.Stderr, d.color)
+		return
+	}
+	for _, e := range d.sorted() {
+		switch e.Severity {
+		case severityWarning:
+			fmt.Fprintf(os.Stderr, "[WARN] %s: %s: %s\n", e.File, e.Subject, e.Message)
+		case severityError:
+			fmt.Fprintf(os.Stderr, "[ERROR] %s: %s: %s\n", e.File, e.Subject, e.Message)
+		case severityInfo:
+			if d.showInfo {
+				fmt.Fprintf(os.Stderr, "[INFO] %s: %s: %s\n", e.File, e.Subject, e.Message)
+			}
+		}
+	}
+}
+
+// count returns the number of entries of a severity.
+func (d *diagnostics) count(severity string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, e := range d.entries {
+		if e.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// exitOnWarnings 在存在警告时输出汇总并以非零状态退出 (-fail-on-warn)
+func (d *diagnostics) exitOnWarnings() {
+	if d == nil {
+		return
+	}
+	if n := d.count(severityWarning); n > 0 {
+		fmt.Fprintf(os.Stderr, "[FAIL] -fail-on-warn: %d 条警告\n", n)
+		os.Exit(1)
+	}
+}
+
+// writeReport 输出 json 格式的有损转换报告
+func (d *diagnostics) writeReport(path string) error {
+	entries := d.sorted()
+	if entries == nil {
+		entries = []diagnostic{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// diag records a diagnostic for the file being generated.
+func (g *genContext) diag(severity, kind, subject, msg string) {
+	if g.diags == nil {
+		return
+	}
+	e := diagnostic{File: g.doc.source, Subject: subject, Kind: kind, Severity: severity, Message: msg}
+	origin := g.doc.subjectOrigin(subject)
+	if origin == "" && g.component != nil {
+		origin = g.component.origin
+	}
+	g.doc.locate(&e, origin)
+	g.diags.add(e)
+}
+
+// fail records an error diagnostic that makes generation of the current file fail.
+func (g *genContext) fail(kind, subject, msg string) {
+	g.diag(severityError, kind, subject, msg)
+	g.errors = append(g.errors, subject+": "+msg)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Values of -diag-style.
+const (
+	diagStyleAuto   = "auto"
+	diagStylePlain  = "plain"
+	diagStylePretty = "pretty"
+)
+
+// Values of -color.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// ANSI escapes of the pretty diagnostics.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[1;31m"
+	ansiYellow = "\x1b[1;33m"
+	ansiBlue   = "\x1b[1;34m"
+)
+
+// isTerminal reports whether f is a character device (a terminal).
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// useColor 根据 -color 取值决定是否输出颜色 (auto: 终端且未设置 NO_COLOR)
+func useColor(mode string) bool {
+	switch mode {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	return isTerminal(os.Stderr) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+}
+
+// subjectOrigin finds the origin of the schema (or property) a diagnostic
+// subject such as "Pet" or "Pet.owner_id" names; empty when unknown.
+func (d *Document) subjectOrigin(subject string) string {
+	head, rest, _ := strings.Cut(subject, ".")
+	s := d.Components.Schemas[head]
+	if s == nil {
+		for _, name := range sortedKeys(d.Components.Schemas) {
+			if normalizeMessage(name) == head {
+				s = d.Components.Schemas[name]
+				break
+			}
+		}
+	}
+	if s == nil {
+		return ""
+	}
+	if p := s.Properties[rest]; p != nil && p.origin != "" {
+		return p.origin
+	}
+	if rest != "" {
+		for _, prop := range sortedKeys(s.Properties) {
+			if p := s.Properties[prop]; p != nil && p.origin != "" && (prop == rest || normalizeField(prop) == rest) {
+				return p.origin
+			}
+		}
+	}
+	return s.origin
+}
+
+// locate attaches the spec file and pointer of origin to a diagnostic.
+func (d *Document) locate(e *diagnostic, origin string) {
+	file, ptr, ok := strings.Cut(origin, "#")
+	if !ok {
+		return
+	}
+	e.Origin = origin
+	e.specPath, e.pointer = d.files[file], ptr
+}
+
+// group is the schema a diagnostic belongs to: the head of its origin
+// pointer below components/schemas, else the head of its subject.
+func (e diagnostic) group() string {
+	if _, ptr, ok := strings.Cut(e.Origin, componentSchemasPrefix); ok {
+		head, _, _ := strings.Cut(ptr, "/")
+		return unescapePointer(head)
+	}
+	head, _, _ := strings.Cut(e.Subject, ".")
+	return head
+}
+
+// printPretty writes warnings and errors grouped by file and schema, with
+// the spec line each one comes from when it can be resolved.
+func (d *diagnostics) printPretty(w io.Writer, color bool) {
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + ansiReset
+	}
+	type spec struct {
+		root  *yaml.Node
+		lines []string
+	}
+	specs := map[string]*spec{}
+	excerpt := func(e diagnostic) (int, string) {
+		if e.specPath == "" {
+			return 0, ""
+		}
+		sp, ok := specs[e.specPath]
+		if !ok {
+			sp = &spec{}
+			if data, err := os.ReadFile(e.specPath); err == nil {
+				sp.root = loadSpecNode(func(string) ([]byte, error) { return data, nil }, e.specPath)
+				sp.lines = strings.Split(string(data), "\n")
+			}
+			specs[e.specPath] = sp
+		}
+		_, line := pointerNode(sp.root, e.pointer)
+		if line < 1 || line > len(sp.lines) {
+			return 0, ""
+		}
+		return line, strings.TrimRight(sp.lines[line-1], "\r")
+	}
+	entries := d.sorted()
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].File != entries[j].File {
+			return entries[i].File < entries[j].File
+		}
+		return entries[i].group() < entries[j].group()
+	})
+	var file, group string
+	for _, e := range entries {
+		var label string
+		switch e.Severity {
+		case severityWarning:
+			label = paint(ansiYellow, "warning")
+		case severityError:
+			label = paint(ansiRed, "error")
+		case severityInfo:
+			if !d.showInfo {
+				continue
+			}
+			label = paint(ansiBlue, "info")
+		default:
+			continue
+		}
+		if e.File != file || e.group() != group {
+			if file != "" {
+				fmt.Fprintln(w)
+			}
+			file, group = e.File, e.group()
+			fmt.Fprintf(w, "%s %s\n", paint(ansiBold, group), paint(ansiBlue, "("+file+")"))
+		}
+		fmt.Fprintf(w, "  %s[%s]: %s\n", label, e.Kind, e.Message)
+		if e.Subject != group {
+			fmt.Fprintf(w, "    %s %s\n", paint(ansiBlue, "-->"), e.Subject)
+		}
+		if line, text := excerpt(e); line > 0 {
+			num := fmt.Sprint(line)
+			fmt.Fprintf(w, "    %s %s%s\n", strings.Repeat(" ", len(num)), paint(ansiBlue, "|"), " "+e.Origin)
+			fmt.Fprintf(w, "    %s %s %s\n", paint(ansiBlue, num), paint(ansiBlue, "|"), text)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Enum mappings for -enum.
+const (
+	enumProto  = "proto"
+	enumString = "string"
+)
+
+// Zero values of generated enums (-enum-zero).
+const (
+	enumZeroUnspecified = "unspecified"
+	enumZeroUnknown     = "unknown"
+	enumZeroDefault     = "default"
+)
+
+// enumZeroIdent is the suffix of the generated zero value.
+func (o *genOptions) enumZeroIdent() string {
+	if o.enumZero == enumZeroUnknown {
+		return "UNKNOWN"
+	}
+	return "UNSPECIFIED"
+}
+
+// enumZeroOrder returns the values of an enum in emission order. Under
+// -enum-zero=default a spec value takes number 0 instead of a generated zero
+// value: the schema default when it is one of the values, otherwise a value
+// spelled unspecified or unknown. That value moves first (proto3 wants the
+// zero value first) and specZero is true.
+func (g *genContext) enumZeroOrder(s *Schema) (values []string, specZero bool) {
+	if g.enumZero != enumZeroDefault {
+		return s.Enum, false
+	}
+	zero := -1
+	if s.Default != nil {
+		zero = slices.Index(s.Enum, fmt.Sprint(s.Default))
+	}
+	for i := 0; zero < 0 && i < len(s.Enum); i++ {
+		if v := strings.ToLower(s.Enum[i]); v == "unspecified" || v == "unknown" {
+			zero = i
+		}
+	}
+	if zero < 0 {
+		return s.Enum, false
+	}
+	values = append([]string{s.Enum[zero]}, s.Enum[:zero]...)
+	return append(values, s.Enum[zero+1:]...), true
+}
+
+// enumAsScalar reports whether an enum schema is emitted as a plain scalar
+// field (-enum=string) instead of a proto enum.
+func (g *genContext) enumAsScalar(s *Schema) bool {
+	return g.enumMode == enumString && len(s.Enum) > 0
+}
+
+// enumValuesNote documents the allowed values of an enum kept as a scalar,
+// unless a protovalidate `in` rule already carries them.
+func (g *genContext) enumValuesNote(s *Schema, ptype string) string {
+	rs := g.resolveRef(s)
+	if strings.HasPrefix(ptype, "repeated ") && rs.Items != nil {
+		rs = g.resolveRef(rs.Items)
+	}
+	if !g.enumAsScalar(rs) || g.validate == validateProtovalidate {
+		return ""
+	}
+	return "allowed: " + strings.Join(rs.Enum, " | ")
+}
+
+// enumInRule renders the protovalidate `in` rule of an enum kept as a scalar.
+func enumInRule(s *Schema, ptype string) string {
+	vals := make([]string, 0, len(s.Enum))
+	for _, v := range s.Enum {
+		if ptype == "string" {
+			v = textQuote(v)
+		}
+		vals = append(vals, v)
+	}
+	return "in: [" + strings.Join(vals, ", ") + "]"
+}
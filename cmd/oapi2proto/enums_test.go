@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// enumLines returns the value lines of enum name in out.
+func enumLines(out, name string) []string {
+	_, body, ok := strings.Cut(out, "enum "+name+" {\n")
+	if !ok {
+		return nil
+	}
+	body, _, _ = strings.Cut(body, "\n}")
+	var lines []string
+	for _, l := range strings.Split(body, "\n") {
+		lines = append(lines, strings.TrimSpace(l))
+	}
+	return lines
+}
+
+// renderEnum renders a spec holding the Sign enum with the given values
+// (YAML flow sequence items) and schema extras.
+func renderEnum(t *testing.T, opts *genOptions, values, extra string) string {
+	t.Helper()
+	return renderSpec(t, opts, "enum.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Sign: {type: string, enum: [`+values+`]`+extra+`}
+`)
+}
+
+func TestToEnumValue(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		lossy    bool
+	}{
+		{"active", "ACTIVE", false},
+		{"in-progress", "IN_PROGRESS", false},
+		{"a.b", "A_B", true},
+		{"", "VALUE_EMPTY", true},
+		{"-", "VALUE_MINUS", true},
+		{"+", "VALUE_PLUS", true},
+		{" ", "VALUE_SPACE", true},
+		{"<=", "VALUE_LT_EQ", true},
+		{"→", "VALUE_U2192", true},
+	} {
+		got, lossy := toEnumValue(tc.in)
+		if got != tc.want || lossy != tc.lossy {
+			t.Errorf("toEnumValue(%q) = %q, %t; want %q, %t", tc.in, got, lossy, tc.want, tc.lossy)
+		}
+	}
+}
+
+// TestSymbolEnumValues checks the placeholders of values without letters or
+// digits: deterministic, unique, with the original string in a comment and
+// in the -manifest value mapping.
+func TestSymbolEnumValues(t *testing.T) {
+	opts := testOptions(t)
+	opts.manifest = &manifest{}
+	doc := loadSpec(t, opts, "enum.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Sign: {type: string, enum: ["", "-", "+", a-b, a b]}
+`)
+	out, ctx := renderFile(doc, opts, opts.pkg, opts.goPkg, "")
+	if len(ctx.errors) > 0 {
+		t.Fatal(ctx.errors)
+	}
+	want := []string{
+		"SIGN_UNSPECIFIED = 0;",
+		`SIGN_VALUE_EMPTY = 1; // ""`,
+		`SIGN_VALUE_MINUS = 2; // "-"`,
+		`SIGN_VALUE_PLUS = 3; // "+"`,
+		"SIGN_A_B = 4;",
+		`SIGN_A_B_2 = 5; // "a b"`,
+	}
+	if got := enumLines(out, "Sign"); !reflect.DeepEqual(got, want) {
+		t.Errorf("values = %q, want %q", got, want)
+	}
+	if again, _ := renderFile(doc, opts, opts.pkg, opts.goPkg, ""); again != out {
+		t.Errorf("placeholders not deterministic:\n%s\nvs\n%s", out, again)
+	}
+	if len(ctx.manifestEnums) != 1 {
+		t.Fatalf("manifest enums = %v", ctx.manifestEnums)
+	}
+	mapping := map[string]string{}
+	for _, v := range ctx.manifestEnums[0].Values {
+		mapping[v.Value] = v.Name
+	}
+	for value, name := range map[string]string{"": "SIGN_VALUE_EMPTY", "+": "SIGN_VALUE_PLUS", "a b": "SIGN_A_B_2"} {
+		if mapping[value] != name {
+			t.Errorf("manifest maps %q to %q, want %q", value, mapping[value], name)
+		}
+	}
+}
+
+func TestDigitEnumValues(t *testing.T) {
+	for _, tc := range []struct {
+		name, values string
+		args         []string
+		want         []string
+	}{
+		{"value", `"2xx", "404", ok`, nil, []string{
+			"SIGN_UNSPECIFIED = 0;", `SIGN_2XX = 1; // "2xx"`, `SIGN_404 = 2; // "404"`, "SIGN_OK = 3;",
+		}},
+		{"buf style", `"2xx"`, []string{"-style", "buf"}, []string{"SIGN_UNSPECIFIED = 0;", `SIGN_2XX = 1; // "2xx"`}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+			gen := registerGenFlags(fs)
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			opts, err := gen.options()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := enumLines(renderEnum(t, opts, tc.values, ""), "Sign"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("values = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestEnumDigitPrefix checks -enum-digit-prefix on enums whose name starts
+// with a digit, where the prefix alone cannot start the value names.
+func TestEnumDigitPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		prefix, want string
+		err          bool
+	}{
+		{"", "N2XXCODE_404", false},
+		{"x_", "X_2XXCODE_404", false},
+		{"_", "_2XXCODE_404", false},
+		{"9", "", true},
+		{"a-b", "", true},
+	} {
+		fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+		gen := registerGenFlags(fs)
+		var args []string
+		if tc.prefix != "" {
+			args = []string{"-enum-digit-prefix", tc.prefix}
+		}
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		opts, err := gen.options()
+		if (err != nil) != tc.err {
+			t.Errorf("-enum-digit-prefix %q: error %v, want error %t", tc.prefix, err, tc.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := opts.enumValueName("2XXCODE", "404"); got != tc.want {
+			t.Errorf("-enum-digit-prefix %q: enumValueName = %q, want %q", tc.prefix, got, tc.want)
+		}
+		if got := opts.enumValueName("CODE", "404"); got != "CODE_404" {
+			t.Errorf("-enum-digit-prefix %q: prefixed a letter-leading name: %q", tc.prefix, got)
+		}
+	}
+}
+
+func TestEnumZero(t *testing.T) {
+	for _, tc := range []struct {
+		name, mode, values, extra string
+		want                      []string
+	}{
+		{"unspecified", enumZeroUnspecified, "cat, dog", "", []string{"SIGN_UNSPECIFIED = 0;", "SIGN_CAT = 1;", "SIGN_DOG = 2;"}},
+		{"unknown", enumZeroUnknown, "cat, dog", "", []string{"SIGN_UNKNOWN = 0;", "SIGN_CAT = 1;", "SIGN_DOG = 2;"}},
+		{"default value", enumZeroDefault, "cat, dog", ", default: dog", []string{"SIGN_DOG = 0;", "SIGN_CAT = 1;"}},
+		{"unknown value", enumZeroDefault, "cat, Unknown, dog", "", []string{"SIGN_UNKNOWN = 0;", "SIGN_CAT = 1;", "SIGN_DOG = 2;"}},
+		{"default wins", enumZeroDefault, "unspecified, cat", ", default: cat", []string{"SIGN_CAT = 0;", "SIGN_UNSPECIFIED = 1;"}},
+		{"no suitable value", enumZeroDefault, "cat, dog", ", default: fish", []string{"SIGN_UNSPECIFIED = 0;", "SIGN_CAT = 1;", "SIGN_DOG = 2;"}},
+		{"value spelled like the zero", enumZeroUnknown, "unknown, cat", "", []string{"SIGN_UNKNOWN = 0;", `SIGN_UNKNOWN_2 = 1; // "unknown"`, "SIGN_CAT = 2;"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := testOptions(t)
+			opts.enumZero = tc.mode
+			out := renderEnum(t, opts, tc.values, tc.extra)
+			if got := enumLines(out, "Sign"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("values = %q, want %q", got, tc.want)
+			}
+			if problems := checkProto(out); len(problems) > 0 {
+				t.Errorf("output does not compile: %v\n%s", problems, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "unicode/utf8"
+
+// exampleMaxLen bounds example values rendered into comments.
+const exampleMaxLen = 80
+
+// exampleNote renders the schema example (`example`, else the first of
+// `examples`) for a comment, truncated and sanitized.
+func (g *genContext) exampleNote(s *Schema) string {
+	if !g.exampleComments || s == nil {
+		return ""
+	}
+	ex, ok := exampleOf(s)
+	if !ok {
+		return ""
+	}
+	return "example: " + commentSafe(ex, exampleMaxLen)
+}
+
+// commentSafe makes a value safe for a single-line comment (see
+// sanitizeComment) and cuts it to max runes.
+func commentSafe(v string, max int) string {
+	v = oneline(v)
+	if utf8.RuneCountInString(v) > max {
+		v = string([]rune(v)[:max]) + "…"
+	}
+	return v
+}
@@ -0,0 +1,743 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Output formats of the examples subcommand.
+const (
+	examplesTextproto = "textproto"
+	examplesJSON      = "json"
+)
+
+// exampleMaxDepth bounds assembling object examples from property examples
+// (recursive schemas would otherwise never end).
+const exampleMaxDepth = 8
+
+// runExamples 实现 `oapi2proto examples`: 将组件 schema 的 example / examples
+// 转为与生成的 message 对应的 textproto 或 proto3 JSON 文件, 作为测试数据;
+// -check 时只校验示例与 message 是否一致. 示例按生成文件的描述符 (与
+// -format textproto-descriptor 相同的解析结果) 转换
+func runExamples(args []string) {
+	fs := flag.NewFlagSet("examples", flag.ExitOnError)
+	gen := registerGenFlags(fs)
+	in := fs.String("in", "openapi.json", "openapi 文件 (json|yaml|yml)")
+	out := fs.String("out", "examples", "输出目录, 每个示例一个文件 (<Message>[_<n>].txtpb|.json)")
+	format := fs.String("format", examplesTextproto, "输出格式: textproto|json (proto3 JSON 映射)")
+	check := fs.Bool("check", false, "只校验: 将所有 schema / 属性示例与生成的 message 比对, 不符时报错退出, 不写文件")
+	fs.Parse(args)
+
+	if *format != examplesTextproto && *format != examplesJSON {
+		fatal(fmt.Errorf("未知 -format 取值: %s", *format))
+	}
+	opts, err := gen.options()
+	if err != nil {
+		fatal(err)
+	}
+	opts.format = formatProto
+	opts.manifest = &manifest{}
+	opts.diags = &diagnostics{}
+	doc, err := loadDocument(*in, opts)
+	if err != nil {
+		fatal(err)
+	}
+	doc.source = *in
+	base := inputBase(*in)
+	outFile := filepath.Join(*out, opts.outputBase(strings.TrimSuffix(base, filepath.Ext(base)))+".proto")
+	c, files, err := opts.exampleFiles(&doc, opts.packageFor(&doc, *in), outFile)
+	if err != nil {
+		fatal(err)
+	}
+	if *check {
+		checked, failed := 0, 0
+		for _, g := range files {
+			n, bad := g.checkExamples(c)
+			checked, failed = checked+n, failed+bad
+		}
+		opts.diags.print()
+		if failed > 0 {
+			fatal(fmt.Errorf("%d/%d 个示例与生成的 message 不符", failed, checked))
+		}
+		return
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fatal(err)
+	}
+	for _, g := range files {
+		if err = g.writeExamples(c, *out, *format); err != nil {
+			break
+		}
+	}
+	opts.diags.print()
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// exampleFiles renders the files generation writes for doc (one per
+// x-proto-package) and returns a converter over their descriptors, with the
+// context of every file.
+func (o *genOptions) exampleFiles(doc *Document, pkg, outFile string) (*exampleConverter, []*genContext, error) {
+	parts, err := o.splitPackages(doc, pkg, outFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := &exampleConverter{
+		messages:   map[string]*protoMessage{},
+		enums:      map[string]*protoEnum{},
+		types:      &descriptorWriter{types: map[string]string{}},
+		enumValues: map[string]map[string]string{},
+	}
+	var files []*genContext
+	for _, part := range parts {
+		src, g := renderFile(part.doc, o, part.pkg, "", "")
+		if err := c.add(src, g); err != nil {
+			return nil, nil, err
+		}
+		files = append(files, g)
+	}
+	return c, files, nil
+}
+
+// writeExamples writes one file per example of every component message of
+// the file. Examples that do not fit the message are reported and skipped.
+func (g *genContext) writeExamples(c *exampleConverter, dir, format string) error {
+	messages := g.exampleMessages()
+	for _, key := range sortedKeys(g.doc.Components.Schemas) {
+		full, ok := messages[g.componentName(key)]
+		if !ok {
+			continue
+		}
+		m := c.messages[full]
+		values := g.exampleValues(g.doc.Components.Schemas[key], 0)
+		for i, v := range values {
+			name := m.name
+			if len(values) > 1 {
+				name = fmt.Sprintf("%s_%d", m.name, i+1)
+			}
+			var data []byte
+			var err error
+			if format == examplesJSON {
+				var jv any
+				if jv, err = c.jsonMessage(jsonCompatible(v), full); err == nil {
+					data, err = json.MarshalIndent(jv, "", "  ")
+				}
+				name += ".json"
+			} else {
+				var b strings.Builder
+				fmt.Fprintf(&b, "# proto-message: %s\n\n", strings.TrimPrefix(full, "."))
+				err = c.textFields(&b, "", jsonCompatible(v), full)
+				data = []byte(b.String())
+				name += ".txtpb"
+			}
+			if err != nil {
+				g.diag(severityWarning, "example", m.name, fmt.Sprintf("example %d skipped: %v", i+1, err))
+				continue
+			}
+			if len(data) > 0 && data[len(data)-1] != '\n' {
+				data = append(data, '\n')
+			}
+			if err := writeFileAtomic(filepath.Join(dir, name), data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exampleMessages maps the component schemas of the file to the full
+// names (".pkg.Msg") of their messages, renamed like the generated file
+// names them (-strip-suffix, -style, -case-conflict, ...).
+func (g *genContext) exampleMessages() map[string]string {
+	messages := map[string]string{}
+	for _, m := range g.manifestMessages {
+		if m.Schema != "" {
+			messages[m.Schema] = protoScope(g.filePkg) + "." + m.Message
+		}
+	}
+	return messages
+}
+
+// protoScope is the scope of the top-level types of a package: "" or ".pkg".
+func protoScope(pkg string) string {
+	if pkg == "" {
+		return ""
+	}
+	return "." + pkg
+}
+
+// exampleValues returns the examples of a schema: `example`, then
+// `examples`. An object without its own example is assembled from the
+// examples of its properties.
+func (g *genContext) exampleValues(s *Schema, depth int) []any {
+	s = g.resolveRef(s)
+	if s == nil || depth > exampleMaxDepth {
+		return nil
+	}
+	if values := exampleList(s); len(values) > 0 {
+		return values
+	}
+	switch {
+	case len(s.Properties) > 0 || len(s.AllOf) > 0:
+		obj := map[string]any{}
+		props := g.exampleProperties(s)
+		for _, name := range sortedKeys(props) {
+			if vs := g.exampleValues(props[name], depth+1); len(vs) > 0 {
+				obj[name] = vs[0]
+			}
+		}
+		if len(obj) > 0 {
+			return []any{obj}
+		}
+	case s.Type == "array" && s.Items != nil:
+		if vs := g.exampleValues(s.Items, depth+1); len(vs) > 0 {
+			return []any{[]any{vs[0]}}
+		}
+	}
+	return nil
+}
+
+// exampleProperties merges the properties of an object schema and its allOf
+// parts.
+func (g *genContext) exampleProperties(s *Schema) map[string]*Schema {
+	props := map[string]*Schema{}
+	for _, part := range s.AllOf {
+		if part = g.resolveRef(part); part != nil {
+			for k, v := range part.Properties {
+				props[k] = v
+			}
+		}
+	}
+	for k, v := range s.Properties {
+		props[k] = v
+	}
+	return props
+}
+
+// checkExamples validates every example of the component schemas of the file
+// and of their (inline) properties against the generated messages and
+// reports each mismatch as an error. A property example is checked as the only
+// member of a payload of its component message. It returns the number of
+// examples checked and the number of mismatches.
+func (g *genContext) checkExamples(c *exampleConverter) (checked, failed int) {
+	check := func(subject, full string, v any) {
+		checked++
+		if _, err := c.jsonMessage(jsonCompatible(v), full); err != nil {
+			failed++
+			g.diag(severityError, "example", subject, err.Error())
+		}
+	}
+	var walk func(s *Schema, subject, full string, wrap func(any) any, depth int)
+	walk = func(s *Schema, subject, full string, wrap func(any) any, depth int) {
+		if depth > exampleMaxDepth {
+			return
+		}
+		props := g.exampleProperties(s)
+		for _, name := range sortedKeys(props) {
+			ps := props[name]
+			if ps == nil || ps.Ref != "" { // components are checked on their own
+				continue
+			}
+			inner := func(v any) any { return wrap(map[string]any{name: v}) }
+			for _, v := range exampleList(ps) {
+				check(subject+"."+name, full, inner(v))
+			}
+			// inline objects become nested messages with their own properties
+			if ps.Type == "array" && ps.Items != nil {
+				if ps.Items.Ref == "" {
+					walk(ps.Items, subject+"."+name, full, func(v any) any { return inner([]any{v}) }, depth+1)
+				}
+				continue
+			}
+			walk(ps, subject+"."+name, full, inner, depth+1)
+		}
+	}
+	messages := g.exampleMessages()
+	for _, key := range sortedKeys(g.doc.Components.Schemas) {
+		full, ok := messages[g.componentName(key)]
+		s := g.resolveRef(g.doc.Components.Schemas[key])
+		if !ok || s == nil {
+			continue
+		}
+		subject := c.messages[full].name
+		for _, v := range exampleList(s) {
+			check(subject, full, v)
+		}
+		walk(s, subject, full, func(v any) any { return v }, 0)
+	}
+	return checked, failed
+}
+
+// exampleList returns the `example` and `examples` values of a schema.
+func exampleList(s *Schema) []any {
+	var values []any
+	if s.Example != nil {
+		values = append(values, s.Example)
+	}
+	return append(values, s.Examples...)
+}
+
+// exampleConverter maps JSON example values onto the messages of the
+// generated files, read back from their source like the descriptor output:
+// fields are matched by json_name or name, as a proto3 JSON parser does.
+type exampleConverter struct {
+	// messages / enums are the generated types by full name (".pkg.Msg")
+	messages map[string]*protoMessage
+	enums    map[string]*protoEnum
+	// types resolves type references of the files like the descriptor output
+	types *descriptorWriter
+	// enumValues maps the spec values of every enum to its value names,
+	// which is all the generated file keeps of them
+	enumValues map[string]map[string]string
+}
+
+// add indexes the types of a generated file; g is the context it was
+// rendered with.
+func (c *exampleConverter) add(src string, g *genContext) error {
+	ast, err := parseProto(src)
+	if err != nil {
+		return fmt.Errorf("解析生成结果失败: %w", err)
+	}
+	scope := protoScope(ast.pkg)
+	c.index(scope, ast.messages, ast.enums)
+	for _, e := range g.manifestEnums {
+		values := map[string]string{}
+		for _, v := range e.Values {
+			values[v.Value] = v.Name
+		}
+		c.enumValues[scope+"."+e.Enum] = values
+	}
+	return nil
+}
+
+func (c *exampleConverter) index(scope string, msgs []*protoMessage, enums []*protoEnum) {
+	for _, m := range msgs {
+		c.messages[scope+"."+m.name] = m
+		c.types.types[scope+"."+m.name] = "TYPE_MESSAGE"
+		c.index(scope+"."+m.name, m.messages, m.enums)
+	}
+	for _, e := range enums {
+		c.enums[scope+"."+e.name] = e
+		c.types.types[scope+"."+e.name] = "TYPE_ENUM"
+	}
+}
+
+// fieldType returns the kind of a field ("repeated", "map" or "") and its
+// (value) type: a scalar name or the full name of a message / enum.
+func (c *exampleConverter) fieldType(scope string, f *protoField) (kind, typ string) {
+	switch {
+	case f.keyType != "":
+		return "map", c.resolve(scope, f.valType)
+	case f.label == "repeated":
+		return "repeated", c.resolve(scope, f.typ)
+	}
+	return "", c.resolve(scope, f.typ)
+}
+
+func (c *exampleConverter) resolve(scope, typ string) string {
+	if _, full := c.types.resolveType(scope, typ); full != "" {
+		return full
+	}
+	return typ
+}
+
+// fieldJSONName is the json_name of a field: the explicit option, else
+// protoc's default.
+func fieldJSONName(f *protoField) string {
+	for _, o := range f.options {
+		if o.name == "json_name" {
+			if name, err := strconv.Unquote(o.value); err == nil {
+				return name
+			}
+		}
+	}
+	return protoJSONName(f.name)
+}
+
+type exampleMember struct {
+	field *protoField
+	value any
+}
+
+// members matches a JSON value to the fields of a message: object members by
+// json_name or field name; otherwise a map / Struct `entries` field takes the
+// whole object and a oneof the first branch accepting the whole value.
+func (c *exampleConverter) members(v any, full string) ([]exampleMember, error) {
+	m := c.messages[full]
+	obj, isObj := v.(map[string]any)
+	known := map[string]bool{}
+	var entries *protoField
+	plain := 0
+	for _, f := range m.fields {
+		known[f.name], known[fieldJSONName(f)] = true, true
+		if f.oneof == "" {
+			plain++
+			if f.name == "entries" {
+				entries = f
+			}
+		}
+	}
+	unknown := ""
+	for _, k := range sortedKeys(obj) {
+		if !known[k] {
+			unknown = k
+			break
+		}
+	}
+	var out []exampleMember
+	switch {
+	case isObj && unknown == "":
+		for _, f := range m.fields {
+			if pv, ok := obj[fieldJSONName(f)]; ok {
+				out = append(out, exampleMember{f, pv})
+			} else if pv, ok := obj[f.name]; ok {
+				out = append(out, exampleMember{f, pv})
+			}
+		}
+	case isObj && entries != nil && plain == 1:
+		if entries.label != "repeated" {
+			return []exampleMember{{entries, obj}}, nil
+		}
+		// -map=entries: one {key, value} message per entry
+		var list []any
+		for _, k := range sortedKeys(obj) {
+			list = append(list, map[string]any{"key": k, "value": obj[k]})
+		}
+		out = append(out, exampleMember{entries, list})
+	case plain == 0 && len(m.oneofs) > 0:
+		for _, o := range m.oneofs {
+			for _, f := range m.fields {
+				if f.oneof != o {
+					continue
+				}
+				kind, t := c.fieldType(full, f)
+				if _, err := c.jsonValue(v, kind, t); err == nil {
+					out = append(out, exampleMember{f, v})
+					break
+				}
+			}
+		}
+		if len(out) == 0 {
+			return nil, fmt.Errorf("%s: no oneof branch accepts %s", m.name, literal(v))
+		}
+	case isObj:
+		return nil, fmt.Errorf("%s: unknown property %q", m.name, unknown)
+	default:
+		return nil, fmt.Errorf("%s: expected an object, got %s", m.name, literal(v))
+	}
+	return out, nil
+}
+
+// scalarValue checks a JSON value against a scalar proto type and returns it
+// normalized (numbers as float64).
+func scalarValue(v any, t string) (any, bool, error) {
+	switch {
+	case t == "string" || t == "bytes":
+		s, ok := v.(string)
+		if !ok {
+			return nil, true, fmt.Errorf("expected %s, got %s", t, literal(v))
+		}
+		return s, true, nil
+	case t == "bool":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, true, fmt.Errorf("expected bool, got %s", literal(v))
+		}
+		return b, true, nil
+	case isIntegerType(t) || t == "double" || t == "float":
+		n, ok := numberValue(v)
+		if !ok {
+			return nil, true, fmt.Errorf("expected %s, got %s", t, literal(v))
+		}
+		if isIntegerType(t) && n != float64(int64(n)) {
+			return nil, true, fmt.Errorf("expected %s (an integer), got %s", t, literal(v))
+		}
+		return n, true, nil
+	}
+	return nil, false, nil
+}
+
+// enumName maps an example value to an enum value name: the spec value the
+// name was generated from, or the name itself (as in proto3 JSON).
+func (c *exampleConverter) enumName(v any, full string) (string, error) {
+	e := c.enums[full]
+	want := fmt.Sprint(v)
+	alias := c.enumValues[full][want]
+	for _, ev := range e.values {
+		if ev.name == alias || ev.name == want {
+			return ev.name, nil
+		}
+	}
+	return "", fmt.Errorf("%s has no value %s", e.name, literal(v))
+}
+
+// jsonValue converts a value of the given field kind and type to proto3 JSON.
+func (c *exampleConverter) jsonValue(v any, kind, t string) (any, error) {
+	switch kind {
+	case "repeated":
+		list, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected an array, got %s", literal(v))
+		}
+		out := make([]any, 0, len(list))
+		for _, item := range list {
+			jv, err := c.jsonValue(item, "", t)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, jv)
+		}
+		return out, nil
+	case "map":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected an object, got %s", literal(v))
+		}
+		var out jsonObject
+		for _, k := range sortedKeys(obj) {
+			jv, err := c.jsonValue(obj[k], "", t)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, jsonMember{k, jv})
+		}
+		return out, nil
+	}
+	if v == nil {
+		return nil, nil
+	}
+	if sv, ok, err := scalarValue(v, t); ok {
+		if err != nil {
+			return nil, err
+		}
+		if n, isNum := sv.(float64); isNum && (t == "int64" || t == "uint64" || t == "sint64" || t == "fixed64" || t == "sfixed64") {
+			return formatNumber(n), nil // 64-bit integers are JSON strings
+		}
+		return sv, nil
+	}
+	switch t {
+	case ".google.protobuf.Value":
+		return v, nil
+	case ".google.protobuf.Struct":
+		if _, ok := v.(map[string]any); !ok {
+			return nil, fmt.Errorf("expected an object for %s, got %s", t[1:], literal(v))
+		}
+		return v, nil
+	case ".google.protobuf.ListValue":
+		if _, ok := v.([]any); !ok {
+			return nil, fmt.Errorf("expected an array for %s, got %s", t[1:], literal(v))
+		}
+		return v, nil
+	}
+	if _, ok := c.enums[t]; ok {
+		return c.enumName(v, t)
+	}
+	if _, ok := c.messages[t]; ok {
+		return c.jsonMessage(v, t)
+	}
+	return nil, fmt.Errorf("unsupported field type %s", strings.TrimPrefix(t, "."))
+}
+
+func (c *exampleConverter) jsonMessage(v any, full string) (any, error) {
+	members, err := c.members(v, full)
+	if err != nil {
+		return nil, err
+	}
+	out := jsonObject{}
+	for _, mem := range members {
+		if mem.value == nil {
+			continue
+		}
+		kind, t := c.fieldType(full, mem.field)
+		jv, err := c.jsonValue(mem.value, kind, t)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", c.messages[full].name, mem.field.name, err)
+		}
+		out = append(out, jsonMember{fieldJSONName(mem.field), jv})
+	}
+	return out, nil
+}
+
+// textFields writes the textproto fields of a message value.
+func (c *exampleConverter) textFields(b *strings.Builder, indent string, v any, full string) error {
+	members, err := c.members(v, full)
+	if err != nil {
+		return err
+	}
+	for _, mem := range members {
+		if mem.value == nil {
+			continue
+		}
+		kind, t := c.fieldType(full, mem.field)
+		if err := c.textField(b, indent, mem.field.name, mem.value, kind, t); err != nil {
+			return fmt.Errorf("%s.%s: %w", c.messages[full].name, mem.field.name, err)
+		}
+	}
+	return nil
+}
+
+// textField writes one field; repeated fields repeat the field name.
+func (c *exampleConverter) textField(b *strings.Builder, indent, name string, v any, kind, t string) error {
+	switch kind {
+	case "repeated":
+		list, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("expected an array, got %s", literal(v))
+		}
+		for _, item := range list {
+			if err := c.textField(b, indent, name, item, "", t); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "map":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("expected an object, got %s", literal(v))
+		}
+		for _, k := range sortedKeys(obj) {
+			fmt.Fprintf(b, "%s%s {\n%s  key: %s\n", indent, name, indent, textQuote(k))
+			if err := c.textField(b, indent+"  ", "value", obj[k], "", t); err != nil {
+				return err
+			}
+			fmt.Fprintf(b, "%s}\n", indent)
+		}
+		return nil
+	}
+	if v == nil {
+		return nil
+	}
+	if sv, ok, err := scalarValue(v, t); ok {
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "%s%s: %s\n", indent, name, textScalar(sv, t))
+		return nil
+	}
+	switch t {
+	case ".google.protobuf.Value", ".google.protobuf.Struct", ".google.protobuf.ListValue":
+		if _, err := c.jsonValue(v, "", t); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "%s%s {\n", indent, name)
+		switch t {
+		case ".google.protobuf.Struct":
+			textStructFields(b, indent+"  ", v.(map[string]any))
+		case ".google.protobuf.ListValue":
+			textListValues(b, indent+"  ", v.([]any))
+		default:
+			textValue(b, indent+"  ", v)
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+		return nil
+	}
+	if _, ok := c.enums[t]; ok {
+		n, err := c.enumName(v, t)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "%s%s: %s\n", indent, name, n)
+		return nil
+	}
+	if _, ok := c.messages[t]; ok {
+		fmt.Fprintf(b, "%s%s {\n", indent, name)
+		if err := c.textFields(b, indent+"  ", v, t); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+		return nil
+	}
+	return fmt.Errorf("unsupported field type %s", strings.TrimPrefix(t, "."))
+}
+
+func textScalar(v any, t string) string {
+	switch x := v.(type) {
+	case string:
+		return textQuote(x)
+	case bool:
+		return strconv.FormatBool(x)
+	case float64:
+		if isIntegerType(t) {
+			return formatNumber(x)
+		}
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// textValue writes the body of a google.protobuf.Value.
+func textValue(b *strings.Builder, indent string, v any) {
+	switch x := v.(type) {
+	case nil:
+		fmt.Fprintf(b, "%snull_value: NULL_VALUE\n", indent)
+	case bool:
+		fmt.Fprintf(b, "%sbool_value: %t\n", indent, x)
+	case string:
+		fmt.Fprintf(b, "%sstring_value: %s\n", indent, textQuote(x))
+	case map[string]any:
+		fmt.Fprintf(b, "%sstruct_value {\n", indent)
+		textStructFields(b, indent+"  ", x)
+		fmt.Fprintf(b, "%s}\n", indent)
+	case []any:
+		fmt.Fprintf(b, "%slist_value {\n", indent)
+		textListValues(b, indent+"  ", x)
+		fmt.Fprintf(b, "%s}\n", indent)
+	default:
+		if n, ok := numberValue(v); ok {
+			fmt.Fprintf(b, "%snumber_value: %s\n", indent, strconv.FormatFloat(n, 'g', -1, 64))
+		}
+	}
+}
+
+func textStructFields(b *strings.Builder, indent string, obj map[string]any) {
+	for _, k := range sortedKeys(obj) {
+		fmt.Fprintf(b, "%sfields {\n%s  key: %s\n%s  value {\n", indent, indent, textQuote(k), indent)
+		textValue(b, indent+"    ", obj[k])
+		fmt.Fprintf(b, "%s  }\n%s}\n", indent, indent)
+	}
+}
+
+func textListValues(b *strings.Builder, indent string, list []any) {
+	for _, item := range list {
+		fmt.Fprintf(b, "%svalues {\n", indent)
+		textValue(b, indent+"  ", item)
+		fmt.Fprintf(b, "%s}\n", indent)
+	}
+}
+
+// jsonObject is a JSON object that keeps its member order (field order).
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	key   string
+	value any
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
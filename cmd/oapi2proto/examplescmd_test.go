@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const examplesSpec = `
+openapi: 3.0.0
+info: {title: Pets, version: "1"}
+paths: {}
+components:
+  schemas:
+    PetDto:
+      type: object
+      properties:
+        tag: {type: array, items: {type: string}}
+        kind: {type: string, enum: [cat, dog]}
+        ownerId: {type: integer, format: int64}
+      example: {tag: [a], kind: cat, ownerId: 7}
+`
+
+// writeSpecExamples runs the examples subcommand on an in-memory spec with
+// the given generation flags and returns the written files by name.
+func writeSpecExamples(t *testing.T, args []string, format, spec string) map[string]string {
+	t.Helper()
+	fs := flag.NewFlagSet("examples", flag.ContinueOnError)
+	gen := registerGenFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := gen.options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.format = formatProto
+	opts.manifest = &manifest{}
+	opts.diags = &diagnostics{}
+	doc := loadSpec(t, opts, "pets.yaml", spec)
+	dir := t.TempDir()
+	c, rendered, err := opts.exampleFiles(doc, opts.packageFor(doc, "pets.yaml"), filepath.Join(dir, "pets.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range rendered {
+		if len(g.errors) > 0 {
+			t.Fatal(g.errors)
+		}
+		if err := g.writeExamples(c, dir, format); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, d := range opts.diags.entries {
+		if d.Kind == "example" {
+			t.Errorf("%s: %s", d.Subject, d.Message)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = string(data)
+	}
+	return files
+}
+
+// TestExamplesGenerationFlags checks that the examples follow the names the
+// generation flags give the messages, fields and enum values.
+func TestExamplesGenerationFlags(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		format string
+		file   string
+		want   []string
+	}{
+		{"defaults", nil, examplesTextproto, "PetDto.txtpb", []string{
+			"# proto-message: api.v1.PetDto\n", "kind: PETDTOKIND_CAT\n", "owner_id: 7\n", "tag: \"a\"\n",
+		}},
+		{"strip suffix", []string{"-strip-suffix", "Dto"}, examplesTextproto, "Pet.txtpb", []string{
+			"# proto-message: api.v1.Pet\n", "kind: PETKIND_CAT\n",
+		}},
+		{"buf style, plural fields", []string{"-style", "buf", "-plural-fields", "rename", "-strip-suffix", "Dto"}, examplesTextproto, "Pet.txtpb", []string{
+			"kind: PET_KIND_CAT\n", "tags: \"a\"\n",
+		}},
+		{"package from info", []string{"-pkg-from", "info"}, examplesTextproto, "PetDto.txtpb", []string{
+			"# proto-message: pets.v1.PetDto\n",
+		}},
+		{"json keeps json_name", []string{"-plural-fields", "rename"}, examplesJSON, "PetDto.json", []string{
+			`"tag": [`, `"kind": "PETDTOKIND_CAT"`, `"ownerId": "7"`,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			files := writeSpecExamples(t, tc.args, tc.format, examplesSpec)
+			got, ok := files[tc.file]
+			if !ok {
+				t.Fatalf("no %s in %v", tc.file, files)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("missing %q in\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+const richExamplesSpec = `
+openapi: 3.0.0
+info: {title: Rich, version: "1"}
+paths: {}
+components:
+  schemas:
+    Color:
+      type: string
+      enum: [red, green]
+      x-proto-package: shared.v1
+    Cat:
+      type: object
+      properties:
+        meow: {type: boolean}
+    Dog:
+      type: object
+      properties:
+        bark: {type: string}
+    Animal:
+      oneOf:
+        - $ref: '#/components/schemas/Cat'
+        - $ref: '#/components/schemas/Dog'
+      example: {bark: woof}
+    Labels:
+      type: object
+      additionalProperties: {type: string}
+      example: {a: x}
+    Owner:
+      type: object
+      properties:
+        color: {$ref: '#/components/schemas/Color'}
+        pets:
+          type: array
+          items:
+            type: object
+            properties:
+              nick: {type: string, example: rex}
+        display_name: {type: string}
+      example: {color: green, pets: [{nick: rex}], display_name: Ann}
+`
+
+// TestExamplesDescriptors checks the conversion through the descriptors of
+// the generated files: oneof branches, map entries and types of sibling
+// files.
+func TestExamplesDescriptors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		format string
+		file   string
+		want   []string
+	}{
+		{"oneof branch", nil, examplesTextproto, "Animal.txtpb", []string{"dog {\n  bark: \"woof\"\n}\n"}},
+		{"map", nil, examplesTextproto, "Labels.txtpb", []string{"entries {\n  key: \"a\"\n  value: \"x\"\n}\n"}},
+		{"map entries", []string{"-map", "entries"}, examplesJSON, "Labels.json", []string{`"entries": [`, `"key": "a"`}},
+		{"sibling package enum", nil, examplesTextproto, "Owner.txtpb", []string{"color: COLOR_GREEN\n", "display_name: \"Ann\"\n", "pets {\n  nick: \"rex\"\n}\n"}},
+		{"json names", nil, examplesJSON, "Owner.json", []string{`"color": "COLOR_GREEN"`, `"displayName": "Ann"`}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			files := writeSpecExamples(t, tc.args, tc.format, richExamplesSpec)
+			got, ok := files[tc.file]
+			if !ok {
+				t.Fatalf("no %s in %v", tc.file, files)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("missing %q in\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckExamples(t *testing.T) {
+	for _, tc := range []struct {
+		name, edit, subject string
+	}{
+		{"valid", "", ""},
+		{"unknown property", "display_name: Ann}", "Owner"},
+		{"wrong property example", "nick: {type: string, example: rex}", "Owner.pets.nick"},
+		{"unknown enum value", "color: green", "Owner"},
+		{"no oneof branch", "example: {bark: woof}", "Animal"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := richExamplesSpec
+			if tc.edit != "" {
+				bad := map[string]string{
+					"display_name: Ann}":                 "display_name: Ann, nickname: x}",
+					"nick: {type: string, example: rex}": "nick: {type: string, example: 3}",
+					"color: green":                       "color: blue",
+					"example: {bark: woof}":              "example: 42",
+				}[tc.edit]
+				spec = strings.Replace(spec, tc.edit, bad, 1)
+			}
+			opts := testOptions(t)
+			opts.manifest = &manifest{}
+			opts.diags = &diagnostics{}
+			doc := loadSpec(t, opts, "rich.yaml", spec)
+			c, files, err := opts.exampleFiles(doc, opts.pkg, filepath.Join(t.TempDir(), "rich.proto"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checked, failed := 0, 0
+			for _, g := range files {
+				n, bad := g.checkExamples(c)
+				checked, failed = checked+n, failed+bad
+			}
+			if checked != 4 {
+				t.Errorf("checked %d examples, want 4", checked)
+			}
+			var subjects []string
+			for _, d := range opts.diags.entries {
+				subjects = append(subjects, d.Subject)
+			}
+			if tc.subject == "" {
+				if failed != 0 {
+					t.Errorf("%d failures: %v", failed, opts.diags.entries)
+				}
+				return
+			}
+			if failed != 1 || len(subjects) != 1 || subjects[0] != tc.subject {
+				t.Errorf("failed = %d, subjects = %v, want 1 failure of %s", failed, subjects, tc.subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// refBundler imports the schemas behind $refs into other files (relative
+// paths, URLs, archive members) as components and rewrites the refs to
+// local ones, so the rest of the pipeline only sees a single document.
+type refBundler struct {
+	doc      *Document
+	root     string
+	read     func(string) ([]byte, error)
+	nodes    map[string]*yaml.Node // spec path -> parsed file
+	names    map[string]string     // spec path + "#" + pointer -> component
+	displays map[string]string     // spec path -> origin prefix (relative to the root)
+	seen     map[*Schema]bool
+}
+
+// bundleExternalRefs 将指向其他文件 (相对路径 / URL / 归档成员) 的 $ref 导入为组件并改写为本地引用
+func bundleExternalRefs(doc *Document, root string, read func(string) ([]byte, error)) {
+	b := &refBundler{doc: doc, root: root, read: read, nodes: map[string]*yaml.Node{}, names: map[string]string{},
+		displays: map[string]string{root: inputBase(root)}, seen: map[*Schema]bool{}}
+	if doc.Components.Schemas == nil {
+		doc.Components.Schemas = map[string]*Schema{}
+	}
+	var roots []*Schema
+	walkSchemas(doc, func(s *Schema) { roots = append(roots, s) })
+	for _, s := range roots {
+		b.visit(s, root)
+	}
+	for file, display := range b.displays {
+		if file != root {
+			if doc.files == nil {
+				doc.files = map[string]string{}
+			}
+			doc.files[display] = file
+		}
+	}
+}
+
+// visit rewrites the refs of s and its subschemas, which were read from file.
+// $defs of imported schemas are dropped: refs into them are imported on
+// their own.
+func (b *refBundler) visit(s *Schema, file string) {
+	if s == nil || b.seen[s] {
+		return
+	}
+	b.seen[s] = true
+	if s.Ref != "" {
+		s.Ref = b.rewrite(s.Ref, file)
+	}
+	for _, p := range s.Properties {
+		b.visit(p, file)
+	}
+	b.visit(s.Items, file)
+	b.visit(s.AddlProps, file)
+	b.visit(s.UnevaluatedProps, file)
+	for _, p := range s.PatternProperties {
+		b.visit(p, file)
+	}
+	for _, list := range [][]*Schema{s.AllOf, s.OneOf, s.AnyOf, s.PrefixItems} {
+		for _, c := range list {
+			b.visit(c, file)
+		}
+	}
+	for _, defs := range []map[string]*Schema{s.Defs, s.Definitions} {
+		for _, d := range defs {
+			b.visit(d, file)
+		}
+	}
+	if file != b.root {
+		s.Defs, s.Definitions = nil, nil
+	}
+}
+
+// rewrite returns the local ref replacing ref. Refs that cannot be resolved
+// are kept (with a warning) and fall back to the lookup by last segment.
+func (b *refBundler) rewrite(ref, file string) string {
+	filePart, ptr, _ := strings.Cut(ref, "#")
+	target := file
+	if filePart != "" {
+		var err error
+		if target, err = resolveSpecPath(file, filePart); err != nil {
+			b.doc.warn("external-ref", ref, err.Error()+"; ref kept")
+			return ref
+		}
+		if _, ok := b.displays[target]; !ok {
+			b.displays[target] = displayPath(b.displays[file], filePart, target)
+		}
+	}
+	if target == b.root {
+		return "#" + ptr
+	}
+	key := target + "#" + ptr
+	if name, ok := b.names[key]; ok {
+		return componentSchemasPrefix + escapePointer(name)
+	}
+	if ptr != "" && !strings.HasPrefix(ptr, "/") {
+		b.doc.warn("external-ref", ref, "only JSON pointer fragments can be resolved in other files; ref kept")
+		return ref
+	}
+	node, err := b.node(target)
+	if err != nil {
+		b.doc.warn("external-ref", ref, err.Error()+"; ref kept")
+		return ref
+	}
+	n, _ := pointerNode(node, ptr)
+	if n == nil {
+		b.doc.warn("external-ref", ref, fmt.Sprintf("%s not found in %s; ref kept", ptr, b.displays[target]))
+		return ref
+	}
+	s := &Schema{}
+	if err := n.Decode(s); err != nil {
+		b.doc.warn("external-ref", ref, fmt.Sprintf("%s: %v; ref kept", b.displays[target], err))
+		return ref
+	}
+	name := b.componentName(ref, ptr, target, s)
+	b.names[key] = name
+	if b.doc.Components.Schemas[name] == nil {
+		setOrigin(s, b.displays[target]+"#"+ptr)
+		b.doc.Components.Schemas[name] = s
+		b.visit(s, target)
+	}
+	return componentSchemasPrefix + escapePointer(name)
+}
+
+// componentName names an imported schema after the last pointer segment (or
+// the file name). A taken name is reused for an identical schema and
+// numbered otherwise.
+func (b *refBundler) componentName(ref, ptr, target string, s *Schema) string {
+	base := unescapePointer(ptr[strings.LastIndex(ptr, "/")+1:])
+	if base == "" {
+		base = strings.TrimSuffix(path.Base(b.displays[target]), path.Ext(b.displays[target]))
+	}
+	name := base
+	for n := 2; ; n++ {
+		existing := b.doc.Components.Schemas[name]
+		if existing == nil || literal(existing) == literal(s) {
+			break
+		}
+		name = base + strconv.Itoa(n)
+	}
+	if name != base {
+		b.doc.warn("external-ref", ref, fmt.Sprintf("schema %s is already defined; imported as %s", base, name))
+	}
+	return name
+}
+
+// node parses (once) a referenced spec file.
+func (b *refBundler) node(file string) (*yaml.Node, error) {
+	if n, ok := b.nodes[file]; ok {
+		return n, nil
+	}
+	data, err := b.read(file)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", b.displays[file], err)
+	}
+	if len(root.Content) == 0 {
+		return nil, fmt.Errorf("%s is empty", b.displays[file])
+	}
+	b.nodes[file] = root.Content[0]
+	return root.Content[0], nil
+}
+
+// resolveSpecPath resolves the file part of a $ref against the spec
+// containing it: a member of the same archive, a file of the same git ref, a
+// URL relative to the spec URL, or a local path.
+func resolveSpecPath(base, rel string) (string, error) {
+	if strings.HasPrefix(rel, "http://") || strings.HasPrefix(rel, "https://") {
+		return rel, nil
+	}
+	if archive, member, ok := splitArchivePath(base); ok {
+		joined := path.Join(path.Dir(member), rel)
+		if path.IsAbs(rel) || joined == ".." || strings.HasPrefix(joined, "../") {
+			return "", fmt.Errorf("%s points outside of %s", rel, archive)
+		}
+		return archive + "//" + joined, nil
+	}
+	if g, err := parseGitSpec(base); err == nil {
+		joined := path.Join(path.Dir(g.path), rel)
+		if path.IsAbs(rel) || joined == ".." || strings.HasPrefix(joined, "../") {
+			return "", fmt.Errorf("%s points outside of the repository", rel)
+		}
+		return fmt.Sprintf("git+%s//%s@%s", g.repo, joined, g.ref), nil
+	}
+	if isRemoteSpec(base) {
+		u, err := url.Parse(base)
+		if err != nil {
+			return "", err
+		}
+		r, err := url.Parse(rel)
+		if err != nil {
+			return "", err
+		}
+		// a remote spec may only point at other http(s) URLs, not at git+
+		// refs, archives on other schemes or local files
+		resolved := u.ResolveReference(r)
+		if resolved.Scheme != "http" && resolved.Scheme != "https" {
+			return "", fmt.Errorf("%s: remote spec %s may only reference http(s) URLs", rel, base)
+		}
+		return resolved.String(), nil
+	}
+	if filepath.IsAbs(rel) {
+		return rel, nil
+	}
+	return filepath.Join(filepath.Dir(base), filepath.FromSlash(rel)), nil
+}
+
+// displayPath is the origin prefix of a referenced file: its path relative
+// to the root spec, or the URL when it leaves the root's location.
+func displayPath(from, rel, target string) string {
+	if strings.HasPrefix(rel, "http://") || strings.HasPrefix(rel, "https://") || path.IsAbs(rel) || filepath.IsAbs(rel) {
+		return target
+	}
+	return path.Join(path.Dir(from), rel)
+}
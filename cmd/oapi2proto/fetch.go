@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// isRemoteSpec reports whether an input is an http(s) URL or a git+ reference.
+func isRemoteSpec(p string) bool {
+	return strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://") || isGitSpec(p)
+}
+
+// inputBase is the file name of an input path or URL (query and fragment
+// dropped; the member for archive inputs), used for origins and derived
+// names.
+func inputBase(p string) string {
+	if archive, member, ok := splitArchivePath(p); ok {
+		if member != "" {
+			return path.Base(member)
+		}
+		p = archive
+	}
+	if ref, err := parseGitSpec(p); err == nil {
+		return path.Base(ref.path)
+	}
+	if isRemoteSpec(p) {
+		if u, err := url.Parse(p); err == nil {
+			if b := path.Base(u.Path); b != "/" && b != "." {
+				return b
+			}
+			return u.Host
+		}
+	}
+	return filepath.Base(p)
+}
+
+// httpFetcher downloads remote specs through an on-disk cache. Cached
+// responses are revalidated with ETag / Last-Modified; -offline only reads
+// the cache.
+type httpFetcher struct {
+	dir     string
+	offline bool
+	client  *http.Client
+	conn    httpClientOptions // also passed to git for git+ inputs
+}
+
+// cacheMeta is stored next to each cached body.
+type cacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// httpClientOptions configures the connection of remote fetches.
+type httpClientOptions struct {
+	proxy   string        // proxy URL; empty uses HTTPS_PROXY / HTTP_PROXY / NO_PROXY
+	caFile  string        // extra PEM CA bundle, added to the system roots
+	cert    string        // client certificate (PEM)
+	key     string        // client key (PEM)
+	timeout time.Duration // per request; 0 disables
+}
+
+// newHTTPClient 按代理 / CA / 客户端证书 / 超时设置创建 http client
+func newHTTPClient(o httpClientOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.proxy != "" {
+		u, err := url.Parse(o.proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("-http-proxy %q 不是有效的 URL", o.proxy)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.caFile != "" {
+		pem, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("-http-ca: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("-http-ca: %s 中没有 PEM 证书", o.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (o.cert == "") != (o.key == "") {
+		return nil, errors.New("-http-cert 与 -http-key 需同时指定")
+	}
+	if o.cert != "" {
+		pair, err := tls.LoadX509KeyPair(o.cert, o.key)
+		if err != nil {
+			return nil, fmt.Errorf("-http-cert / -http-key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: o.timeout}, nil
+}
+
+// newHTTPFetcher 创建远程 spec 下载器; dir 为空时使用用户缓存目录下的 oapi2proto/http
+func newHTTPFetcher(dir string, offline bool, conn httpClientOptions) (*httpFetcher, error) {
+	client, err := newHTTPClient(conn)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		if base, err := os.UserCacheDir(); err == nil {
+			dir = filepath.Join(base, "oapi2proto", "http")
+		} else {
+			dir = filepath.Join(os.TempDir(), "oapi2proto-http")
+		}
+	}
+	return &httpFetcher{dir: dir, offline: offline, client: client, conn: conn}, nil
+}
+
+func (f *httpFetcher) paths(rawURL string) (body, meta string) {
+	sum := sha256.Sum256([]byte(rawURL))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(f.dir, key+".body"), filepath.Join(f.dir, key+".json")
+}
+
+// cached returns the cached body and metadata of a URL, if any.
+func (f *httpFetcher) cached(rawURL string) ([]byte, *cacheMeta) {
+	bodyPath, metaPath := f.paths(rawURL)
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, nil
+	}
+	meta := &cacheMeta{}
+	if data, err := os.ReadFile(metaPath); err == nil {
+		json.Unmarshal(data, meta)
+	}
+	return body, meta
+}
+
+// fetch returns the content of a URL. A failed request falls back to the
+// cached copy (with a warning) so flaky registries do not break builds.
+func (f *httpFetcher) fetch(rawURL string) ([]byte, error) {
+	body, meta := f.cached(rawURL)
+	if f.offline {
+		if body == nil {
+			return nil, fmt.Errorf("-offline: 缓存 %s 中没有 %s", f.dir, rawURL)
+		}
+		return body, nil
+	}
+	data, err := f.request(rawURL, body, meta)
+	if err != nil && body != nil {
+		fmt.Fprintf(os.Stderr, "[WARN] %s: %v; 使用 %s 的缓存副本\n", rawURL, err, meta.Fetched.Format(time.RFC3339))
+		return body, nil
+	}
+	return data, err
+}
+
+func (f *httpFetcher) request(rawURL string, body []byte, meta *cacheMeta) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && body != nil:
+		return body, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.store(rawURL, data, resp.Header); err != nil {
+		fmt.Fprintf(os.Stderr, "[WARN] 缓存 %s 失败: %v\n", rawURL, err)
+	}
+	return data, nil
+}
+
+// store writes the body and its validators to the cache directory.
+func (f *httpFetcher) store(rawURL string, data []byte, h http.Header) error {
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+	bodyPath, metaPath := f.paths(rawURL)
+	meta, err := json.MarshalIndent(cacheMeta{URL: rawURL, ETag: h.Get("ETag"), LastModified: h.Get("Last-Modified"), Fetched: time.Now().UTC()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(bodyPath, data); err != nil {
+		return err
+	}
+	return writeFileAtomic(metaPath, append(meta, '\n'))
+}
+
+// readSpec 读取本地文件、归档成员或 (经缓存) 下载远程 spec
+func (o *genOptions) readSpec(p string) ([]byte, error) {
+	if isArchiveSpec(p) {
+		return o.readArchiveMember(p)
+	}
+	return o.readFile(p)
+}
+
+// readFile reads a local file or fetches a remote one.
+func (o *genOptions) readFile(p string) ([]byte, error) {
+	if !isRemoteSpec(p) {
+		return os.ReadFile(p)
+	}
+	if o.fetcher == nil {
+		return nil, errors.New("远程输入未启用")
+	}
+	if isGitSpec(p) {
+		return o.fetcher.fetchGit(p)
+	}
+	return o.fetcher.fetch(p)
+}
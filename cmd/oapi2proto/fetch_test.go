@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// specServer serves files by path with an ETag per version and a fixed
+// Last-Modified, honoring If-None-Match, and records the requests it saw.
+type specServer struct {
+	mu       sync.Mutex
+	files    map[string]string
+	version  int
+	requests []string // "<path> <If-None-Match> <If-Modified-Since>"
+}
+
+const specModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+func (s *specServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.URL.Path+" "+r.Header.Get("If-None-Match")+" "+r.Header.Get("If-Modified-Since"))
+	body, ok := s.files[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	etag := `"v` + strconv.Itoa(s.version) + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", specModified)
+	w.Write([]byte(body))
+}
+
+func (s *specServer) seen() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := s.requests
+	s.requests = nil
+	return seen
+}
+
+func TestHTTPCache(t *testing.T) {
+	srv := &specServer{files: map[string]string{"/pets.yaml": "v0"}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	dir := t.TempDir()
+	online, err := newHTTPFetcher(dir, false, httpClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline, err := newHTTPFetcher(dir, true, httpClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := ts.URL + "/pets.yaml"
+	for _, step := range []struct {
+		name     string
+		before   func()
+		fetcher  *httpFetcher
+		url      string
+		want     string
+		err      string
+		requests []string
+	}{
+		{"first fetch", nil, online, url, "v0", "", []string{"/pets.yaml  "}},
+		{"revalidated", nil, online, url, "v0", "", []string{`/pets.yaml "v0" ` + specModified}},
+		{"changed", func() { srv.files["/pets.yaml"], srv.version = "v1", 1 }, online, url, "v1", "", []string{`/pets.yaml "v0" ` + specModified}},
+		{"offline", func() { srv.files["/pets.yaml"] = "v2" }, offline, url, "v1", "", nil},
+		{"offline miss", nil, offline, ts.URL + "/other.yaml", "", "-offline", nil},
+		{"registry error falls back to the cache", func() { delete(srv.files, "/pets.yaml") }, online, url, "v1", "", []string{`/pets.yaml "v1" ` + specModified}},
+		{"uncached error", nil, online, ts.URL + "/other.yaml", "", "404", []string{"/other.yaml  "}},
+	} {
+		if step.before != nil {
+			step.before()
+		}
+		data, err := step.fetcher.fetch(step.url)
+		switch {
+		case step.err != "" && (err == nil || !strings.Contains(err.Error(), step.err)):
+			t.Errorf("%s: error %v, want %q", step.name, err, step.err)
+		case step.err == "" && err != nil:
+			t.Errorf("%s: %v", step.name, err)
+		case string(data) != step.want:
+			t.Errorf("%s: got %q, want %q", step.name, data, step.want)
+		}
+		if got := srv.seen(); strings.Join(got, "\n") != strings.Join(step.requests, "\n") {
+			t.Errorf("%s: requests %q, want %q", step.name, got, step.requests)
+		}
+	}
+}
+
+// TestRemoteRefs checks that relative refs of a remote spec are fetched
+// relative to its URL and, once cached, resolve under -offline.
+func TestRemoteRefs(t *testing.T) {
+	srv := &specServer{files: map[string]string{
+		"/specs/pets.yaml": `
+openapi: 3.0.0
+info: {title: Pets, version: "1"}
+paths: {}
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        owner: {$ref: 'common/owner.yaml#/Owner'}
+`,
+		"/specs/common/owner.yaml": `
+Owner:
+  type: object
+  properties:
+    name: {type: string}
+`,
+	}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	dir := t.TempDir()
+	for _, offline := range []bool{false, true} {
+		opts := testOptions(t)
+		fetcher, err := newHTTPFetcher(dir, offline, httpClientOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.fetcher = fetcher
+		doc, err := loadDocument(ts.URL+"/specs/pets.yaml", opts)
+		if err != nil {
+			t.Fatalf("offline=%t: %v", offline, err)
+		}
+		out, ctx := renderFile(&doc, opts, opts.pkg, opts.goPkg, "")
+		if len(ctx.errors) > 0 {
+			t.Fatal(ctx.errors)
+		}
+		if !strings.Contains(out, "message Owner {\n  string name = 1;\n}") {
+			t.Errorf("offline=%t: remote ref not resolved:\n%s", offline, out)
+		}
+		requests := srv.seen()
+		if offline && len(requests) > 0 {
+			t.Errorf("-offline sent requests %q", requests)
+		}
+		if !offline && len(requests) != 2 {
+			t.Errorf("requests %q, want the spec and its ref", requests)
+		}
+	}
+}
+
+// writeClientCert writes a self-signed client certificate and its key as PEM
+// files and returns their paths and the certificate.
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "oapi2proto"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestHTTPClientOptions(t *testing.T) {
+	dir := t.TempDir()
+	srv := &specServer{files: map[string]string{"/pets.yaml": "spec"}}
+	ts := httptest.NewUnstartedServer(srv)
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	for _, tc := range []struct {
+		name       string
+		conn       httpClientOptions
+		url        string
+		want       string
+		clientErr  string // error of newHTTPClient
+		requestErr bool
+	}{
+		{"ca and client certificate", httpClientOptions{caFile: caFile, cert: certFile, key: keyFile}, ts.URL + "/pets.yaml", "spec", "", false},
+		{"unknown authority", httpClientOptions{cert: certFile, key: keyFile}, ts.URL + "/pets.yaml", "", "", true},
+		{"no client certificate", httpClientOptions{caFile: caFile}, ts.URL + "/pets.yaml", "", "", true},
+		{"proxy", httpClientOptions{proxy: proxy.URL}, "http://registry.example/pets.yaml", "via proxy", "", false},
+		{"timeout", httpClientOptions{timeout: 50 * time.Millisecond}, slow.URL, "", "", true},
+		{"bad proxy", httpClientOptions{proxy: "::"}, "", "", "-http-proxy", false},
+		{"missing ca", httpClientOptions{caFile: filepath.Join(dir, "missing.pem")}, "", "", "-http-ca", false},
+		{"ca without certificates", httpClientOptions{caFile: notPEM}, "", "", "没有 PEM 证书", false},
+		{"cert without key", httpClientOptions{cert: certFile}, "", "", "需同时指定", false},
+		{"bad key", httpClientOptions{cert: certFile, key: caFile}, "", "", "-http-cert / -http-key", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := newHTTPFetcher(t.TempDir(), false, tc.conn)
+			if tc.clientErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.clientErr) {
+					t.Errorf("error %v, want %q", err, tc.clientErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := f.fetch(tc.url)
+			if tc.requestErr {
+				if err == nil {
+					t.Errorf("fetched %q, want an error", data)
+				}
+				return
+			}
+			if err != nil || string(data) != tc.want {
+				t.Errorf("got %q, %v; want %q", data, err, tc.want)
+			}
+		})
+	}
+	if len(proxied) != 1 || proxied[0] != "http://registry.example/pets.yaml" {
+		t.Errorf("proxy saw %q", proxied)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// fieldNames assigns the proto field name of every property: config
+// overrides first, then snake_case (pluralized for arrays under
+// -plural-fields=rename). Properties normalizing to the same name
+// (userId / user_id) are disambiguated deterministically: the property already
+// spelled like the field keeps it (else the first in sort order), the others
+// get _2, _3, ... in sort order. Every renamed or colliding property is
+// flagged for an explicit json_name, so the JSON mapping stays intact.
+func (g *genContext) fieldNames(schema, msgName string, props []string, schemas map[string]*Schema) (map[string]string, map[string]bool) {
+	names := make(map[string]string, len(props))
+	jsonName := map[string]bool{}
+	groups := make(map[string][]string, len(props))
+	for _, prop := range props {
+		fname := normalizeField(prop)
+		if renamed, ok := g.config.fieldName(schema, msgName, prop); ok {
+			fname = renamed
+			jsonName[prop] = true
+		} else if plural, ok := g.pluralFieldName(msgName, fname, schemas[prop]); ok {
+			fname = plural
+			jsonName[prop] = true
+		}
+		names[prop] = fname
+		groups[fname] = append(groups[fname], prop)
+	}
+	var collided []string
+	for fname, members := range groups {
+		if len(members) > 1 {
+			collided = append(collided, fname)
+		}
+	}
+	if len(collided) == 0 {
+		return names, jsonName
+	}
+	sort.Strings(collided)
+	taken := make(map[string]bool, len(groups))
+	for fname := range groups {
+		taken[fname] = true
+	}
+	for _, fname := range collided {
+		members := groups[fname]
+		sort.Slice(members, func(i, j int) bool {
+			if (members[i] == fname) != (members[j] == fname) {
+				return members[i] == fname
+			}
+			return members[i] < members[j]
+		})
+		for i, prop := range members {
+			jsonName[prop] = true
+			if i == 0 {
+				continue
+			}
+			n := i + 1
+			for taken[fmt.Sprintf("%s_%d", fname, n)] {
+				n++
+			}
+			names[prop] = fmt.Sprintf("%s_%d", fname, n)
+			taken[names[prop]] = true
+			g.diag(severityWarning, "field-collision", msgName+"."+fname, fmt.Sprintf("property %q normalizes to %q like %q; renamed to %s", prop, fname, members[0], names[prop]))
+		}
+	}
+	return names, jsonName
+}
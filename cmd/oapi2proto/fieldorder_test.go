@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// messageFields lists the field names of message msg in out, in order.
+func messageFields(out, msg string) []string {
+	_, body, ok := strings.Cut(out, "message "+msg+" {\n")
+	if !ok {
+		return nil
+	}
+	body, _, _ = strings.Cut(body, "\n}")
+	var names []string
+	for _, l := range strings.Split(body, "\n") {
+		decl, _, ok := strings.Cut(strings.TrimSpace(l), " = ")
+		if f := strings.Fields(decl); ok && len(f) >= 2 && f[0] != "option" && f[0] != "reserved" {
+			names = append(names, f[len(f)-1])
+		}
+	}
+	return names
+}
+
+func TestDeclarationOrder(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "shared.yaml"), []byte(`
+Audit:
+  type: object
+  properties:
+    zeta: {type: string}
+    alpha: {type: string}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, file, spec string
+		sort, required   bool
+		want             []string
+	}{
+		{"yaml", "order.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [name, id]
+      properties:
+        zebra: {type: string}
+        id: {type: string}
+        apple: {type: string}
+        name: {type: string}
+`, false, false, []string{"zebra", "id", "apple", "name"}},
+		{"json", "order.json", `{"openapi": "3.0.0", "info": {"title": "X", "version": "1"}, "paths": {},
+ "components": {"schemas": {"Pet": {"type": "object", "required": ["name", "id"],
+  "properties": {"zebra": {"type": "string"}, "id": {"type": "string"}, "apple": {"type": "string"}, "name": {"type": "string"}}}}}}`,
+			false, false, []string{"zebra", "id", "apple", "name"}},
+		{"required first keeps declaration order", "order.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [name, id]
+      properties:
+        zebra: {type: string}
+        id: {type: string}
+        apple: {type: string}
+        name: {type: string}
+`, false, true, []string{"id", "name", "zebra", "apple"}},
+		{"required first sorted", "order.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [name, id]
+      properties:
+        zebra: {type: string}
+        id: {type: string}
+        apple: {type: string}
+        name: {type: string}
+`, true, true, []string{"id", "name", "apple", "zebra"}},
+		{"allOf with bundled ref", "order.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Pet:
+      allOf:
+        - $ref: 'shared.yaml#/Audit'
+        - type: object
+          properties:
+            mid: {type: string}
+            beta: {type: string}
+      properties:
+        last: {type: string}
+        first: {type: string}
+`, false, false, []string{"zeta", "alpha", "mid", "beta", "last", "first"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := testOptions(t)
+			opts.sortFields, opts.requiredFirst = tc.sort, tc.required
+			out := renderSpec(t, opts, filepath.Join(dir, tc.file), tc.spec)
+			for i := 0; i < 5; i++ {
+				if again := renderSpec(t, opts, filepath.Join(dir, tc.file), tc.spec); again != out {
+					t.Fatalf("output not deterministic:\n%s\nvs\n%s", out, again)
+				}
+			}
+			if got := messageFields(out, "Pet"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("fields = %v, want %v\n%s", got, tc.want, out)
+			}
+		})
+	}
+}
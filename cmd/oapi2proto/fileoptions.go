@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// customOptionRe matches an extension option name such as (my.pkg.opt) or
+// (my.pkg.opt).sub_field.
+var customOptionRe = regexp.MustCompile(`^\([A-Za-z_]\w*(\.[A-Za-z_]\w*)*\)(\.[A-Za-z_]\w*)*$`)
+
+// optionNameRe matches a built-in option name.
+var optionNameRe = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// Value kinds of the built-in file options.
+var fileOptionKinds = map[string]string{
+	"java_package": "string", "java_outer_classname": "string", "csharp_namespace": "string",
+	"objc_class_prefix": "string", "php_namespace": "string", "ruby_package": "string", "swift_prefix": "string",
+	"java_multiple_files": "bool", "cc_enable_arenas": "bool", "deprecated": "bool",
+	"optimize_for": "optimize_for",
+}
+
+// parseFileOptions 校验 -option 的 name=value, 返回按给定顺序输出的 option 语句
+func parseFileOptions(entries []string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, e := range entries {
+		name, value, err := splitFileOption(e)
+		if err != nil {
+			return nil, fmt.Errorf("-option %q: %w", e, err)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("-option %q: %s 重复设置", e, name)
+		}
+		seen[name] = true
+		out = append(out, fmt.Sprintf("option %s = %s;", name, value))
+	}
+	return out, nil
+}
+
+// splitFileOption splits and validates one file option name=value pair.
+func splitFileOption(e string) (name, value string, err error) {
+	name, value, err = splitOption(e)
+	if err != nil {
+		return "", "", err
+	}
+	if name == "go_package" {
+		return "", "", fmt.Errorf("go_package 由 -go_pkg / -go-pkg-template 设置")
+	}
+	kind, builtin := fileOptionKinds[name]
+	if !builtin && !customOptionRe.MatchString(name) {
+		return "", "", fmt.Errorf("未知 file option %s (自定义 option 需写成 (full.name))", name)
+	}
+	if err := checkOptionValue(value, kind); err != nil {
+		return "", "", err
+	}
+	return name, value, nil
+}
+
+// splitOption splits name=value at the first = outside parentheses; the
+// name must be an identifier or an extension name.
+func splitOption(e string) (name, value string, err error) {
+	depth := 0
+	eq := -1
+	for i := 0; i < len(e) && eq < 0; i++ {
+		switch e[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '=':
+			if depth == 0 {
+				eq = i
+			}
+		}
+	}
+	if eq < 0 {
+		return "", "", fmt.Errorf("需要 name=value 形式")
+	}
+	name, value = strings.TrimSpace(e[:eq]), strings.TrimSpace(e[eq+1:])
+	if !optionNameRe.MatchString(name) && !customOptionRe.MatchString(name) {
+		return "", "", fmt.Errorf("option 名 %q 无效", name)
+	}
+	return name, value, nil
+}
+
+// checkOptionValue accepts a single constant (string, number, identifier) or
+// a balanced aggregate {...}; built-in options also check the value kind.
+func checkOptionValue(value, kind string) error {
+	toks := tokenizeProto(value)
+	if len(toks) == 0 {
+		return fmt.Errorf("缺少取值")
+	}
+	if toks[0].text == "{" && !toks[0].str {
+		depth := 0
+		for i, t := range toks {
+			if t.str {
+				continue
+			}
+			switch t.text {
+			case "{", "[":
+				depth++
+			case "}", "]":
+				depth--
+			}
+			if depth == 0 && i != len(toks)-1 {
+				return fmt.Errorf("取值 %s 不是单个常量", value)
+			}
+		}
+		if depth != 0 {
+			return fmt.Errorf("取值 %s 的括号不匹配", value)
+		}
+		if kind != "" {
+			return fmt.Errorf("取值 %s 类型不符", value)
+		}
+		return nil
+	}
+	if len(toks) == 2 && toks[0].text == "-" && !toks[0].str {
+		toks = toks[1:] // tokenizer keeps "-1" together; "- 1" is still a number
+	}
+	if len(toks) != 1 {
+		return fmt.Errorf("取值 %s 不是单个常量", value)
+	}
+	t := toks[0]
+	ok := true
+	switch kind {
+	case "string":
+		ok = t.str
+	case "bool":
+		ok = !t.str && (t.text == "true" || t.text == "false")
+	case "optimize_for":
+		ok = !t.str && (t.text == "SPEED" || t.text == "CODE_SIZE" || t.text == "LITE_RUNTIME")
+	}
+	if !ok {
+		return fmt.Errorf("取值 %s 类型不符", value)
+	}
+	return nil
+}
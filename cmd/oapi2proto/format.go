@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Blank-line policies for -blank-lines.
+const (
+	blankLinesKeep    = "keep"
+	blankLinesCompact = "compact"
+	blankLinesSpaced  = "spaced"
+)
+
+// Leading comment styles for -comment-style.
+const (
+	commentStyleLine  = "line"
+	commentStyleBlock = "block"
+)
+
+// printOptions controls the final layout of the generated proto source. The
+// generator always renders with two-space indentation; apply re-prints that
+// output, so the rest of the tool never has to care about house style.
+type printOptions struct {
+	indent        string // one level of indentation
+	lineWidth     int    // wrap leading comments longer than this (0 = never)
+	blankLines    string
+	alignComments bool
+	commentStyle  string
+}
+
+// parsePrintIndent maps an -indent value to one indentation level.
+func parsePrintIndent(v string) (string, error) {
+	switch v {
+	case "2":
+		return "  ", nil
+	case "4":
+		return "    ", nil
+	case "tab":
+		return "\t", nil
+	}
+	return "", fmt.Errorf("未知 -indent 取值: %s", v)
+}
+
+func (p printOptions) isDefault() bool {
+	return p.indent == "  " && p.lineWidth == 0 && p.blankLines == blankLinesKeep && !p.alignComments && p.commentStyle == commentStyleLine
+}
+
+// printLine is one source line split into its nesting depth and content.
+type printLine struct {
+	depth   int
+	text    string // trimmed; "" for a blank line
+	comment bool   // the whole line is a // comment
+	marker  bool   // the generated marker, kept verbatim so isGenerated and linters still find it
+}
+
+// apply re-prints rendered proto source according to the options.
+func (p printOptions) apply(src string) string {
+	if p.isDefault() {
+		return src
+	}
+	lines := p.blank(p.block(p.wrap(splitPrintLines(src))))
+	if p.alignComments {
+		alignTrailingComments(lines)
+	}
+	var b strings.Builder
+	for _, l := range lines {
+		if l.text != "" {
+			b.WriteString(strings.Repeat(p.indent, l.depth))
+			b.WriteString(l.text)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// splitPrintLines tracks brace depth outside strings and comments, so the
+// depth does not depend on how the source happened to be indented.
+func splitPrintLines(src string) []printLine {
+	var out []printLine
+	depth := 0
+	for _, raw := range strings.Split(strings.TrimSuffix(src, "\n"), "\n") {
+		text := strings.TrimSpace(raw)
+		l := printLine{depth: depth, text: text, comment: strings.HasPrefix(text, "//"), marker: text == "// "+generatedMarker}
+		if strings.HasPrefix(text, "}") && depth > 0 {
+			l.depth--
+		}
+		code, _ := splitTrailingComment(text)
+		code = stripStrings(code)
+		depth += strings.Count(code, "{") - strings.Count(code, "}")
+		if depth < 0 {
+			depth = 0
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// splitTrailingComment splits a line at the first // outside a string literal.
+func splitTrailingComment(text string) (code, comment string) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '/' && i+1 < len(text) && text[i+1] == '/':
+			return strings.TrimRight(text[:i], " \t"), text[i:]
+		}
+	}
+	return text, ""
+}
+
+// stripStrings blanks out quoted literals so their braces are not counted.
+func stripStrings(text string) string {
+	if !strings.ContainsAny(text, `"'`) {
+		return text
+	}
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// wrap breaks leading comment lines wider than lineWidth at word boundaries;
+// the generated marker is never broken.
+func (p printOptions) wrap(lines []printLine) []printLine {
+	if p.lineWidth <= 0 {
+		return lines
+	}
+	var out []printLine
+	for _, l := range lines {
+		width := len(strings.Repeat(p.indent, l.depth)) + len(l.text)
+		if !l.comment || l.marker || width <= p.lineWidth {
+			out = append(out, l)
+			continue
+		}
+		prefix := "//"
+		if strings.HasPrefix(l.text, "// ") {
+			prefix = "// "
+		}
+		limit := p.lineWidth - len(strings.Repeat(p.indent, l.depth)) - len(prefix)
+		var cur string
+		for _, w := range strings.Fields(strings.TrimPrefix(l.text, "//")) {
+			if cur != "" && len(cur)+1+len(w) > limit {
+				out = append(out, printLine{depth: l.depth, text: prefix + cur, comment: true})
+				cur = ""
+			}
+			if cur != "" {
+				cur += " "
+			}
+			cur += w
+		}
+		out = append(out, printLine{depth: l.depth, text: prefix + cur, comment: true})
+	}
+	return out
+}
+
+// block rewrites leading comments (a run of // lines directly above a
+// declaration) as /** */ blocks; detached comments, trailing comments and
+// the generated marker keep the // form.
+func (p printOptions) block(lines []printLine) []printLine {
+	if p.commentStyle != commentStyleBlock {
+		return lines
+	}
+	var out []printLine
+	for i := 0; i < len(lines); {
+		if !lines[i].comment || lines[i].marker {
+			out = append(out, lines[i])
+			i++
+			continue
+		}
+		end := i
+		for end < len(lines) && lines[end].comment && !lines[end].marker && lines[end].depth == lines[i].depth {
+			end++
+		}
+		if end == len(lines) || lines[end].text == "" {
+			out = append(out, lines[i:end]...)
+			i = end
+			continue
+		}
+		depth := lines[i].depth
+		out = append(out, printLine{depth: depth, text: "/**", comment: true})
+		for _, l := range lines[i:end] {
+			text := strings.TrimPrefix(strings.TrimPrefix(l.text, "//"), " ")
+			text = strings.ReplaceAll(text, "*/", "* /")
+			out = append(out, printLine{depth: depth, text: strings.TrimRight(" * "+text, " "), comment: true})
+		}
+		out = append(out, printLine{depth: depth, text: " */", comment: true})
+		i = end
+	}
+	return out
+}
+
+// blank applies the blank-line policy inside message / enum / service bodies.
+// compact drops blank lines there; spaced separates every member (together
+// with its leading comments) from the previous one.
+func (p printOptions) blank(lines []printLine) []printLine {
+	if p.blankLines == blankLinesKeep {
+		return lines
+	}
+	var out []printLine
+	for _, l := range lines {
+		if l.text == "" && l.depth > 0 {
+			continue
+		}
+		if p.blankLines == blankLinesSpaced && l.depth > 0 && l.text != "" && !strings.HasPrefix(l.text, "}") && len(out) > 0 {
+			prev := out[len(out)-1]
+			opensBlock := strings.HasSuffix(prev.text, "{")
+			if prev.text != "" && !prev.comment && !opensBlock && prev.depth >= l.depth {
+				out = append(out, printLine{depth: l.depth})
+			}
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// alignTrailingComments lines up trailing // comments within runs of
+// consecutive lines at the same depth.
+func alignTrailingComments(lines []printLine) {
+	for start := 0; start < len(lines); {
+		end := start + 1
+		for end < len(lines) && lines[end].text != "" && lines[end].depth == lines[start].depth {
+			end++
+		}
+		width := 0
+		for _, l := range lines[start:end] {
+			if code, comment := splitTrailingComment(l.text); comment != "" && code != "" {
+				width = max(width, len(code))
+			}
+		}
+		for i := start; i < end; i++ {
+			if code, comment := splitTrailingComment(lines[i].text); comment != "" && code != "" {
+				lines[i].text = code + strings.Repeat(" ", width-len(code)+1) + comment
+			}
+		}
+		start = end
+	}
+}
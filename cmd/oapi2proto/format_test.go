@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrintKeepsMarker(t *testing.T) {
+	src := "// " + generatedMarker + "\nsyntax = \"proto3\";\npackage api.v1;\n\n// A pet with a rather long description that wraps.\nmessage Pet {\n  string name = 1;\n}\n"
+	for _, tc := range []struct {
+		name string
+		p    printOptions
+	}{
+		{"line width", printOptions{indent: "  ", blankLines: blankLinesKeep, commentStyle: commentStyleLine, lineWidth: 20}},
+		{"block comments", printOptions{indent: "  ", blankLines: blankLinesKeep, commentStyle: commentStyleBlock}},
+		{"both", printOptions{indent: "  ", blankLines: blankLinesKeep, commentStyle: commentStyleBlock, lineWidth: 20}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := tc.p.apply(src)
+			if first, _, _ := strings.Cut(out, "\n"); first != "// "+generatedMarker {
+				t.Errorf("marker line changed to %q\n%s", first, out)
+			}
+			if !isGenerated([]byte(out)) {
+				t.Errorf("output no longer recognized as generated:\n%s", out)
+			}
+			if tc.p.lineWidth > 0 && strings.Contains(out, "rather long description that wraps") {
+				t.Errorf("description not wrapped:\n%s", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+)
+
+// GAPIC client annotations (google/api/client.proto): default_host and
+// oauth_scopes on services, method_signature on rpcs. They come from the
+// x-default-host / x-oauth-scopes document extensions and x-method-signature
+// on operations; service_options / method_signatures in the config take
+// precedence.
+
+const clientImport = "google/api/client.proto"
+
+// clientServiceOptions renders the default_host / oauth_scopes options of a
+// service.
+func (g *genContext) clientServiceOptions(svc string) string {
+	host, scopes := g.doc.DefaultHost, g.doc.OAuthScopes
+	if g.config != nil {
+		if o, ok := g.config.ServiceOptions[svc]; ok {
+			if o.DefaultHost != "" {
+				host = o.DefaultHost
+			}
+			if o.OAuthScopes != nil {
+				scopes = o.OAuthScopes
+			}
+		}
+	}
+	var b strings.Builder
+	if host != "" {
+		b.WriteString("  option (google.api.default_host) = " + textQuote(host) + ";\n")
+	}
+	if len(scopes) > 0 {
+		b.WriteString("  option (google.api.oauth_scopes) = " + textQuote(strings.Join(scopes, ",")) + ";\n")
+	}
+	if b.Len() > 0 {
+		g.useImport(clientImport)
+	}
+	return b.String()
+}
+
+// methodSignatures returns the method_signature options of an rpc, with the
+// listed request fields in proto field name form.
+func (g *genContext) methodSignatures(m *rpcMethod) []string {
+	if m.op == nil {
+		return nil
+	}
+	sigs := []string(m.op.MethodSignature)
+	if g.config != nil && m.op.OperationID != "" {
+		if s, ok := g.config.MethodSignatures[m.op.OperationID]; ok {
+			sigs = s
+		}
+	}
+	out := make([]string, 0, len(sigs))
+	for _, sig := range sigs {
+		var fields []string
+		for _, f := range strings.Split(sig, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				fields = append(fields, normalizeField(f))
+			}
+		}
+		out = append(out, strings.Join(fields, ","))
+	}
+	if len(out) > 0 {
+		g.useImport(clientImport)
+	}
+	return out
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// genFlags 是决定生成内容 (类型名、字段名与编号、结构与排版) 的命令行选项; 生成命令与
+// examples 等子命令注册同一组 flag, 以保证同样的参数得到同样的 message / 字段
+type genFlags struct {
+	fs *flag.FlagSet
+
+	pkg, goPkg, pkgFrom, goPkgTemplate, presence, anyOfMode, services, serviceName               *string
+	httpCache, httpProxy, httpCA, httpCert, httpKey, validate, configPath, httpMode              *string
+	untyped, nullableArray, defaults, reserveRange, numbering, indent, blankLines                *string
+	commentStyle, googleTypes, enumDigitPrefix, enumZero, enumMode, mapMode, pluralFields        *string
+	stripSuffixList, acronymList, caseConflict, inlineNames, layout, style, bufName, inputFormat *string
+
+	useOptional, sortFields, requiredFirst, infoComments, offline, openapiv2, splitRW *bool
+	exampleComments, alignComments, provenance, originOpt, dedupInline                *bool
+
+	httpTimeout *time.Duration
+
+	maxDepth, lineWidth *int
+
+	importRoots, publicImports, extraImports, fileOptions stringList
+}
+
+// registerGenFlags registers the generation flags on fs.
+func registerGenFlags(fs *flag.FlagSet) *genFlags {
+	f := &genFlags{fs: fs}
+	f.pkg = fs.String("pkg", "api.v1", "proto package")
+	f.goPkg = fs.String("go_pkg", "example.com/project/api/v1;v1", "go_package option value")
+	f.pkgFrom = fs.String("pkg-from", "flag", "proto package 来源: flag (-pkg)|info (由 info.title + info.version 推导, 如 pet_store.v2)")
+	f.goPkgTemplate = fs.String("go-pkg-template", "", "按文件推导 go_package 的模板 (text/template, 可用 .Package .ProtoPackage .Alias .File), 设置后覆盖 -go_pkg")
+	f.useOptional = fs.Bool("use-optional", true, "为 nullable 标量生成 optional (等价于 -presence=nullable, false 等价于 -presence=none)")
+	f.presence = fs.String("presence", "", "optional 生成策略: none|nullable|non-required|all (默认 nullable)")
+	f.anyOfMode = fs.String("anyof", "oneof", "anyof 处理: oneof|repeat|merge (合并所有分支属性为 optional 字段)")
+	f.sortFields = fs.Bool("sort", true, "按字母排序 schema 与字段以获得稳定结果 (false 时字段按 spec 声明顺序)")
+	f.requiredFirst = fs.Bool("required-first", false, "required 字段优先分配最小字段号 (required 字段之间及其余字段保持字段顺序, -sort=false 时为 spec 声明顺序)")
+	f.services = fs.String("services", servicesNone, "由 paths 生成 service: none|single|path (按首段路径分组)|tag (按首个 tag 分组)|config (按 -config 的 service_map)")
+	f.serviceName = fs.String("service-name", "", "未分组 operation 所属的默认 service 名 (默认由 package 推导, 如 ApiService)")
+	f.infoComments = fs.Bool("info-comment", true, "在文件头输出 info.title/version/contact 与 servers 注释块")
+	f.httpCache = fs.String("http-cache", "", "远程 (http/https) spec 的缓存目录 (默认用户缓存目录下的 oapi2proto/http), 按 ETag / Last-Modified 重新验证")
+	f.offline = fs.Bool("offline", false, "只使用 -http-cache 中的远程 spec, 不访问网络")
+	f.httpProxy = fs.String("http-proxy", "", "远程 spec 使用的代理 URL (默认读取 HTTPS_PROXY / HTTP_PROXY / NO_PROXY 环境变量)")
+	f.httpCA = fs.String("http-ca", "", "追加到系统根证书的 PEM CA 证书包 (企业内网 TLS 拦截等)")
+	f.httpCert = fs.String("http-cert", "", "客户端证书 (PEM, mTLS), 需配合 -http-key")
+	f.httpKey = fs.String("http-key", "", "客户端私钥 (PEM)")
+	f.httpTimeout = fs.Duration("http-timeout", 60*time.Second, "远程 spec 单次请求超时 (0 不限)")
+	f.validate = fs.String("validate", validateNone, "生成字段校验规则: none|protovalidate (buf.validate)")
+	f.configPath = fs.String("config", "", "json/yaml 配置文件")
+	f.httpMode = fs.String("http", httpNone, "-services 生成 rpc 的 HTTP 转码规则: none|annotations (google.api.http)|yaml (独立的 <out>_http.yaml 服务配置)|both")
+	f.openapiv2 = fs.Bool("openapiv2", false, "输出 protoc-gen-openapiv2 注解 (info / tags / 描述 / 示例 / required), 由 proto 回生成 OpenAPI 时保留原文档")
+	f.untyped = fs.String("untyped", untypedString, "无 type 且无组合的 schema 映射: string|value (google.protobuf.Value)|any (google.protobuf.Any)|error (生成失败)")
+	f.nullableArray = fs.String("nullable-array", nullableArrayIgnore, "nullable 数组处理: ignore|wrapper (<Elem>List 包装 message, 未设置即 null)|listvalue (google.protobuf.ListValue)|comment (仅注释说明)")
+	f.splitRW = fs.Bool("split-read-write", false, "混用 readOnly / writeOnly 的 schema 额外生成 <Name>Input (去除 readOnly) 与 <Name>Output (去除 writeOnly), 请求体 / 响应使用对应变体")
+	f.defaults = fs.String("defaults", defaultsNone, "schema default 输出: none|comment (字段注释)|option (自定义字段 option (oapi2proto.default_json), 定义写入输出目录的 oapi2proto/options.proto)")
+	f.exampleComments = fs.Bool("example-comments", false, "将 schema 的 example / examples (截断并清理后) 写入字段与 message 注释")
+	f.maxDepth = fs.Int("max-depth", 32, "内联 object 展开的最大深度, 超出部分映射为 google.protobuf.Struct 并告警 (0 不限制)")
+	f.reserveRange = fs.String("reserve-range", "", "在每个 message 中保留的备用字段号区间 <from>-<to> (如 100-199), 供下游手工扩展; 生成的字段号跳过该区间")
+	f.numbering = fs.String("numbering", numberingSequential, "新字段号分配方式: sequential|hash (由属性名的稳定哈希推导, 冲突时顺延; 无需共享锁文件即可一致)")
+	f.indent = fs.String("indent", "2", "输出缩进: 2|4|tab")
+	f.lineWidth = fs.Int("line-width", 0, "前置注释的最大行宽, 超出时按单词折行 (0 不折行)")
+	f.blankLines = fs.String("blank-lines", blankLinesKeep, "message/enum/service 内部成员间的空行策略: keep|compact|spaced")
+	f.alignComments = fs.Bool("align-comments", false, "对齐连续行的行尾 // 注释")
+	f.commentStyle = fs.String("comment-style", commentStyleLine, "前置注释风格: line (//) | block (/** */)")
+	f.provenance = fs.Bool("provenance", false, "在每个 message/enum/字段上方输出来源注释 (source: <文件>#<JSON pointer>)")
+	f.googleTypes = fs.String("google-types", googleTypesOff, "按结构识别常见 schema (经纬度 / 金额 / RFC3339 时间区间 / 日期) 并映射为 google.type 类型: off|report (告警并给出 type_map 建议)|apply (直接替换, 记录到诊断)")
+	f.originOpt = fs.Bool("origin-option", false, "在每个 message 上输出自定义选项 (oapi2proto.origin) = {schema, source, spec_version}, 供运行时工具追溯到 spec 版本")
+	f.enumDigitPrefix = fs.String("enum-digit-prefix", "N", "以数字开头的 enum 值名 (如 2xxCode 的 2XXCODE_404) 前插入的前缀, 保证标识符合法")
+	f.enumZero = fs.String("enum-zero", enumZeroUnspecified, "enum 零值: unspecified (<PREFIX>_UNSPECIFIED)|unknown (<PREFIX>_UNKNOWN)|default (schema default 或名为 unspecified/unknown 的取值占用 0, 否则同 unspecified)")
+	f.enumMode = fs.String("enum", enumProto, "enum 映射: proto (proto enum) | string (普通 string 字段, 取值写入注释或 -validate 的 in 规则)")
+	f.mapMode = fs.String("map", mapProto, "additionalProperties map 的表示: map (proto map) | entries (repeated <Name>Entry {key, value}, 保留顺序)")
+	f.pluralFields = fs.String("plural-fields", pluralFieldsOff, "数组属性的字段名复数化: off|warn (单数名告警)|rename (改为复数, 保留 json_name); 例外用配置 inflections 指定")
+	f.stripSuffixList = fs.String("strip-suffix", "", "逗号分隔的 schema 名后缀, 生成 message 名时去掉 (不区分大小写, 如 Dto,Schema,Model); 去掉后冲突的保持原名并告警")
+	f.acronymList = fs.String("acronyms", "", "逗号分隔的缩写词, 转 snake_case 时整体保留 (如 OAuth,IDs); 与配置 acronyms 合并")
+	f.caseConflict = fs.String("case-conflict", caseConflictWarn, "仅大小写不同的 message/enum 名 (如 Userprofile 与 UserProfile): warn|rename (组件 schema 追加数字后缀)|error")
+	f.dedupInline = fs.Bool("dedup-inline", false, "结构相同的内联 object 只生成一个 message (以首次出现处命名), 各处引用共享")
+	f.inlineNames = fs.String("inline-names", inlineNamesPath, "内联类型命名: path (<父 message><属性>) | hash (再追加 schema 内容的短哈希, 保证唯一且稳定)")
+	f.layout = fs.String("layout", layoutFlat, "输出布局: flat|buf-module (-out 为模块根目录, 文件按 package 放入子目录并生成 buf.yaml)")
+	f.style = fs.String("style", styleDefault, "命名与结构风格: default|buf (满足 buf lint DEFAULT 规则: package 版本后缀、UPPER_SNAKE 枚举值前缀、Service 后缀、<Rpc>Request/Response、lower_snake 文件名, 文件注释挂在 package 上)|protolint (满足 protolint 默认规则: 2 空格缩进、80 列注释折行、小写 package 等); 无法满足的规则报告为告警")
+	f.bufName = fs.String("buf-module-name", "", "buf-module 布局下 buf.yaml 的模块名, 如 buf.build/acme/petapis")
+	f.inputFormat = fs.String("input-format", inputOpenAPI, "输入格式: openapi|jsonschema (独立 JSON Schema 文档, $defs/definitions 映射为 message)|asyncapi (message payload 映射为 message, -services 将 channel 映射为 rpc)")
+	fs.Var(&f.importRoots, "import-root", "import 路径前缀映射 logical=physical (可重复), 如 google/protobuf/=third_party/google/protobuf/")
+	fs.Var(&f.publicImports, "import-public", "以 import public 输出的 import 路径 (可重复, 逻辑路径)")
+	fs.Var(&f.extraImports, "import", "强制输出的 import 路径 (可重复, 逻辑路径, 与自动生成的 import 去重), 如 google/protobuf/descriptor.proto")
+	fs.Var(&f.fileOptions, "option", "追加到每个生成文件的 file option name=value (可重复, 如 optimize_for=CODE_SIZE 或 '(my.custom.file_opt)=\"x\"'), 原样输出 (会校验)")
+	return f
+}
+
+// options validates the parsed flags and returns the generation options they
+// select, with the config file loaded and the acronym / inflection tables set.
+// Run state — diagnostics, lock file, cache, buf module, ... — is left to the
+// command.
+func (f *genFlags) options() (*genOptions, error) {
+	opts := &genOptions{pkg: *f.pkg, goPkg: *f.goPkg, presence: *f.presence, anyOfMode: *f.anyOfMode, sortFields: *f.sortFields, requiredFirst: *f.requiredFirst}
+	if opts.presence == "" {
+		opts.presence = presenceNullable
+		if !*f.useOptional {
+			opts.presence = presenceNone
+		}
+	}
+	switch opts.presence {
+	case presenceNone, presenceNullable, presenceNonRequired, presenceAll:
+	default:
+		return nil, fmt.Errorf("未知 -presence 取值: %s", opts.presence)
+	}
+	switch opts.anyOfMode {
+	case "oneof", "repeat", "merge":
+	default:
+		return nil, fmt.Errorf("未知 -anyof 取值: %s", opts.anyOfMode)
+	}
+	if *f.goPkgTemplate != "" {
+		tmpl, err := template.New("go_pkg").Option("missingkey=error").Parse(*f.goPkgTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("-go-pkg-template: %w", err)
+		}
+		opts.goPkgTemplate = tmpl
+	}
+	roots, err := parseImportRoots(f.importRoots)
+	if err != nil {
+		return nil, err
+	}
+	opts.importRoots = roots
+	opts.publicImports = f.publicImports
+	if opts.extraImports, err = parseExtraImports(f.extraImports); err != nil {
+		return nil, err
+	}
+	if opts.fileOptions, err = parseFileOptions(f.fileOptions); err != nil {
+		return nil, err
+	}
+	switch *f.services {
+	case servicesNone, servicesSingle, servicesPath, servicesTag, servicesConfig:
+	default:
+		return nil, fmt.Errorf("未知 -services 取值: %s", *f.services)
+	}
+	opts.services = *f.services
+	opts.serviceName = *f.serviceName
+	opts.infoComment = *f.infoComments
+	if *f.pkgFrom != "flag" && *f.pkgFrom != "info" {
+		return nil, fmt.Errorf("未知 -pkg-from 取值: %s", *f.pkgFrom)
+	}
+	opts.pkgFromInfo = *f.pkgFrom == "info"
+	f.fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == "go_pkg" {
+			opts.goPkgSet = true
+		}
+	})
+	if *f.validate != validateNone && *f.validate != validateProtovalidate {
+		return nil, fmt.Errorf("未知 -validate 取值: %s", *f.validate)
+	}
+	opts.validate = *f.validate
+	switch *f.inputFormat {
+	case inputOpenAPI, inputJSONSchema, inputAsyncAPI:
+	default:
+		return nil, fmt.Errorf("未知 -input-format 取值: %s", *f.inputFormat)
+	}
+	opts.inputFormat = *f.inputFormat
+	switch *f.httpMode {
+	case httpNone, httpAnnotations, httpYAML, httpBoth:
+	default:
+		return nil, fmt.Errorf("未知 -http 取值: %s", *f.httpMode)
+	}
+	opts.http = *f.httpMode
+	opts.openapiv2 = *f.openapiv2
+	switch *f.untyped {
+	case untypedString, untypedValue, untypedAny, untypedError:
+	default:
+		return nil, fmt.Errorf("未知 -untyped 取值: %s", *f.untyped)
+	}
+	opts.untyped = *f.untyped
+	switch *f.nullableArray {
+	case nullableArrayIgnore, nullableArrayWrapper, nullableArrayListValue, nullableArrayComment:
+	default:
+		return nil, fmt.Errorf("未知 -nullable-array 取值: %s", *f.nullableArray)
+	}
+	opts.nullableArrays = *f.nullableArray
+	opts.splitRW = *f.splitRW
+	switch *f.defaults {
+	case defaultsNone, defaultsComment, defaultsOption:
+	default:
+		return nil, fmt.Errorf("未知 -defaults 取值: %s", *f.defaults)
+	}
+	opts.defaults = *f.defaults
+	opts.exampleComments = *f.exampleComments
+	if *f.maxDepth < 0 {
+		return nil, fmt.Errorf("-max-depth 不能为负数: %d", *f.maxDepth)
+	}
+	opts.maxDepth = *f.maxDepth
+	if *f.numbering != numberingSequential && *f.numbering != numberingHash {
+		return nil, fmt.Errorf("未知 -numbering 取值: %s", *f.numbering)
+	}
+	opts.numbering = *f.numbering
+	if *f.reserveRange != "" {
+		r, err := parseReserveRange(*f.reserveRange)
+		if err != nil {
+			return nil, fmt.Errorf("-reserve-range: %w", err)
+		}
+		opts.reserveRange = r
+	}
+	opts.provenance = *f.provenance
+	opts.emitOrigin = *f.originOpt
+	switch *f.googleTypes {
+	case googleTypesOff, googleTypesReport, googleTypesApply:
+	default:
+		return nil, fmt.Errorf("未知 -google-types 取值: %s", *f.googleTypes)
+	}
+	opts.googleTypes = *f.googleTypes
+	if *f.enumMode != enumProto && *f.enumMode != enumString {
+		return nil, fmt.Errorf("未知 -enum 取值: %s", *f.enumMode)
+	}
+	opts.enumMode = *f.enumMode
+	if !validEnumDigitPrefix(*f.enumDigitPrefix) {
+		return nil, fmt.Errorf("-enum-digit-prefix 须以字母或 _ 开头且只含字母、数字、_: %q", *f.enumDigitPrefix)
+	}
+	opts.enumDigitPrefix = strings.ToUpper(*f.enumDigitPrefix)
+	switch *f.enumZero {
+	case enumZeroUnspecified, enumZeroUnknown, enumZeroDefault:
+	default:
+		return nil, fmt.Errorf("未知 -enum-zero 取值: %s", *f.enumZero)
+	}
+	opts.enumZero = *f.enumZero
+	if *f.mapMode != mapProto && *f.mapMode != mapEntries {
+		return nil, fmt.Errorf("未知 -map 取值: %s", *f.mapMode)
+	}
+	opts.mapMode = *f.mapMode
+	switch *f.caseConflict {
+	case caseConflictWarn, caseConflictRename, caseConflictError:
+	default:
+		return nil, fmt.Errorf("未知 -case-conflict 取值: %s", *f.caseConflict)
+	}
+	opts.caseConflict = *f.caseConflict
+	if *f.inlineNames != inlineNamesPath && *f.inlineNames != inlineNamesHash {
+		return nil, fmt.Errorf("未知 -inline-names 取值: %s", *f.inlineNames)
+	}
+	opts.inlineNames = *f.inlineNames
+	unit, err := parsePrintIndent(*f.indent)
+	if err != nil {
+		return nil, err
+	}
+	switch *f.blankLines {
+	case blankLinesKeep, blankLinesCompact, blankLinesSpaced:
+	default:
+		return nil, fmt.Errorf("未知 -blank-lines 取值: %s", *f.blankLines)
+	}
+	if *f.lineWidth < 0 {
+		return nil, fmt.Errorf("-line-width 不能为负数: %d", *f.lineWidth)
+	}
+	if *f.commentStyle != commentStyleLine && *f.commentStyle != commentStyleBlock {
+		return nil, fmt.Errorf("未知 -comment-style 取值: %s", *f.commentStyle)
+	}
+	opts.print = printOptions{indent: unit, lineWidth: *f.lineWidth, blankLines: *f.blankLines, alignComments: *f.alignComments, commentStyle: *f.commentStyle}
+	if *f.layout != layoutFlat && *f.layout != layoutBufModule {
+		return nil, fmt.Errorf("未知 -layout 取值: %s", *f.layout)
+	}
+	switch *f.style {
+	case styleDefault, styleBuf:
+	case styleProtolint: // INDENT 与 MAX_LINE_LENGTH 的默认值: 2 空格, 80 列
+		if opts.print.indent != "  " {
+			return nil, errors.New("-style=protolint 需要 -indent 2")
+		}
+		if opts.print.lineWidth == 0 || opts.print.lineWidth > protolintMaxLineLength {
+			opts.print.lineWidth = protolintMaxLineLength
+		}
+	default:
+		return nil, fmt.Errorf("未知 -style 取值: %s", *f.style)
+	}
+	opts.style = *f.style
+	if opts.config, err = loadConfig(*f.configPath); err != nil {
+		return nil, err
+	}
+	setAcronyms(*f.acronymList, opts.config)
+	setInflections(opts.config)
+	switch *f.pluralFields {
+	case pluralFieldsOff, pluralFieldsWarn, pluralFieldsRename:
+	default:
+		return nil, fmt.Errorf("未知 -plural-fields 取值: %s", *f.pluralFields)
+	}
+	opts.pluralFields = *f.pluralFields
+	opts.dedupInline = *f.dedupInline
+	for _, suf := range strings.Split(*f.stripSuffixList, ",") {
+		if suf = strings.TrimSpace(suf); suf != "" {
+			opts.stripSuffixes = append(opts.stripSuffixes, suf)
+		}
+	}
+	conn := httpClientOptions{proxy: *f.httpProxy, caFile: *f.httpCA, cert: *f.httpCert, key: *f.httpKey, timeout: *f.httpTimeout}
+	if opts.fetcher, err = newHTTPFetcher(*f.httpCache, *f.offline, conn); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
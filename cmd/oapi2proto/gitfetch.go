@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// gitSpec is a parsed git+<url>//<path>@<ref> input.
+type gitSpec struct {
+	repo string // clone URL without the git+ prefix
+	path string // file inside the repository
+	ref  string // branch, tag or commit; HEAD when omitted
+}
+
+// commitRe matches a full commit id, which never needs refetching.
+var commitRe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func isGitSpec(p string) bool {
+	return strings.HasPrefix(p, "git+")
+}
+
+// parseGitSpec 解析 git+https://host/org/repo.git//path/spec.yaml@ref
+func parseGitSpec(p string) (gitSpec, error) {
+	rest, ok := strings.CutPrefix(p, "git+")
+	if !ok {
+		return gitSpec{}, fmt.Errorf("%s 不是 git+ 输入", p)
+	}
+	scheme := strings.Index(rest, "://")
+	if scheme < 0 {
+		return gitSpec{}, fmt.Errorf("%s: 缺少 git+<scheme>:// 前缀", p)
+	}
+	sep := strings.Index(rest[scheme+3:], "//")
+	if sep < 0 {
+		return gitSpec{}, fmt.Errorf("%s: 需要 <repo>//<path>[@ref] 形式", p)
+	}
+	g := gitSpec{repo: rest[:scheme+3+sep], path: rest[scheme+3+sep+2:], ref: "HEAD"}
+	if i := strings.LastIndex(g.path, "@"); i >= 0 {
+		g.path, g.ref = g.path[:i], g.path[i+1:]
+	}
+	if g.path == "" || g.ref == "" {
+		return gitSpec{}, fmt.Errorf("%s: 需要 <repo>//<path>[@ref] 形式", p)
+	}
+	// refs and paths reach git as arguments: never let them read as options
+	if strings.HasPrefix(g.ref, "-") || strings.HasPrefix(g.path, "-") {
+		return gitSpec{}, fmt.Errorf("%s: ref 与路径不能以 - 开头", p)
+	}
+	return g, nil
+}
+
+// fetchGit returns a file of a git reference. The file is kept in the
+// -http-cache directory (a commit id is served from there without network);
+// branches and tags are fetched again, falling back to the cached copy when
+// git fails. Only the requested ref is fetched, shallowly, into a bare
+// repository per remote.
+func (f *httpFetcher) fetchGit(p string) ([]byte, error) {
+	spec, err := parseGitSpec(p)
+	if err != nil {
+		return nil, err
+	}
+	body, meta := f.cached(p)
+	if f.offline || (body != nil && commitRe.MatchString(spec.ref)) {
+		if body == nil {
+			return nil, fmt.Errorf("-offline: 缓存 %s 中没有 %s", f.dir, p)
+		}
+		return body, nil
+	}
+	data, err := f.gitShow(spec)
+	if err != nil {
+		if body != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] %s: %v; 使用 %s 的缓存副本\n", p, err, meta.Fetched.Format(time.RFC3339))
+			return body, nil
+		}
+		return nil, err
+	}
+	if err := f.store(p, data, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "[WARN] 缓存 %s 失败: %v\n", p, err)
+	}
+	return data, nil
+}
+
+func (f *httpFetcher) gitShow(spec gitSpec) ([]byte, error) {
+	sum := sha256.Sum256([]byte(spec.repo))
+	dir := filepath.Join(f.dir, "git", hex.EncodeToString(sum[:8]))
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		if _, err := f.git("", "init", "--bare", "--quiet", dir); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := f.git(dir, "fetch", "--quiet", "--depth", "1", "--end-of-options", spec.repo, spec.ref); err != nil {
+		return nil, err
+	}
+	return f.git(dir, "show", "FETCH_HEAD:"+spec.path)
+}
+
+// git runs one git command with the -http-* connection settings.
+func (f *httpFetcher) git(dir string, args ...string) ([]byte, error) {
+	var cfg []string
+	if f.conn.proxy != "" {
+		cfg = append(cfg, "-c", "http.proxy="+f.conn.proxy)
+	}
+	if f.conn.caFile != "" {
+		cfg = append(cfg, "-c", "http.sslCAInfo="+f.conn.caFile)
+	}
+	if f.conn.cert != "" {
+		cfg = append(cfg, "-c", "http.sslCert="+f.conn.cert, "-c", "http.sslKey="+f.conn.key)
+	}
+	if dir != "" {
+		cfg = append(cfg, "-C", dir)
+	}
+	ctx := context.Background()
+	if f.conn.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.conn.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "git", append(cfg, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseGitSpec(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want gitSpec
+		err  bool
+	}{
+		{"git+https://host/org/repo.git//specs/pets.yaml@v1.2.0", gitSpec{"https://host/org/repo.git", "specs/pets.yaml", "v1.2.0"}, false},
+		{"git+https://host/org/repo.git//pets.yaml", gitSpec{"https://host/org/repo.git", "pets.yaml", "HEAD"}, false},
+		{"git+ssh://git@host/org/repo.git//a/b.yaml@main", gitSpec{"ssh://git@host/org/repo.git", "a/b.yaml", "main"}, false},
+		{"git+file:///srv/repo//pets.yaml@0123456789abcdef0123456789abcdef01234567", gitSpec{"file:///srv/repo", "pets.yaml", "0123456789abcdef0123456789abcdef01234567"}, false},
+		{"git+host/org/repo.git//pets.yaml", gitSpec{}, true},
+		{"git+https://host/org/repo.git", gitSpec{}, true},
+		{"git+https://host/org/repo.git//pets.yaml@", gitSpec{}, true},
+		{"git+https://host/org/repo.git//pets.yaml@--upload-pack=evil", gitSpec{}, true},
+		{"git+https://host/org/repo.git//-pets.yaml", gitSpec{}, true},
+		{"https://host/pets.yaml", gitSpec{}, true},
+	} {
+		got, err := parseGitSpec(tc.in)
+		if (err != nil) != tc.err || got != tc.want {
+			t.Errorf("parseGitSpec(%q) = %+v, %v; want %+v, error %t", tc.in, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+// gitRepo creates a repository with one commit per version of its files
+// and returns its directory and the commit ids.
+func gitRepo(t *testing.T, versions ...map[string]string) (string, []string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run("init", "--quiet", "--initial-branch", "main")
+	var commits []string
+	for i, files := range versions {
+		for name, content := range files {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		run("add", "-A")
+		run("commit", "--quiet", "-m", "v"+strconv.Itoa(i+1))
+		run("tag", "v"+strconv.Itoa(i+1))
+		commits = append(commits, run("rev-parse", "HEAD"))
+	}
+	return dir, commits
+}
+
+func TestFetchGit(t *testing.T) {
+	repo, commits := gitRepo(t, map[string]string{"specs/pets.yaml": "one"}, map[string]string{"specs/pets.yaml": "two"})
+	url := "git+file://" + filepath.ToSlash(repo) + "//specs/pets.yaml"
+	cache := t.TempDir()
+	online, err := newHTTPFetcher(cache, false, httpClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline, err := newHTTPFetcher(cache, true, httpClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []struct {
+		name    string
+		before  func()
+		fetcher *httpFetcher
+		in      string
+		want    string
+		err     string
+	}{
+		{"tag", nil, online, url + "@v1", "one", ""},
+		{"branch", nil, online, url + "@main", "two", ""},
+		{"head", nil, online, url, "two", ""},
+		{"commit", nil, online, url + "@" + commits[0], "one", ""},
+		{"missing file", nil, online, "git+file://" + filepath.ToSlash(repo) + "//specs/none.yaml@v1", "", "git show"},
+		{"offline", nil, offline, url + "@v1", "one", ""},
+		{"offline miss", nil, offline, url + "@v2", "", "-offline"},
+		{"cached commit needs no repository", func() { os.RemoveAll(repo) }, online, url + "@" + commits[0], "one", ""},
+		{"failed fetch falls back to the cache", nil, online, url + "@main", "two", ""},
+		{"failed fetch without cache", nil, online, url + "@v2", "", "git fetch"},
+	} {
+		if step.before != nil {
+			step.before()
+		}
+		data, err := step.fetcher.fetchGit(step.in)
+		switch {
+		case step.err != "" && (err == nil || !strings.Contains(err.Error(), step.err)):
+			t.Errorf("%s: error %v, want %q", step.name, err, step.err)
+		case step.err == "" && err != nil:
+			t.Errorf("%s: %v", step.name, err)
+		case string(data) != step.want:
+			t.Errorf("%s: got %q, want %q", step.name, data, step.want)
+		}
+	}
+}
+
+// TestGitRefs checks that relative refs of a git input resolve to files of
+// the same ref, not of the current branch.
+func TestGitRefs(t *testing.T) {
+	repo, _ := gitRepo(t, map[string]string{
+		"specs/pets.yaml": `
+openapi: 3.0.0
+info: {title: Pets, version: "1"}
+paths: {}
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        owner: {$ref: '../common/owner.yaml#/Owner'}
+`,
+		"common/owner.yaml": "Owner: {type: object, properties: {name: {type: string}}}\n",
+	}, map[string]string{
+		"common/owner.yaml": "Owner: {type: object, properties: {nick: {type: string}}}\n",
+	})
+	opts := testOptions(t)
+	fetcher, err := newHTTPFetcher(t.TempDir(), false, httpClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.fetcher = fetcher
+	doc, err := loadDocument("git+file://"+filepath.ToSlash(repo)+"//specs/pets.yaml@v1", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, ctx := renderFile(&doc, opts, opts.pkg, opts.goPkg, "")
+	if len(ctx.errors) > 0 {
+		t.Fatal(ctx.errors)
+	}
+	if !strings.Contains(out, "message Owner {\n  string name = 1;\n}") {
+		t.Errorf("ref not resolved at v1:\n%s", out)
+	}
+	if _, err := resolveSpecPath("git+file:///srv/repo//specs/pets.yaml@v1", "../../etc/passwd"); err == nil {
+		t.Error("ref outside of the repository accepted")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// -google-types modes.
+const (
+	googleTypesOff    = "off"
+	googleTypesReport = "report"
+	googleTypesApply  = "apply"
+)
+
+// patternField is one property of a google.type pattern: its accepted
+// names (the first is the JSON name of the google.type field) and types.
+// lossy, when set, explains why an accepted property would not convert
+// exactly ("" when it does).
+type patternField struct {
+	names    []string
+	accepts  func(*Schema) bool
+	optional bool
+	lossy    func(prop string, s *Schema) string
+}
+
+// googleTypePattern recognizes component schemas structurally equivalent to
+// a google.type message.
+type googleTypePattern struct {
+	mapping TypeMapping
+	fields  []patternField
+}
+
+func isNumberSchema(s *Schema) bool  { return s.Type == "number" || s.Type == "integer" }
+func isIntegerSchema(s *Schema) bool { return s.Type == "integer" }
+func isStringSchema(s *Schema) bool  { return s.Type == "string" && len(s.Enum) == 0 }
+func isDateTimeSchema(s *Schema) bool {
+	return s.Type == "string" && s.Format == "date-time"
+}
+
+// decimalSchema accepts amounts spelled as numbers or decimal strings.
+func decimalSchema(s *Schema) bool { return isNumberSchema(s) || isStringSchema(s) }
+
+// moneyUnits accepts only an integer `units` as google.type.Money units: a
+// number or decimal string amount would lose its fraction in int64 units,
+// and an integer `amount` / `value` may count minor units (cents).
+func moneyUnits(prop string, s *Schema) string {
+	switch {
+	case patternKey(prop) == "units" && isIntegerSchema(s):
+		return ""
+	case isIntegerSchema(s):
+		return prop + " (integer) may count minor units, not whole units"
+	case s.Type == "string":
+		return prop + " (decimal string) would lose its fraction in int64 units"
+	}
+	return prop + " (" + s.Type + ") would lose its fraction in int64 units"
+}
+
+var googleTypePatterns = []googleTypePattern{
+	{TypeMapping{Type: "google.type.LatLng", Import: "google/type/latlng.proto"}, []patternField{
+		{names: []string{"latitude", "lat"}, accepts: isNumberSchema},
+		{names: []string{"longitude", "lng", "lon", "long"}, accepts: isNumberSchema},
+	}},
+	{TypeMapping{Type: "google.type.Money", Import: "google/type/money.proto"}, []patternField{
+		{names: []string{"currencyCode", "currency"}, accepts: isStringSchema},
+		{names: []string{"units", "amount", "value"}, accepts: decimalSchema, lossy: moneyUnits},
+		{names: []string{"nanos"}, accepts: isIntegerSchema, optional: true},
+	}},
+	{TypeMapping{Type: "google.type.Interval", Import: "google/type/interval.proto"}, []patternField{
+		{names: []string{"startTime", "start", "from"}, accepts: isDateTimeSchema},
+		{names: []string{"endTime", "end", "to"}, accepts: isDateTimeSchema},
+	}},
+	{TypeMapping{Type: "google.type.Date", Import: "google/type/date.proto"}, []patternField{
+		{names: []string{"year"}, accepts: isIntegerSchema},
+		{names: []string{"month"}, accepts: isIntegerSchema},
+		{names: []string{"day"}, accepts: isIntegerSchema},
+	}},
+}
+
+// patternKey folds a property name for matching (`currency_code` ==
+// `currencyCode`).
+func patternKey(name string) string {
+	return strings.ToLower(patternKeyReplacer.Replace(name))
+}
+
+var patternKeyReplacer = strings.NewReplacer("_", "", "-", "")
+
+// match returns the renamed properties (spec name -> google.type JSON name)
+// and the lossy conversions when every property of s maps onto a field of
+// the pattern.
+func (p *googleTypePattern) match(g *genContext, s *Schema) (renames, lossy []string, ok bool) {
+	if !isMessageSchema(s) || len(s.Properties) == 0 || s.AllOf != nil || s.OneOf != nil || s.AnyOf != nil || s.AddlProps != nil {
+		return nil, nil, false
+	}
+	used := make([]bool, len(p.fields))
+	for _, prop := range sortedKeys(s.Properties) {
+		ps := g.resolveRef(s.Properties[prop])
+		found := false
+		for i, f := range p.fields {
+			if used[i] || !f.accepts(ps) {
+				continue
+			}
+			for _, n := range f.names {
+				if patternKey(n) == patternKey(prop) {
+					used[i], found = true, true
+					if prop != f.names[0] {
+						renames = append(renames, prop+" → "+f.names[0])
+					}
+					if f.lossy != nil {
+						if why := f.lossy(prop, ps); why != "" {
+							lossy = append(lossy, why)
+						}
+					}
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return nil, nil, false
+		}
+	}
+	for i, f := range p.fields {
+		if !used[i] && !f.optional {
+			return nil, nil, false
+		}
+	}
+	return renames, lossy, true
+}
+
+// detectGoogleTypes 按结构识别与 google.type 等价的组件 schema (经纬度、金额、时间区间、日期):
+// report 模式仅告警并给出 type_map 建议, apply 模式直接替换并在报告中记录;
+// 有损的匹配 (如小数金额) 两种模式下都只告警, 需要时由 type_map 显式映射
+func (o *genOptions) detectGoogleTypes(doc *Document) {
+	if o.googleTypes == "" || o.googleTypes == googleTypesOff {
+		return
+	}
+	g := newGenContext(doc, o)
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		if _, mapped := g.mappedType(name); !mapped {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := g.resolveRef(doc.Components.Schemas[name])
+		for _, p := range googleTypePatterns {
+			renames, lossy, ok := p.match(g, s)
+			if !ok {
+				continue
+			}
+			if len(lossy) > 0 {
+				doc.warn("google-type", name, fmt.Sprintf("resembles %s but would not convert exactly: %s; not mapped (type_map `%s: {type: %s, import: %s}` converts it anyway)",
+					p.mapping.Type, strings.Join(lossy, ", "), name, p.mapping.Type, p.mapping.Import))
+				break
+			}
+			shape := "the JSON shape is unchanged"
+			if len(renames) > 0 {
+				shape = "JSON field names change (" + strings.Join(renames, ", ") + ")"
+			}
+			if o.googleTypes == googleTypesReport {
+				doc.warn("google-type", name, fmt.Sprintf("matches %s; %s. Map it with type_map `%s: {type: %s, import: %s}` or -google-types=apply",
+					p.mapping.Type, shape, name, p.mapping.Type, p.mapping.Import))
+				break
+			}
+			if doc.externalTypes == nil {
+				doc.externalTypes = map[string]TypeMapping{}
+			}
+			doc.externalTypes[name] = p.mapping
+			severity := severityInfo
+			if len(renames) > 0 {
+				severity = severityWarning
+			}
+			doc.warnings = append(doc.warnings, diagnostic{Subject: name, Kind: "google-type", Severity: severity,
+				Message: fmt.Sprintf("mapped to %s; %s", p.mapping.Type, shape)})
+			break
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGoogleTypeMoney(t *testing.T) {
+	for _, tc := range []struct {
+		name, props string
+		mapped      bool
+		warning     string
+	}{
+		{"units and nanos", `{currencyCode: {type: string}, units: {type: integer, format: int64}, nanos: {type: integer}}`, true, ""},
+		{"units", `{currency: {type: string}, units: {type: integer}}`, true, ""},
+		{"number amount", `{currency: {type: string}, amount: {type: number}}`, false, "amount (number) would lose its fraction"},
+		{"decimal string", `{currency: {type: string}, amount: {type: string}}`, false, "amount (decimal string) would lose its fraction"},
+		{"minor units", `{currency: {type: string}, amount: {type: integer}}`, false, "amount (integer) may count minor units"},
+		{"decimal units", `{currency: {type: string}, units: {type: number}}`, false, "units (number) would lose its fraction"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := testOptions(t)
+			opts.googleTypes = googleTypesApply
+			doc := loadSpec(t, opts, "money.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Price:
+      type: object
+      properties: `+tc.props+`
+`)
+			if _, mapped := doc.externalTypes["Price"]; mapped != tc.mapped {
+				t.Errorf("mapped = %t, want %t (%v)", mapped, tc.mapped, doc.warnings)
+			}
+			if tc.warning == "" {
+				return
+			}
+			for _, w := range doc.warnings {
+				if w.Kind == "google-type" && w.Severity == severityWarning && strings.Contains(w.Message, tc.warning) {
+					return
+				}
+			}
+			t.Errorf("no google-type warning containing %q in %v", tc.warning, doc.warnings)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// runPostHooks runs the -post-hook commands for one generated file, in
+// order, through the platform shell. Placeholders: {} / {path} the file,
+// {dir} its directory, {name} its base name (all quoted for the shell).
+func (o *genOptions) runPostHooks(file string) error {
+	for _, hook := range o.postHooks {
+		r := strings.NewReplacer(
+			"{path}", shellQuote(file),
+			"{dir}", shellQuote(filepath.Dir(file)),
+			"{name}", shellQuote(filepath.Base(file)),
+			"{}", shellQuote(file),
+		)
+		cmdline := r.Replace(hook)
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", cmdline)
+		} else {
+			cmd = exec.Command("sh", "-c", cmdline)
+		}
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("-post-hook %q (%s): %w", hook, file, err)
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes a path for sh (single quotes) or cmd.exe (double quotes).
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
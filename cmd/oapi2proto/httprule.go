@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// HTTP transcoding modes for -http.
+const (
+	httpNone        = "none"
+	httpAnnotations = "annotations"
+	httpYAML        = "yaml"
+	httpBoth        = "both"
+)
+
+const httpAnnotationsImport = "google/api/annotations.proto"
+
+// httpRule is the google.api.HttpRule of one rpc, derived from the original path.
+type httpRule struct {
+	selector string
+	verb     string // get|put|post|delete|patch, or the custom kind (HEAD ...)
+	custom   bool
+	path     string
+	body     string
+	// responseBody is the response field serialized as the HTTP body
+	responseBody string
+}
+
+// httpRuleFor builds the rule of an rpc mapped from an OpenAPI operation
+// (AsyncAPI channel rpcs have none).
+func (g *genContext) httpRuleFor(svc string, m *rpcMethod) *httpRule {
+	if g.http == httpNone || m.channel != nil {
+		return nil
+	}
+	r := &httpRule{selector: svc + "." + m.name, verb: m.verb, path: httpPathTemplate(m.path)}
+	if g.filePkg != "" {
+		r.selector = g.filePkg + "." + r.selector
+	}
+	switch m.verb {
+	case "get", "put", "post", "delete", "patch":
+	default:
+		r.verb, r.custom = strings.ToUpper(m.verb), true
+	}
+	if m.hasBody {
+		r.body = "body"
+	}
+	r.responseBody = m.responseBody
+	return r
+}
+
+// httpPathTemplate rewrites path parameters to the request field names
+// (/pets/{petId} -> /pets/{pet_id}).
+func httpPathTemplate(path string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(path, "{")
+		end := strings.Index(path, "}")
+		if start < 0 || end < start {
+			b.WriteString(path)
+			return b.String()
+		}
+		b.WriteString(path[:start+1])
+		b.WriteString(normalizeField(path[start+1 : end]))
+		b.WriteString("}")
+		path = path[end+1:]
+	}
+}
+
+// annotation renders the rule as an rpc option block.
+func (r *httpRule) annotation() string {
+	var b strings.Builder
+	b.WriteString("    option (google.api.http) = {\n")
+	if r.custom {
+		b.WriteString(fmt.Sprintf("      custom: {kind: %q, path: %q}\n", r.verb, r.path))
+	} else {
+		b.WriteString(fmt.Sprintf("      %s: %q\n", r.verb, r.path))
+	}
+	if r.body != "" {
+		b.WriteString(fmt.Sprintf("      body: %q\n", r.body))
+	}
+	if r.responseBody != "" {
+		b.WriteString(fmt.Sprintf("      response_body: %q\n", r.responseBody))
+	}
+	b.WriteString("    };\n")
+	return b.String()
+}
+
+// renderHTTPConfig 渲染 grpc-gateway 可用的 gRPC API 配置 (google.api.Service http rules)
+func renderHTTPConfig(rules []*httpRule) string {
+	var b strings.Builder
+	b.WriteString("# Generated by oapi2proto: HTTP rules for gRPC transcoding (grpc-gateway grpc_api_configuration).\n")
+	b.WriteString("type: google.api.Service\n")
+	b.WriteString("config_version: 3\n")
+	b.WriteString("http:\n")
+	b.WriteString("  rules:\n")
+	for _, r := range rules {
+		b.WriteString(fmt.Sprintf("    - selector: %s\n", r.selector))
+		if r.custom {
+			b.WriteString("      custom:\n")
+			b.WriteString(fmt.Sprintf("        kind: %s\n", r.verb))
+			b.WriteString(fmt.Sprintf("        path: %q\n", r.path))
+		} else {
+			b.WriteString(fmt.Sprintf("      %s: %q\n", r.verb, r.path))
+		}
+		if r.body != "" {
+			b.WriteString(fmt.Sprintf("      body: %q\n", r.body))
+		}
+		if r.responseBody != "" {
+			b.WriteString(fmt.Sprintf("      response_body: %q\n", r.responseBody))
+		}
+	}
+	return b.String()
+}
+
+// httpConfigPath 返回输出文件对应的 http rule yaml 路径 (api.proto -> api_http.yaml)
+func httpConfigPath(outFile string) string {
+	return strings.TrimSuffix(outFile, filepath.Ext(outFile)) + "_http.yaml"
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// stringList 是可重复的字符串 flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// protoImport is a single import statement of a generated file.
+type protoImport struct {
+	path   string
+	public bool
+}
+
+// parseImportRoots 解析 -import-root 的 logical=physical 映射
+func parseImportRoots(entries []string) (map[string]string, error) {
+	roots := map[string]string{}
+	for _, e := range entries {
+		logical, physical, ok := strings.Cut(e, "=")
+		if !ok || logical == "" {
+			return nil, fmt.Errorf("-import-root 需要 logical=physical 形式: %q", e)
+		}
+		roots[logical] = physical
+	}
+	return roots, nil
+}
+
+// mapImportPath rewrites a logical import path using the longest matching
+// -import-root prefix.
+func (o *genOptions) mapImportPath(p string) string {
+	best := ""
+	for logical := range o.importRoots {
+		if strings.HasPrefix(p, logical) && len(logical) > len(best) {
+			best = logical
+		}
+	}
+	if best == "" {
+		return p
+	}
+	return o.importRoots[best] + strings.TrimPrefix(p, best)
+}
+
+// useImport records that the file being generated depends on a logical import path.
+func (g *genContext) useImport(p string) {
+	g.imports[p] = true
+}
+
+// parseExtraImports 校验 -import 的 import 路径
+func parseExtraImports(entries []string) ([]string, error) {
+	for _, e := range entries {
+		if !strings.HasSuffix(e, ".proto") || strings.ContainsAny(e, "\"\\ ") {
+			return nil, fmt.Errorf("-import 需要 .proto 文件路径: %q", e)
+		}
+	}
+	return entries, nil
+}
+
+// fileImports returns the sorted, mapped import list for the generated file.
+// Public and -import imports are always emitted, even when nothing in the
+// file uses them; an import reaching the same (mapped) path twice is emitted
+// once.
+func (g *genContext) fileImports() []protoImport {
+	public := map[string]bool{}
+	for _, p := range g.publicImports {
+		public[p] = true
+	}
+	all := map[string]bool{}
+	for p := range g.imports {
+		all[p] = true
+	}
+	for p := range public {
+		all[p] = true
+	}
+	for _, p := range g.extraImports {
+		all[p] = true
+	}
+	paths := make([]string, 0, len(all))
+	for p := range all {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	out := make([]protoImport, 0, len(paths))
+	index := map[string]int{}
+	for _, p := range paths {
+		mapped := g.mapImportPath(p)
+		if i, ok := index[mapped]; ok {
+			out[i].public = out[i].public || public[p]
+			continue
+		}
+		index[mapped] = len(out)
+		out = append(out, protoImport{path: mapped, public: public[p]})
+	}
+	return out
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// Naming of synthesized inline types for -inline-names.
+const (
+	inlineNamesPath = "path"
+	inlineNamesHash = "hash"
+)
+
+// inlineTypeName names an inline type after its parent and property, and
+// with -inline-names=hash appends a short hash of the schema content, so the
+// same property name at different depths (or in different shapes) cannot
+// collide and the name only changes when the schema does.
+func (g *genContext) inlineTypeName(parent, base string, s *Schema) string {
+	if g.inlineNames != inlineNamesHash {
+		return normalizeMessage(parent + "_" + base)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(literal(s)))
+	return normalizeMessage(fmt.Sprintf("%s_%s_%08x", parent, base, h.Sum32()))
+}
+
+// sharedInlineType implements -dedup-inline: the first inline object of a
+// given shape keeps its name and every structurally identical one (same
+// shapeKey) reuses that message instead of emitting a copy. Inline enums
+// repeated across schemas are hoisted under a shared name, see sharedEnums.
+func (g *genContext) sharedInlineType(msgName, field, name string, s *Schema) string {
+	if !g.dedupInline {
+		return name
+	}
+	if g.inlineShapes == nil {
+		g.inlineShapes = g.sharedEnums()
+	}
+	key := g.shapeKey(s)
+	if shared, ok := g.inlineShapes[key]; ok {
+		if shared != name {
+			g.diag(severityInfo, "dedup-inline", msgName+"."+field, "uses the shared inline type "+shared)
+		}
+		return shared
+	}
+	g.inlineShapes[key] = name
+	return name
+}
+
+// shapeKey identifies what a schema generates for -dedup-inline: its literal
+// plus the decoded state literal does not show (boolean schemas, closed /
+// open objects, Struct mapping, field order, normalized bounds, type unions)
+// of it and of every subschema.
+func (g *genContext) shapeKey(s *Schema) string {
+	var b strings.Builder
+	b.WriteString(literal(s))
+	seen := map[*Schema]bool{}
+	var walk func(path string, s *Schema)
+	walk = func(path string, s *Schema) {
+		if s == nil || seen[s] {
+			return
+		}
+		seen[s] = true
+		fmt.Fprintf(&b, "\n%s bool=%s closed=%q open=%t struct=%t bounds=%s,%s union=%q order=%q", path,
+			boolString(s.boolValue), s.closed, s.open, s.dynamicStruct, boundString(s.lower), boundString(s.upper), s.typeUnion, s.propOrder)
+		if !g.sortFields {
+			fmt.Fprintf(&b, " decl=%q", s.propertyNames())
+		}
+		for _, k := range sortedKeys(s.Properties) {
+			walk(path+"/properties/"+k, s.Properties[k])
+		}
+		for _, k := range sortedKeys(s.PatternProperties) {
+			walk(path+"/patternProperties/"+k, s.PatternProperties[k])
+		}
+		walk(path+"/items", s.Items)
+		walk(path+"/additionalProperties", s.AddlProps)
+		walk(path+"/unevaluatedProperties", s.UnevaluatedProps)
+		for _, kw := range listKeywords {
+			for i, c := range s.list(kw) {
+				walk(fmt.Sprintf("%s/%s/%d", path, kw, i), c)
+			}
+		}
+	}
+	walk("#", s)
+	return b.String()
+}
+
+func boolString(b *bool) string {
+	if b == nil {
+		return "-"
+	}
+	return fmt.Sprint(*b)
+}
+
+func boundString(b *bound) string {
+	if b == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%v/%t", b.value, b.exclusive)
+}
+
+// sharedEnums names the inline enums occurring more than once in the
+// component schemas: after their property when every occurrence uses the
+// same one and that type name is free (`status` -> Status). Others are
+// shared under the name of their first occurrence like inline objects.
+func (g *genContext) sharedEnums() map[string]string {
+	count := map[string]int{}
+	props := map[string]map[string]bool{}
+	var order []string
+	inStack := map[*Schema]bool{}
+	var walk func(prop string, s *Schema)
+	walk = func(prop string, s *Schema) {
+		if s == nil || s.Ref != "" || inStack[s] {
+			return
+		}
+		if len(s.Enum) > 0 {
+			if prop != "" && !g.enumAsScalar(s) {
+				key := g.shapeKey(s)
+				if count[key] == 0 {
+					order = append(order, key)
+					props[key] = map[string]bool{}
+				}
+				count[key]++
+				props[key][prop] = true
+			}
+			return
+		}
+		inStack[s] = true
+		defer delete(inStack, s)
+		for _, name := range sortedKeys(s.Properties) {
+			walk(name, s.Properties[name])
+		}
+		walk(prop, s.Items)
+		walk(prop, s.AddlProps)
+		for _, list := range [][]*Schema{s.AllOf, s.OneOf, s.AnyOf} {
+			for _, c := range list {
+				walk("", c)
+			}
+		}
+	}
+	for _, name := range sortedKeys(g.doc.Components.Schemas) {
+		walk("", g.doc.Components.Schemas[name])
+	}
+	taken := map[string]bool{}
+	for name := range g.doc.Components.Schemas {
+		taken[normalizeMessage(name)] = true
+	}
+	shared := map[string]string{}
+	for _, key := range order {
+		if count[key] < 2 || len(props[key]) != 1 {
+			continue
+		}
+		for prop := range props[key] {
+			if name := normalizeMessage(prop); !taken[name] {
+				taken[name] = true
+				shared[key] = name
+			}
+		}
+	}
+	return shared
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedupInlineHiddenState(t *testing.T) {
+	for _, tc := range []struct {
+		name, a, b string
+		shared     bool
+	}{
+		{"identical", `{type: object, properties: {x: {type: string}}}`, `{type: object, properties: {x: {type: string}}}`, true},
+		{"closed", `{type: object, properties: {x: {type: string}}}`, `{type: object, properties: {x: {type: string}}, additionalProperties: false}`, false},
+		{"open", `{type: object, properties: {x: {type: string}}}`, `{type: object, properties: {x: {type: string}}, additionalProperties: true}`, false},
+		{"nested closed", `{type: object, properties: {x: {type: object, properties: {y: {type: string}}}}}`,
+			`{type: object, properties: {x: {type: object, properties: {y: {type: string}}, additionalProperties: false}}}`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := testOptions(t)
+			opts.dedupInline = true
+			out := renderSpec(t, opts, "dedup.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    A:
+      type: object
+      properties:
+        inner: `+tc.a+`
+    B:
+      type: object
+      properties:
+        inner: `+tc.b+`
+`)
+			if shared := strings.Contains(out, "message B {\n  AInner inner = 1;"); shared != tc.shared {
+				t.Errorf("shared = %t, want %t\n%s", shared, tc.shared, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Input formats accepted by -input-format.
+const (
+	inputOpenAPI    = "openapi"
+	inputJSONSchema = "jsonschema"
+)
+
+// parseJSONSchema 将独立 JSON Schema 文档包装为 Document:
+// 根级 $defs / definitions 成为同名 message, 根 schema 本身 (若为 object / enum)
+// 以 title 命名 (缺省为文件名)
+func parseJSONSchema(data []byte, fileName string) (Document, error) {
+	root := &Schema{}
+	if jErr := json.Unmarshal(data, root); jErr != nil {
+		if yErr := yaml.Unmarshal(data, root); yErr != nil {
+			return Document{}, fmt.Errorf("parse json schema (json/yaml) failed: jsonErr=%v yamlErr=%v", jErr, yErr)
+		}
+	}
+	setOrigin(root, "#")
+	doc := Document{Info: Info{Title: root.Title}}
+	doc.Components.Schemas = map[string]*Schema{}
+	moved := map[string]string{} // root-relative pointer prefix -> component name
+	for _, kw := range []string{"$defs", "definitions"} {
+		defs := root.Defs
+		if kw == "definitions" {
+			defs = root.Definitions
+		}
+		for _, name := range sortedKeys(defs) {
+			if _, dup := doc.Components.Schemas[name]; dup {
+				doc.warn("duplicate-def", name, fmt.Sprintf("%s/%s duplicates an earlier definition; using the first", kw, name))
+				continue
+			}
+			doc.Components.Schemas[name] = defs[name]
+			moved["#/"+kw+"/"+escapePointer(name)] = name
+		}
+	}
+	root.Defs, root.Definitions = nil, nil
+
+	rootName := ""
+	if len(root.Enum) > 0 || isMessageSchema(root) || len(root.PrefixItems) > 0 {
+		rootName = normalizeMessage(firstNonEmpty(root.Title, fileName))
+		for doc.Components.Schemas[rootName] != nil {
+			rootName += "Root"
+		}
+		doc.Components.Schemas[rootName] = root
+	}
+	if doc.empty() {
+		return Document{}, errors.New("json schema defines no object, enum or $defs")
+	}
+
+	walkSchemas(&doc, func(s *Schema) {
+		switch {
+		case s.Ref == "#" && rootName != "":
+			s.Ref = componentSchemasPrefix + escapePointer(rootName)
+		case strings.HasPrefix(s.Ref, "#/"):
+			for prefix, name := range moved {
+				if s.Ref == prefix || strings.HasPrefix(s.Ref, prefix+"/") {
+					s.Ref = componentSchemasPrefix + escapePointer(name) + strings.TrimPrefix(s.Ref, prefix)
+					return
+				}
+			}
+			if rootName != "" && !strings.HasPrefix(s.Ref, componentSchemasPrefix) {
+				s.Ref = componentSchemasPrefix + escapePointer(rootName) + strings.TrimPrefix(s.Ref, "#")
+			}
+		}
+	})
+	prepareDocument(&doc)
+	return doc, nil
+}
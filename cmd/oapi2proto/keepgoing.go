@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// skippedSchemas collects the schemas -keep-going left out.
+type skippedSchemas struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (s *skippedSchemas) add(file, schema string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, fmt.Sprintf("%s: %s: %v", file, schema, err))
+}
+
+// exitIfAny 在有 schema 被跳过时输出汇总并以非零状态退出
+func (s *skippedSchemas) exitIfAny() {
+	if len(s.entries) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[FAIL] %d 个 schema 被跳过 (-keep-going):\n", len(s.entries))
+	for _, e := range s.entries {
+		fmt.Fprintf(os.Stderr, "  %s\n", e)
+	}
+	os.Exit(1)
+}
+
+// emitComponent emits a component schema. Under -keep-going a schema whose
+// emission fails (a generation error or a panic on malformed input) is
+// replaced by a placeholder comment and recorded instead of failing the
+// file; the result reports whether it was emitted.
+func (g *genContext) emitComponent(b *strings.Builder, name string, s *Schema) bool {
+	if e, ok := g.early[name]; ok {
+		b.WriteString(e.text)
+		return e.ok
+	}
+	g.component = s
+	defer func() { g.component = nil }()
+	if g.skipped == nil {
+		g.emitSchema(b, name, s)
+		return true
+	}
+	var part strings.Builder
+	before := len(g.errors)
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("internal error: %v", r)
+				g.diag(severityError, "skipped", name, err.Error())
+			}
+		}()
+		g.emitSchema(&part, name, s)
+		if len(g.errors) > before {
+			return errors.New(strings.Join(g.errors[before:], "; "))
+		}
+		return nil
+	}()
+	if err == nil {
+		b.WriteString(part.String())
+		return true
+	}
+	g.errors = g.errors[:before]
+	g.skipped.add(g.doc.source, name, err)
+	if g.skippedComponents == nil {
+		g.skippedComponents = map[string]bool{}
+	}
+	g.skippedComponents[name] = true
+	b.WriteString(fmt.Sprintf("// oapi2proto: schema %s skipped (-keep-going): %s\n\n", oneline(name), oneline(err.Error())))
+	return false
+}
+
+// earlyComponent is a component emitted ahead of its turn by
+// componentSkipped, kept until the component loop reaches it.
+type earlyComponent struct {
+	text string
+	ok   bool
+}
+
+// componentSkipped reports whether -keep-going skips component key. A
+// component not emitted yet is emitted now (its text is kept for its turn),
+// so fields referencing a failing schema can be redirected before it is
+// reached. A component still being emitted counts as not skipped.
+func (g *genContext) componentSkipped(key string) bool {
+	if g.skipped == nil {
+		return false
+	}
+	if g.skippedComponents[key] {
+		return true
+	}
+	if e, ok := g.early[key]; ok {
+		return !e.ok
+	}
+	s := g.doc.Components.Schemas[key]
+	if s == nil || g.visited[key] {
+		return false
+	}
+	if _, mapped := g.mappedType(key); mapped {
+		return false
+	}
+	component, depth := g.component, g.depth
+	g.depth = 0
+	var part strings.Builder
+	ok := g.emitComponent(&part, key, s)
+	g.component, g.depth = component, depth
+	if g.early == nil {
+		g.early = map[string]earlyComponent{}
+	}
+	g.early[key] = earlyComponent{text: part.String(), ok: ok}
+	return !ok
+}
+
+// skippedRef maps a $ref to a component skipped by -keep-going onto
+// google.protobuf.Struct, so the file still compiles; user names the field
+// (or rpc) holding the reference in the diagnostic.
+func (g *genContext) skippedRef(s *Schema, user string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	key, ok := componentRefName(s.Ref)
+	if !ok || !g.componentSkipped(key) {
+		return "", false
+	}
+	g.useImport("google/protobuf/struct.proto")
+	g.diag(severityWarning, "skipped-ref", key, fmt.Sprintf("schema skipped (-keep-going); %s referencing it is mapped to google.protobuf.Struct", user))
+	return "google.protobuf.Struct", true
+}
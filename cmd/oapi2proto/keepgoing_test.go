@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeepGoingRedirectsRefs(t *testing.T) {
+	opts := testOptions(t)
+	opts.untyped = untypedError
+	opts.skipped = &skippedSchemas{}
+	opts.diags = &diagnostics{}
+	opts.services = servicesSingle
+	out := renderSpec(t, opts, "kg.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths:
+  /bad:
+    get:
+      operationId: getBad
+      responses:
+        "200":
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/Bad"}
+components:
+  schemas:
+    Alpha:
+      type: object
+      properties:
+        bad: {$ref: "#/components/schemas/Bad"}
+        list: {type: array, items: {$ref: "#/components/schemas/Bad"}}
+        good: {$ref: "#/components/schemas/Good"}
+    Bad:
+      type: object
+      properties:
+        x: {}
+    Good:
+      type: object
+      properties:
+        bad: {$ref: "#/components/schemas/Bad"}
+    Zed:
+      type: object
+      properties:
+        bad: {$ref: "#/components/schemas/Bad"}
+`)
+	for _, want := range []string{
+		`import "google/protobuf/struct.proto";`,
+		"// oapi2proto: schema Bad skipped (-keep-going)",
+		"message Alpha {\n  google.protobuf.Struct bad = 1;\n  Good good = 2;\n  repeated google.protobuf.Struct list = 3;\n}",
+		"message Good {\n  google.protobuf.Struct bad = 1;\n}",
+		"message Zed {\n  google.protobuf.Struct bad = 1;\n}",
+		"rpc GetBad(GetBadRequest) returns (google.protobuf.Struct)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Bad bad") || strings.Contains(out, "message Bad {") {
+		t.Errorf("reference to the skipped schema kept:\n%s", out)
+	}
+	if strings.Count(out, "message Good {") != 1 {
+		t.Errorf("Good emitted %d times:\n%s", strings.Count(out, "message Good {"), out)
+	}
+	if len(opts.skipped.entries) != 1 {
+		t.Errorf("skipped %v, want only Bad", opts.skipped.entries)
+	}
+	refs := 0
+	for _, e := range opts.diags.sorted() {
+		if e.Kind == "skipped-ref" {
+			refs++
+		}
+	}
+	if refs != 5 {
+		t.Errorf("%d skipped-ref diagnostics, want 5", refs)
+	}
+}
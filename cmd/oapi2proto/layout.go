@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Output layouts accepted by -layout.
+const (
+	layoutFlat      = "flat"
+	layoutBufModule = "buf-module"
+)
+
+// bufDeps maps import path prefixes to the BSR module providing them.
+var bufDeps = map[string]string{
+	"buf/validate/":         "buf.build/bufbuild/protovalidate",
+	"google/api/":           "buf.build/googleapis/googleapis",
+	"google/type/":          "buf.build/googleapis/googleapis",
+	"google/rpc/":           "buf.build/googleapis/googleapis",
+	"protoc-gen-openapiv2/": "buf.build/grpc-ecosystem/grpc-gateway",
+}
+
+// bufModule 收集 -layout buf-module 的模块根目录与依赖
+type bufModule struct {
+	root string
+	name string
+	mu   sync.Mutex
+	deps map[string]bool
+}
+
+// layoutPath 在 buf-module 布局下将输出文件放到与 package 对应的目录
+// (api.v1 -> <root>/api/v1/<file>)
+func (o *genOptions) layoutPath(pkg, outFile string) string {
+	if o.module == nil {
+		return outFile
+	}
+	return filepath.Join(o.module.root, filepath.FromSlash(strings.ReplaceAll(pkg, ".", "/")), filepath.Base(outFile))
+}
+
+// protoFileName 返回输出文件对应的 .proto 文件名: 相对输出根目录的路径 (buf-module
+// 布局下为模块根目录), 与其他文件 import 它时的路径一致
+func (o *genOptions) protoFileName(outFile string) string {
+	name := descriptorFileName(outFile)
+	if o.outRoot == "" {
+		return name
+	}
+	rel, err := filepath.Rel(o.outRoot, filepath.Join(filepath.Dir(outFile), name))
+	if err != nil {
+		return name
+	}
+	return filepath.ToSlash(rel)
+}
+
+// recordImports notes the BSR dependencies of a generated file.
+func (m *bufModule) recordImports(content string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, line := range strings.Split(content, "\n") {
+		rest, ok := strings.CutPrefix(line, "import ")
+		if !ok {
+			continue
+		}
+		path := strings.Trim(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(rest), "public "), ";"), `"`)
+		for prefix, dep := range bufDeps {
+			if strings.HasPrefix(path, prefix) {
+				m.deps[dep] = true
+			}
+		}
+	}
+}
+
+// writeBufYAML 在模块根目录写出 buf.yaml (已存在时保留)
+func (m *bufModule) writeBufYAML() error {
+	path := filepath.Join(m.root, "buf.yaml")
+	if _, err := os.Stat(path); err == nil {
+		fmt.Fprintf(os.Stderr, "[INFO] 保留已有 %s\n", path)
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("# Generated by oapi2proto (-layout buf-module).\n")
+	b.WriteString("version: v2\n")
+	b.WriteString("modules:\n")
+	b.WriteString("  - path: .\n")
+	if m.name != "" {
+		b.WriteString(fmt.Sprintf("    name: %s\n", m.name))
+	}
+	if len(m.deps) > 0 {
+		deps := make([]string, 0, len(m.deps))
+		for d := range m.deps {
+			deps = append(deps, d)
+		}
+		sort.Strings(deps)
+		b.WriteString("deps:\n")
+		for _, d := range deps {
+			b.WriteString(fmt.Sprintf("  - %s\n", d))
+		}
+	}
+	if err := os.MkdirAll(m.root, 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(b.String()))
+}
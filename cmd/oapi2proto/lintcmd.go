@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runLint 实现 `oapi2proto lint`: 在生成前检查 spec 中已知转换效果差的写法
+// (布尔 additionalProperties, 无类型 schema, 混合类型 enum, 过深的内联 object),
+// 给出修改建议; 存在警告时以非零状态退出
+func runLint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	in := fs.String("in", "openapi.json", "openapi 文件、http(s) URL 或归档 (json|yaml|yml)")
+	maxDepth := fs.Int("max-depth", 3, "内联 object 嵌套超过该层数时建议抽取为组件 schema (0 不检查)")
+	diagStyle := fs.String("diag-style", diagStyleAuto, "同生成命令的 -diag-style")
+	colorMode := fs.String("color", colorAuto, "同生成命令的 -color")
+	reportPath := fs.String("report", "", "将检查结果写入 json 文件")
+	fs.Parse(args)
+
+	fetcher, err := newHTTPFetcher("", false, httpClientOptions{timeout: 60 * time.Second})
+	if err != nil {
+		fatal(err)
+	}
+	opts := &genOptions{config: &Config{}, inputFormat: inputOpenAPI, fetcher: fetcher, diags: &diagnostics{showInfo: true}}
+	switch *diagStyle {
+	case diagStyleAuto:
+		opts.diags.pretty = isTerminal(os.Stderr)
+	case diagStylePlain:
+	case diagStylePretty:
+		opts.diags.pretty = true
+	default:
+		fatal(fmt.Errorf("未知 -diag-style 取值: %s", *diagStyle))
+	}
+	opts.diags.color = useColor(*colorMode)
+	doc, err := loadDocument(*in, opts)
+	if err != nil {
+		fatal(err)
+	}
+	doc.source = *in
+	opts.diags.addDocument(&doc)
+	l := &linter{doc: &doc, diags: opts.diags, maxDepth: *maxDepth, specs: map[string]*yaml.Node{}, read: opts.readSpec}
+	l.run()
+	opts.diags.print()
+	if *reportPath != "" {
+		if err := opts.diags.writeReport(*reportPath); err != nil {
+			fatal(err)
+		}
+	}
+	if n := opts.diags.count(severityWarning); n > 0 {
+		fmt.Fprintf(os.Stderr, "[FAIL] lint: %d 条警告\n", n)
+		os.Exit(1)
+	}
+}
+
+// linter checks a loaded spec for patterns that convert poorly.
+type linter struct {
+	doc      *Document
+	diags    *diagnostics
+	maxDepth int
+	// specs caches the node trees used to see the JSON types of enum values,
+	// which decoding turns into strings.
+	specs map[string]*yaml.Node
+	read  func(string) ([]byte, error)
+}
+
+func (l *linter) run() {
+	walkSchemas(l.doc, l.checkSchema)
+	if l.maxDepth > 0 {
+		for _, name := range sortedKeys(l.doc.Components.Schemas) {
+			l.checkDepth(l.doc.Components.Schemas[name], 0)
+		}
+	}
+}
+
+// report records a finding about s.
+func (l *linter) report(severity, kind string, s *Schema, msg string) {
+	e := diagnostic{File: l.doc.source, Subject: lintSubject(s.origin), Kind: kind, Severity: severity, Message: msg}
+	l.doc.locate(&e, s.origin)
+	l.diags.add(e)
+}
+
+// lintSubject names a schema by its pointer below components/schemas (or
+// the whole pointer elsewhere): "Pet/properties/owner".
+func lintSubject(origin string) string {
+	_, ptr, _ := strings.Cut(origin, "#")
+	if rest, ok := strings.CutPrefix("#"+ptr, componentSchemasPrefix); ok {
+		return rest
+	}
+	return ptr
+}
+
+func (l *linter) checkSchema(s *Schema) {
+	if s.origin == "" {
+		return
+	}
+	switch {
+	case s.open:
+		l.report(severityWarning, "additional-properties-true", s, "additionalProperties: true maps the object to google.protobuf.Struct (with declared properties, the extra ones are dropped); declare a value schema (e.g. additionalProperties: {type: string}) for a typed map<string, T>")
+	case s.closed == "additionalProperties: false" && len(s.Properties) > 0:
+		l.report(severityInfo, "additional-properties-false", s, "additionalProperties: false is not enforced by proto3 (unknown fields are kept); enforce it in validation if clients rely on it")
+	}
+	if isUntypedSchema(s) {
+		l.report(severityWarning, "untyped", s, "schema declares no type; it becomes string (or -untyped value|any); add `type` or a $ref")
+	}
+	if len(s.Enum) > 0 {
+		l.checkEnum(s)
+	}
+}
+
+// isUntypedSchema reports whether the emitter has nothing to derive a type
+// from (see untypedType).
+func isUntypedSchema(s *Schema) bool {
+	return s.boolValue == nil && s.Ref == "" && s.DynamicRef == "" && s.Type == "" && len(s.typeUnion) == 0 &&
+		s.Properties == nil && s.AddlProps == nil && s.Items == nil && len(s.PatternProperties) == 0 &&
+		s.AllOf == nil && s.OneOf == nil && s.AnyOf == nil && len(s.Enum) == 0 && s.Const == nil
+}
+
+// checkEnum flags enums whose values are not all strings: proto enum values
+// are names, so numbers and booleans change their JSON form, and mixed
+// types cannot round-trip at all.
+func (l *linter) checkEnum(s *Schema) {
+	node := l.node(s.origin + "/enum")
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return
+	}
+	kinds := map[string]bool{}
+	for _, v := range node.Content {
+		switch v.Tag {
+		case "!!null":
+		case "!!int", "!!float":
+			kinds["number"] = true
+		case "!!bool":
+			kinds["boolean"] = true
+		case "!!str":
+			kinds["string"] = true
+		default:
+			kinds["other"] = true
+		}
+	}
+	kindList := strings.Join(sortedKeys(kinds), ", ")
+	switch {
+	case len(kinds) > 1:
+		l.report(severityWarning, "enum-mixed-types", s, "enum mixes "+kindList+" values, which no proto enum can represent in JSON; split it (oneOf) or use one type")
+	case len(kinds) == 1 && !kinds["string"]:
+		l.report(severityInfo, "enum-non-string", s, kindList+" enum values become enum names (1 -> X_1), so the proto3 JSON form is a string; use string values or drop the enum for a plain scalar")
+	}
+}
+
+// node resolves an origin pointer in the spec it points into.
+func (l *linter) node(origin string) *yaml.Node {
+	file, ptr, ok := strings.Cut(origin, "#")
+	if !ok {
+		return nil
+	}
+	root, ok := l.specs[file]
+	if !ok {
+		root = loadSpecNode(l.read, l.doc.files[file])
+		l.specs[file] = root
+	}
+	n, _ := pointerNode(root, ptr)
+	return n
+}
+
+// checkDepth flags inline objects nested deeper than -max-depth below a
+// component schema: they become long generated names (Parent_Child_...)
+// and cannot be reused.
+func (l *linter) checkDepth(s *Schema, depth int) {
+	if s == nil || s.Ref != "" {
+		return
+	}
+	if depth > l.maxDepth && s.Properties != nil {
+		l.report(severityWarning, "deep-inline", s, fmt.Sprintf("inline object nested %d levels deep (-max-depth %d); move it to components/schemas and $ref it", depth, l.maxDepth))
+		return
+	}
+	next := depth
+	if s.Properties != nil {
+		next++
+	}
+	for _, name := range sortedKeys(s.Properties) {
+		l.checkDepth(s.Properties[name], next)
+	}
+	l.checkDepth(s.Items, next)
+	if s.AddlProps != nil {
+		l.checkDepth(s.AddlProps, next)
+	}
+	for _, list := range [][]*Schema{s.AllOf, s.OneOf, s.AnyOf} {
+		for _, c := range list {
+			l.checkDepth(c, depth)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// lockFile persists assigned field numbers and enum value numbers so that
+// regenerations never renumber existing members. Keys are fully-qualified
+// type names (package.Type) and member names. Numbers of members that
+// disappear stay in the lock (and are emitted as reserved) so they are never
+// reused.
+type lockFile struct {
+	path string
+	mu   sync.Mutex
+
+	Version  int                       `json:"version"`
+	Messages map[string]map[string]int `json:"messages"`
+	Enums    map[string]map[string]int `json:"enums"`
+	// Oneofs holds the tag range [first, last] reserved for each oneof of a
+	// message (type -> oneof name), so new branches stay inside it.
+	Oneofs map[string]map[string][2]int `json:"oneofs,omitempty"`
+}
+
+const lockFileVersion = 1
+
+// loadLockFile 读取锁文件, 不存在时返回空锁
+func loadLockFile(path string) (*lockFile, error) {
+	l := &lockFile{path: path, Version: lockFileVersion, Messages: map[string]map[string]int{}, Enums: map[string]map[string]int{}, Oneofs: map[string]map[string][2]int{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	if l.Messages == nil {
+		l.Messages = map[string]map[string]int{}
+	}
+	if l.Enums == nil {
+		l.Enums = map[string]map[string]int{}
+	}
+	if l.Oneofs == nil {
+		l.Oneofs = map[string]map[string][2]int{}
+	}
+	return l, nil
+}
+
+func (l *lockFile) save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(l.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(l.path, append(data, '\n'))
+}
+
+// Field numbering modes for -numbering.
+const (
+	numberingSequential = "sequential"
+	numberingHash       = "hash"
+)
+
+// maxFieldNumber is the largest valid proto field number.
+const maxFieldNumber = 536870911
+
+// numberer hands out member numbers for one message or enum.
+type numberer struct {
+	lock    *lockFile
+	entries map[string]int // locked numbers of this type (nil without -lock)
+	next    int
+	used    map[int]bool
+	// hash allocates new numbers from the member name (-numbering=hash)
+	hash bool
+	// oneofKey is the key of the message's oneof tag ranges in the lock
+	oneofKey string
+	// fields marks message field numbering; enum values are not subject to
+	// the 19000-19999 reservation
+	fields bool
+	// check validates the numbers handed out (field numbers only)
+	check func(member string, num int)
+	// spare is the -reserve-range block new numbers skip (zero: none)
+	spare [2]int
+}
+
+// oneofRangeSize is the smallest tag range reserved for a oneof in the lock.
+const oneofRangeSize = 16
+
+func (g *genContext) newNumberer(msgName string) *numberer {
+	n := g.lockedNumberer(func(l *lockFile) map[string]map[string]int { return l.Messages }, msgName)
+	n.hash = g.numbering == numberingHash
+	n.fields = true
+	n.check = func(member string, num int) { g.checkFieldNumber(msgName, member, num) }
+	n.spare = g.reserveRange
+	if n.lock != nil {
+		key := msgName
+		if g.filePkg != "" {
+			key = g.filePkg + "." + msgName
+		}
+		n.lock.mu.Lock()
+		n.oneofKey = key
+		for _, r := range n.lock.Oneofs[key] {
+			if r[1] >= n.next {
+				n.next = r[1] + 1
+			}
+		}
+		n.lock.mu.Unlock()
+	}
+	return n
+}
+
+// oneofNumber returns the number of a oneof member. With -lock every oneof
+// owns a tag range, reserved when the oneof is first locked (members is its
+// current size), and new members take the lowest free number in it, so
+// adding a branch renumbers nothing and regular fields never land between
+// the members. A member locked under its positional name (legacy, e.g.
+// choice_2 before names came from titles) keeps that number.
+func (n *numberer) oneofNumber(oneof, member, legacy string, members int) int {
+	if n.lock == nil || n.hash {
+		return n.number(member)
+	}
+	n.lock.mu.Lock()
+	if _, ok := n.entries[member]; !ok && legacy != member {
+		if num, ok := n.entries[legacy]; ok {
+			n.entries[member] = num
+			delete(n.entries, legacy)
+		}
+	}
+	if num, ok := n.entries[member]; ok {
+		n.used[num] = true
+		n.lock.mu.Unlock()
+		return n.checked(member, num)
+	}
+	r, ok := n.lock.Oneofs[n.oneofKey][oneof]
+	if !ok {
+		size := oneofRangeSize
+		for size < 2*members {
+			size *= 2
+		}
+		r = [2]int{n.next, n.next + size - 1}
+		if n.lock.Oneofs[n.oneofKey] == nil {
+			n.lock.Oneofs[n.oneofKey] = map[string][2]int{}
+		}
+		n.lock.Oneofs[n.oneofKey][oneof] = r
+		n.next = r[1] + 1
+	}
+	taken := map[int]bool{}
+	for _, num := range n.entries {
+		taken[num] = true
+	}
+	for num := r[0]; num <= r[1]; num++ {
+		if !taken[num] && !n.skipped(num) {
+			n.entries[member] = num
+			n.used[num] = true
+			n.lock.mu.Unlock()
+			return n.checked(member, num)
+		}
+	}
+	n.lock.mu.Unlock()
+	return n.number(member) // range full: continue after it
+}
+
+// newEnumNumberer starts at 1: number 0 goes to the zero value (see -enum-zero).
+func (g *genContext) newEnumNumberer(enumName string) *numberer {
+	return g.lockedNumberer(func(l *lockFile) map[string]map[string]int { return l.Enums }, enumName)
+}
+
+func (g *genContext) lockedNumberer(table func(*lockFile) map[string]map[string]int, typeName string) *numberer {
+	n := &numberer{next: 1, used: map[int]bool{}}
+	if g.lock == nil {
+		return n
+	}
+	key := typeName
+	if g.filePkg != "" {
+		key = g.filePkg + "." + typeName
+	}
+	g.lock.mu.Lock()
+	defer g.lock.mu.Unlock()
+	t := table(g.lock)
+	if t[key] == nil {
+		t[key] = map[string]int{}
+	}
+	n.lock = g.lock
+	n.entries = t[key]
+	for _, num := range n.entries {
+		if num >= n.next {
+			n.next = num + 1
+		}
+	}
+	return n
+}
+
+// number returns the member's locked number, or allocates a fresh one that
+// was never handed out before.
+func (n *numberer) number(member string) int {
+	if n.lock == nil {
+		num := n.allocate(member)
+		n.used[num] = true
+		return n.checked(member, num)
+	}
+	n.lock.mu.Lock()
+	num, ok := n.entries[member]
+	if !ok {
+		num = n.allocate(member)
+		n.entries[member] = num
+	}
+	n.used[num] = true
+	n.lock.mu.Unlock()
+	return n.checked(member, num)
+}
+
+// skipped reports whether a fresh number must not be handed out: a field
+// number in 19000-19999 (reserved for the protobuf implementation) or in
+// the -reserve-range block.
+func (n *numberer) skipped(num int) bool {
+	return n.fields && num >= 19000 && num <= 19999 || n.spare[0] > 0 && num >= n.spare[0] && num <= n.spare[1]
+}
+
+// checked runs the number check, if any, and returns num.
+func (n *numberer) checked(member string, num int) int {
+	if n.check != nil {
+		n.check(member, num)
+	}
+	return num
+}
+
+// checkFieldNumber fails the generation of a message whose field would get a
+// number proto does not accept: above 536870911, or in 19000-19999, which is
+// reserved for the protobuf implementation. Fresh numbers skip that range,
+// so this catches numbers taken from a lock (edited by hand or written by
+// another tool) and messages too large for the number space.
+func (g *genContext) checkFieldNumber(msgName, member string, num int) {
+	switch {
+	case num < 1 || num > maxFieldNumber:
+		g.fail("field-number", msgName+"."+member, fmt.Sprintf("field number %d is outside 1-%d", num, maxFieldNumber))
+	case num >= 19000 && num <= 19999:
+		g.fail("field-number", msgName+"."+member, fmt.Sprintf("field number %d is in the range 19000-19999 reserved for the protobuf implementation (check the -lock entry)", num))
+	}
+}
+
+// allocate hands out a new number: the next sequential one, or with hash
+// numbering the member's hash slot, probing upwards past numbers already
+// taken in this type (emitted or locked) and the numbers skipped (see skipped).
+func (n *numberer) allocate(member string) int {
+	if !n.hash {
+		for n.skipped(n.next) {
+			n.next++
+		}
+		num := n.next
+		n.next++
+		return num
+	}
+	taken := map[int]bool{}
+	for num := range n.used {
+		taken[num] = true
+	}
+	for _, num := range n.entries {
+		taken[num] = true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(member))
+	num := int(h.Sum32()%maxFieldNumber) + 1
+	for taken[num] || n.skipped(num) {
+		num++
+		if num > maxFieldNumber {
+			num = 1
+		}
+	}
+	return num
+}
+
+// unused lists locked numbers not emitted in this generation.
+func (n *numberer) unused() []int {
+	if n.lock == nil {
+		return nil
+	}
+	n.lock.mu.Lock()
+	defer n.lock.mu.Unlock()
+	var out []int
+	for _, num := range n.entries {
+		if !n.used[num] {
+			out = append(out, num)
+		}
+	}
+	sort.Ints(out)
+	return out
+}
+
+// parseReserveRange parses a -reserve-range value: "<from>-<to>" (or a
+// single number) of valid field numbers outside 19000-19999.
+func parseReserveRange(v string) ([2]int, error) {
+	lo, hi, isRange := strings.Cut(v, "-")
+	if !isRange {
+		hi = lo
+	}
+	from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	switch {
+	case err1 != nil || err2 != nil:
+		return [2]int{}, fmt.Errorf("应为 <from>-<to>, 如 100-199: %q", v)
+	case from < 1 || to > maxFieldNumber || from > to:
+		return [2]int{}, fmt.Errorf("区间须在 1-%d 之内且 from <= to: %q", maxFieldNumber, v)
+	case from <= 19999 && to >= 19000:
+		return [2]int{}, fmt.Errorf("区间不能与 protobuf 保留的 19000-19999 重叠: %q", v)
+	}
+	return [2]int{from, to}, nil
+}
+
+// spareRange renders the `reserved <from> to <to>;` line of -reserve-range
+// for a message whose members have all been numbered. Messages that already
+// use a number of the block (locked before the option was turned on) keep
+// those numbers and get no block, with a warning.
+func (g *genContext) spareRange(msgName string, n *numberer) string {
+	r := g.reserveRange
+	if r[0] == 0 {
+		return ""
+	}
+	clash := func(num int) bool { return num >= r[0] && num <= r[1] }
+	var taken []int
+	for num := range n.used {
+		if clash(num) {
+			taken = append(taken, num)
+		}
+	}
+	if n.lock != nil {
+		n.lock.mu.Lock()
+		for _, num := range n.entries {
+			if clash(num) && !n.used[num] {
+				taken = append(taken, num)
+			}
+		}
+		n.lock.mu.Unlock()
+	}
+	if len(taken) > 0 {
+		sort.Ints(taken)
+		g.diag(severityWarning, "reserve-range", msgName, fmt.Sprintf("field numbers %s already lie in -reserve-range %d-%d; no spare block reserved", joinInts(taken), r[0], r[1]))
+		return ""
+	}
+	if r[0] == r[1] {
+		return fmt.Sprintf("  reserved %d;\n", r[0])
+	}
+	return fmt.Sprintf("  reserved %d to %d;\n", r[0], r[1])
+}
+
+func joinInts(nums []int) string {
+	parts := make([]string, len(nums))
+	for i, n := range nums {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ", ")
+}
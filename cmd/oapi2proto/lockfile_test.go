@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const lockSpec = `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Status: {type: string, enum: [old, new]}
+    Pet:
+      type: object
+      properties:
+        old: {type: string}
+        new: {type: string}
+`
+
+// renderLocked renders lockSpec with the given lock entries and returns the
+// output and the generation errors.
+func renderLocked(t *testing.T, opts *genOptions, messages, enums map[string]map[string]int) (string, []string) {
+	t.Helper()
+	lock, err := loadLockFile(filepath.Join(t.TempDir(), "lock.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range messages {
+		lock.Messages[k] = v
+	}
+	for k, v := range enums {
+		lock.Enums[k] = v
+	}
+	opts.lock = lock
+	doc := loadSpec(t, opts, "lock.yaml", lockSpec)
+	out, ctx := renderFile(doc, opts, opts.pkg, opts.goPkg, "")
+	return out, ctx.errors
+}
+
+// renderGenerations renders each spec in turn with the lock file at path,
+// saved and loaded again between the runs like consecutive invocations.
+func renderGenerations(t *testing.T, opts *genOptions, path string, specs ...string) []string {
+	t.Helper()
+	var outs []string
+	for i, spec := range specs {
+		lock, err := loadLockFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.lock = lock
+		doc := loadSpec(t, opts, fmt.Sprintf("gen%d.yaml", i+1), spec)
+		out, ctx := renderFile(doc, opts, opts.pkg, opts.goPkg, "")
+		if len(ctx.errors) > 0 {
+			t.Fatal(ctx.errors)
+		}
+		if err := lock.save(); err != nil {
+			t.Fatal(err)
+		}
+		outs = append(outs, out)
+	}
+	return outs
+}
+
+// enumSpec is a spec with one enum of the given values.
+func enumSpec(values string) string {
+	return `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Status: {type: string, enum: [` + values + `]}
+`
+}
+
+func TestEnumLock(t *testing.T) {
+	outs := renderGenerations(t, testOptions(t), filepath.Join(t.TempDir(), "lock.json"), enumSpec("old, new"), enumSpec("old, mid, new"), enumSpec("new"), enumSpec("old, new"))
+	for i, want := range []string{
+		"  STATUS_UNSPECIFIED = 0;\n  STATUS_OLD = 1;\n  STATUS_NEW = 2;\n}",
+		"  STATUS_OLD = 1;\n  STATUS_MID = 3;\n  STATUS_NEW = 2;\n}",
+		"  STATUS_NEW = 2;\n  reserved 1, 3;\n}",
+		"  STATUS_OLD = 1;\n  STATUS_NEW = 2;\n  reserved 3;\n}",
+	} {
+		if !strings.Contains(outs[i], want) {
+			t.Errorf("generation %d: missing %q in\n%s", i+1, want, outs[i])
+		}
+	}
+}
+
+func TestReservedNumberRange(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		messages map[string]map[string]int
+		enums    map[string]map[string]int
+		want     []string
+		err      string
+	}{
+		{"fields skip the range", map[string]map[string]int{"api.v1.Pet": {"old": 18999}}, nil,
+			[]string{"string old = 18999;", "string new = 20000;"}, ""},
+		{"enum values may use it", nil, map[string]map[string]int{"api.v1.Status": {"STATUS_OLD": 18999}},
+			[]string{"STATUS_OLD = 18999;", "STATUS_NEW = 19000;"}, ""},
+		{"locked field in the range", map[string]map[string]int{"api.v1.Pet": {"old": 19500}}, nil,
+			nil, "Pet.old: field number 19500 is in the range 19000-19999"},
+		{"locked field above the maximum", map[string]map[string]int{"api.v1.Pet": {"old": maxFieldNumber + 1}}, nil,
+			nil, "Pet.old: field number 536870912 is outside 1-536870911"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, errs := renderLocked(t, testOptions(t), tc.messages, tc.enums)
+			if tc.err != "" {
+				if !strings.Contains(strings.Join(errs, "\n"), tc.err) {
+					t.Errorf("errors %q, want one containing %q", errs, tc.err)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestHashNumbering(t *testing.T) {
+	// the numbers are part of the output contract: independent runs must agree
+	want := map[string]int{"name": 221887979, "id": 389573346, "zeta": 91498691}
+	for _, tc := range []struct {
+		name, props string
+		sort        bool
+	}{
+		{"sorted", "{name: {type: string}, id: {type: string}}", true},
+		{"declaration order", "{id: {type: string}, name: {type: string}}", false},
+		{"another property added", "{zeta: {type: string}, name: {type: string}, id: {type: string}}", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := testOptions(t)
+			opts.numbering, opts.sortFields = numberingHash, tc.sort
+			out := renderSpec(t, opts, "hash.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Pet: {type: object, properties: `+tc.props+`}
+`)
+			fields := messageFields(out, "Pet")
+			if len(fields) != strings.Count(tc.props, "type:") {
+				t.Fatalf("fields = %v in\n%s", fields, out)
+			}
+			for _, f := range fields {
+				if line := fmt.Sprintf("string %s = %d;", f, want[f]); !strings.Contains(out, line) {
+					t.Errorf("missing %q in\n%s", line, out)
+				}
+			}
+		})
+	}
+}
+
+func TestHashNumberProbing(t *testing.T) {
+	const slot = 221887979 // hash slot of "name"
+	for _, tc := range []struct {
+		name string
+		n    *numberer
+		want int
+	}{
+		{"free slot", &numberer{hash: true, fields: true, used: map[int]bool{}}, slot},
+		{"taken by another field", &numberer{hash: true, fields: true, used: map[int]bool{slot: true, slot + 1: true}}, slot + 2},
+		{"taken in the lock", &numberer{hash: true, fields: true, used: map[int]bool{}, entries: map[string]int{"old": slot}}, slot + 1},
+		{"inside -reserve-range", &numberer{hash: true, fields: true, used: map[int]bool{}, spare: [2]int{slot - 5, slot + 5}}, slot + 6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.n.allocate("name"); got != tc.want {
+				t.Errorf("allocate = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// oneofSpec is a spec whose Pet holds a oneof of the given branches.
+func oneofSpec(props, branches string) string {
+	return `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Cat: {type: object, properties: {meow: {type: boolean}}}
+    Dog: {type: object, properties: {bark: {type: string}}}
+    Pet:
+      type: object
+      properties: ` + props + `
+      oneOf:` + branches + `
+`
+}
+
+const (
+	catBranch  = "\n        - $ref: '#/components/schemas/Cat'"
+	dogBranch  = "\n        - $ref: '#/components/schemas/Dog'"
+	birdBranch = "\n        - {title: Bird, type: object, properties: {tweet: {type: string}}}"
+	fishBranch = "\n        - {title: Goldfish Info, type: object, properties: {bubbles: {type: integer}}}"
+	textBranch = "\n        - {type: string}"
+)
+
+func TestOneofLock(t *testing.T) {
+	outs := renderGenerations(t, testOptions(t), filepath.Join(t.TempDir(), "lock.json"),
+		oneofSpec("{name: {type: string}}", catBranch+dogBranch+fishBranch),
+		oneofSpec("{name: {type: string}, age: {type: integer}}", catBranch+birdBranch+dogBranch+fishBranch+textBranch),
+		oneofSpec("{name: {type: string}, age: {type: integer}}", dogBranch+fishBranch+textBranch))
+	for _, tc := range []struct {
+		generation int
+		want       []string
+	}{
+		{1, []string{"string name = 1;", "Cat cat = 2;", "Dog dog = 3;", "PetGoldfishInfo goldfish_info = 4;"}},
+		// new branches take free numbers of the oneof's range, new fields
+		// come after it
+		{2, []string{"Cat cat = 2;", "PetBird bird = 5;", "Dog dog = 3;", "PetGoldfishInfo goldfish_info = 4;", "string choice_5 = 6;", "int64 age = 18;"}},
+		{3, []string{"Dog dog = 3;", "PetGoldfishInfo goldfish_info = 4;", "string choice_3 = 7;", "reserved 2, 5, 6;"}},
+	} {
+		out := outs[tc.generation-1]
+		for _, want := range tc.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("generation %d: missing %q in\n%s", tc.generation, want, out)
+			}
+		}
+	}
+}
+
+// TestOneofLegacyNames checks that members locked under their positional
+// name keep their number once they are named from the branch.
+func TestOneofLegacyNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock.json")
+	if err := os.WriteFile(path, []byte(`{"version": 1,
+  "messages": {"api.v1.Pet": {"name": 1, "choice_1": 3, "choice_2": 2}},
+  "oneofs": {"api.v1.Pet": {"one_of": [2, 17]}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := renderGenerations(t, testOptions(t), path, oneofSpec("{name: {type: string}}", catBranch+dogBranch))[0]
+	for _, want := range []string{"Cat cat = 3;", "Dog dog = 2;"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestParseReserveRange(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want [2]int
+		err  bool
+	}{
+		{"100-199", [2]int{100, 199}, false},
+		{" 100 - 199 ", [2]int{100, 199}, false},
+		{"7", [2]int{7, 7}, false},
+		{"20000-20010", [2]int{20000, 20010}, false},
+		{"199-100", [2]int{}, true},
+		{"0-10", [2]int{}, true},
+		{"18990-19010", [2]int{}, true},
+		{"1-536870912", [2]int{}, true},
+		{"a-b", [2]int{}, true},
+	} {
+		got, err := parseReserveRange(tc.in)
+		if (err != nil) != tc.err || got != tc.want {
+			t.Errorf("parseReserveRange(%q) = %v, %v; want %v, error %t", tc.in, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestSpareRange(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		spare    [2]int
+		messages map[string]map[string]int
+		want     []string
+		warning  string
+	}{
+		{"block skipped by new fields", [2]int{1, 1}, nil,
+			[]string{"string new = 2;", "string old = 3;", "  reserved 1;\n}"}, ""},
+		{"range", [2]int{2, 10}, nil,
+			[]string{"string new = 1;", "string old = 11;", "  reserved 2 to 10;\n}"}, ""},
+		{"locked numbers kept", [2]int{2, 10}, map[string]map[string]int{"api.v1.Pet": {"new": 1, "old": 2}},
+			[]string{"string new = 1;", "string old = 2;"}, "field numbers 2 already lie in -reserve-range 2-10"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := testOptions(t)
+			opts.reserveRange = tc.spare
+			opts.diags = &diagnostics{}
+			out, errs := renderLocked(t, opts, tc.messages, nil)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in\n%s", want, out)
+				}
+			}
+			var warnings []string
+			for _, d := range opts.diags.entries {
+				if d.Kind == "reserve-range" {
+					warnings = append(warnings, d.Message)
+				}
+			}
+			switch {
+			case tc.warning == "" && len(warnings) > 0:
+				t.Errorf("unexpected warnings %q", warnings)
+			case tc.warning != "" && (len(warnings) != 1 || !strings.Contains(warnings[0], tc.warning)):
+				t.Errorf("warnings %q, want one containing %q", warnings, tc.warning)
+			}
+			if tc.warning != "" && strings.Contains(out, "reserved 2 to 10") {
+				t.Errorf("spare block emitted over locked numbers:\n%s", out)
+			}
+			if !strings.Contains(out, "STATUS_OLD = 1;") {
+				t.Errorf("enum values are not subject to -reserve-range:\n%s", out)
+			}
+		})
+	}
+}
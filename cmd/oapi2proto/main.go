@@ -5,21 +5,83 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
-
-	"gopkg.in/yaml.v3"
 )
 
 // Simplified OAS structures (minimal fields used)
 type Document struct {
+	Info       Info      `json:"info" yaml:"info"`
+	Servers    []*Server `json:"servers" yaml:"servers"`
+	Tags       []*Tag    `json:"tags" yaml:"tags"`
 	Components struct {
-		Schemas map[string]*Schema `json:"schemas" yaml:"schemas"`
+		Schemas       map[string]*Schema      `json:"schemas" yaml:"schemas"`
+		Parameters    map[string]*Parameter   `json:"parameters" yaml:"parameters"`
+		RequestBodies map[string]*RequestBody `json:"requestBodies" yaml:"requestBodies"`
+		Responses     map[string]*Response    `json:"responses" yaml:"responses"`
 	} `json:"components" yaml:"components"`
+	Paths map[string]*PathItem `json:"paths" yaml:"paths"`
+	// DefaultHost / OAuthScopes 生成各 service 的 (google.api.default_host) / (google.api.oauth_scopes)
+	DefaultHost string   `json:"x-default-host" yaml:"x-default-host"`
+	OAuthScopes []string `json:"x-oauth-scopes" yaml:"x-oauth-scopes"`
+
+	// source 是文档来源文件 (诊断信息使用)
+	source string
+	// warnings 是解析 / 预处理阶段的诊断, 生成时并入 -report
+	warnings []diagnostic
+	// renamedFrom 记录被重命名的组件 schema 的原名 (新名 -> 原名)
+	renamedFrom map[string]string
+	// files 将来源文件名 (origin 中的前缀) 映射到其路径
+	files map[string]string
+	// channels 是 AsyncAPI 输入的 channel operation (-services 生成 rpc)
+	channels []*channelOp
+	// externalTypes 是在其他文件中定义的 schema 的映射: -google-types=apply 识别出的
+	// google.type 类型, 以及 x-proto-package 拆分到其他 package 的 schema
+	externalTypes map[string]TypeMapping
+	// goPackage 覆盖拆分出的子 package 文件的 go_package (未设置 -go-pkg-template 时)
+	goPackage string
+	// schemaOrder 是组件 schema 在 spec 中的声明顺序 (-sort=false 时的输出顺序)
+	schemaOrder []string
+}
+
+// warn records a parse-time diagnostic.
+func (d *Document) warn(kind, subject, msg string) {
+	d.warnings = append(d.warnings, diagnostic{Subject: subject, Kind: kind, Severity: severityWarning, Message: msg})
+}
+
+type Info struct {
+	Title       string `json:"title" yaml:"title"`
+	Version     string `json:"version" yaml:"version"`
+	Description string `json:"description" yaml:"description"`
+	Contact     struct {
+		Name  string `json:"name" yaml:"name"`
+		Email string `json:"email" yaml:"email"`
+		URL   string `json:"url" yaml:"url"`
+	} `json:"contact" yaml:"contact"`
+}
+
+type Tag struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+}
+
+type Server struct {
+	URL         string `json:"url" yaml:"url"`
+	Description string `json:"description" yaml:"description"`
+}
+
+// empty reports whether the document has nothing to generate from.
+func (d *Document) empty() bool {
+	return len(d.Components.Schemas) == 0 && len(d.Paths) == 0
 }
 
 type Schema struct {
@@ -36,50 +98,294 @@ type Schema struct {
 	Nullable    bool               `json:"nullable" yaml:"nullable"`
 	AddlProps   *Schema            `json:"additionalProperties" yaml:"additionalProperties"`
 	Description string             `json:"description" yaml:"description"`
+	Const       any                `json:"const" yaml:"const"`
+	Title       string             `json:"title" yaml:"title"`
+	Deprecated  bool               `json:"deprecated" yaml:"deprecated"`
+	PrefixItems []*Schema          `json:"prefixItems" yaml:"prefixItems"`
+	// PatternProperties 由 normalizePatternProperties 折叠为 map 或 Struct
+	PatternProperties map[string]*Schema `json:"patternProperties" yaml:"patternProperties"`
+	UnevaluatedProps  *Schema            `json:"unevaluatedProperties" yaml:"unevaluatedProperties"`
+	Minimum           *float64           `json:"minimum" yaml:"minimum"`
+	Maximum           *float64           `json:"maximum" yaml:"maximum"`
+	// ExclusiveMinimum / ExclusiveMaximum: 3.0 为 bool, 3.1 为数值
+	ExclusiveMinimum any      `json:"exclusiveMinimum" yaml:"exclusiveMinimum"`
+	ExclusiveMaximum any      `json:"exclusiveMaximum" yaml:"exclusiveMaximum"`
+	MultipleOf       *float64 `json:"multipleOf" yaml:"multipleOf"`
+	Default          any      `json:"default" yaml:"default"`
+	ReadOnly         bool     `json:"readOnly" yaml:"readOnly"`
+	WriteOnly        bool     `json:"writeOnly" yaml:"writeOnly"`
+	Example          any      `json:"example" yaml:"example"`
+	Examples         []any    `json:"examples" yaml:"examples"`
+	// Defs 由 hoistDefs 提升为顶层 schema
+	Defs          map[string]*Schema `json:"$defs" yaml:"$defs"`
+	Definitions   map[string]*Schema `json:"definitions" yaml:"definitions"`
+	ID            string             `json:"$id" yaml:"$id"`
+	Anchor        string             `json:"$anchor" yaml:"$anchor"`
+	DynamicAnchor string             `json:"$dynamicAnchor" yaml:"$dynamicAnchor"`
+	DynamicRef    string             `json:"$dynamicRef" yaml:"$dynamicRef"`
+	// ProtoPackage / Namespace 将组件 schema 放入其他 proto package (见 splitPackages)
+	ProtoPackage string `json:"x-proto-package" yaml:"x-proto-package"`
+	Namespace    string `json:"x-namespace" yaml:"x-namespace"`
+	// XML / ContentEncoding / ContentMediaType 只解析, 不影响 proto (见 warnSerializationHints)
+	XML              *XML   `json:"xml" yaml:"xml"`
+	ContentEncoding  string `json:"contentEncoding" yaml:"contentEncoding"`
+	ContentMediaType string `json:"contentMediaType" yaml:"contentMediaType"`
+	// XNullable (Swagger 2 风格的 x-nullable) 由 normalizeNullable 并入 Nullable
+	XNullable bool `json:"x-nullable" yaml:"x-nullable"`
+	// AIPResource / GoogleResource 生成 (google.api.resource) message option
+	AIPResource    *AIPResource `json:"x-aip-resource" yaml:"x-aip-resource"`
+	GoogleResource *AIPResource `json:"x-google-resource" yaml:"x-google-resource"`
+
+	// propOrder fixes the field order of synthesized schemas (e.g. tuples)
+	propOrder []string
+	// declOrder lists the properties in the order the spec declares them
+	// (recorded at decode time, see propertyNames)
+	declOrder []string
+	// dynamicStruct marks free-form objects mapped to google.protobuf.Struct
+	dynamicStruct bool
+	// boolValue is set for boolean schemas (`additionalProperties: false` ...)
+	boolValue *bool
+	// closed marks objects forbidding extra properties
+	closed string
+	// open marks objects declaring `additionalProperties: true`
+	open bool
+	// lower / upper are the normalized numeric bounds
+	lower, upper *bound
+	// yamlAnchor is the YAML anchor (&name) defining this node, also set on
+	// every alias (*name) of it
+	yamlAnchor string
+	// rwSplit marks components with -split-read-write variants; rwVariant
+	// marks the generated <Name>Input / <Name>Output variants
+	rwSplit, rwVariant bool
+	// typeUnion holds the non-null entries of a multi-type `type` array
+	typeUnion []string
+	// origin is the JSON pointer (prefixed with the file name) the schema
+	// was decoded from, see annotateOrigins
+	origin string
 }
 
 func main() {
-	in := flag.String("in", "openapi.json", "openapi v3 文件或目录 (json|yaml|yml)")
-	out := flag.String("out", "api.proto", "输出 proto 文件 (单文件模式) 或目录 (目录输入模式)")
-	pkg := flag.String("pkg", "api.v1", "proto package")
-	goPkg := flag.String("go_pkg", "example.com/project/api/v1;v1", "go_package option value")
-	useOptional := flag.Bool("use-optional", true, "为 nullable 标量生成 optional")
-	anyOfMode := flag.String("anyof", "oneof", "anyof 处理: oneof|repeat")
-	sortFields := flag.Bool("sort", true, "按字母排序 schema 与字段以获得稳定结果")
+	if len(os.Args) > 1 && os.Args[1] == "examples" {
+		runExamples(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		runLint(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		runBench(os.Args[2:])
+		return
+	}
+	gen := registerGenFlags(flag.CommandLine)
+	in := flag.String("in", "openapi.json", "openapi v3 文件、目录、http(s) URL、zip/tar 归档 (bundle.zip[//root.yaml]) 或 git+https://host/repo.git//path/spec.yaml@ref (json|yaml|yml)")
+	out := flag.String("out", "api.proto", "输出 proto 文件 (单文件模式) 或目录 (目录输入模式); 以 .zip/.tar/.tar.gz/.tgz 结尾时打包为归档")
 	parallel := flag.Int("parallel", 0, "并行文件数量 (0=auto,1=串行)")
+	breaking := flag.String("breaking", breakingOff, "与已有输出比较的不兼容变更处理: off|warn|fail|bump (bump: 升级 package 版本并输出到并列目录)")
+	lockPath := flag.String("lock", "", "字段号 / 枚举值编号锁文件 (json), 已分配编号永久保持, 不存在时创建")
+	force := flag.Bool("force", false, "覆盖不带生成标记 (\""+generatedMarker+"\") 的已有输出文件 (默认拒绝, 以免覆盖手写文件)")
+	backup := flag.Bool("backup", false, "覆盖已有输出 (内容有变化) 前将其保存为 <file>.bak")
+	cachePath := flag.String("cache", "", "增量生成缓存文件 (json): 记录每个输入解析后 schema 的指纹, 未变更 (且输出未被改动) 的文件跳过生成; 与 -manifest 同用时不生效")
+	reportPath := flag.String("report", "", "将诊断 / 有损转换报告写入 json 文件")
+	format := flag.String("format", formatProto, "输出格式: proto|textproto-descriptor (protobuf 文本格式的 FileDescriptorProto, 目录模式扩展名为 .txtpb)")
+	serviceConfigFlag := flag.Bool("service-config", false, "额外输出 <name>_service_config.json: 由 operation 的 x-timeout / x-retry 生成 gRPC service config (methodConfig 的 timeout 与 retryPolicy)")
+	sourceMapFlag := flag.Bool("source-map", false, "额外输出 <name>.map.json, 记录每个 message/enum/字段对应的源 JSON pointer 与行号")
+	diagStyle := flag.String("diag-style", diagStyleAuto, "警告与错误的输出格式: auto (终端上为 pretty), plain (每条一行), pretty (按 schema 分组并附 spec 源码行)")
+	colorMode := flag.String("color", colorAuto, "pretty 诊断是否着色: auto (终端且未设置 NO_COLOR), always, never")
+	cpuProfile := flag.String("cpuprofile", "", "将 CPU profile 写入文件 (go tool pprof 格式), 用于排查大型 spec 的性能问题")
+	memProfile := flag.String("memprofile", "", "结束时将堆 profile 写入文件 (go tool pprof 格式)")
+	pprofAddr := flag.String("pprof", "", "运行期间在该地址 (如 localhost:6060) 提供 net/http/pprof 端点 (/debug/pprof/)")
+	metricsPath := flag.String("metrics", "", "以 OpenMetrics (Prometheus 文本) 格式写出运行指标: 是否成功, 各阶段耗时, 输入 / 输出 / schema 计数, 按级别与类别统计的诊断")
+	failOnWarn := flag.Bool("fail-on-warn", false, "存在任何警告 (有损转换, 标识符重命名, 丢弃的关键字等) 时以非零状态退出, 用于 CI")
+	keepGoing := flag.Bool("keep-going", false, "单个 schema 生成失败时跳过它 (输出占位注释) 并继续, 结束时汇总跳过的 schema 并以非零状态退出")
+	manifestPath := flag.String("manifest", "", "输出 JSON 清单: 每个 OpenAPI schema/属性对应的 proto message/字段 (含重命名与合成类型)")
+	var postHooks, verifyIncludes stringList
+	verify := flag.String("verify", "", "生成后编译校验: internal (内置检查: 重名 / 字段号 / 保留号 / 未定义类型)|protoc|buf (外部工具, 不可用时退回 internal); 错误标注来源 schema 指针")
+	flag.Var(&verifyIncludes, "verify-include", "-verify=protoc 额外的 proto 搜索目录 (可重复, 如 googleapis 所在目录)")
+	flag.Var(&postHooks, "post-hook", "每个生成文件写出后执行的命令 (可重复, 经 sh -c / cmd /C 执行), {} 或 {path} 替换为文件路径, {dir} 目录, {name} 文件名, 如 \"buf format -w {}\"")
 	flag.Parse()
 
-	info, err := os.Stat(*in)
+	opts, err := gen.options()
 	if err != nil {
 		fatal(err)
 	}
-
-	// 单文件行为维持原样
-	if !info.IsDir() {
-		if err := generateForFile(*in, *out, *pkg, *goPkg, *useOptional, *anyOfMode, *sortFields); err != nil {
+	switch *breaking {
+	case breakingOff, breakingWarn, breakingFail, breakingBump:
+	default:
+		fatal(fmt.Errorf("未知 -breaking 取值: %s", *breaking))
+	}
+	opts.breaking = *breaking
+	if *format != formatProto && *format != formatTextprotoDescriptor {
+		fatal(fmt.Errorf("未知 -format 取值: %s", *format))
+	}
+	if *format != formatProto && opts.breaking != breakingOff {
+		fatal(errors.New("-breaking 仅支持 -format proto"))
+	}
+	opts.format = *format
+	opts.sourceMap = *sourceMapFlag
+	opts.serviceConfig = *serviceConfigFlag
+	opts.force = *force
+	opts.postHooks = postHooks
+	switch *verify {
+	case "", verifyInternal:
+	case verifyProtoc, verifyBuf:
+		if *format != formatProto {
+			fatal(fmt.Errorf("-verify=%s 需要 -format proto", *verify))
+		}
+	default:
+		fatal(fmt.Errorf("未知 -verify 取值: %s", *verify))
+	}
+	opts.verify = *verify
+	opts.verifyIncludes = verifyIncludes
+	opts.backup = *backup
+	if *failOnWarn { // 最先注册: 其余收尾完成后才检查警告
+		defer func() { opts.diags.exitOnWarnings() }()
+	}
+	if *keepGoing { // 先于其余收尾注册: 其余收尾完成后才以非零状态退出
+		opts.skipped = &skippedSchemas{}
+		defer opts.skipped.exitIfAny()
+	}
+	if *metricsPath != "" { // 在退出检查之前, 其余收尾之后写出; 运行失败时由 fatal 写出
+		opts.metrics = newMetrics(*metricsPath)
+		flushMetrics = func(success bool) {
+			flushMetrics = func(bool) {}
+			if err := opts.metrics.write(opts.diags, success); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+			}
+		}
+		defer func() {
+			success := opts.skipped == nil || len(opts.skipped.entries) == 0
+			if *failOnWarn && opts.diags.count(severityWarning) > 0 {
+				success = false
+			}
+			flushMetrics(success)
+		}()
+	}
+	// 在 -fail-on-warn / -keep-going 的退出检查之前, 其余收尾之后写出 profile
+	stop, err := startProfiling(*cpuProfile, *memProfile, *pprofAddr)
+	if err != nil {
+		fatal(err)
+	}
+	stopProfiling = stop
+	defer stop()
+	// -out 为归档时先输出到临时目录, 结束后打包 (先注册, 在其余收尾写出之后执行)
+	staging := ""
+	if archiveOut := *out; isArchiveOutput(archiveOut) {
+		if staging, err = os.MkdirTemp("", "oapi2proto-out-"); err != nil {
 			fatal(err)
 		}
-		return
+		*out = staging
+		defer func() {
+			err := opts.writeArchive(archiveOut, os.DirFS(staging))
+			os.RemoveAll(staging)
+			if err != nil {
+				fatal(err)
+			}
+		}()
+	}
+	if *manifestPath != "" {
+		opts.manifest = &manifest{path: *manifestPath, root: staging}
+		defer func() {
+			if err := opts.manifest.write(); err != nil {
+				fatal(err)
+			}
+		}()
+	}
+	defer func() {
+		if err := opts.writeCustomOptions(); err != nil {
+			fatal(err)
+		}
+	}()
+	if *gen.layout == layoutBufModule {
+		root := *out
+		if ext := strings.ToLower(filepath.Ext(root)); ext == ".proto" || ext == opts.outputExt() {
+			root = filepath.Dir(root)
+		}
+		opts.module = &bufModule{root: root, name: *gen.bufName, deps: map[string]bool{}}
+		defer func() {
+			if err := opts.module.writeBufYAML(); err != nil {
+				fatal(err)
+			}
+		}()
+	}
+	opts.diags = &diagnostics{}
+	switch *diagStyle {
+	case diagStyleAuto:
+		opts.diags.pretty = isTerminal(os.Stderr)
+	case diagStylePlain:
+	case diagStylePretty:
+		opts.diags.pretty = true
+	default:
+		fatal(fmt.Errorf("未知 -diag-style 取值: %s", *diagStyle))
+	}
+	switch *colorMode {
+	case colorAuto, colorAlways, colorNever:
+	default:
+		fatal(fmt.Errorf("未知 -color 取值: %s", *colorMode))
+	}
+	opts.diags.color = useColor(*colorMode)
+	pendingDiags = opts.diags
+	defer func() {
+		opts.diags.print()
+		if *reportPath != "" {
+			if err := opts.diags.writeReport(*reportPath); err != nil {
+				fatal(err)
+			}
+		}
+	}()
+	if *lockPath != "" {
+		if opts.lock, err = loadLockFile(*lockPath); err != nil {
+			fatal(err)
+		}
+		defer func() {
+			if err := opts.lock.save(); err != nil {
+				fatal(err)
+			}
+		}()
+	}
+	if *cachePath != "" && opts.manifest == nil {
+		fp, err := optionsFingerprint(*gen.configPath)
+		if err != nil {
+			fatal(err)
+		}
+		if opts.cache, err = loadGenCache(*cachePath, fp); err != nil {
+			fatal(err)
+		}
+		defer func() {
+			if err := opts.cache.save(); err != nil {
+				fatal(err)
+			}
+		}()
 	}
-	// 是否合并为单一 proto 文件: 目录输入 + 输出以 .proto 结尾
-	combine := strings.HasSuffix(strings.ToLower(*out), ".proto")
 
-	// 收集文件 (目录模式通用)
-	var files []string
-	walkFn := func(p string, d fs.DirEntry, err error) error {
+	isDir := false
+	if !isRemoteSpec(*in) && !isArchiveSpec(*in) {
+		info, err := os.Stat(*in)
 		if err != nil {
-			return err
+			fatal(err)
 		}
-		if d.IsDir() {
-			return nil
+		isDir = info.IsDir()
+	}
+
+	// 单文件行为维持原样
+	if !isDir {
+		outFile := *out
+		if (opts.module != nil && outFile == opts.module.root) || outFile == staging { // -out 为模块根目录或归档
+			base := inputBase(*in)
+			outFile = filepath.Join(outFile, opts.outputBase(strings.TrimSuffix(base, filepath.Ext(base)))+opts.outputExt())
 		}
-		lower := strings.ToLower(d.Name())
-		if strings.HasSuffix(lower, ".json") || strings.HasSuffix(lower, ".yaml") || strings.HasSuffix(lower, ".yml") {
-			files = append(files, p)
+		opts.setOutRoot(filepath.Dir(outFile))
+		if err := generateForFile(*in, outFile, opts); err != nil && !errors.Is(err, errUpToDate) {
+			fatal(err)
 		}
-		return nil
+		return
 	}
-	if err := filepath.WalkDir(*in, walkFn); err != nil {
+	// 是否合并为单一 proto 文件: 目录输入 + 输出以 .proto 结尾
+	combine := strings.HasSuffix(strings.ToLower(*out), ".proto") || strings.HasSuffix(strings.ToLower(*out), opts.outputExt())
+
+	// 收集文件 (目录模式通用)
+	files, err := specFiles(*in)
+	if err != nil {
 		fatal(err)
 	}
 	if len(files) == 0 {
@@ -88,7 +394,8 @@ func main() {
 	sort.Strings(files)
 
 	if combine {
-		if err := generateCombined(files, *out, *pkg, *goPkg, *useOptional, *anyOfMode, *sortFields); err != nil {
+		opts.setOutRoot(filepath.Dir(*out))
+		if err := generateCombined(files, *out, opts); err != nil {
 			fatal(err)
 		}
 		return
@@ -102,6 +409,7 @@ func main() {
 			outDir = "protos"
 		}
 	}
+	opts.setOutRoot(outDir)
 	if err := os.MkdirAll(outDir, 0o755); err != nil {
 		fatal(err)
 	}
@@ -129,8 +437,8 @@ func main() {
 			for j := range jobs {
 				base := filepath.Base(j.inFile)
 				base = strings.TrimSuffix(base, filepath.Ext(base))
-				outFile := filepath.Join(outDir, base+".proto")
-				rErr := generateForFile(j.inFile, outFile, *pkg, *goPkg, *useOptional, *anyOfMode, *sortFields)
+				outFile := filepath.Join(outDir, opts.outputBase(base)+opts.outputExt())
+				rErr := generateForFile(j.inFile, outFile, opts)
 				results <- result{file: j.inFile, err: rErr}
 			}
 		}()
@@ -144,7 +452,9 @@ func main() {
 	var failed []string
 	for i := 0; i < len(files); i++ {
 		r := <-results
-		if r.err != nil {
+		if errors.Is(r.err, errUpToDate) {
+			fmt.Fprintf(os.Stderr, "[SKIP] %s (未变更)\n", r.file)
+		} else if r.err != nil {
 			fmt.Fprintf(os.Stderr, "[FAIL] %s: %v\n", r.file, r.err)
 			failed = append(failed, r.file)
 		} else {
@@ -156,116 +466,620 @@ func main() {
 	}
 }
 
-// generateForFile 处理单个 openapi 文件 -> proto
-func generateForFile(inFile, outFile, pkg, goPkg string, useOptional bool, anyOfMode string, sortFields bool) error {
-	data, err := os.ReadFile(inFile)
-	if err != nil {
-		return err
+// Presence strategies controlling when fields are marked optional.
+const (
+	presenceNone        = "none"
+	presenceNullable    = "nullable"
+	presenceNonRequired = "non-required"
+	presenceAll         = "all"
+)
+
+// genOptions 汇总命令行生成选项, 在所有文件间共享 (只读)
+type genOptions struct {
+	pkg        string
+	goPkg      string
+	presence   string
+	anyOfMode  string
+	sortFields bool
+	// requiredFirst 让 required 字段占用最小字段号
+	requiredFirst bool
+	// goPkgTemplate 非空时按输出文件推导 go_package
+	goPkgTemplate *template.Template
+	// lock 非空时字段号 / 枚举值编号从锁文件读取并回写
+	lock *lockFile
+	// validate 选择生成的校验规则方言 (none|protovalidate)
+	validate string
+	// diags 收集诊断信息 (有损转换记录)
+	diags *diagnostics
+	// breaking 为已有输出的不兼容变更处理方式 (off|warn|fail|bump)
+	breaking string
+	// pkgFromInfo 由 info.title / info.version 推导 package
+	pkgFromInfo bool
+	// goPkgSet 表示显式设置了 -go_pkg; 未设置时 -pkg-from info 的 go_package 随 package 推导
+	goPkgSet bool
+	// infoComment 输出 info / servers 文件级注释
+	infoComment bool
+	// services 控制是否/如何由 paths 生成 service (none|single|path|tag|config)
+	services    string
+	serviceName string
+	config      *Config
+	// importRoots 将逻辑 import 路径前缀映射为实际构建布局下的路径
+	importRoots map[string]string
+	// publicImports 以 import public 形式输出 (并总是输出) 的 import
+	publicImports []string
+	// extraImports 是 -import 强制输出的 import (与自动管理的 import 去重)
+	extraImports []string
+	// verify 非空时写出后用 internal|protoc|buf 编译校验生成结果
+	verify string
+	// verifyIncludes 是 -verify=protoc 额外的 -I 目录
+	verifyIncludes []string
+	// fetcher 下载 (并缓存) http(s) 输入
+	fetcher *httpFetcher
+	// postHooks 是每个生成文件写出后执行的 -post-hook 命令
+	postHooks []string
+	// force 允许覆盖不是本工具生成的已有输出文件
+	force bool
+	// backup 覆盖前将原输出保存为 <file>.bak
+	backup bool
+	// cache 非空时 (-cache) 跳过输入指纹未变的文件
+	cache *genCache
+	// fileOptions 是 -option 追加到每个文件头部的 option 语句
+	fileOptions []string
+	// inputFormat 为输入文档格式 (openapi|jsonschema|asyncapi)
+	inputFormat string
+	// format 为输出格式 (proto|textproto-descriptor)
+	format string
+	// module 非空时按 buf module 布局输出 (-layout buf-module)
+	module *bufModule
+	// style 为命名与结构风格 (default|buf)
+	style string
+	// http 控制由 paths 生成的 HTTP 转码规则 (none|annotations|yaml|both)
+	http string
+	// openapiv2 输出 protoc-gen-openapiv2 注解以便回生成 OpenAPI 文档
+	openapiv2 bool
+	// untyped 为无类型 schema 的映射 (string|value|any|error)
+	untyped string
+	// nullableArrays 为 nullable 数组的处理方式 (ignore|wrapper|listvalue|comment)
+	nullableArrays string
+	// splitRW 为混用 readOnly / writeOnly 的 schema 生成 Input / Output 变体
+	splitRW bool
+	// defaults 控制 schema default 的输出方式 (none|comment|option)
+	defaults string
+	// exampleComments 将 example / examples 写入字段与 message 注释
+	exampleComments bool
+	// maxDepth 限制内联 object 展开深度 (0 不限制)
+	maxDepth int
+	// numbering 为新字段的编号方式 (sequential|hash)
+	numbering string
+	// reserveRange 为每个 message 预留的备用字段号区间 (-reserve-range), 零值表示不预留
+	reserveRange [2]int
+	// provenance 在 message / 字段上方输出来源 JSON pointer 注释
+	provenance bool
+	// enumMode 为 enum 的映射方式 (proto|string)
+	enumMode string
+	// enumDigitPrefix 加在以数字开头的 enum 值名之前
+	enumDigitPrefix string
+	// enumZero 为 enum 零值的命名方式 (unspecified|unknown|default)
+	enumZero string
+	// mapMode 为 additionalProperties map 的表示方式 (map|entries)
+	mapMode string
+	// caseConflict 为仅大小写不同的类型名的处理策略 (warn|rename|error)
+	caseConflict string
+	// inlineNames 为内联类型的命名方式 (path|hash)
+	inlineNames string
+	// dedupInline 使结构相同的内联 schema 共享同一 message
+	dedupInline bool
+	// skipped 非空时 (-keep-going) 收集生成失败而被跳过的 schema
+	skipped *skippedSchemas
+	// metrics 非空时 (-metrics) 收集运行指标
+	metrics *metrics
+	// manifest 收集 -manifest 的 schema/属性 -> message/字段 映射 (nil 表示不输出)
+	manifest *manifest
+	// pluralFields 为数组字段名的复数化策略 (off|warn|rename)
+	pluralFields string
+	// stripSuffixes 是从组件 schema 名末尾去掉的后缀 (-strip-suffix)
+	stripSuffixes []string
+	// googleTypes 为 google.type 结构识别模式 (off|report|apply)
+	googleTypes string
+	// emitOrigin 在 message 上输出 (oapi2proto.origin) 选项 (schema / 来源 / spec 版本)
+	emitOrigin bool
+	// sourceMap 输出 <name>.map.json (生成元素 -> 源 JSON pointer / 行号)
+	sourceMap bool
+	// serviceConfig 输出 <name>_service_config.json (x-timeout / x-retry)
+	serviceConfig bool
+	// print 控制输出排版 (缩进 / 行宽 / 空行 / 行尾注释对齐)
+	print printOptions
+	// outRoot 是输出根目录 (共享的 oapi2proto/options.proto 写在这里)
+	outRoot string
+	// customOptions 记录是否有文件引用了自定义 option
+	customOptions atomic.Bool
+}
+
+// goPackageData 是 -go-pkg-template 可用的字段
+type goPackageData struct {
+	Package      string // proto package 的路径形式, 如 api/v1
+	ProtoPackage string // proto package 原样, 如 api.v1
+	Alias        string // package 最后一段, 如 v1
+	File         string // 输出文件名 (不含扩展名)
+}
+
+// goPackageFor 返回某个输出文件的 go_package 取值: -go-pkg-template 优先; -pkg-from info
+// 且未显式设置 -go_pkg 时按推导出的 package 改写 -go_pkg 默认值 (见 subGoPackage)
+func (o *genOptions) goPackageFor(pkg, outFile string) (string, error) {
+	if o.goPkgTemplate == nil {
+		if o.pkgFromInfo && !o.goPkgSet {
+			return subGoPackage(o.goPkg, o.pkg, pkg), nil
+		}
+		return o.goPkg, nil
 	}
-	doc, err := parseDocument(data)
-	if err != nil {
-		return fmt.Errorf("%s: %w", inFile, err)
+	base := filepath.Base(outFile)
+	data := goPackageData{
+		Package:      strings.ReplaceAll(pkg, ".", "/"),
+		ProtoPackage: pkg,
+		Alias:        goAlias(pkg),
+		File:         strings.TrimSuffix(base, filepath.Ext(base)),
 	}
 	var b strings.Builder
+	if err := o.goPkgTemplate.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("go-pkg-template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// goAlias derives a Go package name from the last proto package segment.
+func goAlias(pkg string) string {
+	last := pkg
+	if i := strings.LastIndex(pkg, "."); i >= 0 {
+		last = pkg[i+1:]
+	}
+	alias := strings.ToLower(strings.ReplaceAll(lowerSnake(last), "_", ""))
+	if alias == "" || (alias[0] >= '0' && alias[0] <= '9') {
+		alias = "pb" + alias
+	}
+	return alias
+}
+
+// writeFileHeader 写入生成标记 / syntax / package / import / go_package / -option 头部;
+// pkgComment 非空时作为 package 的前置注释
+func writeFileHeader(b *strings.Builder, pkg, goPkg, pkgComment string, imports []protoImport, options []string) {
+	b.WriteString("// " + generatedMarker + "\n")
 	b.WriteString("syntax = \"proto3\";\n")
+	if pkgComment != "" {
+		b.WriteString("\n" + pkgComment)
+	}
 	b.WriteString(fmt.Sprintf("package %s;\n", pkg))
-	b.WriteString(fmt.Sprintf("option go_package = \"%s\";\n\n", goPkg))
+	for _, imp := range imports {
+		if imp.public {
+			b.WriteString(fmt.Sprintf("import public \"%s\";\n", imp.path))
+			continue
+		}
+		b.WriteString(fmt.Sprintf("import \"%s\";\n", imp.path))
+	}
+	b.WriteString(fmt.Sprintf("option go_package = \"%s\";\n", goPkg))
+	for _, o := range options {
+		b.WriteString(o + "\n")
+	}
+	b.WriteString("\n")
+}
 
-	names := make([]string, 0, len(doc.Components.Schemas))
-	for name := range doc.Components.Schemas {
-		names = append(names, name)
+// generateForFile 处理单个 openapi 文件 -> proto
+func generateForFile(inFile, outFile string, opts *genOptions) (err error) {
+	defer func() { opts.metrics.countInput(inputStatus(err)) }()
+	doc, err := loadDocument(inFile, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", inFile, err)
 	}
-	if sortFields {
-		sort.Strings(names)
+	doc.source = inFile
+	opts.diags.addDocument(&doc)
+	preamble := ""
+	if opts.infoComment {
+		preamble = infoComment(&doc, "")
 	}
-	ctx := &genContext{doc: &doc, useOptional: useOptional, anyOfMode: anyOfMode, sortFields: sortFields, visited: map[string]bool{}}
-	for _, name := range names {
-		ctx.emitSchema(&b, name, doc.Components.Schemas[name])
+	pkg := opts.packageFor(&doc, inFile)
+	if opts.cache == nil {
+		return writePackages(&doc, opts, pkg, outFile, preamble)
 	}
-	if err := os.MkdirAll(filepath.Dir(outFile), 0o755); err != nil {
+	return opts.cachedGenerate(&doc, inFile, opts.layoutPath(pkg, outFile), func() error {
+		return writePackages(&doc, opts, pkg, outFile, preamble)
+	})
+}
+
+// writeProtoFile 渲染并写出单个 proto 文件 (含不兼容变更检查)
+func writeProtoFile(doc *Document, opts *genOptions, pkg, outFile, preamble string) error {
+	outFile = opts.layoutPath(pkg, outFile)
+	goPkg, err := opts.goPackageFor(pkg, outFile)
+	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(outFile, []byte(b.String()), 0o644); err != nil {
+	if doc.goPackage != "" {
+		goPkg = doc.goPackage
+	}
+	var ctx *genContext
+	var content string
+	if opts.canStream() {
+		if ctx, err = opts.streamProtoFile(doc, pkg, goPkg, preamble, outFile); err != nil {
+			return err
+		}
+	} else {
+		render := func(pkg, goPkg string) string {
+			var proto string
+			proto, ctx = renderFile(doc, opts, pkg, goPkg, preamble)
+			return proto
+		}
+		content = render(pkg, goPkg)
+		if len(ctx.errors) > 0 {
+			return fmt.Errorf("%s", strings.Join(ctx.errors, "; "))
+		}
+		outFile, content, err = ctx.checkBreaking(outFile, content, pkg, goPkg, render)
+		if err != nil {
+			return err
+		}
+		if opts.format == formatProto {
+			switch opts.style {
+			case styleBuf:
+				ctx.bufLint(outFile, content)
+			case styleProtolint:
+				ctx.protolintCheck(outFile, content)
+			}
+		}
+		start := time.Now()
+		if err := opts.writeOutput(outFile, content, ctx.siblingEnums()); err != nil {
+			return err
+		}
+		opts.metrics.observe(phaseWrite, start)
+		if opts.verify != "" {
+			if err := ctx.verifyOutput(outFile, content); err != nil {
+				return err
+			}
+		}
+	}
+	opts.metrics.countOutput()
+	if err := opts.runPostHooks(outFile); err != nil {
+		return err
+	}
+	if opts.sourceMap {
+		if err := ctx.writeSourceMap(outFile, content); err != nil {
+			return err
+		}
+	}
+	if opts.manifest != nil {
+		opts.manifest.add(outFile, ctx)
+	}
+	opts.cache.wrote(doc.source, ctx.imports[customOptionsImport], outFile)
+	if opts.sourceMap {
+		opts.cache.wrote(doc.source, false, sourceMapPath(outFile))
+	}
+	if len(ctx.methodConfigs) > 0 {
+		if err := ctx.writeServiceConfig(outFile); err != nil {
+			return err
+		}
+		opts.cache.wrote(doc.source, false, serviceConfigPath(outFile))
+	}
+	if len(ctx.httpRules) == 0 {
+		return nil
+	}
+	if err := opts.writeGenerated(httpConfigPath(outFile), []byte(renderHTTPConfig(ctx.httpRules))); err != nil {
 		return err
 	}
+	opts.cache.wrote(doc.source, false, httpConfigPath(outFile))
 	return nil
 }
 
-// parseDocument 尝试 json / yaml
-func parseDocument(data []byte) (Document, error) {
+// infoComment 将 info / servers 渲染为文件级注释块; source 非空时标注来源文件 (合并模式)
+func infoComment(doc *Document, source string) string {
+	var lines []string
+	if source != "" {
+		lines = append(lines, "Source: "+source)
+	}
+	if doc.Info.Title != "" {
+		lines = append(lines, "API: "+oneline(doc.Info.Title))
+	}
+	if doc.Info.Version != "" {
+		lines = append(lines, "Version: "+oneline(doc.Info.Version))
+	}
+	if doc.Info.Description != "" {
+		lines = append(lines, "Description: "+oneline(doc.Info.Description))
+	}
+	c := doc.Info.Contact
+	if c.Name != "" || c.Email != "" || c.URL != "" {
+		contact := c.Name
+		if c.Email != "" {
+			contact = strings.TrimSpace(contact + " <" + c.Email + ">")
+		}
+		if c.URL != "" {
+			contact = strings.TrimSpace(contact + " (" + c.URL + ")")
+		}
+		lines = append(lines, "Contact: "+oneline(contact))
+	}
+	for _, srv := range doc.Servers {
+		if srv == nil || srv.URL == "" {
+			continue
+		}
+		line := "Server: " + srv.URL
+		if srv.Description != "" {
+			line += " - " + oneline(srv.Description)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 || (source != "" && len(lines) == 1) {
+		return ""
+	}
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString("// " + sanitizeComment(l) + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// renderProto 生成完整 proto 文件内容; preamble 紧随文件头输出
+func renderProto(doc *Document, opts *genOptions, pkg, goPkg, preamble string) string {
+	proto, _ := renderFile(doc, opts, pkg, goPkg, preamble)
+	return proto
+}
+
+// renderFile 渲染 proto 源码, 并返回生成上下文 (http rule、生成错误等)
+func renderFile(doc *Document, opts *genOptions, pkg, goPkg, preamble string) (string, *genContext) {
+	var body strings.Builder
+	ctx, header := renderParts(doc, opts, pkg, goPkg, preamble, &body)
+	return opts.print.apply(header + body.String()), ctx
+}
+
+// renderParts writes the body of a file (messages, enums, services) to w
+// one component at a time, so a streamed file never holds more than one
+// component in memory, and returns the header (which depends on the imports
+// the body used) to be written before it. print options are not applied.
+func renderParts(doc *Document, opts *genOptions, pkg, goPkg, preamble string, w io.Writer) (*genContext, string) {
+	defer opts.metrics.observe(phaseRender, time.Now())
+	ctx := newGenContext(doc, opts)
+	ctx.filePkg = pkg
+	if opts.splitRW {
+		ctx.splitReadWrite()
+	}
+	if opts.caseConflict == caseConflictRename {
+		if err := ctx.renameCaseConflicts(); err != nil {
+			ctx.errors = append(ctx.errors, err.Error())
+		}
+	}
+	names := declaredOrder(doc.Components.Schemas, doc.schemaOrder)
+	if opts.sortFields {
+		sort.Strings(names)
+	}
+	var part strings.Builder
+	flush := func() {
+		ctx.recordTypeNames(part.String())
+		io.WriteString(w, part.String()) // 写入错误由调用方 (bufio.Writer.Flush) 报告
+		part.Reset()
+	}
+	part.WriteString(ctx.openapiv2FileOption())
+	converted, skipped := 0, 0
+	for _, name := range names {
+		if _, mapped := ctx.mappedType(name); mapped {
+			continue
+		}
+		if ctx.emitComponent(&part, name, doc.Components.Schemas[name]) {
+			converted++
+		} else {
+			skipped++
+		}
+		flush()
+	}
+	opts.metrics.countSchemas(converted, skipped)
+	ctx.emitServices(&part)
+	flush()
+	ctx.checkCaseConflicts()
+	var b strings.Builder
+	pkgComment := ""
+	if opts.style == styleBuf { // 文件级注释挂在 package 上
+		pkgComment, preamble = strings.TrimRight(preamble, "\n")+"\n", ""
+		if pkgComment == "\n" {
+			pkgComment = ""
+		}
+	}
+	writeFileHeader(&b, pkg, goPkg, pkgComment, ctx.fileImports(), opts.fileOptions)
+	b.WriteString(preamble)
+	return ctx, b.String()
+}
+
+// specFiles 收集目录下的 openapi 文件 (*.json|*.yaml|*.yml)
+func specFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		lower := strings.ToLower(d.Name())
+		if strings.HasSuffix(lower, ".json") || strings.HasSuffix(lower, ".yaml") || strings.HasSuffix(lower, ".yml") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// parseDocument 尝试 json / yaml (yaml 支持 --- 分隔的多文档); path 为文档位置,
+// 用于解析指向其他文件的 $ref
+func parseDocument(data []byte, path string, read func(string) ([]byte, error)) (Document, error) {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return Document{}, err
+	}
+	bundleExternalRefs(&doc, path, read)
+	prepareDocument(&doc)
+	return doc, nil
+}
+
+// decodeDocument 解码 json / yaml 并记录 schema 来源, 不解析引用
+func decodeDocument(data []byte) (Document, error) {
 	var doc Document
 	var jsonErr error
-	if jErr := json.Unmarshal(data, &doc); jErr != nil || len(doc.Components.Schemas) == 0 {
+	if jErr := json.Unmarshal(data, &doc); jErr != nil || doc.empty() {
 		jsonErr = jErr
-		var ydoc Document
-		yErr := yaml.Unmarshal(data, &ydoc)
-		if yErr == nil && len(ydoc.Components.Schemas) > 0 {
+		ydoc, yErr := decodeYAMLDocuments(data)
+		if yErr == nil && !ydoc.empty() {
 			doc = ydoc
 		} else if jsonErr != nil {
 			return Document{}, fmt.Errorf("parse openapi (json/yaml) failed: jsonErr=%v yamlErr=%v", jsonErr, yErr)
 		}
 	}
-	if len(doc.Components.Schemas) == 0 {
-		return Document{}, errors.New("no components.schemas found")
+	if doc.empty() {
+		return Document{}, errors.New("no components.schemas or paths found")
 	}
+	doc.schemaOrder = declaredSchemas(data)
+	annotateOrigins(&doc)
 	return doc, nil
 }
 
+// prepareDocument 提升 / 解析引用并规范化 schema
+func prepareDocument(doc *Document) {
+	hoistYAMLAnchors(doc)
+	hoistDefs(doc)
+	resolveAnchors(doc)
+	warnSerializationHints(doc)
+	normalizeDocument(doc)
+}
+
+// loadDocument 读取输入文件并按 -input-format 解析
+func loadDocument(path string, opts *genOptions) (Document, error) {
+	defer opts.metrics.observe(phaseLoad, time.Now())
+	if isArchiveSpec(path) {
+		root, err := opts.archiveRoot(path)
+		if err != nil {
+			return Document{}, err
+		}
+		path = root
+	}
+	data, err := opts.readSpec(path)
+	if err != nil {
+		return Document{}, err
+	}
+	var doc Document
+	base := inputBase(path)
+	switch opts.inputFormat {
+	case inputJSONSchema:
+		doc, err = parseJSONSchema(data, strings.TrimSuffix(base, filepath.Ext(base)))
+	case inputAsyncAPI:
+		doc, err = parseAsyncAPI(data)
+	default:
+		doc, err = parseDocument(data, path, opts.readSpec)
+	}
+	if err != nil {
+		return Document{}, err
+	}
+	if err := opts.finishDocument(&doc, path); err != nil {
+		return Document{}, err
+	}
+	return doc, nil
+}
+
+// finishDocument 记录来源文件并应用重命名 / 后缀去除 / google 类型识别
+func (o *genOptions) finishDocument(doc *Document, path string) error {
+	base := inputBase(path)
+	setOriginFile(doc, base)
+	if doc.files == nil {
+		doc.files = map[string]string{}
+	}
+	doc.files[base] = path
+	if err := o.config.renameSchemas(doc); err != nil {
+		return err
+	}
+	if err := stripSchemaSuffixes(doc, o.stripSuffixes); err != nil {
+		return err
+	}
+	o.detectGoogleTypes(doc)
+	return nil
+}
+
 // generateCombined 聚合多个 openapi 文件为单一 proto，重复 schema 名只保留首次出现
-func generateCombined(files []string, outFile, pkg, goPkg string, useOptional bool, anyOfMode string, sortFields bool) error {
+func generateCombined(files []string, outFile string, opts *genOptions) error {
 	combined := Document{}
 	combined.Components.Schemas = map[string]*Schema{}
+	combined.source = outFile
+	pkg := ""
 	overridden := 0
+	var sources strings.Builder
 	for _, f := range files {
-		data, err := os.ReadFile(f)
-		if err != nil {
-			return err
-		}
-		doc, err := parseDocument(data)
+		doc, err := loadDocument(f, opts)
+		opts.metrics.countInput(inputStatus(err))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "[WARN] 跳过 %s: %v\n", f, err)
 			continue
 		}
+		doc.source = f
+		opts.diags.addDocument(&doc)
+		combined.schemaOrder = append(combined.schemaOrder, doc.schemaOrder...)
 		for name, schema := range doc.Components.Schemas {
 			if _, exists := combined.Components.Schemas[name]; exists {
 				overridden++
 			}
 			combined.Components.Schemas[name] = schema // 后者覆盖前者
+			if m, ok := doc.externalTypes[name]; ok {
+				if combined.externalTypes == nil {
+					combined.externalTypes = map[string]TypeMapping{}
+				}
+				combined.externalTypes[name] = m
+			} else {
+				delete(combined.externalTypes, name)
+			}
+		}
+		combined.mergeOperations(&doc)
+		if pkg == "" {
+			pkg = opts.packageFor(&doc, f) // 合并模式以第一个有效文件的 info 为准
+		}
+		if opts.infoComment {
+			sources.WriteString(infoComment(&doc, filepath.Base(f)))
 		}
 	}
-	if len(combined.Components.Schemas) == 0 {
+	if combined.empty() {
 		return errors.New("无有效 schema 可生成")
 	}
-	var b strings.Builder
-	b.WriteString("syntax = \"proto3\";\n")
-	b.WriteString(fmt.Sprintf("package %s;\n", pkg))
-	b.WriteString(fmt.Sprintf("option go_package = \"%s\";\n\n", goPkg))
+	preamble := sources.String()
 	if overridden > 0 {
-		b.WriteString(fmt.Sprintf("// 注意: 有 %d 个重复 schema 名被后续文件覆盖 (采用最后出现版本)\n\n", overridden))
-	}
-	names := make([]string, 0, len(combined.Components.Schemas))
-	for n := range combined.Components.Schemas {
-		names = append(names, n)
-	}
-	if sortFields {
-		sort.Strings(names)
-	}
-	ctx := &genContext{doc: &combined, useOptional: useOptional, anyOfMode: anyOfMode, sortFields: sortFields, visited: map[string]bool{}}
-	for _, n := range names {
-		ctx.emitSchema(&b, n, combined.Components.Schemas[n])
-	}
-	if err := os.MkdirAll(filepath.Dir(outFile), 0o755); err != nil {
-		return err
+		preamble += fmt.Sprintf("// 注意: 有 %d 个重复 schema 名被后续文件覆盖 (采用最后出现版本)\n\n", overridden)
 	}
-	return os.WriteFile(outFile, []byte(b.String()), 0o644)
+	return writePackages(&combined, opts, pkg, outFile, preamble)
 }
 
 type genContext struct {
-	doc         *Document
-	useOptional bool
-	anyOfMode   string
-	sortFields  bool
-	visited     map[string]bool
+	doc *Document
+	*genOptions
+	visited map[string]bool
+	imports map[string]bool
+	// filePkg 是当前文件实际使用的 proto package (可能由 info 推导)
+	filePkg string
+	// httpRules 收集 -http yaml|both 输出的 http rule
+	httpRules []*httpRule
+	// errors 是导致本文件生成失败的问题 (如 -untyped=error)
+	errors []string
+	// listWrappers 记录 -nullable-array=wrapper 已生成的包装 message (元素类型 -> 名称)
+	listWrappers map[string]string
+	// depth 是当前内联展开深度 (组件 schema 为 0)
+	depth int
+	// sourceEntries 收集 -source-map 的条目
+	sourceEntries []*sourceMapEntry
+	// methodConfigs 收集 -service-config 的条目
+	methodConfigs []*methodConfig
+	// inlineShapes 记录 -dedup-inline 已命名的内联 schema (shapeKey -> message 名)
+	inlineShapes map[string]string
+	// manifestMessages / manifestEnums 收集本文件的 -manifest 条目
+	manifestMessages []*manifestMessage
+	manifestEnums    []*manifestEnum
+	// component 是正在输出的组件 schema, 为其诊断提供来源位置
+	component *Schema
+	// typeNames 收集已输出的 message / enum 名, 供大小写冲突检查
+	typeNames []string
+	// componentMessages 为组件 schema 规范化后的 message 名, 由 uniqueMessageName 首次调用时建立
+	componentMessages map[string]bool
+	// skippedComponents / early 记录 -keep-going 跳过的组件与提前输出的组件
+	skippedComponents map[string]bool
+	early             map[string]earlyComponent
+}
+
+func newGenContext(doc *Document, opts *genOptions) *genContext {
+	return &genContext{doc: doc, genOptions: opts, visited: map[string]bool{}, imports: map[string]bool{}, listWrappers: map[string]string{}}
 }
 
 func (g *genContext) emitSchema(b *strings.Builder, name string, s *Schema) {
@@ -274,152 +1088,561 @@ func (g *genContext) emitSchema(b *strings.Builder, name string, s *Schema) {
 	}
 	g.visited[name] = true
 	resolved := g.resolveRef(s)
+	if g.enumAsScalar(resolved) {
+		return
+	}
 	if len(resolved.Enum) > 0 {
 		g.emitEnum(b, name, resolved)
 		return
 	}
-	if resolved.Type == "object" || resolved.Properties != nil || resolved.AllOf != nil || resolved.OneOf != nil || resolved.AnyOf != nil || resolved.AddlProps != nil {
+	if isMessageSchema(resolved) {
 		g.emitMessage(b, name, resolved)
 		return
 	}
+	if len(resolved.PrefixItems) > 0 {
+		g.emitMessage(b, name, tupleSchema(resolved))
+		return
+	}
+	if resolved.Type == "array" || resolved.Items != nil {
+		g.emitMessage(b, name, arrayWrapperSchema(resolved))
+		return
+	}
 	// Primitive at top-level: wrap in message
-	b.WriteString(fmt.Sprintf("// Primitive schema %s promoted to wrapper message\n", name))
+	writeDescription(b, resolved.Description)
+	b.WriteString(fmt.Sprintf("// Primitive schema %s promoted to wrapper message\n", oneline(name)))
+	if g.style == styleProtolint { // INDENT: 字段单独成行
+		b.WriteString(fmt.Sprintf("message %s {\n  %s value = 1;\n}\n\n", normalizeMessage(name), g.scalarType(resolved)))
+		return
+	}
 	b.WriteString(fmt.Sprintf("message %s { %s value = 1; }\n\n", normalizeMessage(name), g.scalarType(resolved)))
 }
 
+// isMessageSchema reports whether a (resolved) schema is emitted as a message.
+func isMessageSchema(s *Schema) bool {
+	return s.Type == "object" || s.Properties != nil || s.AllOf != nil || s.OneOf != nil || s.AnyOf != nil || s.AddlProps != nil
+}
+
+// refTypeName returns the type name of a local $ref to a component schema that
+// is emitted as its own message or enum, so references reuse that type instead
+// of flattening a copy under the referencing field's name. Pure maps keep
+// being inlined as map fields (unless -map=entries makes them messages).
+func (g *genContext) refTypeName(s *Schema) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	key, ok := componentRefName(s.Ref)
+	if !ok {
+		// pointer to a nested schema that itself references a component
+		if tgt := lookupPointer(g.doc, s.Ref); tgt != nil && tgt != s && tgt.Ref != "" && tgt.Ref != s.Ref {
+			return g.refTypeName(tgt)
+		}
+		return "", false
+	}
+	if m, ok := g.mappedType(key); ok {
+		g.useImport(m.Import)
+		return m.Type, true
+	}
+	tgt, ok := g.doc.Components.Schemas[key]
+	if !ok {
+		return "", false
+	}
+	tgt = g.resolveRef(tgt)
+	if len(tgt.Enum) > 0 && !g.enumAsScalar(tgt) {
+		return normalizeMessage(key), true
+	}
+	pureMap := len(tgt.Properties) == 0 && tgt.AddlProps != nil && tgt.AllOf == nil && tgt.OneOf == nil && tgt.AnyOf == nil
+	if isMessageSchema(tgt) && (!pureMap || g.mapMode == mapEntries) {
+		return normalizeMessage(key), true
+	}
+	return "", false
+}
+
 func (g *genContext) emitEnum(b *strings.Builder, name string, s *Schema) {
 	enumName := normalizeMessage(name)
+	g.trace(b, "", "enum", enumName, s.origin)
+	writeDescription(b, s.Description)
 	b.WriteString(fmt.Sprintf("enum %s {\n", enumName))
-	b.WriteString(fmt.Sprintf("  %s_UNSPECIFIED = 0;\n", strings.ToUpper(enumName)))
-	for i, v := range s.Enum {
-		b.WriteString(fmt.Sprintf("  %s_%s = %d;\n", strings.ToUpper(enumName), toEnumValue(v), i+1))
+	if s.Deprecated {
+		b.WriteString("  option deprecated = true;\n")
+	}
+	prefix := g.enumValuePrefix(enumName)
+	values, specZero := g.enumZeroOrder(s)
+	taken := map[string]bool{}
+	if !specZero {
+		zero := g.enumValueName(prefix, g.enumZeroIdent())
+		b.WriteString(fmt.Sprintf("  %s = 0;\n", zero))
+		taken[zero] = true
+	}
+	nums := g.newEnumNumberer(enumName)
+	entry := g.manifestEnum(name, enumName, s)
+	for i, v := range values {
+		ident, lossy := toEnumValue(v)
+		valueName := g.enumValueName(prefix, ident)
+		for n := 2; taken[valueName]; n++ {
+			// "a-b" and "a b" both read A_B: later values get a suffix
+			valueName, lossy = g.enumValueName(prefix, ident+"_"+strconv.Itoa(n)), true
+		}
+		if isDigitByte(ident[0]) || isDigitByte(valueName[0]) {
+			// "2xx" reads as STATUS_2XX: keep the original next to it
+			lossy = true
+		}
+		taken[valueName] = true
+		num := 0
+		if !specZero || i > 0 {
+			num = nums.number(valueName)
+		}
+		entry.addValue(v, valueName, num)
+		b.WriteString("  " + valueName + " = " + strconv.Itoa(num) + ";")
+		if lossy {
+			// the original spelling, also kept in the -manifest value mapping
+			b.WriteString(" // " + oneline(textQuote(v)))
+		}
+		b.WriteString("\n")
+	}
+	if reserved := nums.unused(); len(reserved) > 0 {
+		b.WriteString(fmt.Sprintf("  reserved %s;\n", joinInts(reserved)))
 	}
 	b.WriteString("}\n\n")
 }
 
 func (g *genContext) emitMessage(b *strings.Builder, name string, s *Schema) {
 	msgName := normalizeMessage(name)
+	g.trace(b, "", "message", msgName, s.origin)
+	writeDescription(b, s.Description)
+	if s.closed != "" {
+		b.WriteString(fmt.Sprintf("// Closed object (%s): extra properties are forbidden by the OpenAPI contract; proto3 does not enforce this.\n", s.closed))
+		g.diag(severityInfo, "closed-object", msgName, s.closed+" is not enforced by proto3")
+	}
+	if n := g.exampleNote(s); n != "" {
+		b.WriteString("// " + strings.ToUpper(n[:1]) + n[1:] + "\n")
+	}
 	b.WriteString(fmt.Sprintf("message %s {\n", msgName))
-	// Merge allOf properties first
-	merged := &Schema{Properties: map[string]*Schema{}, Required: s.Required}
-	// allOf merge
-	for _, part := range s.AllOf {
-		merged = mergeInto(merged, g.resolveRef(part))
+	entry := g.manifestMessage(name, msgName, s)
+	if s.Deprecated {
+		b.WriteString("  option deprecated = true;\n")
 	}
-	// base properties
-	for k, v := range s.Properties {
-		merged.Properties[k] = v
+	if o := g.openapiv2SchemaOption(s); o != "" {
+		b.WriteString("  " + o + "\n")
 	}
-
-	// Track field numbers
-	fieldNum := 1
-	propNames := make([]string, 0, len(merged.Properties))
-	for k := range merged.Properties {
-		propNames = append(propNames, k)
+	if o := g.originOption(name, s); o != "" {
+		b.WriteString("  " + o + "\n")
+	}
+	if o := g.resourceOption(msgName, s); o != "" {
+		b.WriteString("  " + o + "\n")
 	}
+	for _, o := range g.config.messageOptions(name, msgName) {
+		b.WriteString("  option " + o + ";\n")
+	}
+	// Merge allOf properties first (nested allOf included); the oneOf /
+	// anyOf groups of s and of every part each become their own oneof
+	merged := &Schema{Properties: map[string]*Schema{}}
+	var oneOfs, anyOfs [][]*Schema
+	g.mergeAllOf(merged, s, &oneOfs, &anyOfs, map[*Schema]bool{})
+	// -anyof=merge: object branches add their properties as optional fields
+	var mergedAnyOf map[string]bool
+	if g.anyOfMode == "merge" {
+		mergedAnyOf, anyOfs = g.mergeAnyOf(msgName, merged, &oneOfs, anyOfs)
+	}
+
+	// Track field numbers (stable across runs when -lock is used)
+	nums := g.newNumberer(msgName)
+	propNames := merged.propertyNames()
 	if g.sortFields {
 		sort.Strings(propNames)
 	}
+	if len(s.propOrder) > 0 && len(s.AllOf) == 0 {
+		propNames = s.propOrder
+	}
+	if g.requiredFirst {
+		propNames = requiredFirstOrder(propNames, merged)
+	}
 	// Collect nested schemas to emit later (flatten)
 	type pending struct {
 		name   string
 		schema *Schema
 	}
 	var toEmit []pending
-	for _, prop := range propNames {
+	var wrappers []string
+	// flatten defers emission of a nested type, renamed with the parent prefix.
+	// Beyond -max-depth nested messages fall back to google.protobuf.Struct.
+	flatten := func(field, ptype string, nested []any) string {
+		if nested == nil {
+			return ptype
+		}
+		baseNestedName := nested[0].(string)
+		ns := nested[1].(*Schema)
+		if g.maxDepth > 0 && g.depth >= g.maxDepth && len(ns.Enum) == 0 {
+			g.diag(severityWarning, "max-depth", msgName+"."+field, fmt.Sprintf("inline nesting deeper than -max-depth=%d; mapped to google.protobuf.Struct", g.maxDepth))
+			g.useImport("google/protobuf/struct.proto")
+			return strings.ReplaceAll(ptype, baseNestedName, "google.protobuf.Struct")
+		}
+		flatName := g.sharedInlineType(msgName, field, g.inlineTypeName(msgName, baseNestedName, ns), ns)
+		// Preserve qualifiers like "repeated" or "map<...>" by replacing only the nested type token
+		ptype = strings.ReplaceAll(ptype, baseNestedName, flatName)
+		// schedule emission if not visited yet under new name
+		if !g.visited[flatName] {
+			toEmit = append(toEmit, pending{name: flatName, schema: ns})
+		}
+		return ptype
+	}
+	required := map[string]bool{}
+	for _, r := range merged.Required {
+		required[r] = true
+	}
+	fieldNames, jsonName := g.fieldNames(name, msgName, propNames, merged.Properties)
+	// a oneOf of `required: [prop]` branches puts those sibling properties
+	// into the oneof instead of the message body
+	variants := g.requiredVariants(msgName, oneOfs, merged)
+	writeField := func(prop, indent, oneof string, members int) {
 		ps := merged.Properties[prop]
 		ptype, nested := g.fieldType(prop, ps)
-		if nested != nil { // defer emission for flatten, rename with parent prefix
-			baseNestedName := nested[0].(string)
-			flatName := normalizeMessage(msgName + "_" + baseNestedName)
-			// Preserve qualifiers like "repeated" or "map<...>" by replacing only the nested type token
-			ptype = strings.ReplaceAll(ptype, baseNestedName, flatName)
-			// schedule emission if not visited yet under new name
-			if !g.visited[flatName] {
-				toEmit = append(toEmit, pending{name: flatName, schema: nested[1].(*Schema)})
-			}
+		ptype = flatten(prop, ptype, nested)
+		ptype, wrapper := g.nullableArray(ps, ptype)
+		if wrapper != "" {
+			wrappers = append(wrappers, wrapper)
 		}
 		opt := ""
-		if ps.Nullable && g.useOptional && isScalar(ptype) {
+		if oneof == "" && (g.wantsOptional(ps, ptype, required[prop]) || mergedAnyOf[prop] && isSingular(ptype)) {
 			opt = "optional "
 		}
-		b.WriteString(fmt.Sprintf("  %s%s %s = %d;", opt, ptype, normalizeField(prop), fieldNum))
-		if ps.Description != "" {
-			b.WriteString(fmt.Sprintf(" // %s", oneline(ps.Description)))
+		fname := fieldNames[prop]
+		fieldOpts := append(g.fieldOptions(ps, ptype), g.config.fieldOptions(name, msgName, prop)...)
+		if jsonName[prop] {
+			fieldOpts = append([]string{"json_name = " + textQuote(prop)}, fieldOpts...)
+		}
+		g.trace(b, indent, "field", msgName+"."+fname, ps.origin)
+		var num int
+		if oneof == "" {
+			num = nums.number(fname)
+		} else {
+			num = nums.oneofNumber(oneof, fname, fname, members)
+		}
+		explicitJSON := ""
+		if jsonName[prop] {
+			explicitJSON = prop
+		}
+		entry.addField(prop, fname, num, opt+ptype, explicitJSON, oneof)
+		// Written piecewise: this runs for every field of every message.
+		b.WriteString(indent)
+		b.WriteString(opt)
+		b.WriteString(ptype)
+		b.WriteByte(' ')
+		b.WriteString(fname)
+		b.WriteString(" = ")
+		b.WriteString(strconv.Itoa(num))
+		b.WriteString(renderFieldOptions(fieldOpts))
+		b.WriteByte(';')
+		if c := g.fieldComment(ps, ptype); c != "" {
+			b.WriteString(" // ")
+			b.WriteString(c)
 		}
 		b.WriteString("\n")
-		fieldNum++
+	}
+	for _, prop := range propNames {
+		if _, variant := variants[prop]; !variant {
+			writeField(prop, "  ", "", 0)
+		}
 	}
 
+	if s.dynamicStruct && len(merged.Properties) == 0 {
+		g.useImport("google/protobuf/struct.proto")
+		num := nums.number("entries")
+		entry.addField("", "entries", num, "google.protobuf.Struct", "", "")
+		b.WriteString(fmt.Sprintf("  google.protobuf.Struct entries = %d;%s\n", num, trailingComment(patternNote(s))))
+	}
 	// map type
-	if s.AddlProps != nil && len(merged.Properties) == 0 {
-		valType, nested := g.fieldType("value", s.AddlProps)
-		if nested != nil {
-			g.emitSchema(b, nested[0].(string), nested[1].(*Schema))
-		}
-		b.WriteString(fmt.Sprintf("  map<string,%s> entries = 1;\n", valType))
+	if s.AddlProps != nil && len(merged.Properties) == 0 && g.mapMode == mapEntries {
+		ptype := flatten("entries", "repeated Entry", []any{"Entry", mapEntrySchema(s.AddlProps)})
+		num := nums.number("entries")
+		entry.addField("", "entries", num, ptype, "", "")
+		b.WriteString(fmt.Sprintf("  %s entries = %d;\n", ptype, num))
+	} else if s.AddlProps != nil && len(merged.Properties) == 0 {
+		valType, nested := g.mapValueType("value", s.AddlProps)
+		ptype := flatten("entries", "map<string,"+valType+">", nested)
+		num := nums.number("entries")
+		entry.addField("", "entries", num, ptype, "", "")
+		b.WriteString(fmt.Sprintf("  %s entries = %d;\n", ptype, num))
 	}
 
 	// oneOf -> oneof block
-	if len(s.OneOf) > 0 {
-		b.WriteString("  oneof one_of {\n")
-		idx := 0
-		for _, branch := range s.OneOf {
+	// oneof members are named from branch refs / titles when the name is free
+	memberNames := map[string]bool{}
+	for _, prop := range propNames {
+		memberNames[fieldNames[prop]] = true
+	}
+	idx := 0
+	for k, group := range oneOfs {
+		oneof := groupName("one_of", k)
+		members := 0
+		for _, in := range variants {
+			if in == k {
+				members++
+			}
+		}
+		for _, branch := range group {
+			if !requiredOnly(branch) {
+				members++
+			}
+		}
+		if members == 0 {
+			idx += len(group)
+			continue
+		}
+		b.WriteString("  oneof " + oneof + " {\n")
+		for _, prop := range propNames {
+			if in, variant := variants[prop]; variant && in == k {
+				writeField(prop, "    ", oneof, members)
+			}
+		}
+		for _, branch := range group {
 			idx++
-			pt, nested := g.fieldType(fmt.Sprintf("choice_%d", idx), branch)
-			if nested != nil {
-				baseNestedName := nested[0].(string)
-				flatName := normalizeMessage(msgName + "_" + baseNestedName)
-				pt = strings.ReplaceAll(pt, baseNestedName, flatName)
-				if !g.visited[flatName] {
-					toEmit = append(toEmit, pending{name: flatName, schema: nested[1].(*Schema)})
-				}
+			if requiredOnly(branch) {
+				continue
 			}
-			b.WriteString(fmt.Sprintf("    %s %s = %d;\n", pt, fmt.Sprintf("choice_%d", idx), fieldNum))
-			fieldNum++
+			legacy := fmt.Sprintf("choice_%d", idx)
+			fname := oneofMemberName(branch, legacy, memberNames)
+			branch = variantBranch(branch, merged)
+			pt, nested := g.fieldType(fname, branch)
+			pt = flatten(fname, pt, nested)
+			g.trace(b, "    ", "field", msgName+"."+fname, branch.origin)
+			num := nums.oneofNumber(oneof, fname, legacy, members)
+			entry.addField("", fname, num, pt, "", oneof)
+			b.WriteString("    " + pt + " " + fname + " = " + strconv.Itoa(num) + ";\n")
 		}
 		b.WriteString("  }\n")
 	}
 	// anyOf handling
-	if len(s.AnyOf) > 0 {
+	idx = 0
+	for k, group := range anyOfs {
 		if g.anyOfMode == "repeat" {
-			pt, nested := g.fieldType("anyof_value", s.AnyOf[0])
-			if nested != nil {
-				baseNestedName := nested[0].(string)
-				flatName := normalizeMessage(msgName + "_" + baseNestedName)
-				pt = strings.ReplaceAll(pt, baseNestedName, flatName)
-				if !g.visited[flatName] {
-					toEmit = append(toEmit, pending{name: flatName, schema: nested[1].(*Schema)})
-				}
-			}
-			b.WriteString(fmt.Sprintf("  repeated %s anyof_value = %d; // anyOf first schema repeated\n", pt, fieldNum))
-			fieldNum++
-		} else {
-			b.WriteString("  oneof any_of {\n")
-			idx := 0
-			for _, branch := range s.AnyOf {
-				idx++
-				pt, nested := g.fieldType(fmt.Sprintf("alt_%d", idx), branch)
-				if nested != nil {
-					baseNestedName := nested[0].(string)
-					flatName := normalizeMessage(msgName + "_" + baseNestedName)
-					pt = strings.ReplaceAll(pt, baseNestedName, flatName)
-					if !g.visited[flatName] {
-						toEmit = append(toEmit, pending{name: flatName, schema: nested[1].(*Schema)})
-					}
-				}
-				b.WriteString(fmt.Sprintf("    %s alt_%d = %d;\n", pt, idx, fieldNum))
-				fieldNum++
-			}
-			b.WriteString("  }\n")
+			fname := groupName("anyof_value", k)
+			pt, nested := g.fieldType(fname, group[0])
+			pt = flatten(fname, pt, nested)
+			b.WriteString(fmt.Sprintf("  repeated %s %s = %d; // anyOf first schema repeated\n", pt, fname, nums.number(fname)))
+			continue
+		}
+		oneof := groupName("any_of", k)
+		b.WriteString("  oneof " + oneof + " {\n")
+		for _, branch := range group {
+			idx++
+			legacy := fmt.Sprintf("alt_%d", idx)
+			fname := oneofMemberName(branch, legacy, memberNames)
+			pt, nested := g.fieldType(fname, branch)
+			pt = flatten(fname, pt, nested)
+			g.trace(b, "    ", "field", msgName+"."+fname, branch.origin)
+			num := nums.oneofNumber(oneof, fname, legacy, len(group))
+			entry.addField("", fname, num, pt, "", oneof)
+			b.WriteString("    " + pt + " " + fname + " = " + strconv.Itoa(num) + ";\n")
 		}
+		b.WriteString("  }\n")
 	}
+	if reserved := nums.unused(); len(reserved) > 0 {
+		b.WriteString(fmt.Sprintf("  reserved %s;\n", joinInts(reserved)))
+	}
+	b.WriteString(g.spareRange(msgName, nums))
 
 	b.WriteString("}\n\n")
 	// Emit deferred nested schemas top-level after parent
+	for _, w := range wrappers {
+		b.WriteString(w)
+	}
+	g.depth++
 	for _, p := range toEmit {
 		g.emitSchema(b, p.name, p.schema)
 	}
+	g.depth--
+}
+
+// requiredOnly reports whether a oneOf branch only constrains which sibling
+// properties are present (`- required: [card]`) instead of adding a type.
+func requiredOnly(s *Schema) bool {
+	return s != nil && len(s.Required) > 0 && s.Ref == "" && s.Type == "" && len(s.typeUnion) == 0 &&
+		s.Properties == nil && s.Items == nil && s.AddlProps == nil && len(s.PrefixItems) == 0 &&
+		s.AllOf == nil && s.OneOf == nil && s.AnyOf == nil && len(s.Enum) == 0 && s.Const == nil
+}
+
+// requiredVariants returns the sibling properties the oneOf groups select
+// between with `required`-only branches, mapped to the index of their group.
+// Each such branch must name exactly one distinct, singular property of the
+// message; other constraint branches cannot be expressed in proto and are
+// reported and dropped.
+func (g *genContext) requiredVariants(msgName string, groups [][]*Schema, merged *Schema) map[string]int {
+	variants := map[string]int{}
+	for k, group := range groups {
+		for i, branch := range group {
+			if !requiredOnly(branch) {
+				continue
+			}
+			prop := branch.Required[0]
+			ps := merged.Properties[prop]
+			if _, taken := variants[prop]; len(branch.Required) == 1 && ps != nil && !taken && singularSchema(g.resolveRef(ps)) {
+				variants[prop] = k
+				continue
+			}
+			g.diag(severityWarning, "oneof-constraint", msgName, fmt.Sprintf("oneOf[%d] requires %s; only a single non-repeated sibling property can become a oneof member, constraint dropped", i, strings.Join(branch.Required, ", ")))
+		}
+	}
+	return variants
+}
+
+// oneofMemberName names a oneof branch after its title, or else the component
+// it references, in lower_snake_case (`$ref: .../CardPayment` → card_payment).
+// Branches with neither, or whose name is already taken in the message, keep
+// the positional fallback (choice_<n> / alt_<n>). used collects the names
+// handed out.
+func oneofMemberName(branch *Schema, fallback string, used map[string]bool) string {
+	name := fallback
+	if branch != nil {
+		for _, cand := range []string{branch.Title, componentRefTail(branch.Ref)} {
+			if n := strings.Trim(normalizeField(cand), "_"); n != "" && !used[n] && !isDigitByte(n[0]) {
+				name = n
+				break
+			}
+		}
+	}
+	used[name] = true
+	return name
+}
+
+// groupName names the k-th oneof (or anyOf field) of a message: the first
+// keeps the plain name, later ones get a _<n> suffix.
+func groupName(base string, k int) string {
+	if k == 0 {
+		return base
+	}
+	return base + "_" + strconv.Itoa(k+1)
+}
+
+// singularSchema reports whether a property schema maps to a field that may
+// sit in a oneof (no repeated or map fields).
+func singularSchema(s *Schema) bool {
+	pureMap := len(s.Properties) == 0 && s.AddlProps != nil && s.AllOf == nil && s.OneOf == nil && s.AnyOf == nil
+	return s.Type != "array" && s.Items == nil && !pureMap
+}
+
+// variantBranch drops the properties an inline oneOf branch shares with its
+// parent, so the variant message only carries what the variant adds. Branches
+// made only of shared properties are kept as they are.
+func variantBranch(branch, merged *Schema) *Schema {
+	if branch == nil || branch.Ref != "" || len(branch.Properties) == 0 {
+		return branch
+	}
+	own := map[string]*Schema{}
+	for k, v := range branch.Properties {
+		if _, shared := merged.Properties[k]; !shared {
+			own[k] = v
+		}
+	}
+	if len(own) == len(branch.Properties) || len(own) == 0 {
+		return branch
+	}
+	v := *branch
+	v.Properties = own
+	v.propOrder = nil
+	return &v
+}
+
+// tupleSchema turns an OAS 3.1 prefixItems array into an object with one field
+// per position, named from the item title or item_<n>. Trailing `items`
+// become a repeated `rest` field.
+func tupleSchema(s *Schema) *Schema {
+	t := &Schema{Type: "object", Properties: map[string]*Schema{}, Description: s.Description, origin: s.origin}
+	for i, item := range s.PrefixItems {
+		name := fmt.Sprintf("item_%d", i+1)
+		if item != nil && item.Title != "" {
+			if n := normalizeField(item.Title); n != "" && t.Properties[n] == nil {
+				name = n
+			}
+		}
+		if _, taken := t.Properties[name]; taken {
+			name = fmt.Sprintf("item_%d", i+1)
+		}
+		t.Properties[name] = item
+		t.propOrder = append(t.propOrder, name)
+	}
+	if s.Items != nil {
+		t.Properties["rest"] = &Schema{Type: "array", Items: s.Items}
+		t.propOrder = append(t.propOrder, "rest")
+	}
+	return t
+}
+
+// arrayWrapperSchema turns a top-level array schema into an object whose only
+// field is the repeated `items` list, so the wrapper keeps the item type
+// (message-typed items included) instead of degrading to a scalar value.
+func arrayWrapperSchema(s *Schema) *Schema {
+	list := *s
+	list.Description, list.Title = "", ""
+	if list.Type == "" {
+		list.Type = "array"
+	}
+	if list.Items == nil {
+		list.Items = &Schema{}
+	}
+	t := &Schema{Type: "object", Properties: map[string]*Schema{"items": &list}, Description: s.Description, Deprecated: s.Deprecated, origin: s.origin}
+	t.propOrder = []string{"items"}
+	return t
+}
+
+// mergeAnyOf folds the anyOf groups made only of object branches into merged
+// (-anyof=merge): every branch property not already on the message becomes a
+// field, marked in the returned set so it is emitted as optional since any
+// subset of the branches may match. The first branch defining a property
+// wins. Groups with non-object branches stay oneofs and are returned.
+func (g *genContext) mergeAnyOf(msgName string, merged *Schema, oneOfs *[][]*Schema, groups [][]*Schema) (map[string]bool, [][]*Schema) {
+	added := map[string]bool{}
+	var kept [][]*Schema
+	for k := 0; k < len(groups); k++ {
+		group := groups[k]
+		objects := true
+		for _, branch := range group {
+			if r := g.resolveRef(branch); r == nil || (len(r.Properties) == 0 && r.AllOf == nil) {
+				objects = false
+			}
+		}
+		if !objects {
+			g.diag(severityInfo, "anyof-merge", msgName, "anyOf has branches without properties; kept as a oneof")
+			kept = append(kept, group)
+			continue
+		}
+		for _, branch := range group {
+			part := &Schema{Properties: map[string]*Schema{}}
+			// nested anyOf groups of a branch are merged (or kept) in turn
+			g.mergeAllOf(part, g.resolveRef(branch), oneOfs, &groups, map[*Schema]bool{})
+			for _, prop := range part.propertyNames() {
+				if _, ok := merged.Properties[prop]; !ok {
+					merged.Properties[prop] = part.Properties[prop]
+					merged.declOrder = append(merged.declOrder, prop)
+					added[prop] = true
+				}
+			}
+		}
+	}
+	return added, kept
+}
+
+// mergeAllOf merges the properties and required lists of s into merged,
+// descending into allOf parts (through refs) before the properties of s
+// itself, and appends the oneOf / anyOf groups found on the way in order.
+func (g *genContext) mergeAllOf(merged, s *Schema, oneOfs, anyOfs *[][]*Schema, seen map[*Schema]bool) {
+	if s == nil || seen[s] {
+		return
+	}
+	seen[s] = true
+	for _, part := range s.AllOf {
+		g.mergeAllOf(merged, g.resolveRef(part), oneOfs, anyOfs, seen)
+	}
+	for k, v := range s.Properties {
+		merged.Properties[k] = v
+	}
+	merged.declOrder = append(merged.declOrder, s.propertyNames()...)
+	merged.Required = append(merged.Required, s.Required...)
+	if len(s.OneOf) > 0 {
+		*oneOfs = append(*oneOfs, s.OneOf)
+	}
+	if len(s.AnyOf) > 0 {
+		*anyOfs = append(*anyOfs, s.AnyOf)
+	}
 }
 
 func mergeInto(base *Schema, add *Schema) *Schema {
@@ -429,14 +1652,63 @@ func mergeInto(base *Schema, add *Schema) *Schema {
 	for k, v := range add.Properties {
 		base.Properties[k] = v
 	}
+	base.declOrder = append(base.declOrder, add.propertyNames()...)
+	base.Required = append(base.Required, add.Required...)
 	return base
 }
 
+// requiredFirstOrder moves required properties ahead of the others, keeping
+// the relative order of propNames (declaration order without -sort) on both
+// sides.
+func requiredFirstOrder(propNames []string, s *Schema) []string {
+	required := map[string]bool{}
+	for _, r := range s.Required {
+		required[r] = true
+	}
+	ordered := make([]string, 0, len(propNames))
+	var rest []string
+	for _, p := range propNames {
+		if required[p] {
+			ordered = append(ordered, p)
+		} else {
+			rest = append(rest, p)
+		}
+	}
+	return append(ordered, rest...)
+}
+
+// wantsOptional reports whether a singular field should carry the proto3
+// optional label under the configured presence strategy.
+func (g *genContext) wantsOptional(ps *Schema, ptype string, required bool) bool {
+	switch g.presence {
+	case presenceNullable:
+		return g.isNullable(ps) && isScalar(ptype)
+	case presenceNonRequired:
+		return !required && isSingular(ptype)
+	case presenceAll:
+		return isSingular(ptype)
+	}
+	return false
+}
+
 func (g *genContext) fieldType(name string, s *Schema) (string, []any) {
+	if t, ok := g.skippedRef(s, "field "+name); ok {
+		return t, nil
+	}
+	if t, ok := g.refTypeName(s); ok {
+		return t, nil
+	}
 	s = g.resolveRef(s)
+	if g.enumAsScalar(s) {
+		return g.scalarType(s), nil
+	}
 	if len(s.Enum) > 0 {
 		return normalizeMessage(name), []any{normalizeMessage(name), s}
 	}
+	// prefixItems makes a tuple even without `type: array`, as in emitSchema
+	if len(s.PrefixItems) > 0 {
+		return normalizeMessage(name), []any{normalizeMessage(name), tupleSchema(s)}
+	}
 	switch s.Type {
 	case "string":
 		if s.Format == "byte" || s.Format == "binary" {
@@ -444,7 +1716,7 @@ func (g *genContext) fieldType(name string, s *Schema) (string, []any) {
 		}
 		return "string", nil
 	case "integer":
-		if s.Format == "int32" {
+		if isInt32Format(s.Format) {
 			return "int32", nil
 		}
 		return "int64", nil
@@ -460,25 +1732,60 @@ func (g *genContext) fieldType(name string, s *Schema) (string, []any) {
 			return "repeated string", nil
 		}
 		et, nested := g.fieldType(name+"_item", s.Items)
+		if strings.HasPrefix(et, "repeated ") {
+			// proto has no nested repeated: wrap each inner list in a message
+			item := normalizeMessage(name + "_item")
+			return "repeated " + item, []any{item, arrayWrapperSchema(g.resolveRef(s.Items))}
+		}
 		if nested != nil {
 			return "repeated " + nested[0].(string), nested
 		}
 		return "repeated " + et, nil
 	case "object":
+		if s.dynamicStruct && len(s.Properties) == 0 {
+			g.useImport("google/protobuf/struct.proto")
+			return "google.protobuf.Struct", nil
+		}
+		if len(s.Properties) == 0 && s.AddlProps != nil && g.mapMode == mapEntries {
+			entry := normalizeMessage(name + "_entry")
+			return "repeated " + entry, []any{entry, mapEntrySchema(s.AddlProps)}
+		}
 		if len(s.Properties) == 0 && s.AddlProps != nil { // map
-			vt, nested := g.fieldType(name+"_value", s.AddlProps)
-			if nested != nil {
-				return fmt.Sprintf("map<string,%s>", nested[0].(string)), nested
-			}
-			return fmt.Sprintf("map<string,%s>", vt), nil
+			vt, nested := g.mapValueType(name+"_value", s.AddlProps)
+			return "map<string," + vt + ">", nested
 		}
 		return normalizeMessage(name), []any{normalizeMessage(name), s}
 	default:
-		if s.OneOf != nil || s.AllOf != nil || s.AnyOf != nil {
+		if s.OneOf == nil && s.AllOf == nil && s.AnyOf == nil && s.Properties == nil && s.AddlProps != nil {
+			// untyped schema with only additionalProperties: same as an object map
+			o := *s
+			o.Type = "object"
+			return g.fieldType(name, &o)
+		}
+		if s.OneOf != nil || s.AllOf != nil || s.AnyOf != nil || s.Properties != nil {
 			return normalizeMessage(name), []any{normalizeMessage(name), s}
 		}
 	}
-	return "string", nil
+	return g.untypedType(name, s), nil
+}
+
+// mapValueType returns the value type of a map whose values follow v.
+// Lists and maps cannot be map values in proto, so those are wrapped in a
+// message named name (a `repeated items` list or the inner map message).
+func (g *genContext) mapValueType(name string, v *Schema) (string, []any) {
+	vt, nested := g.fieldType(name, v)
+	if strings.HasPrefix(vt, "repeated ") || strings.HasPrefix(vt, "map<") {
+		value := normalizeMessage(name)
+		inner := g.resolveRef(v)
+		if strings.HasPrefix(vt, "repeated ") {
+			inner = arrayWrapperSchema(inner)
+		}
+		return value, []any{value, inner}
+	}
+	if nested != nil {
+		return nested[0].(string), nested
+	}
+	return vt, nil
 }
 
 func (g *genContext) scalarType(s *Schema) string {
@@ -487,7 +1794,7 @@ func (g *genContext) scalarType(s *Schema) string {
 	case "string":
 		return "string"
 	case "integer":
-		if s.Format == "int32" {
+		if isInt32Format(s.Format) {
 			return "int32"
 		}
 		return "int64"
@@ -502,67 +1809,104 @@ func (g *genContext) scalarType(s *Schema) string {
 	return "string"
 }
 
-func (g *genContext) resolveRef(s *Schema) *Schema {
-	if s == nil {
-		return &Schema{}
-	}
-	if s.Ref == "" {
-		return s
-	}
-	// expecting '#/components/schemas/Name'
-	parts := strings.Split(s.Ref, "/")
-	if len(parts) > 0 {
-		key := parts[len(parts)-1]
-		if tgt, ok := g.doc.Components.Schemas[key]; ok {
-			return tgt
-		}
-	}
-	return s
-}
+// messageNameCache / fieldNameCache memoize normalizeMessage / normalizeField:
+// the same schema and property names are converted many times per file.
+var messageNameCache, fieldNameCache sync.Map
 
 func normalizeMessage(name string) string {
-	name = nonAlnumReplace(name)
-	return upperCamel(name)
+	if v, ok := messageNameCache.Load(name); ok {
+		return v.(string)
+	}
+	out := upperCamel(nonAlnumReplace(name))
+	messageNameCache.Store(name, out)
+	return out
 }
 func normalizeField(name string) string {
-	name = nonAlnumReplace(name)
-	return lowerSnake(name)
+	if v, ok := fieldNameCache.Load(name); ok {
+		return v.(string)
+	}
+	out := lowerSnake(nonAlnumReplace(name))
+	fieldNameCache.Store(name, out)
+	return out
 }
 
+var nonAlnumReplacer = strings.NewReplacer("-", "_", ".", "_", " ", "_")
+
 func nonAlnumReplace(s string) string {
-	r := strings.NewReplacer("-", "_", ".", "_", " ", "_")
-	return r.Replace(s)
+	return nonAlnumReplacer.Replace(s)
 }
 
-func toEnumValue(s string) string {
-	s = strings.ToUpper(s)
-	s = strings.ReplaceAll(s, "-", "_")
-	s = strings.ReplaceAll(s, " ", "_")
-	return s
+// enumSymbolNames spell out the symbols of enum values without any letter
+// or digit, so "+" becomes VALUE_PLUS instead of an empty identifier.
+var enumSymbolNames = map[rune]string{
+	' ': "SPACE", '!': "BANG", '"': "QUOTE", '#': "HASH", '$': "DOLLAR", '%': "PERCENT",
+	'&': "AMP", '\'': "APOS", '(': "LPAREN", ')': "RPAREN", '*': "STAR", '+': "PLUS",
+	',': "COMMA", '-': "MINUS", '.': "DOT", '/': "SLASH", ':': "COLON", ';': "SEMICOLON",
+	'<': "LT", '=': "EQ", '>': "GT", '?': "QUESTION", '@': "AT", '[': "LBRACKET",
+	'\\': "BACKSLASH", ']': "RBRACKET", '^': "CARET", '_': "UNDERSCORE", '`': "BACKTICK",
+	'{': "LBRACE", '|': "PIPE", '}': "RBRACE", '~': "TILDE",
+}
+
+// toEnumValue upper-cases an enum value into the identifier suffix of its
+// enum value name: '-', ' ' and every other character not valid in an
+// identifier become '_'. Values without any letter or digit get a VALUE_
+// placeholder spelled from their symbols (VALUE_EMPTY for ""). lossy reports
+// whether the original string cannot be read back from the suffix.
+func toEnumValue(s string) (ident string, lossy bool) {
+	var b strings.Builder
+	b.Grow(len(s))
+	alnum := false
+	for _, r := range strings.ToUpper(s) {
+		switch {
+		case r >= 'A' && r <= 'Z' || r >= '0' && r <= '9':
+			alnum = true
+			b.WriteRune(r)
+		case r == '_' || r == '-' || r == ' ':
+			b.WriteByte('_')
+		default:
+			lossy = true
+			b.WriteByte('_')
+		}
+	}
+	if alnum {
+		return b.String(), lossy
+	}
+	if s == "" {
+		return "VALUE_EMPTY", true
+	}
+	parts := make([]string, 0, len(s))
+	for _, r := range s {
+		name, ok := enumSymbolNames[r]
+		if !ok {
+			name = fmt.Sprintf("U%04X", r)
+		}
+		parts = append(parts, name)
+	}
+	return "VALUE_" + strings.Join(parts, "_"), true
 }
 
 func upperCamel(s string) string {
 	if s == "" {
 		return ""
 	}
-	parts := strings.Split(s, "_")
-	for i, p := range parts {
-		if p == "" {
-			continue
-		}
-		// Keep all-caps acronyms (length>1) as-is
-		if isAllUpper(p) && len(p) > 1 {
-			parts[i] = p
-			continue
-		}
-		if len(p) == 1 {
-			parts[i] = strings.ToUpper(p)
-			continue
+	var b strings.Builder
+	b.Grow(len(s))
+	for rest := s; rest != ""; {
+		var p string
+		p, rest, _ = strings.Cut(rest, "_")
+		switch {
+		case p == "":
+		case isAllUpper(p) && len(p) > 1: // Keep all-caps acronyms (length>1) as-is
+			b.WriteString(p)
+		case len(p) == 1:
+			b.WriteString(strings.ToUpper(p))
+		default:
+			// Capitalize first rune, preserve existing inner capitalization (do not force lowercase)
+			b.WriteString(strings.ToUpper(p[:1]))
+			b.WriteString(p[1:])
 		}
-		// Capitalize first rune, preserve existing inner capitalization (do not force lowercase)
-		parts[i] = strings.ToUpper(p[:1]) + p[1:]
 	}
-	return strings.Join(parts, "")
+	return b.String()
 }
 
 func isAllUpper(s string) bool {
@@ -573,28 +1917,94 @@ func isAllUpper(s string) bool {
 	}
 	return true
 }
+
+// acronyms 是 lowerSnake 需整体处理的缩写 (-acronyms / 配置 acronyms), 长者优先
+var acronyms []string
+
+// lowerSnake 转为 snake_case; 连续大写视为一个缩写词 (HTTPStatusCode -> http_status_code)
 func lowerSnake(s string) string {
+	// Only ASCII letters and digits form words, so the input is scanned
+	// bytewise: every byte of a multi-byte rune is a separator.
 	s = strings.TrimSpace(s)
-	var out []rune
-	for i, r := range s {
-		if r >= 'A' && r <= 'Z' {
-			if i > 0 {
-				out = append(out, '_')
+	var b strings.Builder
+	b.Grow(len(s) + 4)
+	words, cur := 0, 0 // finished words, bytes of the current word
+	flush := func() {
+		if cur > 0 {
+			words, cur = words+1, 0
+		}
+	}
+	add := func(c byte) {
+		if cur == 0 && words > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteByte(c)
+		cur++
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if a := acronymAt(s, i); a != "" {
+			flush()
+			for _, ac := range []byte(strings.ToLower(a)) { // trailing digits stay attached
+				add(ac)
 			}
-			out = append(out, r-'A'+'a')
+			i += len(a)
 			continue
 		}
-		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
-			out = append(out, r)
+		switch {
+		case isUpperByte(c):
+			if cur > 0 {
+				prev := s[i-1]
+				if isLowerByte(prev) || isDigitByte(prev) || (i+1 < len(s) && isLowerByte(s[i+1])) {
+					flush()
+				}
+			}
+			add(c - 'A' + 'a')
+		case isLowerByte(c) || isDigitByte(c):
+			add(c)
+		default:
+			flush()
+		}
+		i++
+	}
+	return b.String()
+}
+
+// setAcronyms 合并 -acronyms 与配置中的缩写词 (长者优先匹配)
+func setAcronyms(list string, cfg *Config) {
+	for _, a := range append(strings.Split(list, ","), cfg.Acronyms...) {
+		if a = strings.TrimSpace(a); a != "" {
+			acronyms = append(acronyms, a)
+		}
+	}
+	sort.SliceStable(acronyms, func(i, j int) bool { return len(acronyms[i]) > len(acronyms[j]) })
+	messageNameCache.Clear()
+	fieldNameCache.Clear()
+}
+
+// acronymAt returns the configured acronym starting a word at s[i], if any.
+func acronymAt(s string, i int) string {
+	if i > 0 && isLowerByte(s[i-1]) && !isUpperByte(s[i]) {
+		return ""
+	}
+	for _, a := range acronyms {
+		if !strings.HasPrefix(s[i:], a) {
+			continue
+		}
+		if end := i + len(a); end < len(s) && isLowerByte(s[end]) {
 			continue
 		}
-		out = append(out, '_')
+		return a
 	}
-	return strings.Trim(outStr(out), "_")
+	return ""
 }
-func outStr(r []rune) string { return string(r) }
 
-func oneline(s string) string { s = strings.ReplaceAll(s, "\n", " "); return strings.TrimSpace(s) }
+func isUpperByte(c byte) bool { return c >= 'A' && c <= 'Z' }
+func isLowerByte(c byte) bool { return c >= 'a' && c <= 'z' }
+func isDigitByte(c byte) bool { return c >= '0' && c <= '9' }
+
+// oneline flattens spec text for a single-line comment (see sanitizeComment).
+func oneline(s string) string { return strings.TrimSpace(sanitizeComment(s)) }
 
 func isScalar(t string) bool {
 	switch t {
@@ -604,4 +2014,20 @@ func isScalar(t string) bool {
 	return false
 }
 
-func fatal(err error) { fmt.Fprintln(os.Stderr, "error:", err); os.Exit(1) }
+// isSingular reports whether a field type may carry a label (not repeated / map).
+func isSingular(t string) bool {
+	return !strings.HasPrefix(t, "repeated ") && !strings.HasPrefix(t, "map<")
+}
+
+func fatal(err error) {
+	flushMetrics(false)
+	stopProfiling()
+	if pendingDiags != nil && pendingDiags.pretty { // 退出不执行 defer, 先输出已收集的诊断
+		pendingDiags.print()
+	}
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+// pendingDiags 是 fatal 退出前输出的诊断 (-diag-style pretty)
+var pendingDiags *diagnostics
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrefixItemsWithoutType(t *testing.T) {
+	out := renderSpec(t, testOptions(t), "tuple.yaml", `
+openapi: 3.1.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Point:
+      type: object
+      properties:
+        typed: {type: array, prefixItems: [{type: number}, {type: number}]}
+        untyped: {prefixItems: [{type: number}, {type: number}]}
+`)
+	for _, want := range []string{"  PointTyped typed = ", "  PointUntyped untyped = ", "message PointUntyped {"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "string untyped") {
+		t.Errorf("prefixItems without type became a string:\n%s", out)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// manifest is the -manifest file: for every generated file, which OpenAPI
+// schema / property ended up as which message / field, so JSON payloads can
+// be wired to the proto types.
+type manifest struct {
+	path  string
+	root  string // proto paths are relative to it when set (archive output)
+	mu    sync.Mutex
+	Files []*manifestFile `json:"files"`
+}
+
+type manifestFile struct {
+	Proto    string             `json:"proto"`
+	Package  string             `json:"package"`
+	Messages []*manifestMessage `json:"messages,omitempty"`
+	Enums    []*manifestEnum    `json:"enums,omitempty"`
+}
+
+type manifestMessage struct {
+	Message string `json:"message"`
+	// Schema is the OpenAPI component name (before any rename); empty for
+	// synthesized types (inline objects, request / response wrappers, ...)
+	Schema      string           `json:"schema,omitempty"`
+	Synthesized bool             `json:"synthesized,omitempty"`
+	Origin      string           `json:"origin,omitempty"`
+	Fields      []*manifestField `json:"fields,omitempty"`
+}
+
+type manifestField struct {
+	Property string `json:"property,omitempty"` // empty for generated members (oneof branches, map entries)
+	Field    string `json:"field"`
+	Number   int    `json:"number"`
+	Type     string `json:"type"`
+	JSONName string `json:"json_name"`
+	Oneof    string `json:"oneof,omitempty"`
+}
+
+type manifestEnum struct {
+	Enum   string               `json:"enum"`
+	Schema string               `json:"schema,omitempty"`
+	Origin string               `json:"origin,omitempty"`
+	Values []*manifestEnumValue `json:"values"`
+}
+
+type manifestEnumValue struct {
+	Value  string `json:"value"`
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+}
+
+// componentName returns the original OpenAPI name of the component schema
+// emitted as name, or "" when name is not a component.
+func (g *genContext) componentName(name string) string {
+	if g.depth > 0 || g.doc.Components.Schemas[name] == nil {
+		return ""
+	}
+	if orig, ok := g.doc.renamedFrom[name]; ok {
+		return orig
+	}
+	return name
+}
+
+// manifestMessage starts the manifest entry of a message (nil without -manifest).
+func (g *genContext) manifestMessage(name, msgName string, s *Schema) *manifestMessage {
+	if g.manifest == nil {
+		return nil
+	}
+	m := &manifestMessage{Message: msgName, Schema: g.componentName(name), Origin: s.origin}
+	m.Synthesized = m.Schema == ""
+	g.manifestMessages = append(g.manifestMessages, m)
+	return m
+}
+
+// addField records one field; jsonName is the explicit json_name, if any.
+func (m *manifestMessage) addField(prop, field string, number int, ptype, jsonName, oneof string) {
+	if m == nil {
+		return
+	}
+	if jsonName == "" {
+		jsonName = protoJSONName(field)
+	}
+	m.Fields = append(m.Fields, &manifestField{Property: prop, Field: field, Number: number, Type: ptype, JSONName: jsonName, Oneof: oneof})
+}
+
+// manifestEnum starts the manifest entry of an enum (nil without -manifest).
+func (g *genContext) manifestEnum(name, enumName string, s *Schema) *manifestEnum {
+	if g.manifest == nil {
+		return nil
+	}
+	e := &manifestEnum{Enum: enumName, Schema: g.componentName(name), Origin: s.origin}
+	g.manifestEnums = append(g.manifestEnums, e)
+	return e
+}
+
+func (e *manifestEnum) addValue(value, name string, number int) {
+	if e != nil {
+		e.Values = append(e.Values, &manifestEnumValue{Value: value, Name: name, Number: number})
+	}
+}
+
+// add records the types of one generated file.
+func (m *manifest) add(outFile string, g *genContext) {
+	if m.root != "" {
+		if rel, err := filepath.Rel(m.root, outFile); err == nil {
+			outFile = rel
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Files = append(m.Files, &manifestFile{Proto: filepath.ToSlash(outFile), Package: g.filePkg, Messages: g.manifestMessages, Enums: g.manifestEnums})
+}
+
+// write saves the manifest, files in path order (directory mode runs concurrently).
+func (m *manifest) write() error {
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Proto < m.Files[j].Proto })
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.path, append(data, '\n'))
+}
@@ -0,0 +1,20 @@
+package main
+
+// Map representations for -map.
+const (
+	mapProto   = "map"
+	mapEntries = "entries"
+)
+
+// mapEntrySchema is the `{key, value}` message standing in for one map
+// entry with -map=entries; the repeated entries keep their wire order.
+func mapEntrySchema(value *Schema) *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"key":   {Type: "string"},
+			"value": value,
+		},
+		propOrder: []string{"key", "value"},
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phases of -metrics durations.
+const (
+	phaseLoad   = "load"   // reading, parsing and resolving a spec
+	phaseRender = "render" // emitting messages, enums and services
+	phaseWrite  = "write"  // writing the proto file
+)
+
+// Input results of -metrics.
+const (
+	inputOK       = "ok"
+	inputFailed   = "failed"
+	inputUpToDate = "up_to_date"
+)
+
+// metrics collects the counters of a run for -metrics; a nil *metrics
+// ignores every observation.
+type metrics struct {
+	path    string
+	start   time.Time
+	mu      sync.Mutex
+	inputs  map[string]int
+	outputs int
+	schemas int
+	skipped int
+	phases  map[string]time.Duration
+}
+
+func newMetrics(path string) *metrics {
+	return &metrics{path: path, start: time.Now(), inputs: map[string]int{}, phases: map[string]time.Duration{}}
+}
+
+// observe adds the time since start to phase; meant for defer.
+func (m *metrics) observe(phase string, start time.Time) {
+	if m == nil {
+		return
+	}
+	d := time.Since(start)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.phases[phase] += d
+}
+
+func (m *metrics) countInput(status string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inputs[status]++
+}
+
+func (m *metrics) countOutput() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outputs++
+}
+
+func (m *metrics) countSchemas(converted, skipped int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.schemas += converted
+	m.skipped += skipped
+}
+
+// flushMetrics writes the -metrics file; fatal calls it (reporting a failed
+// run), since exiting skips the deferred call in main.
+var flushMetrics = func(success bool) {}
+
+// write 以 OpenMetrics 文本格式写出本次运行的指标
+func (m *metrics) write(diags *diagnostics, success bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	family := func(name, typ, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	family("oapi2proto_run_success", "gauge", "Whether the run finished without errors (1) or failed (0).")
+	ok := 0
+	if success {
+		ok = 1
+	}
+	fmt.Fprintf(&b, "oapi2proto_run_success %d\n", ok)
+	family("oapi2proto_run_duration_seconds", "gauge", "Wall time of the run.")
+	fmt.Fprintf(&b, "oapi2proto_run_duration_seconds %.6f\n", time.Since(m.start).Seconds())
+	family("oapi2proto_phase_duration_seconds", "gauge", "Time spent per phase, summed over all files (parallel files add up).")
+	for _, phase := range []string{phaseLoad, phaseRender, phaseWrite} {
+		fmt.Fprintf(&b, "oapi2proto_phase_duration_seconds{phase=%s} %.6f\n", labelValue(phase), m.phases[phase].Seconds())
+	}
+	family("oapi2proto_inputs", "counter", "Input specs processed, by result.")
+	for _, status := range []string{inputOK, inputFailed, inputUpToDate} {
+		fmt.Fprintf(&b, "oapi2proto_inputs_total{status=%s} %d\n", labelValue(status), m.inputs[status])
+	}
+	family("oapi2proto_outputs", "counter", "Proto files written.")
+	fmt.Fprintf(&b, "oapi2proto_outputs_total %d\n", m.outputs)
+	family("oapi2proto_schemas_converted", "counter", "Component schemas emitted as messages or enums.")
+	fmt.Fprintf(&b, "oapi2proto_schemas_converted_total %d\n", m.schemas)
+	family("oapi2proto_schemas_skipped", "counter", "Component schemas left out by -keep-going.")
+	fmt.Fprintf(&b, "oapi2proto_schemas_skipped_total %d\n", m.skipped)
+	family("oapi2proto_diagnostics", "counter", "Diagnostics recorded, by severity and kind.")
+	counts := map[[2]string]int{}
+	if diags != nil {
+		for _, e := range diags.sorted() {
+			counts[[2]string{e.Severity, e.Kind}]++
+		}
+	}
+	keys := make([][2]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&b, "oapi2proto_diagnostics_total{severity=%s,kind=%s} %d\n", labelValue(k[0]), labelValue(k[1]), counts[k])
+	}
+	b.WriteString("# EOF\n")
+	return writeFileAtomic(m.path, []byte(b.String()))
+}
+
+// labelValue quotes an OpenMetrics label value.
+func labelValue(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// inputStatus is the -metrics result of generating one input.
+func inputStatus(err error) string {
+	switch {
+	case err == nil:
+		return inputOK
+	case errors.Is(err, errUpToDate):
+		return inputUpToDate
+	}
+	return inputFailed
+}
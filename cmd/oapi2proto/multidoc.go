@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeYAMLDocuments decodes every `---` separated YAML document and merges
+// them into one. Identical duplicate definitions are accepted; differing ones
+// are reported as conflicts.
+func decodeYAMLDocuments(data []byte) (Document, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var docs []Document
+	for {
+		var d Document
+		err := dec.Decode(&d)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Document{}, err
+		}
+		docs = append(docs, d)
+	}
+	if len(docs) == 0 {
+		return Document{}, errors.New("empty yaml")
+	}
+	if len(docs) == 1 {
+		return docs[0], nil
+	}
+	merged := docs[0]
+	var conflicts []string
+	for i := 1; i < len(docs); i++ {
+		conflicts = append(conflicts, mergeDocument(&merged, &docs[i], i+1)...)
+	}
+	if len(conflicts) > 0 {
+		return Document{}, fmt.Errorf("yaml 多文档合并冲突:\n  %s", strings.Join(conflicts, "\n  "))
+	}
+	return merged, nil
+}
+
+// mergeDocument merges src (the n-th document) into dst and returns conflicts.
+func mergeDocument(dst, src *Document, n int) []string {
+	var conflicts []string
+	if dst.Info.Title == "" && dst.Info.Version == "" {
+		dst.Info = src.Info
+	}
+	for _, s := range src.Servers {
+		dup := false
+		for _, e := range dst.Servers {
+			if e != nil && s != nil && e.URL == s.URL {
+				dup = true
+			}
+		}
+		if !dup {
+			dst.Servers = append(dst.Servers, s)
+		}
+	}
+	conflicts = append(conflicts, mergeComponent(&dst.Components.Schemas, src.Components.Schemas, "components.schemas", n)...)
+	conflicts = append(conflicts, mergeComponent(&dst.Components.Parameters, src.Components.Parameters, "components.parameters", n)...)
+	conflicts = append(conflicts, mergeComponent(&dst.Components.RequestBodies, src.Components.RequestBodies, "components.requestBodies", n)...)
+	conflicts = append(conflicts, mergeComponent(&dst.Components.Responses, src.Components.Responses, "components.responses", n)...)
+	if len(src.Paths) > 0 && dst.Paths == nil {
+		dst.Paths = map[string]*PathItem{}
+	}
+	for _, p := range sortedKeys(src.Paths) {
+		item := src.Paths[p]
+		existing, ok := dst.Paths[p]
+		if !ok || existing == nil {
+			dst.Paths[p] = item
+			continue
+		}
+		if item == nil {
+			continue
+		}
+		merged := *existing
+		for _, verb := range httpMethods {
+			a, b := existing.operation(verb), item.operation(verb)
+			switch {
+			case b == nil:
+			case a == nil:
+				merged.setOperation(verb, b)
+			case literal(a) != literal(b):
+				conflicts = append(conflicts, fmt.Sprintf("document %d: paths.%s.%s conflicts with an earlier definition", n, p, verb))
+			}
+		}
+		if len(item.Parameters) > 0 && len(existing.Parameters) == 0 {
+			merged.Parameters = item.Parameters
+		}
+		dst.Paths[p] = &merged
+	}
+	return conflicts
+}
+
+// mergeComponent adds src entries into *dst, reporting same-name entries
+// whose content differs.
+func mergeComponent[V any](dst *map[string]V, src map[string]V, section string, n int) []string {
+	if len(src) == 0 {
+		return nil
+	}
+	if *dst == nil {
+		*dst = map[string]V{}
+	}
+	var conflicts []string
+	for _, name := range sortedKeys(src) {
+		v := src[name]
+		if prev, ok := (*dst)[name]; ok {
+			if literal(prev) != literal(v) {
+				conflicts = append(conflicts, fmt.Sprintf("document %d: %s.%s conflicts with an earlier definition", n, section, name))
+			}
+			continue
+		}
+		(*dst)[name] = v
+	}
+	return conflicts
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// normalizeDocument rewrites schema spellings that map onto an existing
+// construct before emission.
+func normalizeDocument(doc *Document) {
+	walkSchemas(doc, func(s *Schema) {
+		normalizeNullable(s)
+		normalizeConst(s)
+		normalizeBooleanSchemas(s)
+		normalizePatternProperties(s)
+		normalizeBounds(s)
+		normalizeFormatBounds(s)
+	})
+}
+
+// normalizeNullable folds every nullability spelling into Nullable, so the
+// presence options and nullable-array strategies see one representation:
+// `nullable: true`, Swagger's `x-nullable: true`, `type: [T, "null"]` (see
+// setTypes) and "null" branches of oneOf / anyOf, which are dropped. A union
+// left with a single branch collapses onto that branch, so `oneOf: [{type:
+// string}, {type: "null"}]` becomes a nullable string rather than a oneof;
+// the 3.0 idiom `nullable: true` + `allOf: [{$ref: X}]` collapses onto the
+// ref the same way. Multi-type `type` arrays become oneOf branches.
+func normalizeNullable(s *Schema) {
+	if s.XNullable {
+		s.Nullable, s.XNullable = true, false
+	}
+	if len(s.typeUnion) > 0 && s.OneOf == nil && s.AnyOf == nil {
+		for _, t := range s.typeUnion {
+			branch := &Schema{Type: t, origin: s.origin}
+			switch t {
+			case "object":
+				branch.Properties, branch.Required, branch.AddlProps = s.Properties, s.Required, s.AddlProps
+			case "array":
+				branch.Items = s.Items
+			default:
+				branch.Format = s.Format
+			}
+			s.OneOf = append(s.OneOf, branch)
+		}
+		s.Properties, s.Required, s.AddlProps, s.Items, s.Format = nil, nil, nil, nil, ""
+		s.typeUnion = nil
+	}
+	for _, list := range []*[]*Schema{&s.OneOf, &s.AnyOf} {
+		if len(*list) == 0 {
+			continue
+		}
+		var kept []*Schema
+		for _, b := range *list {
+			if isNullSchema(b) {
+				s.Nullable = true
+				continue
+			}
+			kept = append(kept, b)
+		}
+		*list = kept
+	}
+	if !s.Nullable || s.Type != "" || s.Ref != "" || len(s.Properties) > 0 {
+		return
+	}
+	var branch *Schema
+	switch {
+	case len(s.OneOf)+len(s.AnyOf) == 1 && len(s.AllOf) == 0:
+		branch = append(s.OneOf, s.AnyOf...)[0]
+	case len(s.AllOf) == 1 && len(s.OneOf)+len(s.AnyOf) == 0 && s.AllOf[0] != nil && s.AllOf[0].Ref != "":
+		branch = s.AllOf[0]
+	default:
+		return
+	}
+	collapsed := *branch
+	collapsed.Nullable = true
+	collapsed.Description = firstNonEmpty(s.Description, branch.Description)
+	collapsed.Title = firstNonEmpty(s.Title, branch.Title)
+	collapsed.ReadOnly = s.ReadOnly || branch.ReadOnly
+	collapsed.WriteOnly = s.WriteOnly || branch.WriteOnly
+	if s.Default != nil {
+		collapsed.Default = s.Default
+	}
+	if s.Example != nil {
+		collapsed.Example = s.Example
+	}
+	collapsed.origin = s.origin
+	*s = collapsed
+}
+
+// isNullSchema reports whether s only admits null (`type: "null"`).
+func isNullSchema(s *Schema) bool {
+	return s != nil && s.Type == "null" && s.Ref == "" && len(s.Properties) == 0
+}
+
+// bound is a numeric limit; exclusive bounds exclude the value itself.
+type bound struct {
+	value     float64
+	exclusive bool
+}
+
+// normalizeBounds folds minimum/maximum and both exclusive spellings (3.0
+// booleans modifying minimum/maximum, 3.1 standalone numbers) into lower /
+// upper. When several apply, the stricter one wins.
+func normalizeBounds(s *Schema) {
+	if s.Minimum != nil {
+		s.lower = &bound{value: *s.Minimum, exclusive: s.ExclusiveMinimum == true}
+	}
+	if v, ok := numberValue(s.ExclusiveMinimum); ok {
+		if s.lower == nil || v >= s.lower.value {
+			s.lower = &bound{value: v, exclusive: true}
+		}
+	}
+	if s.Maximum != nil {
+		s.upper = &bound{value: *s.Maximum, exclusive: s.ExclusiveMaximum == true}
+	}
+	if v, ok := numberValue(s.ExclusiveMaximum); ok {
+		if s.upper == nil || v <= s.upper.value {
+			s.upper = &bound{value: v, exclusive: true}
+		}
+	}
+}
+
+// smallIntRanges are the ranges of the integer formats narrower than int32;
+// they map to int32 and their range becomes a validation bound.
+var smallIntRanges = map[string][2]float64{
+	"int8":   {math.MinInt8, math.MaxInt8},
+	"int16":  {math.MinInt16, math.MaxInt16},
+	"uint8":  {0, math.MaxUint8},
+	"uint16": {0, math.MaxUint16},
+}
+
+// isInt32Format reports whether an integer format maps to int32.
+func isInt32Format(format string) bool {
+	_, small := smallIntRanges[format]
+	return format == "int32" || small
+}
+
+// normalizeFormatBounds tightens lower / upper to the range implied by a
+// small integer format (explicit, stricter bounds are kept).
+func normalizeFormatBounds(s *Schema) {
+	r, ok := smallIntRanges[s.Format]
+	if !ok || s.Type != "integer" {
+		return
+	}
+	if s.lower == nil || s.lower.value < r[0] {
+		s.lower = &bound{value: r[0]}
+	}
+	if s.upper == nil || s.upper.value > r[1] {
+		s.upper = &bound{value: r[1]}
+	}
+}
+
+// numberValue converts a decoded JSON / YAML number.
+func numberValue(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// normalizeBooleanSchemas resolves boolean subschemas: `false` for
+// additionalProperties / unevaluatedProperties marks a closed object;
+// `additionalProperties: true` makes a properties-less object a
+// google.protobuf.Struct (extra properties next to declared ones have no
+// proto field and are dropped); `items: false` closes a tuple.
+func normalizeBooleanSchemas(s *Schema) {
+	if s.AddlProps.isTrue() && len(s.PatternProperties) == 0 {
+		s.AddlProps = nil
+		s.open = true
+		if len(s.Properties) == 0 && s.AllOf == nil && s.OneOf == nil && s.AnyOf == nil {
+			s.dynamicStruct = true
+			if s.Type == "" {
+				s.Type = "object"
+			}
+		}
+	}
+	if s.AddlProps.isFalse() {
+		s.AddlProps = nil
+		s.closed = "additionalProperties: false"
+	}
+	if s.UnevaluatedProps.isFalse() {
+		if s.closed == "" {
+			s.closed = "unevaluatedProperties: false"
+		}
+	}
+	s.UnevaluatedProps = nil
+	if s.Items.isFalse() {
+		s.Items = nil
+	}
+}
+
+// normalizePatternProperties maps a properties-less object whose
+// patternProperties (and additionalProperties, if any) share one value schema
+// onto the regular map path; heterogeneous value schemas become
+// google.protobuf.Struct. Patterns are kept for the field comment.
+func normalizePatternProperties(s *Schema) {
+	if len(s.PatternProperties) == 0 || len(s.Properties) > 0 {
+		return
+	}
+	if s.Type == "" {
+		s.Type = "object"
+	}
+	var shared *Schema
+	sharedKey := ""
+	values := make([]*Schema, 0, len(s.PatternProperties)+1)
+	for _, p := range sortedKeys(s.PatternProperties) {
+		values = append(values, s.PatternProperties[p])
+	}
+	if s.AddlProps != nil {
+		values = append(values, s.AddlProps)
+	}
+	for _, v := range values {
+		key := literal(v)
+		if shared == nil {
+			shared, sharedKey = v, key
+			continue
+		}
+		if key != sharedKey {
+			s.AddlProps = nil
+			s.dynamicStruct = true
+			return
+		}
+	}
+	s.AddlProps = shared
+}
+
+// patternNote documents patternProperties folded into a map / Struct.
+func patternNote(s *Schema) string {
+	if len(s.PatternProperties) == 0 {
+		return ""
+	}
+	return "patternProperties: " + strings.Join(sortedKeys(s.PatternProperties), ", ")
+}
+
+// trailingComment renders " // text" (or nothing for empty text).
+func trailingComment(text string) string {
+	if text == "" {
+		return ""
+	}
+	return " // " + oneline(text)
+}
+
+// normalizeConst turns a string `const` into a single-value enum and infers a
+// missing type from the constant for the other kinds (which stay typed fields
+// documented by fieldComment).
+func normalizeConst(s *Schema) {
+	if s.Const == nil {
+		return
+	}
+	switch v := s.Const.(type) {
+	case string:
+		if len(s.Enum) == 0 {
+			s.Enum = []string{v}
+		}
+		if s.Type == "" {
+			s.Type = "string"
+		}
+	case bool:
+		if s.Type == "" {
+			s.Type = "boolean"
+		}
+	case int, int64, uint64:
+		if s.Type == "" {
+			s.Type = "integer"
+		}
+	case float64:
+		if s.Type == "" {
+			if v == float64(int64(v)) {
+				s.Type = "integer"
+			} else {
+				s.Type = "number"
+			}
+		}
+	}
+}
+
+// walkSchemas visits every schema reachable from components and paths once.
+func walkSchemas(doc *Document, fn func(*Schema)) {
+	seen := map[*Schema]bool{}
+	var walk func(*Schema)
+	walk = func(s *Schema) {
+		if s == nil || seen[s] {
+			return
+		}
+		seen[s] = true
+		fn(s)
+		for _, p := range s.Properties {
+			walk(p)
+		}
+		walk(s.Items)
+		walk(s.AddlProps)
+		for _, p := range s.PatternProperties {
+			walk(p)
+		}
+		for _, list := range [][]*Schema{s.AllOf, s.OneOf, s.AnyOf, s.PrefixItems} {
+			for _, c := range list {
+				walk(c)
+			}
+		}
+	}
+	for _, s := range doc.Components.Schemas {
+		walk(s)
+	}
+	walkParam := func(p *Parameter) {
+		if p != nil {
+			walk(p.Schema)
+		}
+	}
+	walkContent := func(content map[string]*MediaType) {
+		for _, mt := range content {
+			if mt != nil {
+				walk(mt.Schema)
+			}
+		}
+	}
+	for _, p := range doc.Components.Parameters {
+		walkParam(p)
+	}
+	for _, rb := range doc.Components.RequestBodies {
+		if rb != nil {
+			walkContent(rb.Content)
+		}
+	}
+	for _, r := range doc.Components.Responses {
+		if r != nil {
+			walkContent(r.Content)
+		}
+	}
+	for _, item := range doc.Paths {
+		if item == nil {
+			continue
+		}
+		for _, p := range item.Parameters {
+			walkParam(p)
+		}
+		for _, verb := range httpMethods {
+			op := item.operation(verb)
+			if op == nil {
+				continue
+			}
+			for _, p := range op.Parameters {
+				walkParam(p)
+			}
+			if op.RequestBody != nil {
+				walkContent(op.RequestBody.Content)
+			}
+			for _, r := range op.Responses {
+				if r != nil {
+					walkContent(r.Content)
+				}
+			}
+		}
+	}
+}
+
+// fieldComment builds the trailing comment of a field: its description plus
+// notes about schema keywords proto cannot express.
+func (g *genContext) fieldComment(s *Schema, ptype string) string {
+	var parts []string
+	if s.Description != "" {
+		parts = append(parts, oneline(s.Description))
+	}
+	if s.Const != nil {
+		if _, isString := s.Const.(string); !isString {
+			parts = append(parts, "const: "+literal(s.Const))
+		}
+	}
+	if n := patternNote(s); n != "" {
+		parts = append(parts, n)
+	}
+	if n := g.enumValuesNote(s, ptype); n != "" {
+		parts = append(parts, n)
+	}
+	if m := g.resolveRef(s).MultipleOf; m != nil && !g.hasMultipleOfRule(s, ptype) {
+		parts = append(parts, "multipleOf: "+formatNumber(*m))
+	}
+	if n := g.nullableArrayNote(s, ptype); n != "" {
+		parts = append(parts, n)
+	}
+	if n := g.defaultNote(s); n != "" {
+		parts = append(parts, n)
+	}
+	if n := g.exampleNote(s); n != "" {
+		parts = append(parts, n)
+	}
+	return oneline(strings.Join(parts, "; "))
+}
+
+// writeDescription writes a schema description as the leading comment of a
+// message or enum, keeping its line breaks (blank lines become "//").
+func writeDescription(b *strings.Builder, desc string) {
+	desc = strings.TrimSpace(desc)
+	if desc == "" {
+		return
+	}
+	for _, l := range strings.Split(desc, "\n") {
+		if l = strings.TrimRight(l, " \t\r"); l == "" {
+			b.WriteString("//\n")
+			continue
+		}
+		b.WriteString("// " + sanitizeComment(l) + "\n")
+	}
+}
+
+// literal renders a schema value (const, default, example) as compact JSON.
+func literal(v any) string {
+	data, err := json.Marshal(jsonCompatible(v))
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// jsonCompatible converts yaml-decoded map[string]any / map[any]any trees so
+// encoding/json can marshal them.
+func jsonCompatible(v any) any {
+	switch t := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = jsonCompatible(val)
+		}
+		return m
+	case map[string]any:
+		m := make(map[string]any, len(t))
+		for k, val := range t {
+			m[k] = jsonCompatible(val)
+		}
+		return m
+	case []any:
+		out := make([]any, len(t))
+		for i, val := range t {
+			out[i] = jsonCompatible(val)
+		}
+		return out
+	}
+	return v
+}
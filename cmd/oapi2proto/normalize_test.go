@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// testOptions are the generation defaults of the CLI.
+func testOptions(t *testing.T) *genOptions {
+	t.Helper()
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setAcronyms("", cfg)
+	setInflections(cfg)
+	return &genOptions{
+		pkg:         "api.v1",
+		goPkg:       "example.com/project/api/v1;v1",
+		presence:    presenceNullable,
+		anyOfMode:   "oneof",
+		sortFields:  true,
+		config:      cfg,
+		mapMode:     mapProto,
+		enumMode:    enumProto,
+		inlineNames: inlineNamesPath,
+		inputFormat: inputOpenAPI,
+		format:      formatProto,
+		style:       styleDefault,
+		breaking:    breakingOff,
+		infoComment: true,
+		print:       printOptions{indent: "  ", blankLines: blankLinesKeep, commentStyle: commentStyleLine},
+	}
+}
+
+// loadSpec decodes and resolves an in-memory spec like loadDocument.
+func loadSpec(t *testing.T, opts *genOptions, file, spec string) *Document {
+	t.Helper()
+	read := func(p string) ([]byte, error) {
+		if p == file {
+			return []byte(spec), nil
+		}
+		return os.ReadFile(p)
+	}
+	doc, err := parseDocument([]byte(spec), file, read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.finishDocument(&doc, file); err != nil {
+		t.Fatal(err)
+	}
+	doc.source = file
+	return &doc
+}
+
+// renderSpec generates the proto file of an in-memory spec.
+func renderSpec(t *testing.T, opts *genOptions, file, spec string) string {
+	t.Helper()
+	doc := loadSpec(t, opts, file, spec)
+	preamble := ""
+	if opts.infoComment {
+		preamble = infoComment(doc, "")
+	}
+	out, ctx := renderFile(doc, opts, opts.pkg, opts.goPkg, preamble)
+	if len(ctx.errors) > 0 {
+		t.Fatal(ctx.errors)
+	}
+	return out
+}
+
+func TestAdditionalPropertiesTrue(t *testing.T) {
+	out := renderSpec(t, testOptions(t), "ap.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    Free: {type: object, additionalProperties: true}
+    Bare: {additionalProperties: true}
+    Holder:
+      type: object
+      properties:
+        meta: {type: object, additionalProperties: true}
+        bag: {additionalProperties: true}
+        attrs: {type: object, properties: {a: {type: string}}, additionalProperties: true}
+`)
+	for _, want := range []string{
+		`import "google/protobuf/struct.proto";`,
+		"message Free {\n  google.protobuf.Struct entries = 1;\n}",
+		"message Bare {\n  google.protobuf.Struct entries = 1;\n}",
+		"  google.protobuf.Struct meta = ",
+		"  google.protobuf.Struct bag = ",
+		"  HolderAttrs attrs = ",
+		"message HolderAttrs {\n  string a = 1;\n}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "map<") {
+		t.Errorf("additionalProperties: true generated a map:\n%s", out)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Strategies for nullable arrays (-nullable-array); repeated fields have no presence.
+const (
+	nullableArrayIgnore    = "ignore"
+	nullableArrayWrapper   = "wrapper"
+	nullableArrayListValue = "listvalue"
+	nullableArrayComment   = "comment"
+)
+
+// isNullable reports whether a field schema admits null. normalizeNullable
+// has folded every spelling into Nullable; a $ref also picks it up from the
+// referenced schema, so a nullable component makes its uses nullable.
+func (g *genContext) isNullable(s *Schema) bool {
+	return s != nil && (s.Nullable || s.Ref != "" && g.resolveRef(s).Nullable)
+}
+
+// nullableArray rewrites the type of a nullable array field. The wrapper
+// strategy returns the `message <Elem>List { repeated <Elem> items = 1; }`
+// definition to emit (once) after the parent message.
+func (g *genContext) nullableArray(ps *Schema, ptype string) (string, string) {
+	if !g.isNullable(ps) || !strings.HasPrefix(ptype, "repeated ") {
+		return ptype, ""
+	}
+	elem := strings.TrimPrefix(ptype, "repeated ")
+	switch g.nullableArrays {
+	case nullableArrayWrapper:
+		if name, ok := g.listWrappers[elem]; ok {
+			return name, ""
+		}
+		name := g.uniqueMessageName(normalizeMessage(elem[strings.LastIndex(elem, ".")+1:] + "_list"))
+		g.visited[name] = true
+		g.listWrappers[elem] = name
+		nums := g.newNumberer(name)
+		items := nums.number("items")
+		def := fmt.Sprintf("// %s wraps a nullable list: an unset field is null, a set one may be empty.\nmessage %s {\n  repeated %s items = %d;\n%s}\n\n", name, name, elem, items, g.spareRange(name, nums))
+		return name, def
+	case nullableArrayListValue:
+		g.useImport("google/protobuf/struct.proto")
+		return "google.protobuf.ListValue", ""
+	}
+	return ptype, ""
+}
+
+// nullableArrayNote documents nullable arrays kept as plain repeated fields.
+func (g *genContext) nullableArrayNote(s *Schema, ptype string) string {
+	switch {
+	case !g.isNullable(s):
+	case g.nullableArrays == nullableArrayComment && strings.HasPrefix(ptype, "repeated "):
+		return "nullable: null and an empty list are indistinguishable"
+	case ptype == "google.protobuf.ListValue" && s.Type == "array" && s.Items != nil:
+		return "nullable list of " + firstNonEmpty(componentRefTail(s.Items.Ref), s.Items.Type)
+	}
+	return ""
+}
+
+// componentRefTail returns the last segment of a $ref ("" when not a ref).
+func componentRefTail(ref string) string {
+	if ref == "" {
+		return ""
+	}
+	return refKey(ref)
+}
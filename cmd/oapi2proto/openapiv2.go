@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const openapiv2Import = "protoc-gen-openapiv2/options/annotations.proto"
+
+// openapiv2Option is the option name prefix of protoc-gen-openapiv2 annotations.
+const openapiv2Option = "(grpc.gateway.protoc_gen_openapiv2.options."
+
+// aggregate renders `{k: v, ...}` from pre-rendered key/value pairs.
+func aggregate(pairs []string) string {
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// exampleOf returns the (first) example of a schema as JSON, the form
+// protoc-gen-openapiv2 expects in `example`.
+func exampleOf(s *Schema) (string, bool) {
+	if s.Example != nil {
+		return literal(s.Example), true
+	}
+	if len(s.Examples) > 0 {
+		return literal(s.Examples[0]), true
+	}
+	return "", false
+}
+
+// openapiv2FileOption renders the openapiv2_swagger file option from info and tags.
+func (g *genContext) openapiv2FileOption() string {
+	if !g.openapiv2 {
+		return ""
+	}
+	var info []string
+	if v := g.doc.Info.Title; v != "" {
+		info = append(info, "title: "+textQuote(v))
+	}
+	if v := g.doc.Info.Version; v != "" {
+		info = append(info, "version: "+textQuote(v))
+	}
+	if v := g.doc.Info.Description; v != "" {
+		info = append(info, "description: "+textQuote(v))
+	}
+	if c := g.doc.Info.Contact; c.Name != "" || c.Email != "" || c.URL != "" {
+		var contact []string
+		for _, kv := range [][2]string{{"name", c.Name}, {"url", c.URL}, {"email", c.Email}} {
+			if kv[1] != "" {
+				contact = append(contact, kv[0]+": "+textQuote(kv[1]))
+			}
+		}
+		info = append(info, "contact: "+aggregate(contact))
+	}
+	var pairs []string
+	if len(info) > 0 {
+		pairs = append(pairs, "info: "+aggregate(info))
+	}
+	for _, t := range g.doc.Tags {
+		if t == nil || t.Name == "" {
+			continue
+		}
+		tag := []string{"name: " + textQuote(t.Name)}
+		if t.Description != "" {
+			tag = append(tag, "description: "+textQuote(t.Description))
+		}
+		pairs = append(pairs, "tags: "+aggregate(tag))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	g.useImport(openapiv2Import)
+	return fmt.Sprintf("option %sopenapiv2_swagger) = %s;\n\n", openapiv2Option, aggregate(pairs))
+}
+
+// openapiv2SchemaOption renders the openapiv2_schema message option: title,
+// description and required list of the json_schema, plus the example.
+func (g *genContext) openapiv2SchemaOption(s *Schema) string {
+	if !g.openapiv2 {
+		return ""
+	}
+	var js []string
+	if s.Title != "" {
+		js = append(js, "title: "+textQuote(s.Title))
+	}
+	if s.Description != "" {
+		js = append(js, "description: "+textQuote(s.Description))
+	}
+	required := append([]string{}, s.Required...)
+	for _, part := range s.AllOf {
+		required = append(required, g.resolveRef(part).Required...)
+	}
+	if len(required) > 0 {
+		quoted := make([]string, len(required))
+		for i, r := range required {
+			quoted[i] = textQuote(r)
+		}
+		js = append(js, "required: ["+strings.Join(quoted, ", ")+"]")
+	}
+	var pairs []string
+	if len(js) > 0 {
+		pairs = append(pairs, "json_schema: "+aggregate(js))
+	}
+	if ex, ok := exampleOf(s); ok {
+		pairs = append(pairs, "example: "+textQuote(ex))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	g.useImport(openapiv2Import)
+	return fmt.Sprintf("option %sopenapiv2_schema) = %s;", openapiv2Option, aggregate(pairs))
+}
+
+// openapiv2FieldOption renders the openapiv2_field option of a property.
+func (g *genContext) openapiv2FieldOption(s *Schema) string {
+	if !g.openapiv2 || s == nil {
+		return ""
+	}
+	var pairs []string
+	if s.Title != "" {
+		pairs = append(pairs, "title: "+textQuote(s.Title))
+	}
+	if s.Description != "" {
+		pairs = append(pairs, "description: "+textQuote(s.Description))
+	}
+	if ex, ok := exampleOf(s); ok {
+		pairs = append(pairs, "example: "+textQuote(ex))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	g.useImport(openapiv2Import)
+	return fmt.Sprintf("%sopenapiv2_field) = %s", openapiv2Option, aggregate(pairs))
+}
+
+// openapiv2OperationOption renders the openapiv2_operation rpc option.
+func (g *genContext) openapiv2OperationOption(m *rpcMethod) string {
+	if !g.openapiv2 {
+		return ""
+	}
+	op := m.op
+	var pairs []string
+	if op.OperationID != "" {
+		pairs = append(pairs, "operation_id: "+textQuote(op.OperationID))
+	}
+	if op.Summary != "" {
+		pairs = append(pairs, "summary: "+textQuote(op.Summary))
+	}
+	if op.Description != "" {
+		pairs = append(pairs, "description: "+textQuote(op.Description))
+	}
+	for _, t := range op.Tags {
+		pairs = append(pairs, "tags: "+textQuote(t))
+	}
+	if op.Deprecated {
+		pairs = append(pairs, "deprecated: true")
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	g.useImport(openapiv2Import)
+	return fmt.Sprintf("option %sopenapiv2_operation) = %s;", openapiv2Option, aggregate(pairs))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Schemas and operations remember the JSON pointer they were decoded from
+// (their origin), so generated elements can be traced back to the spec. The
+// pointers are recorded right after parsing, before hoisting and
+// normalization move schemas around; schemas synthesized later have none.
+
+// setOrigin records ptr on s and every schema nested in it that has no
+// origin yet (schemas reached twice keep the first pointer).
+func setOrigin(s *Schema, ptr string) {
+	if s == nil || s.origin != "" {
+		return
+	}
+	s.origin = ptr
+	for _, name := range sortedKeys(s.Properties) {
+		setOrigin(s.Properties[name], ptr+"/properties/"+escapePointer(name))
+	}
+	setOrigin(s.Items, ptr+"/items")
+	setOrigin(s.AddlProps, ptr+"/additionalProperties")
+	setOrigin(s.UnevaluatedProps, ptr+"/unevaluatedProperties")
+	for _, name := range sortedKeys(s.PatternProperties) {
+		setOrigin(s.PatternProperties[name], ptr+"/patternProperties/"+escapePointer(name))
+	}
+	for _, kw := range listKeywords {
+		for i, c := range s.list(kw) {
+			setOrigin(c, fmt.Sprintf("%s/%s/%d", ptr, kw, i))
+		}
+	}
+	for _, name := range sortedKeys(s.Defs) {
+		setOrigin(s.Defs[name], ptr+"/$defs/"+escapePointer(name))
+	}
+	for _, name := range sortedKeys(s.Definitions) {
+		setOrigin(s.Definitions[name], ptr+"/definitions/"+escapePointer(name))
+	}
+}
+
+// annotateOrigins records the origin of every schema and operation of a
+// freshly decoded OpenAPI document.
+func annotateOrigins(doc *Document) {
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		setOrigin(doc.Components.Schemas[name], componentSchemasPrefix+escapePointer(name))
+	}
+	content := func(ptr string, c map[string]*MediaType) {
+		for _, mt := range sortedKeys(c) {
+			if c[mt] != nil {
+				setOrigin(c[mt].Schema, ptr+"/content/"+escapePointer(mt)+"/schema")
+			}
+		}
+	}
+	params := func(ptr string, list []*Parameter) {
+		for i, p := range list {
+			if p != nil {
+				setOrigin(p.Schema, fmt.Sprintf("%s/%d/schema", ptr, i))
+			}
+		}
+	}
+	for _, name := range sortedKeys(doc.Components.Parameters) {
+		if p := doc.Components.Parameters[name]; p != nil {
+			setOrigin(p.Schema, "#/components/parameters/"+escapePointer(name)+"/schema")
+		}
+	}
+	for _, name := range sortedKeys(doc.Components.RequestBodies) {
+		if rb := doc.Components.RequestBodies[name]; rb != nil {
+			content("#/components/requestBodies/"+escapePointer(name), rb.Content)
+		}
+	}
+	for _, name := range sortedKeys(doc.Components.Responses) {
+		if r := doc.Components.Responses[name]; r != nil {
+			content("#/components/responses/"+escapePointer(name), r.Content)
+		}
+	}
+	for _, path := range sortedKeys(doc.Paths) {
+		item := doc.Paths[path]
+		if item == nil {
+			continue
+		}
+		base := "#/paths/" + escapePointer(path)
+		params(base+"/parameters", item.Parameters)
+		for _, verb := range httpMethods {
+			op := item.operation(verb)
+			if op == nil {
+				continue
+			}
+			ptr := base + "/" + verb
+			op.origin = ptr
+			params(ptr+"/parameters", op.Parameters)
+			if op.RequestBody != nil {
+				content(ptr+"/requestBody", op.RequestBody.Content)
+			}
+			for _, code := range sortedKeys(op.Responses) {
+				if r := op.Responses[code]; r != nil {
+					content(ptr+"/responses/"+escapePointer(code), r.Content)
+				}
+			}
+		}
+	}
+}
+
+// setOriginFile prefixes the recorded pointers with the source file name.
+func setOriginFile(doc *Document, file string) {
+	walkSchemas(doc, func(s *Schema) {
+		if strings.HasPrefix(s.origin, "#") {
+			s.origin = file + s.origin
+		}
+	})
+	for _, item := range doc.Paths {
+		if item == nil {
+			continue
+		}
+		for _, verb := range httpMethods {
+			if op := item.operation(verb); op != nil && strings.HasPrefix(op.origin, "#") {
+				op.origin = file + op.origin
+			}
+		}
+	}
+}
+
+// provenanceNote writes the detached `// source:` comment of an element
+// (-provenance); the blank line keeps it out of the element's doc comment.
+func (g *genContext) provenanceNote(b *strings.Builder, indent, origin string) {
+	if !g.provenance {
+		return
+	}
+	b.WriteString(indent + "// source: " + oneline(origin) + "\n\n")
+}
+
+// originOption renders the (oapi2proto.origin) message option (-origin-option):
+// component name, origin pointer and info.version of the spec.
+func (g *genContext) originOption(name string, s *Schema) string {
+	if !g.emitOrigin || (s.origin == "" && g.componentName(name) == "") {
+		return ""
+	}
+	var parts []string
+	for _, kv := range [][2]string{{"schema", g.componentName(name)}, {"source", s.origin}, {"spec_version", g.doc.Info.Version}} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+": "+textQuote(kv[1]))
+		}
+	}
+	return "option " + g.useCustomOption("origin") + " = {" + strings.Join(parts, ", ") + "};"
+}
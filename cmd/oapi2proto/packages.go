@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Component schemas carrying x-proto-package (or x-namespace) are generated
+// into their own package and file; references between the files become
+// qualified types with imports, like type_map entries.
+
+// protoPackageRe matches a dotted proto package name.
+var protoPackageRe = regexp.MustCompile(`^[A-Za-z_]\w*(\.[A-Za-z_]\w*)*$`)
+
+// namespaceSepRe splits namespaces spelled like Acme.Billing, acme/billing
+// or Acme::Billing into package segments.
+var namespaceSepRe = regexp.MustCompile(`[./\\]|::`)
+
+// packageHint returns the package a component schema asks to be generated
+// in, "" for the file's own package. x-namespace segments are converted to
+// lower_snake_case.
+func packageHint(s *Schema) string {
+	if s.ProtoPackage != "" {
+		return strings.Trim(s.ProtoPackage, ".")
+	}
+	if s.Namespace == "" {
+		return ""
+	}
+	var segs []string
+	for _, seg := range namespaceSepRe.Split(s.Namespace, -1) {
+		if seg = collapseUnderscores(strings.Trim(lowerSnake(nonAlnumReplace(seg)), "_")); seg != "" {
+			segs = append(segs, seg)
+		}
+	}
+	return strings.Join(segs, ".")
+}
+
+// packagePart is one generated file of a split document.
+type packagePart struct {
+	pkg     string
+	outFile string
+	doc     *Document
+}
+
+// packageOutFile places the file of a sub-package: under -layout buf-module
+// layoutPath already follows the package; otherwise the package path
+// relative to the main package (or the full path for unrelated packages) is
+// appended to the output directory.
+func (o *genOptions) packageOutFile(mainPkg, pkg, outFile string) string {
+	if o.module != nil {
+		return outFile
+	}
+	rel := strings.TrimPrefix(pkg, mainPkg+".")
+	return filepath.Join(filepath.Dir(outFile), filepath.FromSlash(strings.ReplaceAll(rel, ".", "/")), filepath.Base(outFile))
+}
+
+// importPathOf returns the import path of a generated file, relative to the
+// output root.
+func (o *genOptions) importPathOf(pkg, outFile string) string {
+	path := o.layoutPath(pkg, outFile)
+	path = filepath.Join(filepath.Dir(path), descriptorFileName(path))
+	if rel, err := filepath.Rel(o.outRoot, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.Base(path)
+}
+
+// splitPackages 按 x-proto-package / x-namespace 将文档拆分为各 package 的文件;
+// 返回的各部分按 package 排序, 主 package 在最后. 每部分保留全部 schema 以便解析引用,
+// 其他部分的 schema 映射为带 import 的全限定类型而不生成
+func (o *genOptions) splitPackages(doc *Document, pkg, outFile string) ([]packagePart, error) {
+	owner := map[string]string{} // schema -> package
+	pkgs := map[string]bool{}
+	g := newGenContext(doc, o)
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		hint := packageHint(doc.Components.Schemas[name])
+		if hint == "" || hint == pkg {
+			continue
+		}
+		if _, mapped := g.mappedType(name); mapped {
+			continue
+		}
+		if !protoPackageRe.MatchString(hint) {
+			return nil, fmt.Errorf("schema %s: x-proto-package %q 不是合法的 proto package", name, hint)
+		}
+		owner[name] = hint
+		pkgs[hint] = true
+	}
+	if len(pkgs) == 0 {
+		return []packagePart{{pkg: pkg, outFile: outFile, doc: doc}}, nil
+	}
+	files := map[string]string{pkg: outFile}
+	for p := range pkgs {
+		files[p] = o.packageOutFile(pkg, p, outFile)
+	}
+	order := sortedKeys(pkgs)
+	var parts []packagePart
+	for _, p := range append(order, pkg) {
+		part := *doc
+		part.externalTypes = map[string]TypeMapping{}
+		for name, m := range doc.externalTypes {
+			part.externalTypes[name] = m
+		}
+		for name := range doc.Components.Schemas {
+			home, moved := owner[name]
+			if !moved {
+				home = pkg
+			}
+			if _, external := doc.externalTypes[name]; external || home == p {
+				continue
+			}
+			s := g.resolveRef(doc.Components.Schemas[name])
+			part.externalTypes[name] = TypeMapping{Type: home + "." + normalizeMessage(name), Import: o.importPathOf(home, files[home]),
+				enum: len(s.Enum) > 0 && !g.enumAsScalar(s)}
+		}
+		if p != pkg {
+			part.Paths, part.channels = nil, nil
+			if o.goPkgTemplate == nil {
+				mainGo, _ := o.goPackageFor(pkg, outFile) // 无模板时不会失败
+				part.goPackage = subGoPackage(mainGo, pkg, p)
+			}
+		}
+		parts = append(parts, packagePart{pkg: p, outFile: files[p], doc: &part})
+	}
+	return parts, nil
+}
+
+// subGoPackage derives the go_package of a sub-package from the -go_pkg of
+// the main one: nested packages get a sub-directory of its import path,
+// unrelated ones a sibling path under the same root
+// (example.com/project/api/v1 + acme.billing.v1 -> example.com/project/acme/billing/v1).
+func subGoPackage(mainGo, mainPkg, pkg string) string {
+	importPath, _, _ := strings.Cut(mainGo, ";")
+	pkgPath := strings.ReplaceAll(pkg, ".", "/")
+	var path string
+	if rel, ok := strings.CutPrefix(pkg, mainPkg+"."); ok {
+		path = importPath + "/" + strings.ReplaceAll(rel, ".", "/")
+	} else if root, ok := strings.CutSuffix(importPath, "/"+strings.ReplaceAll(mainPkg, ".", "/")); ok {
+		path = root + "/" + pkgPath
+	} else {
+		path = importPath + "/" + pkgPath
+	}
+	return path + ";" + goAlias(pkg)
+}
+
+// writePackages 写出文档的各 package 文件 (无 x-proto-package 时即单个文件)
+func writePackages(doc *Document, opts *genOptions, pkg, outFile, preamble string) error {
+	parts, err := opts.splitPackages(doc, pkg, outFile)
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if err := writeProtoFile(part.doc, opts, part.pkg, part.outFile, preamble); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// siblingEnums lists the enums other files of the run define for this one
+// (x-proto-package), by fully-qualified name.
+func (g *genContext) siblingEnums() map[string]bool {
+	enums := map[string]bool{}
+	for _, m := range g.doc.externalTypes {
+		if m.enum {
+			enums[m.Type] = true
+		}
+	}
+	return enums
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// versionRe matches semver-like versions and proto-style version
+// segments: 2, v2.1.0, 1.0.0-beta.2, v3beta1, v1alpha ...
+var versionRe = regexp.MustCompile(`^[vV]?(\d+)(?:\.\d+)*(?:[-.]?(?i:(alpha|beta))[.\-]?(\d*))?`)
+
+// packageFor 返回某个输入文件使用的 proto package
+func (o *genOptions) packageFor(doc *Document, inFile string) string {
+	if !o.pkgFromInfo {
+		return o.stylePackage(o.pkg, inFile)
+	}
+	pkg, err := packageFromInfo(doc.Info)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARN] %s: %v, 无法推导 package, 使用 -pkg=%s\n", inFile, err, o.pkg)
+		pkg = o.pkg
+	}
+	return o.stylePackage(pkg, inFile)
+}
+
+// packageFromInfo derives "<title>.v<major>[alpha|beta<n>]" from info. The
+// title is transliterated to ASCII (see transliterate) and lowercased into a
+// snake_case identifier; dots in the title separate package segments. A
+// missing or unparsable version yields the title alone. Titles that are
+// empty or keep letters without an ASCII spelling are rejected rather than
+// silently shortened.
+func packageFromInfo(info Info) (string, error) {
+	title, ok := transliterate(info.Title)
+	if !ok {
+		return "", fmt.Errorf("info.title %q 含无法转写为 ASCII 的字符", info.Title)
+	}
+	var segs []string
+	for _, part := range strings.Split(title, ".") {
+		seg := strings.Trim(lowerSnake(nonAlnumReplace(strings.ToLower(strings.TrimSpace(part)))), "_")
+		seg = collapseUnderscores(seg)
+		if seg == "" {
+			continue
+		}
+		if seg[0] >= '0' && seg[0] <= '9' {
+			seg = "x" + seg
+		}
+		segs = append(segs, seg)
+	}
+	if len(segs) == 0 {
+		return "", errors.New("info.title 为空")
+	}
+	if v := versionSuffix(info.Version); v != "" {
+		if isVersionSegment(segs[len(segs)-1]) {
+			segs = segs[:len(segs)-1]
+		}
+		segs = append(segs, v)
+	}
+	return strings.Join(segs, "."), nil
+}
+
+// latinASCII spells Latin letters with diacritics in ASCII (German umlauts
+// the German way: Über -> Ueber).
+var latinASCII = map[rune]string{
+	'ä': "ae", 'ö': "oe", 'ü': "ue", 'Ä': "Ae", 'Ö': "Oe", 'Ü': "Ue", 'ß': "ss",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Å': "A", 'Ā': "A", 'Ă': "A", 'Ą': "A",
+	'æ': "ae", 'Æ': "Ae", 'ç': "c", 'ć': "c", 'č': "c", 'Ç': "C", 'Ć': "C", 'Č': "C",
+	'ď': "d", 'đ': "d", 'ð': "d", 'Ď': "D", 'Đ': "D", 'Ð': "D",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ē': "E", 'Ė': "E", 'Ę': "E", 'Ě': "E",
+	'ğ': "g", 'Ğ': "G", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i",
+	'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I", 'Ī': "I", 'İ': "I",
+	'ł': "l", 'ľ': "l", 'Ł': "L", 'Ľ': "L", 'ñ': "n", 'ń': "n", 'ň': "n", 'Ñ': "N", 'Ń': "N", 'Ň': "N",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ø': "O", 'Ō': "O", 'Ő': "O", 'œ': "oe", 'Œ': "Oe",
+	'ř': "r", 'Ř': "R", 'ś': "s", 'š': "s", 'ş': "s", 'Ś': "S", 'Š': "S", 'Ş': "S",
+	'ť': "t", 'ţ': "t", 'Ť': "T", 'Ţ': "T", 'þ': "th", 'Þ': "Th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'Ù': "U", 'Ú': "U", 'Û': "U", 'Ū': "U", 'Ů': "U", 'Ű': "U",
+	'ý': "y", 'ÿ': "y", 'Ý': "Y", 'ź': "z", 'ż': "z", 'ž': "z", 'Ź': "Z", 'Ż': "Z", 'Ž': "Z",
+}
+
+// transliterate spells s in ASCII: Latin letters with diacritics via
+// latinASCII, other non-ASCII symbols and spaces become separators. It
+// reports false when a letter or digit has no ASCII spelling (CJK, Cyrillic
+// ...), since dropping it would change the name.
+func transliterate(s string) (string, bool) {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case latinASCII[r] != "":
+			b.WriteString(latinASCII[r])
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return "", false
+		default:
+			b.WriteByte(' ')
+		}
+	}
+	return b.String(), true
+}
+
+// versionSuffix maps "2.1.0" -> "v2", "1.0.0-beta.1" -> "v1beta1".
+func versionSuffix(version string) string {
+	m := versionRe.FindStringSubmatch(strings.TrimSpace(version))
+	if m == nil {
+		return ""
+	}
+	v := "v" + strings.TrimLeft(m[1], "0")
+	if v == "v" {
+		v = "v0"
+	}
+	if m[2] != "" {
+		n := m[3]
+		if n == "" {
+			n = "1"
+		}
+		v += strings.ToLower(m[2]) + n
+	}
+	return v
+}
+
+func collapseUnderscores(s string) string {
+	for strings.Contains(s, "__") {
+		s = strings.ReplaceAll(s, "__", "_")
+	}
+	return s
+}
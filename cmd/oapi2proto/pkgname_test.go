@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestPackageFromInfo(t *testing.T) {
+	for _, tc := range []struct {
+		title, version, want string
+	}{
+		{"Pet Store", "2.1.0", "pet_store.v2"},
+		{"Pet Store", "1.0.0-beta.1", "pet_store.v1beta1"},
+		{"Pet Store", "v3beta1", "pet_store.v3beta1"},
+		{"Pet Store", "v2alpha", "pet_store.v2alpha1"},
+		{"Pet Store", "1.0.0-Beta2", "pet_store.v1beta2"},
+		{"Über-Service", "1", "ueber_service.v1"},
+		{"Café Orders", "2", "cafe_orders.v2"},
+		{"Acme.Billing", "", "acme.billing"},
+		{"Pet Store ™", "1", "pet_store.v1"},
+		{"宠物商店", "1", ""},
+		{"Petstore Сервис", "1", ""},
+		{"", "1", ""},
+	} {
+		t.Run(tc.title+"@"+tc.version, func(t *testing.T) {
+			got, err := packageFromInfo(Info{Title: tc.title, Version: tc.version})
+			if tc.want == "" {
+				if err == nil {
+					t.Errorf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("got %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestGoPackageFromInfo(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		fromInfo bool
+		goPkgSet bool
+		want     string
+	}{
+		{"derived", true, false, "example.com/project/pet_store/v2;v2"},
+		{"explicit -go_pkg", true, true, "example.com/project/api/v1;v1"},
+		{"-pkg-from flag", false, false, "example.com/project/api/v1;v1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := testOptions(t)
+			opts.pkgFromInfo, opts.goPkgSet = tc.fromInfo, tc.goPkgSet
+			got, err := opts.goPackageFor("pet_store.v2", "api.proto")
+			if err != nil || got != tc.want {
+				t.Errorf("got %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// -plural-fields modes.
+const (
+	pluralFieldsOff    = "off"
+	pluralFieldsWarn   = "warn"
+	pluralFieldsRename = "rename"
+)
+
+// uncountableWords are their own plural.
+var uncountableWords = map[string]bool{"data": true, "info": true, "metadata": true, "media": true, "children": true,
+	"people": true, "feedback": true, "news": true, "series": true, "equipment": true, "information": true,
+	"species": true, "software": true, "hardware": true, "evidence": true, "config": true, "staff": true}
+
+// irregularPlurals maps singular words to plurals the suffix rules get wrong.
+var irregularPlurals = map[string]string{"person": "people", "child": "children", "man": "men", "woman": "women",
+	"mouse": "mice", "goose": "geese", "foot": "feet", "tooth": "teeth", "datum": "data", "medium": "media",
+	"criterion": "criteria", "phenomenon": "phenomena", "analysis": "analyses", "axis": "axes", "basis": "bases",
+	"leaf": "leaves", "life": "lives", "knife": "knives", "wife": "wives", "half": "halves", "shelf": "shelves"}
+
+// singularS are singular words ending in "s".
+var singularS = map[string]bool{"status": true, "bus": true, "gas": true, "alias": true, "atlas": true, "lens": true,
+	"bonus": true, "campus": true, "census": true, "virus": true, "corpus": true, "radius": true, "focus": true,
+	"canvas": true, "thesis": true, "diagnosis": true, "synopsis": true, "consensus": true, "apparatus": true}
+
+// inflections 是配置 inflections 的单数 -> 复数例外 (复数与单数相同表示不可数)
+var inflections = map[string]string{}
+
+// setInflections 载入配置 inflections (键与值统一为小写)
+func setInflections(cfg *Config) {
+	for singular, plural := range cfg.Inflections {
+		inflections[strings.ToLower(singular)] = strings.ToLower(plural)
+	}
+}
+
+// looksPlural reports whether the last word of a snake_case field name is
+// plural, approximating protolint's REPEATED_FIELD_NAMES_PLURALIZED.
+func looksPlural(name string) bool {
+	word := name[strings.LastIndex(name, "_")+1:]
+	for singular, plural := range inflections {
+		if word == plural {
+			return true
+		}
+		if word == singular {
+			return false
+		}
+	}
+	if uncountableWords[word] {
+		return true
+	}
+	for _, plural := range irregularPlurals {
+		if word == plural {
+			return true
+		}
+	}
+	if _, irregular := irregularPlurals[word]; irregular || singularS[word] || strings.HasSuffix(word, "ss") {
+		return false
+	}
+	return strings.HasSuffix(word, "s")
+}
+
+// pluralizeField pluralizes the last word of a snake_case field name.
+func pluralizeField(name string) string {
+	i := strings.LastIndex(name, "_") + 1
+	return name[:i] + pluralize(name[i:])
+}
+
+// pluralize returns the plural of a lower-case English word: configured
+// inflections and irregular words first, then the usual suffix rules.
+func pluralize(word string) string {
+	if p, ok := inflections[word]; ok {
+		return p
+	}
+	if uncountableWords[word] {
+		return word
+	}
+	if p, ok := irregularPlurals[word]; ok {
+		return p
+	}
+	switch {
+	case strings.HasSuffix(word, "s"), strings.HasSuffix(word, "x"), strings.HasSuffix(word, "z"),
+		strings.HasSuffix(word, "ch"), strings.HasSuffix(word, "sh"):
+		return word + "es"
+	case len(word) > 1 && strings.HasSuffix(word, "y") && !strings.ContainsRune("aeiou", rune(word[len(word)-2])):
+		return word[:len(word)-1] + "ies"
+	}
+	return word + "s"
+}
+
+// pluralFieldName applies -plural-fields to the field of an array property:
+// a singular name is reported (warn) or pluralized (rename).
+func (g *genContext) pluralFieldName(msgName, fname string, ps *Schema) (string, bool) {
+	if g.pluralFields == "" || g.pluralFields == pluralFieldsOff || ps == nil {
+		return fname, false
+	}
+	if rs := g.resolveRef(ps); rs.Type != "array" || len(rs.PrefixItems) > 0 || looksPlural(fname) {
+		return fname, false
+	}
+	plural := pluralizeField(fname)
+	if g.pluralFields == pluralFieldsWarn {
+		g.diag(severityWarning, "plural-field", msgName+"."+fname, fmt.Sprintf("repeated field name is singular; consider %s", plural))
+		return fname, false
+	}
+	g.diag(severityInfo, "plural-field", msgName+"."+fname, "repeated field renamed to "+plural)
+	return plural, true
+}
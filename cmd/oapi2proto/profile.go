@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	httppprof "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// stopProfiling flushes the -cpuprofile / -memprofile output and stops the
+// -pprof server; fatal calls it too, since exiting skips the deferred call in
+// main.
+var stopProfiling = func() {}
+
+// startProfiling 开始 CPU 采样 (-cpuprofile) 并在 httpAddr 上提供 pprof 端点 (-pprof),
+// 返回的函数停止采样与端点并写出堆 profile (-memprofile)
+func startProfiling(cpuPath, memPath, httpAddr string) (func(), error) {
+	stopServer, err := servePprof(httpAddr)
+	if err != nil {
+		return nil, err
+	}
+	var cpu *os.File
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			stopServer()
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			stopServer()
+			return nil, err
+		}
+		cpu = f
+	}
+	done := false
+	return func() {
+		if done {
+			return
+		}
+		done = true
+		stopServer()
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			cpu.Close()
+		}
+		if memPath == "" {
+			return
+		}
+		f, err := os.Create(memPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return
+		}
+		defer f.Close()
+		runtime.GC() // 使堆 profile 反映最新的存活对象
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+	}, nil
+}
+
+// servePprof serves the net/http/pprof handlers on addr (on a mux of its own,
+// not http.DefaultServeMux) until the returned function is called; an empty
+// addr serves nothing.
+func servePprof(addr string) (func(), error) {
+	if addr == "" {
+		return func() {}, nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("-pprof: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln) // 关闭后返回 http.ErrServerClosed
+	fmt.Fprintf(os.Stderr, "[INFO] pprof: http://%s/debug/pprof/\n", ln.Addr())
+	return func() { srv.Close() }, nil
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A small proto3 parser covering the subset this tool emits (and what users
+// typically keep next to it). It is used to compare generations and to
+// inspect generated output; it is not a general-purpose protobuf compiler.
+
+type protoAST struct {
+	syntax   string
+	pkg      string
+	imports  []protoImport
+	options  []protoOption
+	messages []*protoMessage
+	enums    []*protoEnum
+	services []*protoService
+}
+
+type protoOption struct {
+	name  string
+	value string
+}
+
+type protoMessage struct {
+	name          string
+	line          int
+	fields        []*protoField
+	oneofs        []string
+	messages      []*protoMessage
+	enums         []*protoEnum
+	reserved      []protoRange
+	reservedNames []string
+	options       []protoOption
+}
+
+type protoField struct {
+	label   string // "", "optional", "repeated"
+	typ     string // element type, or map<K,V>
+	keyType string // map fields only
+	valType string // map fields only
+	name    string
+	number  int
+	oneof   string
+	line    int
+	options []protoOption
+}
+
+type protoEnum struct {
+	name     string
+	line     int
+	values   []*protoEnumValue
+	reserved []protoRange
+	options  []protoOption
+}
+
+type protoEnumValue struct {
+	name    string
+	number  int
+	line    int
+	options []protoOption
+}
+
+type protoService struct {
+	name    string
+	line    int
+	methods []*protoMethod
+	options []protoOption
+}
+
+type protoMethod struct {
+	name         string
+	input        string
+	output       string
+	clientStream bool
+	serverStream bool
+	line         int
+	options      []protoOption
+}
+
+type protoRange struct{ start, end int }
+
+type protoToken struct {
+	text string
+	line int
+	str  bool // quoted string literal (text holds the unquoted value)
+}
+
+// tokenizeProto splits proto source into tokens, dropping comments.
+func tokenizeProto(src string) []protoToken {
+	var toks []protoToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			i += 2
+			for i+1 < len(src) && !(src[i] == '*' && src[i+1] == '/') {
+				if src[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			i += 2
+		case c == '"' || c == '\'':
+			start := line
+			var sb strings.Builder
+			i++
+			for i < len(src) && src[i] != c {
+				if src[i] == '\\' && i+1 < len(src) {
+					sb.WriteByte(src[i])
+					i++
+				}
+				if src[i] == '\n' {
+					line++
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			i++
+			toks = append(toks, protoToken{text: sb.String(), line: start, str: true})
+		case isIdentByte(c) || c == '.' || c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(src) && (isIdentByte(src[j]) || src[j] == '.' || (src[j] >= '0' && src[j] <= '9')) {
+				j++
+			}
+			toks = append(toks, protoToken{text: src[i:j], line: line})
+			i = j
+		default:
+			toks = append(toks, protoToken{text: string(c), line: line})
+			i++
+		}
+	}
+	return toks
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+type protoParser struct {
+	toks []protoToken
+	pos  int
+	err  error
+}
+
+// parseProto parses proto source produced by (or compatible with) this tool.
+func parseProto(src string) (*protoAST, error) {
+	p := &protoParser{toks: tokenizeProto(src)}
+	ast := &protoAST{}
+	for !p.eof() {
+		t := p.next()
+		switch t.text {
+		case "syntax":
+			p.expect("=")
+			ast.syntax = p.next().text
+			p.expect(";")
+		case "package":
+			ast.pkg = p.next().text
+			p.expect(";")
+		case "import":
+			imp := protoImport{}
+			if p.peek().text == "public" || p.peek().text == "weak" {
+				imp.public = p.next().text == "public"
+			}
+			imp.path = p.next().text
+			p.expect(";")
+			ast.imports = append(ast.imports, imp)
+		case "option":
+			ast.options = append(ast.options, p.parseOption(";"))
+		case "message":
+			ast.messages = append(ast.messages, p.parseMessage(t.line))
+		case "enum":
+			ast.enums = append(ast.enums, p.parseEnum(t.line))
+		case "service":
+			ast.services = append(ast.services, p.parseService(t.line))
+		case "extend":
+			p.next()
+			p.skipBlock()
+		case ";":
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", t.line, t.text)
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+	}
+	return ast, p.err
+}
+
+func (p *protoParser) eof() bool { return p.pos >= len(p.toks) || p.err != nil }
+
+func (p *protoParser) peek() protoToken {
+	if p.pos >= len(p.toks) {
+		return protoToken{}
+	}
+	return p.toks[p.pos]
+}
+
+func (p *protoParser) next() protoToken {
+	t := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	} else if p.err == nil {
+		p.err = fmt.Errorf("unexpected end of file")
+	}
+	return t
+}
+
+func (p *protoParser) expect(text string) {
+	t := p.next()
+	if t.text != text && p.err == nil {
+		p.err = fmt.Errorf("line %d: expected %q, got %q", t.line, text, t.text)
+	}
+}
+
+// skipBlock skips a balanced { ... } block.
+func (p *protoParser) skipBlock() {
+	p.expect("{")
+	depth := 1
+	for depth > 0 && !p.eof() {
+		switch p.next().text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+}
+
+// parseOption parses `name = value` up to (and consuming) the terminator.
+func (p *protoParser) parseOption(term string) protoOption {
+	var name strings.Builder
+	for !p.eof() && p.peek().text != "=" {
+		name.WriteString(p.next().text)
+	}
+	p.expect("=")
+	val := p.parseValue(term)
+	p.expect(term)
+	return protoOption{name: name.String(), value: val}
+}
+
+// parseValue collects a (possibly aggregate) constant until term at depth 0.
+func (p *protoParser) parseValue(term string) string {
+	var parts []string
+	depth := 0
+	for !p.eof() {
+		t := p.peek()
+		if depth == 0 && (t.text == term || (term == "]" && t.text == ",")) && !t.str {
+			break
+		}
+		p.next()
+		if !t.str {
+			switch t.text {
+			case "{", "[":
+				depth++
+			case "}", "]":
+				depth--
+			}
+			parts = append(parts, t.text)
+			continue
+		}
+		parts = append(parts, `"`+t.text+`"`) // text keeps its escapes
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseFieldOptions parses `[a = 1, b = "x"]` if present.
+func (p *protoParser) parseFieldOptions() []protoOption {
+	if p.peek().text != "[" {
+		return nil
+	}
+	p.next()
+	var opts []protoOption
+	for !p.eof() {
+		var name strings.Builder
+		for !p.eof() && p.peek().text != "=" {
+			name.WriteString(p.next().text)
+		}
+		p.expect("=")
+		opts = append(opts, protoOption{name: name.String(), value: p.parseValue("]")})
+		if p.peek().text == "," {
+			p.next()
+			continue
+		}
+		p.expect("]")
+		break
+	}
+	return opts
+}
+
+func (p *protoParser) parseNumber() int {
+	t := p.next()
+	n, err := strconv.ParseInt(t.text, 0, 64)
+	if err != nil {
+		if t.text == "max" {
+			return 536870911
+		}
+		if p.err == nil {
+			p.err = fmt.Errorf("line %d: expected number, got %q", t.line, t.text)
+		}
+	}
+	return int(n)
+}
+
+func (p *protoParser) parseRanges() ([]protoRange, []string) {
+	var ranges []protoRange
+	var names []string
+	for !p.eof() {
+		if p.peek().str {
+			names = append(names, p.next().text)
+		} else {
+			r := protoRange{start: p.parseNumber()}
+			r.end = r.start
+			if p.peek().text == "to" {
+				p.next()
+				r.end = p.parseNumber()
+			}
+			ranges = append(ranges, r)
+		}
+		if p.peek().text == "," {
+			p.next()
+			continue
+		}
+		break
+	}
+	p.expect(";")
+	return ranges, names
+}
+
+func (p *protoParser) parseMessage(line int) *protoMessage {
+	m := &protoMessage{name: p.next().text, line: line}
+	p.expect("{")
+	for !p.eof() && p.peek().text != "}" {
+		t := p.peek()
+		switch t.text {
+		case "message":
+			p.next()
+			m.messages = append(m.messages, p.parseMessage(t.line))
+		case "enum":
+			p.next()
+			m.enums = append(m.enums, p.parseEnum(t.line))
+		case "option":
+			p.next()
+			m.options = append(m.options, p.parseOption(";"))
+		case "reserved":
+			p.next()
+			r, n := p.parseRanges()
+			m.reserved = append(m.reserved, r...)
+			m.reservedNames = append(m.reservedNames, n...)
+		case "oneof":
+			p.next()
+			name := p.next().text
+			m.oneofs = append(m.oneofs, name)
+			p.expect("{")
+			for !p.eof() && p.peek().text != "}" {
+				if p.peek().text == "option" {
+					p.next()
+					p.parseOption(";")
+					continue
+				}
+				f := p.parseField()
+				f.oneof = name
+				m.fields = append(m.fields, f)
+			}
+			p.expect("}")
+		case "extensions":
+			p.next()
+			p.parseRanges()
+		case ";":
+			p.next()
+		default:
+			m.fields = append(m.fields, p.parseField())
+		}
+	}
+	p.expect("}")
+	return m
+}
+
+func (p *protoParser) parseField() *protoField {
+	f := &protoField{line: p.peek().line}
+	if t := p.peek().text; t == "optional" || t == "repeated" || t == "required" {
+		f.label = p.next().text
+	}
+	if p.peek().text == "map" {
+		p.next()
+		p.expect("<")
+		f.keyType = p.next().text
+		p.expect(",")
+		f.valType = p.next().text
+		p.expect(">")
+		f.typ = fmt.Sprintf("map<%s,%s>", f.keyType, f.valType)
+	} else {
+		f.typ = p.next().text
+	}
+	f.name = p.next().text
+	p.expect("=")
+	f.number = p.parseNumber()
+	f.options = p.parseFieldOptions()
+	p.expect(";")
+	return f
+}
+
+func (p *protoParser) parseEnum(line int) *protoEnum {
+	e := &protoEnum{name: p.next().text, line: line}
+	p.expect("{")
+	for !p.eof() && p.peek().text != "}" {
+		t := p.peek()
+		switch t.text {
+		case "option":
+			p.next()
+			e.options = append(e.options, p.parseOption(";"))
+		case "reserved":
+			p.next()
+			r, _ := p.parseRanges()
+			e.reserved = append(e.reserved, r...)
+		case ";":
+			p.next()
+		default:
+			v := &protoEnumValue{name: p.next().text, line: t.line}
+			p.expect("=")
+			v.number = p.parseNumber()
+			v.options = p.parseFieldOptions()
+			p.expect(";")
+			e.values = append(e.values, v)
+		}
+	}
+	p.expect("}")
+	return e
+}
+
+func (p *protoParser) parseService(line int) *protoService {
+	s := &protoService{name: p.next().text, line: line}
+	p.expect("{")
+	for !p.eof() && p.peek().text != "}" {
+		t := p.next()
+		switch t.text {
+		case "option":
+			s.options = append(s.options, p.parseOption(";"))
+		case "rpc":
+			m := &protoMethod{name: p.next().text, line: t.line}
+			p.expect("(")
+			if p.peek().text == "stream" {
+				p.next()
+				m.clientStream = true
+			}
+			m.input = p.next().text
+			p.expect(")")
+			p.expect("returns")
+			p.expect("(")
+			if p.peek().text == "stream" {
+				p.next()
+				m.serverStream = true
+			}
+			m.output = p.next().text
+			p.expect(")")
+			if p.peek().text == "{" {
+				p.next()
+				for !p.eof() && p.peek().text != "}" {
+					if p.next().text == "option" {
+						m.options = append(m.options, p.parseOption(";"))
+					}
+				}
+				p.expect("}")
+			} else {
+				p.expect(";")
+			}
+			s.methods = append(s.methods, m)
+		case ";":
+		default:
+			if p.err == nil {
+				p.err = fmt.Errorf("line %d: unexpected %q in service", t.line, t.text)
+			}
+		}
+	}
+	p.expect("}")
+	return s
+}
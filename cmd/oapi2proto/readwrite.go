@@ -0,0 +1,77 @@
+package main
+
+import "fmt"
+
+// splitReadWrite adds <Name>Input (without readOnly properties) and
+// <Name>Output (without writeOnly properties) variants of every component
+// object mixing readOnly / writeOnly properties. The full message is kept;
+// request bodies use the Input variant and responses the Output variant.
+func (g *genContext) splitReadWrite() {
+	for _, name := range sortedKeys(g.doc.Components.Schemas) {
+		s := g.doc.Components.Schemas[name]
+		if s.rwSplit || s.rwVariant {
+			continue
+		}
+		resolved := g.resolveRef(s)
+		if !isMessageSchema(resolved) {
+			continue
+		}
+		merged := &Schema{Properties: map[string]*Schema{}}
+		for _, part := range resolved.AllOf {
+			merged = mergeInto(merged, g.resolveRef(part))
+		}
+		merged = mergeInto(merged, resolved)
+		readOnly, writeOnly := false, false
+		for _, ps := range merged.Properties {
+			rp := g.resolveRef(ps)
+			readOnly = readOnly || ps.ReadOnly || rp.ReadOnly
+			writeOnly = writeOnly || ps.WriteOnly || rp.WriteOnly
+		}
+		if !readOnly && !writeOnly {
+			continue
+		}
+		ok := true
+		for _, suffix := range []string{"Input", "Output"} {
+			if _, exists := g.doc.Components.Schemas[name+suffix]; exists {
+				g.diag(severityWarning, "read-write-split", name, fmt.Sprintf("%s%s already exists; readOnly / writeOnly variants not generated", name, suffix))
+				ok = false
+			}
+		}
+		if !ok {
+			continue
+		}
+		g.doc.Components.Schemas[name+"Input"] = g.rwVariant(resolved, merged, func(ps *Schema) bool { return ps.ReadOnly || g.resolveRef(ps).ReadOnly })
+		g.doc.Components.Schemas[name+"Output"] = g.rwVariant(resolved, merged, func(ps *Schema) bool { return ps.WriteOnly || g.resolveRef(ps).WriteOnly })
+		s.rwSplit = true
+	}
+}
+
+// rwVariant copies the merged properties of s, dropping those matching skip.
+func (g *genContext) rwVariant(s, merged *Schema, skip func(*Schema) bool) *Schema {
+	v := &Schema{Type: "object", Title: s.Title, Description: s.Description, Properties: map[string]*Schema{}, closed: s.closed, rwVariant: true}
+	for k, ps := range merged.Properties {
+		if !skip(ps) {
+			v.Properties[k] = ps
+		}
+	}
+	v.declOrder = merged.propertyNames()
+	for _, r := range merged.Required {
+		if _, ok := v.Properties[r]; ok {
+			v.Required = append(v.Required, r)
+		}
+	}
+	return v
+}
+
+// rwRef points a body / response schema referencing a split component at its
+// Input / Output variant.
+func (g *genContext) rwRef(s *Schema, suffix string) *Schema {
+	key, ok := componentRefName(s.Ref)
+	if !g.splitRW || !ok {
+		return s
+	}
+	if tgt := g.doc.Components.Schemas[key]; tgt == nil || !tgt.rwSplit {
+		return s
+	}
+	return &Schema{Ref: componentSchemasPrefix + escapePointer(key+suffix)}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const componentSchemasPrefix = "#/components/schemas/"
+
+// resolveRef follows local $ref chains. JSON pointers into components,
+// including nested keywords (properties, items, $defs, ...), are walked;
+// other refs fall back to a lookup of their last segment.
+func (g *genContext) resolveRef(s *Schema) *Schema {
+	if s == nil {
+		return &Schema{}
+	}
+	for depth := 0; s.Ref != "" && depth < 32; depth++ {
+		tgt := lookupPointer(g.doc, s.Ref)
+		if tgt == nil {
+			tgt = g.doc.Components.Schemas[refKey(s.Ref)]
+		}
+		if tgt == nil || tgt == s {
+			break
+		}
+		s = tgt
+	}
+	return s
+}
+
+// componentRefName returns Name for refs of the exact form #/components/schemas/Name.
+func componentRefName(ref string) (string, bool) {
+	if !strings.HasPrefix(ref, componentSchemasPrefix) {
+		return "", false
+	}
+	rest := strings.TrimPrefix(ref, componentSchemasPrefix)
+	if rest == "" || strings.Contains(rest, "/") {
+		return "", false
+	}
+	return unescapePointer(rest), true
+}
+
+// lookupPointer resolves a #/components/schemas/... JSON pointer.
+func lookupPointer(doc *Document, ref string) *Schema {
+	if !strings.HasPrefix(ref, componentSchemasPrefix) {
+		return nil
+	}
+	segs := strings.Split(strings.TrimPrefix(ref, componentSchemasPrefix), "/")
+	for i := range segs {
+		segs[i] = unescapePointer(segs[i])
+	}
+	cur := doc.Components.Schemas[segs[0]]
+	for i := 1; cur != nil && i < len(segs); i++ {
+		kw := segs[i]
+		switch kw {
+		case "items":
+			cur = cur.Items
+			continue
+		case "additionalProperties":
+			cur = cur.AddlProps
+			continue
+		}
+		if i+1 >= len(segs) {
+			return nil
+		}
+		i++
+		key := segs[i]
+		switch kw {
+		case "properties":
+			cur = cur.Properties[key]
+		case "$defs":
+			cur = cur.Defs[key]
+		case "definitions":
+			cur = cur.Definitions[key]
+		case "patternProperties":
+			cur = cur.PatternProperties[key]
+		case "allOf", "oneOf", "anyOf", "prefixItems":
+			list := cur.list(kw)
+			n, err := strconv.Atoi(key)
+			if err != nil || n < 0 || n >= len(list) {
+				return nil
+			}
+			cur = list[n]
+		default:
+			return nil
+		}
+	}
+	return cur
+}
+
+func unescapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// hoistDefs lifts $defs / definitions nested anywhere under a component
+// schema into components.schemas, named <Owner><Def> (Owner is the component
+// or, for nested $defs, the hoisted parent def), and rewrites refs pointing at
+// them so they are emitted once as properly named top-level types.
+func hoistDefs(doc *Document) {
+	moved := map[string]string{} // old pointer -> new component name
+	var visit func(ptr, owner string, s *Schema, seen map[*Schema]bool)
+	visit = func(ptr, owner string, s *Schema, seen map[*Schema]bool) {
+		if s == nil || seen[s] {
+			return
+		}
+		seen[s] = true
+		for _, kw := range []string{"$defs", "definitions"} {
+			defs := s.Defs
+			if kw == "definitions" {
+				defs = s.Definitions
+			}
+			for _, name := range sortedKeys(defs) {
+				def := defs[name]
+				newName := normalizeMessage(owner) + normalizeMessage(name)
+				for doc.Components.Schemas[newName] != nil {
+					newName += "Def"
+				}
+				doc.Components.Schemas[newName] = def
+				defPtr := ptr + "/" + kw + "/" + escapePointer(name)
+				moved[defPtr] = newName
+				visit(defPtr, newName, def, seen)
+			}
+		}
+		for _, name := range sortedKeys(s.Properties) {
+			visit(ptr+"/properties/"+escapePointer(name), owner, s.Properties[name], seen)
+		}
+		visit(ptr+"/items", owner, s.Items, seen)
+		visit(ptr+"/additionalProperties", owner, s.AddlProps, seen)
+		for _, kw := range listKeywords {
+			for i, c := range s.list(kw) {
+				visit(ptr+"/"+kw+"/"+strconv.Itoa(i), owner, c, seen)
+			}
+		}
+	}
+	seen := map[*Schema]bool{}
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		visit(componentSchemasPrefix+escapePointer(name), name, doc.Components.Schemas[name], seen)
+	}
+	if len(moved) == 0 {
+		return
+	}
+	walkSchemas(doc, func(s *Schema) {
+		if n, ok := moved[s.Ref]; ok {
+			s.Ref = componentSchemasPrefix + escapePointer(n)
+			return
+		}
+		// plain-JSON-Schema style refs relative to the document root
+		for _, prefix := range []string{"#/$defs/", "#/definitions/"} {
+			if strings.HasPrefix(s.Ref, prefix) {
+				for old, n := range moved {
+					if strings.HasSuffix(old, "/"+strings.TrimPrefix(s.Ref, "#/")) {
+						s.Ref = componentSchemasPrefix + escapePointer(n)
+						return
+					}
+				}
+			}
+		}
+	})
+}
+
+// walkComponentPointers visits every schema under components.schemas with its
+// JSON pointer (first occurrence only).
+func walkComponentPointers(doc *Document, fn func(ptr string, s *Schema)) {
+	seen := map[*Schema]bool{}
+	var visit func(ptr string, s *Schema)
+	visit = func(ptr string, s *Schema) {
+		if s == nil || seen[s] {
+			return
+		}
+		seen[s] = true
+		fn(ptr, s)
+		for _, name := range sortedKeys(s.Properties) {
+			visit(ptr+"/properties/"+escapePointer(name), s.Properties[name])
+		}
+		for _, name := range sortedKeys(s.PatternProperties) {
+			visit(ptr+"/patternProperties/"+escapePointer(name), s.PatternProperties[name])
+		}
+		visit(ptr+"/items", s.Items)
+		visit(ptr+"/additionalProperties", s.AddlProps)
+		for _, kw := range listKeywords {
+			for i, c := range s.list(kw) {
+				visit(ptr+"/"+kw+"/"+strconv.Itoa(i), c)
+			}
+		}
+	}
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		visit(componentSchemasPrefix+escapePointer(name), doc.Components.Schemas[name])
+	}
+}
+
+// resolveAnchors rewrites $anchor / $id based refs into JSON pointers so the
+// regular resolver (and component naming) applies. $dynamicRef is resolved
+// statically against $dynamicAnchor / $anchor with a warning, since dynamic
+// scoping is not evaluated.
+func resolveAnchors(doc *Document) {
+	anchors := map[string]string{} // anchor name -> pointer
+	dynamic := map[string]string{}
+	ids := map[string]string{} // $id -> pointer
+	walkComponentPointers(doc, func(ptr string, s *Schema) {
+		if s.Anchor != "" {
+			if prev, dup := anchors[s.Anchor]; dup && prev != ptr {
+				doc.warn("duplicate-anchor", s.Anchor, fmt.Sprintf("$anchor %q defined at %s and %s; using the first", s.Anchor, prev, ptr))
+			} else {
+				anchors[s.Anchor] = ptr
+			}
+		}
+		if s.DynamicAnchor != "" {
+			if _, dup := dynamic[s.DynamicAnchor]; !dup {
+				dynamic[s.DynamicAnchor] = ptr
+			}
+		}
+		if s.ID != "" {
+			ids[strings.TrimSuffix(s.ID, "#")] = ptr
+		}
+	})
+	if len(anchors) == 0 && len(dynamic) == 0 && len(ids) == 0 {
+		walkSchemas(doc, func(s *Schema) {
+			if s.DynamicRef != "" {
+				doc.warn("dynamic-ref", s.DynamicRef, "$dynamicRef target not found; schema treated as untyped")
+			}
+		})
+		return
+	}
+	lookupID := func(id string) (string, bool) {
+		if ptr, ok := ids[id]; ok {
+			return ptr, true
+		}
+		// relative $id values: match on the trailing path
+		for known, ptr := range ids {
+			if strings.HasSuffix(id, "/"+known) || strings.HasSuffix(known, "/"+id) {
+				return ptr, true
+			}
+		}
+		return "", false
+	}
+	resolve := func(ref string) (string, bool) {
+		base, frag, hasFrag := strings.Cut(ref, "#")
+		if base == "" {
+			if hasFrag && frag != "" && !strings.HasPrefix(frag, "/") {
+				ptr, ok := anchors[frag]
+				return ptr, ok
+			}
+			return "", false
+		}
+		ptr, ok := lookupID(base)
+		if !ok {
+			return "", false
+		}
+		switch {
+		case !hasFrag || frag == "":
+			return ptr, true
+		case strings.HasPrefix(frag, "/"):
+			return ptr + frag, true
+		default:
+			p, ok := anchors[frag]
+			return p, ok
+		}
+	}
+	walkSchemas(doc, func(s *Schema) {
+		if s.Ref != "" && !strings.HasPrefix(s.Ref, "#/") {
+			if ptr, ok := resolve(s.Ref); ok {
+				s.Ref = ptr
+			}
+		}
+		if s.DynamicRef != "" && s.Ref == "" {
+			name := strings.TrimPrefix(s.DynamicRef, "#")
+			ptr, ok := dynamic[name]
+			if !ok {
+				ptr, ok = anchors[name]
+			}
+			if !ok {
+				ptr, ok = resolve(s.DynamicRef)
+			}
+			if ok {
+				s.Ref = ptr
+				doc.warn("dynamic-ref", s.DynamicRef, "$dynamicRef resolved statically to "+ptr+"; dynamic scope is not evaluated")
+			} else {
+				doc.warn("dynamic-ref", s.DynamicRef, "$dynamicRef target not found; schema treated as untyped")
+			}
+		}
+	})
+}
+
+// hoistYAMLAnchors makes schemas shared through YAML anchors / aliases a single
+// type. Decoding expands every alias into its own copy, which would otherwise be
+// flattened once per use site. An anchored component is reused by name; an
+// anchored inline message or enum used more than once is hoisted to a
+// component named after the anchor. All other occurrences become $refs.
+func hoistYAMLAnchors(doc *Document) {
+	components := map[string]string{} // anchor -> component name
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		if a := doc.Components.Schemas[name].yamlAnchor; a != "" {
+			if _, ok := components[a]; !ok {
+				components[a] = name
+			}
+		}
+	}
+	count := map[string]int{}
+	first := map[string]*Schema{}
+	walkSchemas(doc, func(s *Schema) {
+		if s.yamlAnchor == "" || s.Ref != "" || (len(s.Enum) == 0 && !isMessageSchema(s)) {
+			return
+		}
+		count[s.yamlAnchor]++
+		if first[s.yamlAnchor] == nil {
+			first[s.yamlAnchor] = s
+		}
+	})
+	for _, a := range sortedKeys(count) {
+		if _, ok := components[a]; ok || count[a] < 2 {
+			continue
+		}
+		name := normalizeMessage(a)
+		for doc.Components.Schemas[name] != nil {
+			name += "Shared"
+		}
+		c := *first[a]
+		if doc.Components.Schemas == nil {
+			doc.Components.Schemas = map[string]*Schema{}
+		}
+		doc.Components.Schemas[name] = &c
+		components[a] = name
+	}
+	if len(components) == 0 {
+		return
+	}
+	walkSchemas(doc, func(s *Schema) {
+		name, ok := components[s.yamlAnchor]
+		if !ok || s.Ref != "" || doc.Components.Schemas[name] == s {
+			return
+		}
+		*s = Schema{Ref: componentSchemasPrefix + escapePointer(name), Description: s.Description}
+	})
+}
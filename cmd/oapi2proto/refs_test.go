@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestHoistDefsOrder(t *testing.T) {
+	spec := []byte(`
+openapi: 3.1.0
+info: {title: X, version: "1"}
+paths: {}
+components:
+  schemas:
+    A:
+      allOf:
+        - $defs: {X: {type: string}}
+      oneOf:
+        - $defs: {X: {type: integer}}
+      anyOf:
+        - $defs: {X: {type: boolean}}
+`)
+	want := map[string]string{"AX": "string", "AXDef": "integer", "AXDefDef": "boolean"}
+	for i := 0; i < 20; i++ {
+		doc, err := parseDocument(spec, "a.yaml", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, typ := range want {
+			got := ""
+			if s := doc.Components.Schemas[name]; s != nil {
+				got = s.Type
+			}
+			if got != typ {
+				t.Fatalf("run %d: %s has type %q, want %q", i, name, got, typ)
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestRefTypeName(t *testing.T) {
+	doc := &Document{}
+	doc.Components.Schemas = map[string]*Schema{
+		"pet":    {Type: "object", Properties: map[string]*Schema{"name": {Type: "string"}}},
+		"Color":  {Type: "string", Enum: []string{"red", "green"}},
+		"Labels": {Type: "object", AddlProps: &Schema{Type: "string"}},
+		"Id":     {Type: "string"},
+		"Alias":  {Ref: "#/components/schemas/pet"},
+	}
+	g := newGenContext(doc, &genOptions{pkg: "api.v1"})
+	for _, tc := range []struct {
+		ref  string
+		want string
+		ok   bool
+	}{
+		{"#/components/schemas/pet", "Pet", true},
+		{"#/components/schemas/Color", "Color", true},
+		{"#/components/schemas/Alias", "Alias", true},
+		{"#/components/schemas/Labels", "", false},
+		{"#/components/schemas/Id", "", false},
+		{"#/components/schemas/Missing", "", false},
+		{"", "", false},
+	} {
+		got, ok := g.refTypeName(&Schema{Ref: tc.ref})
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("refTypeName(%q) = %q, %v; want %q, %v", tc.ref, got, ok, tc.want, tc.ok)
+		}
+	}
+	// a field pointing at a component message reuses it instead of
+	// flattening a copy named after the field
+	if typ, nested := g.fieldType("owner", &Schema{Ref: "#/components/schemas/pet"}); typ != "Pet" || nested != nil {
+		t.Errorf("fieldType(owner) = %q, %v; want Pet without a nested message", typ, nested)
+	}
+}
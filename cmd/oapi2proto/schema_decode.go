@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// schemaFields is Schema without its methods, used to decode object schemas.
+type schemaFields Schema
+
+// schemaJSON shadows `type`, which OAS 3.1 also allows as an array.
+type schemaJSON struct {
+	schemaFields
+	Type json.RawMessage `json:"type"`
+}
+
+// UnmarshalJSON accepts boolean schemas (JSON Schema `true` / `false`) and
+// type arrays (`type: [string, "null"]`).
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*s = Schema{boolValue: &b}
+		return nil
+	}
+	var v schemaJSON
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	*s = Schema(v.schemaFields)
+	if len(s.Properties) > 0 {
+		if s.declOrder, err = jsonKeys(data, "properties"); err != nil {
+			return err
+		}
+	}
+	if len(v.Type) == 0 || string(v.Type) == "null" {
+		return nil
+	}
+	var types []string
+	if err := json.Unmarshal(v.Type, &s.Type); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(v.Type, &types); err != nil {
+		return err
+	}
+	s.setTypes(types)
+	return nil
+}
+
+// UnmarshalYAML accepts boolean schemas (JSON Schema `true` / `false`) and
+// records the anchor of anchored / aliased schemas.
+func (s *Schema) UnmarshalYAML(node *yaml.Node) error {
+	anchor := node.Anchor
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		anchor = node.Alias.Anchor
+	}
+	if err := s.decodeYAML(node); err != nil {
+		return err
+	}
+	s.yamlAnchor = anchor
+	s.declOrder = yamlKeys(node, "properties")
+	return nil
+}
+
+// jsonKeys returns the keys of the object found under path in a JSON
+// document, in document order.
+func jsonKeys(data []byte, path ...string) ([]string, error) {
+	for _, key := range path {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, err
+		}
+		if data = obj[key]; len(data) == 0 {
+			return nil, nil
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, err
+	}
+	var names []string
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+		names = append(names, key.(string))
+	}
+	return names, nil
+}
+
+// yamlKeys returns the keys of the mapping found under path in a YAML node,
+// in document order.
+func yamlKeys(node *yaml.Node, path ...string) []string {
+	for _, key := range path {
+		node = yamlValue(node, key)
+		if node == nil {
+			return nil
+		}
+	}
+	node = yamlDeref(node)
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	names := make([]string, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		names = append(names, node.Content[i].Value)
+	}
+	return names
+}
+
+// yamlValue returns the value of key in a mapping node, or nil.
+func yamlValue(node *yaml.Node, key string) *yaml.Node {
+	node = yamlDeref(node)
+	if node.Kind == yaml.DocumentNode && len(node.Content) == 1 {
+		node = yamlDeref(node.Content[0])
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func yamlDeref(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		return node.Alias
+	}
+	return node
+}
+
+// declaredSchemas returns the component schema names of a JSON or
+// (multi-document) YAML spec in declaration order.
+func declaredSchemas(data []byte) []string {
+	if names, err := jsonKeys(data, "components", "schemas"); err == nil {
+		return names
+	}
+	var names []string
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); err != nil {
+			return names
+		}
+		names = append(names, yamlKeys(&node, "components", "schemas")...)
+	}
+}
+
+// propertyNames lists the properties of s in declaration order (see
+// declaredOrder).
+func (s *Schema) propertyNames() []string {
+	return declaredOrder(s.Properties, s.declOrder)
+}
+
+// declaredOrder lists the keys of m in the order of decl; keys the spec did
+// not declare (added by normalization or synthesized) follow in name order,
+// so the result never depends on map iteration.
+func declaredOrder(m map[string]*Schema, decl []string) []string {
+	names := make([]string, 0, len(m))
+	seen := map[string]bool{}
+	for _, n := range decl {
+		if _, ok := m[n]; ok && !seen[n] {
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+	var rest []string
+	for n := range m {
+		if !seen[n] {
+			rest = append(rest, n)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+func (s *Schema) decodeYAML(node *yaml.Node) error {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!bool" {
+		var b bool
+		if err := node.Decode(&b); err != nil {
+			return err
+		}
+		*s = Schema{boolValue: &b}
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return node.Decode((*schemaFields)(s))
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != "type" || node.Content[i+1].Kind != yaml.SequenceNode {
+			continue
+		}
+		var types []string
+		if err := node.Content[i+1].Decode(&types); err != nil {
+			return err
+		}
+		rest := *node
+		rest.Content = append(append([]*yaml.Node{}, node.Content[:i]...), node.Content[i+2:]...)
+		if err := rest.Decode((*schemaFields)(s)); err != nil {
+			return err
+		}
+		s.setTypes(types)
+		return nil
+	}
+	return node.Decode((*schemaFields)(s))
+}
+
+// setTypes applies an OAS 3.1 type array: "null" makes the schema nullable,
+// a single remaining type becomes Type, several are kept for
+// normalizeNullable to split into oneOf branches.
+func (s *Schema) setTypes(types []string) {
+	var kept []string
+	for _, t := range types {
+		if t == "null" {
+			s.Nullable = true
+			continue
+		}
+		kept = append(kept, t)
+	}
+	switch len(kept) {
+	case 0:
+		s.Type = "null"
+	case 1:
+		s.Type = kept[0]
+	default:
+		s.typeUnion = kept
+	}
+}
+
+// isTrue reports whether s is the boolean schema `true`.
+func (s *Schema) isTrue() bool {
+	return s != nil && s.boolValue != nil && *s.boolValue
+}
+
+// isFalse reports whether s is the boolean schema `false`.
+func (s *Schema) isFalse() bool {
+	return s != nil && s.boolValue != nil && !*s.boolValue
+}
+
+// listKeywords are the keywords holding lists of subschemas, in the order
+// schema walks visit them.
+var listKeywords = []string{"allOf", "oneOf", "anyOf", "prefixItems"}
+
+// list returns the subschemas s holds under one of listKeywords.
+func (s *Schema) list(kw string) []*Schema {
+	switch kw {
+	case "allOf":
+		return s.AllOf
+	case "oneOf":
+		return s.OneOf
+	case "anyOf":
+		return s.AnyOf
+	case "prefixItems":
+		return s.PrefixItems
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// XML is the OpenAPI XML object of a schema.
+type XML struct {
+	Name      string `json:"name" yaml:"name"`
+	Namespace string `json:"namespace" yaml:"namespace"`
+	Prefix    string `json:"prefix" yaml:"prefix"`
+	Attribute bool   `json:"attribute" yaml:"attribute"`
+	Wrapped   bool   `json:"wrapped" yaml:"wrapped"`
+}
+
+// describe lists the set members of x, e.g. `name=pet, attribute`.
+func (x *XML) describe() string {
+	var parts []string
+	for _, kv := range [][2]string{{"name", x.Name}, {"namespace", x.Namespace}, {"prefix", x.Prefix}} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+"="+kv[1])
+		}
+	}
+	if x.Attribute {
+		parts = append(parts, "attribute")
+	}
+	if x.Wrapped {
+		parts = append(parts, "wrapped")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// warnSerializationHints 对 proto 无法表达的序列化提示 (xml / contentEncoding / contentMediaType)
+// 记录告警: 它们被解析但不影响生成结果
+func warnSerializationHints(doc *Document) {
+	walkSchemas(doc, func(s *Schema) {
+		subject := s.origin
+		if s.XML != nil {
+			if subject == "" {
+				subject = "xml"
+			}
+			msg := "xml mapping ignored; the XML contract is not represented in proto"
+			if d := s.XML.describe(); d != "" {
+				msg = fmt.Sprintf("xml mapping (%s) ignored; the XML contract is not represented in proto", d)
+			}
+			doc.warn("serialization-hint", subject, msg)
+		}
+		for _, kv := range [][2]string{{"contentEncoding", s.ContentEncoding}, {"contentMediaType", s.ContentMediaType}} {
+			if kv[1] == "" {
+				continue
+			}
+			if subject == "" {
+				subject = kv[0]
+			}
+			doc.warn("serialization-hint", subject, fmt.Sprintf("%s %q ignored; the field keeps its JSON type", kv[0], kv[1]))
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy is the `x-retry` extension of an operation; unset fields get
+// the defaults of defaultRetryPolicy. Status codes are gRPC code names or
+// HTTP statuses (mapped with httpStatusCodes).
+type RetryPolicy struct {
+	MaxAttempts          int     `json:"maxAttempts" yaml:"maxAttempts"`
+	InitialBackoff       string  `json:"initialBackoff" yaml:"initialBackoff"`
+	MaxBackoff           string  `json:"maxBackoff" yaml:"maxBackoff"`
+	BackoffMultiplier    float64 `json:"backoffMultiplier" yaml:"backoffMultiplier"`
+	RetryableStatusCodes []any   `json:"retryableStatusCodes" yaml:"retryableStatusCodes"`
+}
+
+var defaultRetryPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: "0.1s", MaxBackoff: "1s", BackoffMultiplier: 2}
+
+// grpcMaxAttempts is the client-side cap gRPC applies to maxAttempts.
+const grpcMaxAttempts = 5
+
+// httpStatusCodes maps the HTTP statuses commonly listed as retryable to
+// gRPC codes.
+var httpStatusCodes = map[int]string{
+	408: "DEADLINE_EXCEEDED", 409: "ABORTED", 429: "RESOURCE_EXHAUSTED", 500: "INTERNAL",
+	502: "UNAVAILABLE", 503: "UNAVAILABLE", 504: "DEADLINE_EXCEEDED",
+}
+
+var grpcCodeNames = map[string]bool{
+	"CANCELLED": true, "UNKNOWN": true, "INVALID_ARGUMENT": true, "DEADLINE_EXCEEDED": true, "NOT_FOUND": true,
+	"ALREADY_EXISTS": true, "PERMISSION_DENIED": true, "RESOURCE_EXHAUSTED": true, "FAILED_PRECONDITION": true,
+	"ABORTED": true, "OUT_OF_RANGE": true, "UNIMPLEMENTED": true, "INTERNAL": true, "UNAVAILABLE": true,
+	"DATA_LOSS": true, "UNAUTHENTICATED": true,
+}
+
+// serviceConfig is the JSON gRPC service config.
+type serviceConfig struct {
+	MethodConfig []*methodConfig `json:"methodConfig"`
+}
+
+type methodConfig struct {
+	Name        []methodName       `json:"name"`
+	Timeout     string             `json:"timeout,omitempty"`
+	RetryPolicy *retryPolicyConfig `json:"retryPolicy,omitempty"`
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+}
+
+type retryPolicyConfig struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// serviceConfigPath is the sidecar next to the generated file.
+func serviceConfigPath(outFile string) string {
+	return strings.TrimSuffix(outFile, filepath.Ext(outFile)) + "_service_config.json"
+}
+
+// grpcDuration converts a duration (`500ms`, `2s`, or a number of seconds)
+// into the `<seconds>s` form of the service config.
+func grpcDuration(v any) (string, error) {
+	var d time.Duration
+	switch t := v.(type) {
+	case string:
+		var err error
+		if d, err = time.ParseDuration(t); err != nil {
+			return "", fmt.Errorf("invalid duration %q", t)
+		}
+	default:
+		n, ok := numberValue(v)
+		if !ok {
+			return "", fmt.Errorf("invalid duration %v", v)
+		}
+		d = time.Duration(n * float64(time.Second))
+	}
+	if d <= 0 {
+		return "", fmt.Errorf("duration %v must be positive", v)
+	}
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s", nil
+}
+
+// collectMethodConfig records the service config entry of an rpc with
+// x-timeout / x-retry; invalid values are reported and skipped.
+func (g *genContext) collectMethodConfig(svc string, m *rpcMethod) {
+	if !g.serviceConfig || m.op == nil || (m.op.Timeout == nil && m.op.Retry == nil) {
+		return
+	}
+	service := svc
+	if g.filePkg != "" {
+		service = g.filePkg + "." + svc
+	}
+	subject := service + "/" + m.name
+	mc := &methodConfig{Name: []methodName{{Service: service, Method: m.name}}}
+	if m.op.Timeout != nil {
+		t, err := grpcDuration(m.op.Timeout)
+		if err != nil {
+			g.diag(severityWarning, "service-config", subject, "x-timeout: "+err.Error()+"; ignored")
+		}
+		mc.Timeout = t
+	}
+	if m.op.Retry != nil {
+		mc.RetryPolicy = g.retryPolicy(subject, m.op.Retry)
+	}
+	if mc.Timeout != "" || mc.RetryPolicy != nil {
+		g.methodConfigs = append(g.methodConfigs, mc)
+	}
+}
+
+// retryPolicy fills in the defaults of an x-retry policy and validates it
+// against the constraints gRPC enforces when loading the config.
+func (g *genContext) retryPolicy(subject string, r *RetryPolicy) *retryPolicyConfig {
+	p := &retryPolicyConfig{MaxAttempts: r.MaxAttempts, BackoffMultiplier: r.BackoffMultiplier}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = defaultRetryPolicy.MaxAttempts
+	}
+	if p.MaxAttempts < 2 {
+		g.diag(severityWarning, "service-config", subject, fmt.Sprintf("x-retry: maxAttempts %d must be at least 2; retry policy ignored", p.MaxAttempts))
+		return nil
+	}
+	if p.MaxAttempts > grpcMaxAttempts {
+		g.diag(severityInfo, "service-config", subject, fmt.Sprintf("x-retry: maxAttempts %d is capped at %d by gRPC clients", p.MaxAttempts, grpcMaxAttempts))
+	}
+	if p.BackoffMultiplier == 0 {
+		p.BackoffMultiplier = defaultRetryPolicy.BackoffMultiplier
+	}
+	for _, kv := range []struct {
+		key      string
+		value    string
+		fallback string
+		dst      *string
+	}{{"initialBackoff", r.InitialBackoff, defaultRetryPolicy.InitialBackoff, &p.InitialBackoff}, {"maxBackoff", r.MaxBackoff, defaultRetryPolicy.MaxBackoff, &p.MaxBackoff}} {
+		if kv.value == "" {
+			*kv.dst = kv.fallback
+			continue
+		}
+		d, err := grpcDuration(kv.value)
+		if err != nil {
+			g.diag(severityWarning, "service-config", subject, "x-retry: "+kv.key+": "+err.Error()+"; retry policy ignored")
+			return nil
+		}
+		*kv.dst = d
+	}
+	if p.BackoffMultiplier <= 0 {
+		g.diag(severityWarning, "service-config", subject, "x-retry: backoffMultiplier must be positive; retry policy ignored")
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, c := range r.RetryableStatusCodes {
+		code, ok := retryableCode(c)
+		if !ok {
+			g.diag(severityWarning, "service-config", subject, fmt.Sprintf("x-retry: unknown status code %v; skipped", c))
+			continue
+		}
+		if !seen[code] {
+			seen[code] = true
+			p.RetryableStatusCodes = append(p.RetryableStatusCodes, code)
+		}
+	}
+	if len(p.RetryableStatusCodes) == 0 {
+		p.RetryableStatusCodes = []string{"UNAVAILABLE"}
+	}
+	return p
+}
+
+// retryableCode resolves a gRPC code name (any case) or an HTTP status.
+func retryableCode(v any) (string, bool) {
+	if s, ok := v.(string); ok {
+		if n, err := strconv.Atoi(s); err == nil {
+			v = n
+		} else {
+			name := strings.ToUpper(s)
+			return name, grpcCodeNames[name]
+		}
+	}
+	n, ok := numberValue(v)
+	if !ok {
+		return "", false
+	}
+	code, ok := httpStatusCodes[int(n)]
+	return code, ok
+}
+
+// writeServiceConfig writes the <name>_service_config.json sidecar.
+func (g *genContext) writeServiceConfig(outFile string) error {
+	data, err := json.MarshalIndent(serviceConfig{MethodConfig: g.methodConfigs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return g.writeOwned(serviceConfigPath(outFile), append(data, '\n'), isGeneratedServiceConfig)
+}
+
+// isGeneratedServiceConfig stands in for the marker check of a service
+// config, which gRPC parses strictly and so cannot carry a marker field:
+// the file is ours when it holds exactly what writeServiceConfig writes
+// (methodConfig entries with names, timeout and retryPolicy only).
+func isGeneratedServiceConfig(data []byte) bool {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var c serviceConfig
+	return dec.Decode(&c) == nil && !dec.More()
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PathItem holds the operations of a single path.
+type PathItem struct {
+	Get        *Operation   `json:"get" yaml:"get"`
+	Put        *Operation   `json:"put" yaml:"put"`
+	Post       *Operation   `json:"post" yaml:"post"`
+	Delete     *Operation   `json:"delete" yaml:"delete"`
+	Options    *Operation   `json:"options" yaml:"options"`
+	Head       *Operation   `json:"head" yaml:"head"`
+	Patch      *Operation   `json:"patch" yaml:"patch"`
+	Trace      *Operation   `json:"trace" yaml:"trace"`
+	Parameters []*Parameter `json:"parameters" yaml:"parameters"`
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId" yaml:"operationId"`
+	Tags        []string             `json:"tags" yaml:"tags"`
+	Summary     string               `json:"summary" yaml:"summary"`
+	Description string               `json:"description" yaml:"description"`
+	Parameters  []*Parameter         `json:"parameters" yaml:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody" yaml:"requestBody"`
+	Responses   map[string]*Response `json:"responses" yaml:"responses"`
+	Deprecated  bool                 `json:"deprecated" yaml:"deprecated"`
+	// MethodSignature 生成 (google.api.method_signature), 每项为逗号分隔的请求字段
+	MethodSignature stringOrList `json:"x-method-signature" yaml:"x-method-signature"`
+	// Timeout / Retry 写入 -service-config 输出的 gRPC service config
+	Timeout any          `json:"x-timeout" yaml:"x-timeout"`
+	Retry   *RetryPolicy `json:"x-retry" yaml:"x-retry"`
+
+	// origin is the JSON pointer of the operation, see annotateOrigins
+	origin string
+}
+
+type Parameter struct {
+	Ref         string  `json:"$ref" yaml:"$ref"`
+	Name        string  `json:"name" yaml:"name"`
+	In          string  `json:"in" yaml:"in"`
+	Required    bool    `json:"required" yaml:"required"`
+	Description string  `json:"description" yaml:"description"`
+	Schema      *Schema `json:"schema" yaml:"schema"`
+}
+
+type RequestBody struct {
+	Ref         string                `json:"$ref" yaml:"$ref"`
+	Required    bool                  `json:"required" yaml:"required"`
+	Description string                `json:"description" yaml:"description"`
+	Content     map[string]*MediaType `json:"content" yaml:"content"`
+}
+
+type Response struct {
+	Ref         string                `json:"$ref" yaml:"$ref"`
+	Description string                `json:"description" yaml:"description"`
+	Content     map[string]*MediaType `json:"content" yaml:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema" yaml:"schema"`
+}
+
+// Service grouping strategies for -services.
+const (
+	servicesNone   = "none"
+	servicesSingle = "single"
+	servicesPath   = "path"
+	servicesTag    = "tag"
+	servicesConfig = "config"
+)
+
+// httpMethods lists operation slots in a fixed order for stable output.
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+func (p *PathItem) operation(method string) *Operation {
+	switch method {
+	case "get":
+		return p.Get
+	case "put":
+		return p.Put
+	case "post":
+		return p.Post
+	case "delete":
+		return p.Delete
+	case "options":
+		return p.Options
+	case "head":
+		return p.Head
+	case "patch":
+		return p.Patch
+	case "trace":
+		return p.Trace
+	}
+	return nil
+}
+
+func (p *PathItem) setOperation(method string, op *Operation) {
+	switch method {
+	case "get":
+		p.Get = op
+	case "put":
+		p.Put = op
+	case "post":
+		p.Post = op
+	case "delete":
+		p.Delete = op
+	case "options":
+		p.Options = op
+	case "head":
+		p.Head = op
+	case "patch":
+		p.Patch = op
+	case "trace":
+		p.Trace = op
+	}
+}
+
+// mergeOperations 将另一个文档的 paths 与 components (非 schema 部分) 合并进来, 后者覆盖前者
+func (d *Document) mergeOperations(other *Document) {
+	if len(other.Paths) > 0 && d.Paths == nil {
+		d.Paths = map[string]*PathItem{}
+	}
+	for p, item := range other.Paths {
+		d.Paths[p] = item
+	}
+	if len(other.Components.Parameters) > 0 && d.Components.Parameters == nil {
+		d.Components.Parameters = map[string]*Parameter{}
+	}
+	for k, v := range other.Components.Parameters {
+		d.Components.Parameters[k] = v
+	}
+	if len(other.Components.RequestBodies) > 0 && d.Components.RequestBodies == nil {
+		d.Components.RequestBodies = map[string]*RequestBody{}
+	}
+	for k, v := range other.Components.RequestBodies {
+		d.Components.RequestBodies[k] = v
+	}
+	if len(other.Components.Responses) > 0 && d.Components.Responses == nil {
+		d.Components.Responses = map[string]*Response{}
+	}
+	for k, v := range other.Components.Responses {
+		d.Components.Responses[k] = v
+	}
+	if len(other.files) > 0 && d.files == nil {
+		d.files = map[string]string{}
+	}
+	for k, v := range other.files {
+		d.files[k] = v
+	}
+	if len(other.renamedFrom) > 0 && d.renamedFrom == nil {
+		d.renamedFrom = map[string]string{}
+	}
+	for k, v := range other.renamedFrom {
+		d.renamedFrom[k] = v
+	}
+	d.channels = append(d.channels, other.channels...)
+}
+
+// rpcMethod is one operation mapped to an rpc.
+type rpcMethod struct {
+	name      string
+	path      string
+	verb      string
+	op        *Operation
+	params    []*Parameter
+	request   string
+	response  string
+	serviceID string
+	// channel is set for rpcs derived from AsyncAPI channels
+	channel *channelOp
+	// hasBody is set when the request message carries a body field
+	hasBody bool
+	// responseBody is the response field holding the HTTP payload, if any
+	responseBody string
+}
+
+// emitServices writes request/response messages and service blocks for the
+// document paths, grouped according to -services.
+func (g *genContext) emitServices(b *strings.Builder) {
+	if g.services == servicesNone || (len(g.doc.Paths) == 0 && len(g.doc.channels) == 0) {
+		return
+	}
+	paths := make([]string, 0, len(g.doc.Paths))
+	for p := range g.doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	byService := map[string][]*rpcMethod{}
+	usedNames := map[string]bool{}
+	for _, p := range paths {
+		item := g.doc.Paths[p]
+		if item == nil {
+			continue
+		}
+		for _, verb := range httpMethods {
+			op := item.operation(verb)
+			if op == nil {
+				continue
+			}
+			m := &rpcMethod{path: p, verb: verb, op: op}
+			m.name = rpcName(op, verb, p)
+			for i, base := 2, m.name; usedNames[m.name]; i++ {
+				m.name = fmt.Sprintf("%s%d", base, i)
+			}
+			usedNames[m.name] = true
+			m.params = g.mergeParams(item.Parameters, op.Parameters)
+			m.serviceID = g.serviceFor(op, p)
+			byService[m.serviceID] = append(byService[m.serviceID], m)
+		}
+	}
+	g.channelMethods(byService, usedNames)
+	if g.style == styleBuf {
+		styled := map[string][]*rpcMethod{}
+		for _, svc := range sortedKeys(byService) {
+			name := g.styleService(svc)
+			styled[name] = append(styled[name], byService[svc]...)
+		}
+		byService = styled
+	}
+
+	svcNames := make([]string, 0, len(byService))
+	for s := range byService {
+		svcNames = append(svcNames, s)
+	}
+	sort.Strings(svcNames)
+	for _, svc := range svcNames {
+		methods := byService[svc]
+		if g.sortFields {
+			sort.Slice(methods, func(i, j int) bool { return methods[i].name < methods[j].name })
+		}
+		for _, m := range methods {
+			if m.channel != nil {
+				m.request, m.response = g.channelSignature(m.channel)
+				continue
+			}
+			m.request = g.emitRequestMessage(b, m)
+			m.response = g.emitResponseMessage(b, m)
+		}
+		b.WriteString(fmt.Sprintf("service %s {\n", svc))
+		b.WriteString(g.clientServiceOptions(svc))
+		for _, m := range methods {
+			if c := firstNonEmpty(m.op.Summary, m.op.Description); c != "" {
+				b.WriteString(fmt.Sprintf("  // %s\n", oneline(c)))
+			}
+			g.collectMethodConfig(svc, m)
+			var options strings.Builder
+			rule := g.httpRuleFor(svc, m)
+			if rule != nil && (g.http == httpYAML || g.http == httpBoth) {
+				g.httpRules = append(g.httpRules, rule)
+			}
+			if rule != nil && (g.http == httpAnnotations || g.http == httpBoth) {
+				g.useImport(httpAnnotationsImport)
+				options.WriteString(rule.annotation())
+			}
+			if o := g.openapiv2OperationOption(m); o != "" {
+				options.WriteString("    " + o + "\n")
+			}
+			for _, sig := range g.methodSignatures(m) {
+				options.WriteString("    option (google.api.method_signature) = " + textQuote(sig) + ";\n")
+			}
+			if options.Len() > 0 {
+				b.WriteString(fmt.Sprintf("  rpc %s(%s) returns (%s) {\n%s  }\n", m.name, m.request, m.response, options.String()))
+				continue
+			}
+			b.WriteString(fmt.Sprintf("  rpc %s(%s) returns (%s);\n", m.name, m.request, m.response))
+		}
+		b.WriteString("}\n\n")
+	}
+}
+
+// rpcName derives the rpc name from operationId, falling back to verb + path.
+func rpcName(op *Operation, verb, path string) string {
+	if op.OperationID != "" {
+		return normalizeMessage(op.OperationID)
+	}
+	parts := []string{verb}
+	for _, seg := range strings.Split(path, "/") {
+		seg = strings.Trim(seg, "{}")
+		if seg != "" {
+			parts = append(parts, seg)
+		}
+	}
+	return normalizeMessage(strings.Join(parts, "_"))
+}
+
+// serviceFor picks the service an operation belongs to.
+func (g *genContext) serviceFor(op *Operation, path string) string {
+	switch g.services {
+	case servicesPath:
+		if seg := firstPathSegment(path); seg != "" {
+			return normalizeMessage(seg) + "Service"
+		}
+	case servicesTag:
+		if len(op.Tags) > 0 {
+			return normalizeMessage(op.Tags[0]) + "Service"
+		}
+	case servicesConfig:
+		if svc := g.config.serviceFor(op, path); svc != "" {
+			return svc
+		}
+	}
+	return g.defaultServiceName()
+}
+
+// serviceFor matches op:<operationId>, then tag:<tag>, then the longest path prefix.
+func (c *Config) serviceFor(op *Operation, path string) string {
+	if op.OperationID != "" {
+		if svc, ok := c.ServiceMap["op:"+op.OperationID]; ok {
+			return svc
+		}
+	}
+	for _, t := range op.Tags {
+		if svc, ok := c.ServiceMap["tag:"+t]; ok {
+			return svc
+		}
+	}
+	best, svc := "", ""
+	for prefix, name := range c.ServiceMap {
+		if strings.HasPrefix(prefix, "/") && strings.HasPrefix(path, prefix) && len(prefix) > len(best) {
+			best, svc = prefix, name
+		}
+	}
+	return svc
+}
+
+func (g *genContext) defaultServiceName() string {
+	if g.serviceName != "" {
+		return g.serviceName
+	}
+	segs := strings.Split(g.filePkg, ".")
+	for i := len(segs) - 1; i >= 0; i-- {
+		if !isVersionSegment(segs[i]) {
+			return normalizeMessage(segs[i]) + "Service"
+		}
+	}
+	return "ApiService"
+}
+
+// firstPathSegment returns the first literal path segment, skipping version
+// prefixes like v1 and path templates.
+func firstPathSegment(path string) string {
+	for _, seg := range strings.Split(path, "/") {
+		if seg == "" || strings.HasPrefix(seg, "{") || isVersionSegment(seg) {
+			continue
+		}
+		return seg
+	}
+	return ""
+}
+
+// isVersionSegment matches v1, v2beta1 style segments.
+func isVersionSegment(seg string) bool {
+	return len(seg) > 1 && seg[0] == 'v' && seg[1] >= '0' && seg[1] <= '9'
+}
+
+// mergeParams resolves parameter refs; operation parameters override path-level ones.
+func (g *genContext) mergeParams(pathLevel, opLevel []*Parameter) []*Parameter {
+	var out []*Parameter
+	index := map[string]int{}
+	for _, list := range [][]*Parameter{pathLevel, opLevel} {
+		for _, p := range list {
+			p = g.resolveParameter(p)
+			if p == nil || p.Name == "" {
+				continue
+			}
+			key := p.In + ":" + p.Name
+			if i, ok := index[key]; ok {
+				out[i] = p
+				continue
+			}
+			index[key] = len(out)
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (g *genContext) resolveParameter(p *Parameter) *Parameter {
+	if p == nil || p.Ref == "" {
+		return p
+	}
+	if tgt, ok := g.doc.Components.Parameters[refKey(p.Ref)]; ok {
+		return tgt
+	}
+	return nil
+}
+
+func (g *genContext) resolveRequestBody(rb *RequestBody) *RequestBody {
+	if rb == nil || rb.Ref == "" {
+		return rb
+	}
+	return g.doc.Components.RequestBodies[refKey(rb.Ref)]
+}
+
+func (g *genContext) resolveResponse(r *Response) *Response {
+	if r == nil || r.Ref == "" {
+		return r
+	}
+	return g.doc.Components.Responses[refKey(r.Ref)]
+}
+
+// refKey returns the last segment of a local ref.
+func refKey(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// jsonSchemaOf picks the schema of the JSON media type (or the first one).
+func jsonSchemaOf(content map[string]*MediaType) *Schema {
+	if mt, ok := content["application/json"]; ok && mt != nil && mt.Schema != nil {
+		return mt.Schema
+	}
+	keys := make([]string, 0, len(content))
+	for k := range content {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if mt := content[k]; mt != nil && mt.Schema != nil && strings.Contains(k, "json") {
+			return mt.Schema
+		}
+	}
+	return nil
+}
+
+// uniqueMessageName avoids collisions with emitted types and with the
+// message names of component schemas (list_pets_request and listPetsRequest
+// both become ListPetsRequest).
+func (g *genContext) uniqueMessageName(base string) string {
+	if g.componentMessages == nil {
+		g.componentMessages = map[string]bool{}
+		for key := range g.doc.Components.Schemas {
+			g.componentMessages[normalizeMessage(key)] = true
+		}
+	}
+	name := base
+	for i := 2; g.visited[name] || g.componentMessages[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	return name
+}
+
+// emitRequestMessage builds <Rpc>Request from path/query parameters and the body.
+func (g *genContext) emitRequestMessage(b *strings.Builder, m *rpcMethod) string {
+	name := g.uniqueMessageName(m.name + "Request")
+	req := &Schema{Type: "object", Properties: map[string]*Schema{}, origin: m.op.origin}
+	for _, p := range m.params {
+		if p.In != "path" && p.In != "query" {
+			continue
+		}
+		ps := p.Schema
+		if ps == nil {
+			ps = &Schema{Type: "string"}
+		}
+		if p.Description != "" && ps.Description == "" {
+			cp := *ps
+			cp.Description = p.Description
+			ps = &cp
+		}
+		req.Properties[p.Name] = ps
+		if p.Required {
+			req.Required = append(req.Required, p.Name)
+		}
+	}
+	if rb := g.resolveRequestBody(m.op.RequestBody); rb != nil {
+		if bs := jsonSchemaOf(rb.Content); bs != nil {
+			req.Properties["body"] = g.rwRef(bs, "Input")
+			m.hasBody = true
+			if rb.Required {
+				req.Required = append(req.Required, "body")
+			}
+		}
+	}
+	g.emitSchema(b, name, req)
+	return name
+}
+
+// emitResponseMessage returns the rpc response type: the referenced message
+// itself, a generated <Rpc>Response wrapper, or google.protobuf.Empty.
+func (g *genContext) emitResponseMessage(b *strings.Builder, m *rpcMethod) string {
+	rs := g.successSchema(m.op)
+	if rs != nil {
+		rs = g.rwRef(rs, "Output")
+	}
+	if g.style == styleBuf {
+		return g.emitBufResponse(b, m, rs)
+	}
+	if rs == nil {
+		g.useImport("google/protobuf/empty.proto")
+		return "google.protobuf.Empty"
+	}
+	if t, ok := g.skippedRef(rs, "rpc "+m.name); ok {
+		return t
+	}
+	if t, ok := g.refTypeName(rs); ok {
+		return t
+	}
+	name := g.uniqueMessageName(m.name + "Response")
+	if resolved := g.resolveRef(rs); !isMessageSchema(resolved) {
+		field := "value"
+		if resolved.Type == "array" {
+			field = "items"
+		}
+		g.emitSchema(b, name, &Schema{Type: "object", Properties: map[string]*Schema{field: rs}})
+		return name
+	}
+	g.emitSchema(b, name, rs)
+	return name
+}
+
+// emitBufResponse always generates <Rpc>Response (RPC_RESPONSE_STANDARD_NAME,
+// RPC_REQUEST_RESPONSE_UNIQUE): empty for bodiless responses, and wrapping a
+// referenced message in a field named after it, which becomes the HTTP
+// response_body so the JSON payload is unchanged.
+func (g *genContext) emitBufResponse(b *strings.Builder, m *rpcMethod, rs *Schema) string {
+	name := g.uniqueMessageName(m.name + "Response")
+	switch t, ok := g.refTypeName(rs); {
+	case rs == nil:
+		g.emitSchema(b, name, &Schema{Type: "object", Properties: map[string]*Schema{}})
+	case ok:
+		field := normalizeField(t[strings.LastIndex(t, ".")+1:])
+		g.emitSchema(b, name, &Schema{Type: "object", Properties: map[string]*Schema{field: rs}})
+		m.responseBody = field
+	case !isMessageSchema(g.resolveRef(rs)):
+		field := "value"
+		if g.resolveRef(rs).Type == "array" {
+			field = "items"
+		}
+		g.emitSchema(b, name, &Schema{Type: "object", Properties: map[string]*Schema{field: rs}})
+	default:
+		g.emitSchema(b, name, rs)
+	}
+	return name
+}
+
+// successSchema returns the JSON schema of the first 2xx (or default) response.
+func (g *genContext) successSchema(op *Operation) *Schema {
+	codes := make([]string, 0, len(op.Responses))
+	for c := range op.Responses {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+	for _, pass := range []func(string) bool{
+		func(c string) bool { return strings.HasPrefix(c, "2") },
+		func(c string) bool { return c == "default" },
+	} {
+		for _, c := range codes {
+			if !pass(c) {
+				continue
+			}
+			r := g.resolveResponse(op.Responses[c])
+			if r == nil {
+				continue
+			}
+			return jsonSchemaOf(r.Content)
+		}
+	}
+	return nil
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRequestNameAvoidsComponents(t *testing.T) {
+	opts := testOptions(t)
+	opts.services = servicesSingle
+	out := renderSpec(t, opts, "svc.yaml", `
+openapi: 3.0.0
+info: {title: X, version: "1"}
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      parameters:
+        - {name: limit, in: query, schema: {type: integer}}
+      responses:
+        "200":
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/listPetsResponse"}
+components:
+  schemas:
+    list_pets_request:
+      type: object
+      properties:
+        filter: {type: string}
+    listPetsResponse:
+      type: object
+      properties:
+        total: {type: integer}
+`)
+	for _, want := range []string{"message ListPetsRequest {\n  string filter = 1;\n}", "message ListPetsRequest2 {", "rpc ListPets(ListPetsRequest2) returns ("} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "message ListPetsResponse {") > 1 {
+		t.Errorf("duplicate ListPetsResponse:\n%s", out)
+	}
+}
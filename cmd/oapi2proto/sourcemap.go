@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sourceMapEntry links one generated element to the spec node it came from.
+type sourceMapEntry struct {
+	Kind      string `json:"kind"` // message | enum | field
+	Name      string `json:"name"` // Message, Enum or Message.field
+	ProtoLine int    `json:"proto_line,omitempty"`
+	Source    string `json:"source"`
+	Pointer   string `json:"pointer"`
+	Line      int    `json:"line,omitempty"`
+}
+
+type sourceMap struct {
+	// Generated carries generatedMarker, so writeGenerated recognizes the file
+	Generated string            `json:"generated"`
+	Proto     string            `json:"proto"`
+	Package   string            `json:"package"`
+	Entries   []*sourceMapEntry `json:"entries"`
+}
+
+// trace records the origin of a generated element for -source-map / -verify
+// and writes its -provenance comment.
+func (g *genContext) trace(b *strings.Builder, indent, kind, name, origin string) {
+	if origin == "" {
+		return
+	}
+	g.provenanceNote(b, indent, origin)
+	if g.sourceMap || g.verify != "" {
+		file, ptr, _ := strings.Cut(origin, "#")
+		g.sourceEntries = append(g.sourceEntries, &sourceMapEntry{Kind: kind, Name: name, Source: file, Pointer: ptr})
+	}
+}
+
+// sourceMapPath is the sidecar next to the generated file.
+func sourceMapPath(outFile string) string {
+	return strings.TrimSuffix(outFile, filepath.Ext(outFile)) + ".map.json"
+}
+
+// writeSourceMap fills in the proto lines (from the rendered source) and the
+// spec lines (by resolving each pointer in the spec file), then writes the
+// .map.json sidecar.
+func (g *genContext) writeSourceMap(outFile, content string) error {
+	protoLines := map[string]int{}
+	if g.format == formatProto {
+		protoLines = protoElementLines(content)
+	}
+	specs := map[string]*yaml.Node{}
+	for _, e := range g.sourceEntries {
+		e.ProtoLine = protoLines[e.Name]
+		root, ok := specs[e.Source]
+		if !ok {
+			root = loadSpecNode(g.readSpec, g.doc.files[e.Source])
+			specs[e.Source] = root
+		}
+		if _, line := pointerNode(root, e.Pointer); line > 0 {
+			e.Line = line
+		}
+	}
+	m := sourceMap{Generated: generatedMarker, Proto: filepath.Base(outFile), Package: g.filePkg, Entries: g.sourceEntries}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return g.writeGenerated(sourceMapPath(outFile), append(data, '\n'))
+}
+
+// protoElementLines maps top-level messages, their fields and top-level
+// enums (named like trace entries) to their line in rendered proto source.
+func protoElementLines(content string) map[string]int {
+	lines := map[string]int{}
+	ast, err := parseProto(content)
+	if err != nil {
+		return lines
+	}
+	for _, m := range ast.messages {
+		lines[m.name] = m.line
+		for _, f := range m.fields {
+			lines[m.name+"."+f.name] = f.line
+		}
+	}
+	for _, e := range ast.enums {
+		lines[e.name] = e.line
+	}
+	return lines
+}
+
+// loadSpecNode parses a spec file or URL (json or yaml) into a node tree,
+// keeping line numbers; nil when it cannot be read.
+func loadSpecNode(read func(string) ([]byte, error), path string) *yaml.Node {
+	if path == "" {
+		return nil
+	}
+	data, err := read(path)
+	if err != nil {
+		return nil
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+	return root.Content[0]
+}
+
+// pointerNode resolves a JSON pointer inside a node tree, following aliases.
+// The line is the one of the last mapping key (or sequence item) on the path.
+func pointerNode(n *yaml.Node, ptr string) (*yaml.Node, int) {
+	if n == nil {
+		return nil, 0
+	}
+	line := n.Line
+	if ptr == "" || ptr == "/" {
+		return n, line
+	}
+	for _, tok := range strings.Split(strings.TrimPrefix(ptr, "/"), "/") {
+		for n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+		tok = unescapePointer(tok)
+		var next *yaml.Node
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == tok {
+					next, line = n.Content[i+1], n.Content[i].Line
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(tok); err == nil && i >= 0 && i < len(n.Content) {
+				next, line = n.Content[i], n.Content[i].Line
+			}
+		}
+		if next == nil {
+			return nil, 0
+		}
+		n = next
+	}
+	return n, line
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// canStream reports whether a file can be written while it is rendered:
+// every pass over the whole rendered text (reformatting, breaking-change and
+// lint checks, verification, source maps, descriptor output) is off.
+func (o *genOptions) canStream() bool {
+	return o.format == formatProto && o.print.isDefault() && o.breaking == breakingOff &&
+		o.style == styleDefault && o.verify == "" && !o.sourceMap
+}
+
+// streamProtoFile renders a file straight to disk: the body goes component
+// by component through a buffered writer into a spool file, then header and
+// body are written to outFile. Peak memory is the largest component instead
+// of the whole output.
+func (o *genOptions) streamProtoFile(doc *Document, pkg, goPkg, preamble, outFile string) (*genContext, error) {
+	if err := os.MkdirAll(filepath.Dir(outFile), 0o755); err != nil {
+		return nil, err
+	}
+	spool, err := os.CreateTemp(filepath.Dir(outFile), "."+filepath.Base(outFile)+".*.body")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	w := bufio.NewWriter(spool)
+	ctx, header := renderParts(doc, o, pkg, goPkg, preamble, w)
+	if len(ctx.errors) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(ctx.errors, "; "))
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if o.module != nil {
+		o.module.recordImports(header)
+	}
+	defer o.metrics.observe(phaseWrite, time.Now())
+	return ctx, o.writeGeneratedFrom(outFile, io.MultiReader(strings.NewReader(header), spool))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const streamSpec = `
+openapi: 3.0.0
+info: {title: Pets, version: "1"}
+paths:
+  /pets/{id}:
+    get:
+      operationId: getPet
+      parameters:
+        - {name: id, in: path, required: true, schema: {type: string}}
+      responses:
+        "200":
+          content:
+            application/json:
+              schema: {$ref: '#/components/schemas/Pet'}
+components:
+  schemas:
+    Kind: {type: string, enum: [cat, dog]}
+    Pet:
+      type: object
+      properties:
+        kind: {$ref: '#/components/schemas/Kind'}
+        born: {type: string, format: date-time}
+        labels: {type: object, additionalProperties: {type: string}}
+        owner:
+          type: object
+          properties:
+            name: {type: string}
+`
+
+// TestStreamProtoFile checks that a streamed file is byte for byte the
+// rendered one, imports of later components included, and that the spool
+// file is removed.
+func TestStreamProtoFile(t *testing.T) {
+	for _, tc := range []struct{ name, spec string }{
+		{"lock", lockSpec},
+		{"services and imports", streamSpec},
+		{"oneof and maps", richExamplesSpec},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := testOptions(t)
+			opts.services, opts.serviceName = servicesSingle, "PetService"
+			if !opts.canStream() {
+				t.Fatal("default options do not stream")
+			}
+			doc := loadSpec(t, opts, "pets.yaml", tc.spec)
+			preamble := infoComment(doc, "")
+			want, ctx := renderFile(doc, opts, opts.pkg, opts.goPkg, preamble)
+			if len(ctx.errors) > 0 {
+				t.Fatal(ctx.errors)
+			}
+			dir := t.TempDir()
+			outFile := filepath.Join(dir, "pets.proto")
+			if _, err := opts.streamProtoFile(doc, opts.pkg, opts.goPkg, preamble, outFile); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(outFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("streamed output differs:\n%s\nwant:\n%s", got, want)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("left behind %v", entries)
+			}
+		})
+	}
+}
+
+func TestCanStream(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		edit func(o *genOptions)
+		want bool
+	}{
+		{"defaults", func(o *genOptions) {}, true},
+		{"descriptor output", func(o *genOptions) { o.format = formatTextprotoDescriptor }, false},
+		{"indent", func(o *genOptions) { o.print.indent = "    " }, false},
+		{"breaking check", func(o *genOptions) { o.breaking = breakingWarn }, false},
+		{"style", func(o *genOptions) { o.style = styleBuf }, false},
+		{"verify", func(o *genOptions) { o.verify = verifyInternal }, false},
+		{"source map", func(o *genOptions) { o.sourceMap = true }, false},
+	} {
+		opts := testOptions(t)
+		tc.edit(opts)
+		if got := opts.canStream(); got != tc.want {
+			t.Errorf("%s: canStream() = %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
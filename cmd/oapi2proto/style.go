@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Naming styles for -style.
+const (
+	styleDefault   = "default"
+	styleBuf       = "buf"
+	styleProtolint = "protolint"
+)
+
+// protolintMaxLineLength is the MAX_LINE_LENGTH default of protolint.
+const protolintMaxLineLength = 80
+
+// bufVersionRe matches the package versions accepted by buf lint
+// PACKAGE_VERSION_SUFFIX (v1, v1beta1, v1p1alpha1, v1test...).
+var bufVersionRe = regexp.MustCompile(`^v\d+(?:test.*|(?:alpha|beta)\d*|p\d+(?:alpha|beta)\d*)?$`)
+
+var (
+	pascalCaseRe     = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+	lowerSnakeCaseRe = regexp.MustCompile(`^[a-z][a-z0-9]*(?:_[a-z0-9]+)*$`)
+	upperSnakeCaseRe = regexp.MustCompile(`^[A-Z][A-Z0-9]*(?:_[A-Z0-9]+)*$`)
+	protoFileNameRe  = regexp.MustCompile(`^[a-z0-9]+(?:_[a-z0-9]+)*\.proto$`)
+)
+
+// bufPackage 将 package 调整为 buf lint 要求的形式: 各段 lower_snake_case, 以版本段结尾 (缺失时追加 v1)
+func bufPackage(pkg string) string {
+	var segs []string
+	for _, seg := range strings.Split(pkg, ".") {
+		seg = collapseUnderscores(strings.Trim(lowerSnake(nonAlnumReplace(seg)), "_"))
+		if seg == "" {
+			continue
+		}
+		if seg[0] >= '0' && seg[0] <= '9' {
+			seg = "x" + seg
+		}
+		segs = append(segs, seg)
+	}
+	if len(segs) == 0 || !bufVersionRe.MatchString(segs[len(segs)-1]) {
+		segs = append(segs, "v1")
+	}
+	return strings.Join(segs, ".")
+}
+
+// stylePackage applies -style to the package of a file, noting the change.
+func (o *genOptions) stylePackage(pkg, inFile string) string {
+	var styled, kind, rules string
+	switch o.style {
+	case styleBuf:
+		styled, kind, rules = bufPackage(pkg), "buf-lint", "PACKAGE_VERSION_SUFFIX / PACKAGE_LOWER_SNAKE_CASE"
+	case styleProtolint:
+		styled, kind, rules = strings.ToLower(pkg), "protolint", "PACKAGE_NAME_LOWER_CASE"
+	default:
+		return pkg
+	}
+	if styled != pkg && o.diags != nil {
+		o.diags.add(diagnostic{File: inFile, Subject: pkg, Kind: kind, Severity: severityInfo, Message: rules + ": package renamed to " + styled})
+	}
+	return styled
+}
+
+// outputBase is the file name (without extension) derived from an input
+// name; lower_snake_case under -style=buf / protolint.
+func (o *genOptions) outputBase(base string) string {
+	if o.style != styleBuf && o.style != styleProtolint {
+		return base
+	}
+	if s := collapseUnderscores(strings.Trim(lowerSnake(nonAlnumReplace(base)), "_")); s != "" {
+		return s
+	}
+	return base
+}
+
+// enumValuePrefix is the prefix of the values of an enum: the upper-cased
+// name, or its UPPER_SNAKE_CASE form under -style=buf / protolint, whose
+// prefix rules expect it.
+func (o *genOptions) enumValuePrefix(enumName string) string {
+	if o.style == styleBuf || o.style == styleProtolint {
+		return strings.ToUpper(lowerSnake(enumName))
+	}
+	return strings.ToUpper(enumName)
+}
+
+// enumValueName joins an enum value prefix and suffix. Enum names starting
+// with a digit (2xxCode) would give values like 2XXCODE_404, which are not
+// identifiers, so those get -enum-digit-prefix in front (N2XXCODE_404).
+func (o *genOptions) enumValueName(prefix, ident string) string {
+	name := prefix + "_" + ident
+	if isDigitByte(name[0]) {
+		return o.enumDigitPrefix + name
+	}
+	return name
+}
+
+// validEnumDigitPrefix reports whether p can start an identifier.
+func validEnumDigitPrefix(p string) bool {
+	if p == "" || isDigitByte(p[0]) {
+		return false
+	}
+	for i := 0; i < len(p); i++ {
+		if c := p[i]; !(isUpperByte(c) || isLowerByte(c) || isDigitByte(c) || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// styleService adds the Service suffix required by SERVICE_SUFFIX.
+func (o *genOptions) styleService(name string) string {
+	if o.style == styleBuf && !strings.HasSuffix(name, "Service") {
+		return name + "Service"
+	}
+	return name
+}
+
+// bufLint checks a rendered file against the buf lint DEFAULT rules that
+// -style=buf aims for and reports each one it could not satisfy as a
+// warning (names taken from the spec or the config, flat layout, ...).
+func (g *genContext) bufLint(outFile, content string) {
+	ast, err := parseProto(content)
+	if err != nil {
+		return
+	}
+	file := filepath.Base(outFile)
+	report := func(rule, subject, format string, args ...any) {
+		g.diag(severityWarning, "buf-lint", subject, rule+": "+fmt.Sprintf(format, args...))
+	}
+	if !protoFileNameRe.MatchString(file) {
+		report("FILE_LOWER_SNAKE_CASE", file, "file name is not lower_snake_case")
+	}
+	segs := strings.Split(ast.pkg, ".")
+	for _, seg := range segs {
+		if !lowerSnakeCaseRe.MatchString(seg) {
+			report("PACKAGE_LOWER_SNAKE_CASE", ast.pkg, "package is not lower_snake_case")
+			break
+		}
+	}
+	if !bufVersionRe.MatchString(segs[len(segs)-1]) {
+		report("PACKAGE_VERSION_SUFFIX", ast.pkg, "package does not end in a version")
+	}
+	if dir := strings.Join(segs, "/"); !strings.HasSuffix(filepath.ToSlash(filepath.Dir(outFile)), "/"+dir) && filepath.ToSlash(filepath.Dir(outFile)) != dir {
+		report("PACKAGE_DIRECTORY_MATCH", file, "file is not in a %s directory (use -layout buf-module)", dir)
+	}
+	for _, imp := range ast.imports {
+		if imp.public {
+			report("IMPORT_NO_PUBLIC", imp.path, "public import")
+		}
+	}
+	walkProtoTypes(ast, func(name string, m *protoMessage) {
+		if !pascalCaseRe.MatchString(m.name) {
+			report("MESSAGE_PASCAL_CASE", name, "message name is not PascalCase")
+		}
+		for _, f := range m.fields {
+			if !lowerSnakeCaseRe.MatchString(f.name) {
+				report("FIELD_LOWER_SNAKE_CASE", name+"."+f.name, "field name is not lower_snake_case")
+			}
+		}
+		for _, o := range m.oneofs {
+			if !lowerSnakeCaseRe.MatchString(o) {
+				report("ONEOF_LOWER_SNAKE_CASE", name+"."+o, "oneof name is not lower_snake_case")
+			}
+		}
+	}, func(name string, e *protoEnum) {
+		if !pascalCaseRe.MatchString(e.name) {
+			report("ENUM_PASCAL_CASE", name, "enum name is not PascalCase")
+		}
+		for _, o := range e.options {
+			if o.name == "allow_alias" && o.value == "true" {
+				report("ENUM_NO_ALLOW_ALIAS", name, "enum allows aliases")
+			}
+		}
+		valuePrefix := strings.ToUpper(lowerSnake(e.name)) + "_"
+		for i, v := range e.values {
+			if !upperSnakeCaseRe.MatchString(v.name) {
+				report("ENUM_VALUE_UPPER_SNAKE_CASE", name+"."+v.name, "enum value is not UPPER_SNAKE_CASE")
+			}
+			if !strings.HasPrefix(v.name, valuePrefix) {
+				report("ENUM_VALUE_PREFIX", name+"."+v.name, "enum value is not prefixed with %s", valuePrefix)
+			}
+			if i == 0 && v.number != 0 {
+				report("ENUM_FIRST_VALUE_ZERO", name+"."+v.name, "first enum value is not zero")
+			}
+			if v.number == 0 && !strings.HasSuffix(v.name, "_UNSPECIFIED") {
+				report("ENUM_ZERO_VALUE_SUFFIX", name+"."+v.name, "zero value is not suffixed with _UNSPECIFIED")
+			}
+		}
+	})
+	local := func(typ string) string {
+		if ast.pkg != "" {
+			typ = strings.TrimPrefix(strings.TrimPrefix(typ, "."), ast.pkg+".")
+		}
+		return typ
+	}
+	used := map[string]string{} // request / response type -> first rpc
+	for _, s := range ast.services {
+		if !pascalCaseRe.MatchString(s.name) {
+			report("SERVICE_PASCAL_CASE", s.name, "service name is not PascalCase")
+		}
+		if !strings.HasSuffix(s.name, "Service") {
+			report("SERVICE_SUFFIX", s.name, "service name is not suffixed with Service")
+		}
+		for _, m := range s.methods {
+			rpc := s.name + "." + m.name
+			if !pascalCaseRe.MatchString(m.name) {
+				report("RPC_PASCAL_CASE", rpc, "rpc name is not PascalCase")
+			}
+			in, out := local(m.input), local(m.output)
+			if in != m.name+"Request" {
+				report("RPC_REQUEST_STANDARD_NAME", rpc, "request type %s is not named %sRequest", m.input, m.name)
+			}
+			if out != m.name+"Response" {
+				report("RPC_RESPONSE_STANDARD_NAME", rpc, "response type %s is not named %sResponse", m.output, m.name)
+			}
+			for _, t := range []string{in, out} {
+				if first, ok := used[t]; ok {
+					report("RPC_REQUEST_RESPONSE_UNIQUE", rpc, "%s is also used by %s", t, first)
+				} else {
+					used[t] = rpc
+				}
+			}
+		}
+	}
+}
+
+// walkProtoTypes visits every message and enum of a parsed file with its
+// dotted name (nested types included).
+func walkProtoTypes(ast *protoAST, msg func(string, *protoMessage), enum func(string, *protoEnum)) {
+	var messages func(prefix string, list []*protoMessage)
+	enums := func(prefix string, list []*protoEnum) {
+		for _, e := range list {
+			enum(prefix+e.name, e)
+		}
+	}
+	messages = func(prefix string, list []*protoMessage) {
+		for _, m := range list {
+			msg(prefix+m.name, m)
+			messages(prefix+m.name+".", m.messages)
+			enums(prefix+m.name+".", m.enums)
+		}
+	}
+	messages("", ast.messages)
+	enums("", ast.enums)
+}
+
+// protolintCheck checks a rendered file against protolint's default rules
+// and reports each violation -style=protolint could not avoid as a warning.
+func (g *genContext) protolintCheck(outFile, content string) {
+	ast, err := parseProto(content)
+	if err != nil {
+		return
+	}
+	file := filepath.Base(outFile)
+	report := func(rule, subject, format string, args ...any) {
+		g.diag(severityWarning, "protolint", subject, rule+": "+fmt.Sprintf(format, args...))
+	}
+	if !protoFileNameRe.MatchString(file) {
+		report("FILE_NAMES_LOWER_SNAKE_CASE", file, "file name is not lower_snake_case")
+	}
+	if ast.pkg != strings.ToLower(ast.pkg) {
+		report("PACKAGE_NAME_LOWER_CASE", ast.pkg, "package name contains capital letters")
+	}
+	if !sort.SliceIsSorted(ast.imports, func(i, j int) bool { return ast.imports[i].path < ast.imports[j].path }) {
+		report("IMPORTS_SORTED", file, "imports are not sorted")
+	}
+	raws := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i, l := range splitPrintLines(content) {
+		raw := raws[i]
+		if n := utf8.RuneCountInString(raw); n > protolintMaxLineLength {
+			report("MAX_LINE_LENGTH", fmt.Sprintf("%s:%d", file, i+1), "line is %d characters long (max %d)", n, protolintMaxLineLength)
+		}
+		if l.text != "" && raw != strings.Repeat("  ", l.depth)+l.text {
+			report("INDENT", fmt.Sprintf("%s:%d", file, i+1), "expected an indentation of %d spaces", 2*l.depth)
+		}
+	}
+	walkProtoTypes(ast, func(name string, m *protoMessage) {
+		if !pascalCaseRe.MatchString(m.name) {
+			report("MESSAGE_NAMES_UPPER_CAMEL_CASE", name, "message name is not UpperCamelCase")
+		}
+		for _, f := range m.fields {
+			if !lowerSnakeCaseRe.MatchString(f.name) {
+				report("FIELD_NAMES_LOWER_SNAKE_CASE", name+"."+f.name, "field name is not lower_snake_case")
+			}
+			if f.label == "repeated" && !looksPlural(f.name) {
+				report("REPEATED_FIELD_NAMES_PLURALIZED", name+"."+f.name, "repeated field name is not plural")
+			}
+		}
+	}, func(name string, e *protoEnum) {
+		if !pascalCaseRe.MatchString(e.name) {
+			report("ENUM_NAMES_UPPER_CAMEL_CASE", name, "enum name is not UpperCamelCase")
+		}
+		valuePrefix := strings.ToUpper(lowerSnake(e.name)) + "_"
+		for _, v := range e.values {
+			if !upperSnakeCaseRe.MatchString(v.name) {
+				report("ENUM_FIELD_NAMES_UPPER_SNAKE_CASE", name+"."+v.name, "enum value is not UPPER_SNAKE_CASE")
+			}
+			if !strings.HasPrefix(v.name, valuePrefix) {
+				report("ENUM_FIELD_NAMES_PREFIX", name+"."+v.name, "enum value is not prefixed with %s", valuePrefix)
+			}
+			if v.number == 0 && !strings.HasSuffix(v.name, "_UNSPECIFIED") {
+				report("ENUM_FIELD_NAMES_ZERO_VALUE_END_WITH", name+"."+v.name, "zero value does not end with _UNSPECIFIED")
+			}
+		}
+	})
+	for _, s := range ast.services {
+		if !pascalCaseRe.MatchString(s.name) {
+			report("SERVICE_NAMES_UPPER_CAMEL_CASE", s.name, "service name is not UpperCamelCase")
+		}
+		for _, m := range s.methods {
+			if !pascalCaseRe.MatchString(m.name) {
+				report("RPC_NAMES_UPPER_CAMEL_CASE", s.name+"."+m.name, "rpc name is not UpperCamelCase")
+			}
+		}
+	}
+}
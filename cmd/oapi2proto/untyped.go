@@ -0,0 +1,30 @@
+package main
+
+// Mappings for schemas without type / composition (-untyped).
+const (
+	untypedString = "string"
+	untypedValue  = "value"
+	untypedAny    = "any"
+	untypedError  = "error"
+)
+
+// untypedType maps a schema that declares no type and nothing to infer one
+// from (no properties, items, enum or composition).
+func (g *genContext) untypedType(name string, s *Schema) string {
+	if s.Type != "" { // unknown type keyword (e.g. 2.0 "file")
+		return "string"
+	}
+	switch g.untyped {
+	case untypedValue:
+		g.useImport("google/protobuf/struct.proto")
+		return "google.protobuf.Value"
+	case untypedAny:
+		g.useImport("google/protobuf/any.proto")
+		return "google.protobuf.Any"
+	case untypedError:
+		g.fail("untyped", name, "schema has no type (use -untyped=string|value|any to map it)")
+		return "string"
+	}
+	g.diag(severityInfo, "untyped", name, "schema has no type; mapped to string")
+	return "string"
+}
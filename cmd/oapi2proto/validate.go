@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Validation rule dialects for -validate.
+const (
+	validateNone          = "none"
+	validateProtovalidate = "protovalidate"
+)
+
+const protovalidateImport = "buf/validate/validate.proto"
+
+// fieldOptions collects the options placed in a field's [...] list.
+func (g *genContext) fieldOptions(s *Schema, ptype string) []string {
+	var opts []string
+	if s.Deprecated {
+		opts = append(opts, "deprecated = true")
+	}
+	opts = append(opts, g.validateRules(s, ptype)...)
+	if o := g.openapiv2FieldOption(s); o != "" {
+		opts = append(opts, o)
+	}
+	if o := g.defaultOption(s); o != "" {
+		opts = append(opts, o)
+	}
+	return opts
+}
+
+// renderFieldOptions renders " [a, b]" (or nothing).
+func renderFieldOptions(opts []string) string {
+	if len(opts) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(opts, ", ") + "]"
+}
+
+// validateRules derives protovalidate rules from schema constraints. Rules of
+// repeated scalars apply to every item.
+func (g *genContext) validateRules(s *Schema, ptype string) []string {
+	if g.validate != validateProtovalidate {
+		return nil
+	}
+	rs := g.resolveRef(s)
+	repeated := strings.HasPrefix(ptype, "repeated ")
+	elem := strings.TrimPrefix(ptype, "repeated ")
+	if repeated {
+		rs = g.resolveRef(rs.Items)
+	}
+	var rules []string
+	if body := scalarRules(rs, elem); len(body) > 0 {
+		rule := fmt.Sprintf("%s: {%s}", elem, strings.Join(body, ", "))
+		if repeated {
+			rules = append(rules, fmt.Sprintf("(buf.validate.field).repeated = {items: {%s}}", rule))
+		} else {
+			rules = append(rules, fmt.Sprintf("(buf.validate.field).%s = {%s}", elem, strings.Join(body, ", ")))
+		}
+	}
+	if m, ok := integerMultipleOf(rs, elem); ok {
+		expr := fmt.Sprintf("this %% %d == 0", m)
+		if repeated {
+			expr = fmt.Sprintf("this.all(x, x %% %d == 0)", m)
+		}
+		rules = append(rules, fmt.Sprintf("(buf.validate.field).cel = {id: \"multiple_of\", message: \"must be a multiple of %d\", expression: \"%s\"}", m, expr))
+	}
+	if len(rules) > 0 {
+		g.useImport(protovalidateImport)
+	}
+	return rules
+}
+
+// integerMultipleOf returns an integral multipleOf on an integer type;
+// protovalidate has no multipleOf rule, so it becomes a CEL expression.
+func integerMultipleOf(s *Schema, ptype string) (int64, bool) {
+	if s.MultipleOf == nil || !isIntegerType(ptype) {
+		return 0, false
+	}
+	m := *s.MultipleOf
+	if m <= 0 || m != math.Trunc(m) {
+		return 0, false
+	}
+	return int64(m), true
+}
+
+// hasMultipleOfRule reports whether validateRules expresses multipleOf, in
+// which case the field comment does not repeat it.
+func (g *genContext) hasMultipleOfRule(s *Schema, ptype string) bool {
+	if g.validate != validateProtovalidate {
+		return false
+	}
+	rs := g.resolveRef(s)
+	if strings.HasPrefix(ptype, "repeated ") {
+		rs = g.resolveRef(rs.Items)
+	}
+	_, ok := integerMultipleOf(rs, strings.TrimPrefix(ptype, "repeated "))
+	return ok
+}
+
+func isIntegerType(ptype string) bool {
+	switch ptype {
+	case "int32", "int64", "uint32", "uint64", "sint32", "sint64", "fixed32", "fixed64", "sfixed32", "sfixed64":
+		return true
+	}
+	return false
+}
+
+// scalarRules returns the rule entries for one scalar proto type.
+func scalarRules(s *Schema, ptype string) []string {
+	var rules []string
+	switch {
+	case isIntegerType(ptype):
+		// integers: exclusive bounds normalize to the equivalent inclusive ones
+		if s.lower != nil {
+			v := math.Ceil(s.lower.value)
+			if s.lower.exclusive && v == s.lower.value {
+				v++
+			}
+			rules = append(rules, "gte: "+formatNumber(v))
+		}
+		if s.upper != nil {
+			v := math.Floor(s.upper.value)
+			if s.upper.exclusive && v == s.upper.value {
+				v--
+			}
+			rules = append(rules, "lte: "+formatNumber(v))
+		}
+		if len(s.Enum) > 0 {
+			rules = append(rules, enumInRule(s, ptype))
+		}
+	case ptype == "string" && len(s.Enum) > 0:
+		// only reached for -enum=string; proto enums are not strings
+		rules = append(rules, enumInRule(s, ptype))
+	case ptype == "double" || ptype == "float":
+		if s.lower != nil {
+			op := "gte"
+			if s.lower.exclusive {
+				op = "gt"
+			}
+			rules = append(rules, op+": "+formatNumber(s.lower.value))
+		}
+		if s.upper != nil {
+			op := "lte"
+			if s.upper.exclusive {
+				op = "lt"
+			}
+			rules = append(rules, op+": "+formatNumber(s.upper.value))
+		}
+	}
+	return rules
+}
+
+func formatNumber(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e18 {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
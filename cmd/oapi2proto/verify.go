@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Compilers for -verify.
+const (
+	verifyInternal = "internal"
+	verifyProtoc   = "protoc"
+	verifyBuf      = "buf"
+)
+
+// wellKnownTypes lists the types of the well-known imports, for resolving
+// qualified references without reading the imported files.
+var wellKnownTypes = map[string][]string{
+	"google/protobuf/any.proto":        {"Any"},
+	"google/protobuf/duration.proto":   {"Duration"},
+	"google/protobuf/empty.proto":      {"Empty"},
+	"google/protobuf/field_mask.proto": {"FieldMask"},
+	"google/protobuf/struct.proto":     {"Struct", "Value", "ListValue", "NullValue"},
+	"google/protobuf/timestamp.proto":  {"Timestamp"},
+	"google/protobuf/wrappers.proto": {"DoubleValue", "FloatValue", "Int64Value", "UInt64Value", "Int32Value",
+		"UInt32Value", "BoolValue", "StringValue", "BytesValue"},
+}
+
+// wellKnownFile returns the well-known import declaring a google.protobuf
+// type, or "".
+func wellKnownFile(typ string) string {
+	name, ok := strings.CutPrefix(typ, "google.protobuf.")
+	if !ok {
+		return ""
+	}
+	for file, names := range wellKnownTypes {
+		for _, n := range names {
+			if n == name {
+				return file
+			}
+		}
+	}
+	return ""
+}
+
+// compilerErrorRe matches "file.proto:12:5: message" lines of protoc / buf.
+var compilerErrorRe = regexp.MustCompile(`^(.*?\.proto):(\d+):(?:\d+:)?\s*(.*)$`)
+
+// parseErrorLineRe extracts the line of a parseProto error.
+var parseErrorLineRe = regexp.MustCompile(`^line (\d+): `)
+
+// verifyOutput compiles a freshly written proto file with the -verify
+// compiler and returns its errors, each annotated with the spec pointer of
+// the nearest generated element. A missing external compiler falls back to
+// the internal checks with a warning.
+func (g *genContext) verifyOutput(outFile, content string) error {
+	mode := g.verify
+	if mode != verifyInternal {
+		if _, err := exec.LookPath(mode); err != nil {
+			g.diag(severityWarning, "verify", filepath.Base(outFile), fmt.Sprintf("%s not found; using -verify=internal", mode))
+			mode = verifyInternal
+		}
+	}
+	type problem struct {
+		line int
+		msg  string
+	}
+	var problems []problem
+	if mode == verifyInternal {
+		for _, e := range checkProto(content) {
+			problems = append(problems, problem{e.line, e.msg})
+		}
+	} else {
+		out, err := g.runCompiler(mode, outFile)
+		if err == nil {
+			return nil
+		}
+		for _, l := range strings.Split(strings.TrimSpace(out), "\n") {
+			if m := compilerErrorRe.FindStringSubmatch(l); m != nil && filepath.Base(m[1]) == filepath.Base(outFile) {
+				n, _ := strconv.Atoi(m[2])
+				problems = append(problems, problem{n, m[3]})
+			} else if l != "" {
+				problems = append(problems, problem{0, l})
+			}
+		}
+		if len(problems) == 0 {
+			problems = append(problems, problem{0, err.Error()})
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	origins := g.lineOrigins(content)
+	var msgs []string
+	for _, p := range problems {
+		msg := p.msg
+		if p.line > 0 {
+			msg = fmt.Sprintf("%s:%d: %s", filepath.Base(outFile), p.line, p.msg)
+			if o := nearestOrigin(origins, p.line); o != "" {
+				msg += " (source: " + o + ")"
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	return fmt.Errorf("-verify=%s:\n  %s", mode, strings.Join(msgs, "\n  "))
+}
+
+// runCompiler runs protoc or buf on the written file and returns its output.
+func (g *genContext) runCompiler(mode, outFile string) (string, error) {
+	root := g.outRoot
+	if root == "" {
+		root = filepath.Dir(outFile)
+	}
+	rel, err := filepath.Rel(root, outFile)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		root, rel = filepath.Dir(outFile), filepath.Base(outFile)
+	}
+	var cmd *exec.Cmd
+	if mode == verifyProtoc {
+		args := []string{"-I", root}
+		for _, dir := range g.verifyIncludes {
+			args = append(args, "-I", dir)
+		}
+		cmd = exec.Command("protoc", append(args, "-o", os.DevNull, filepath.ToSlash(rel))...)
+	} else {
+		cmd = exec.Command("buf", "build", root, "--path", outFile, "-o", os.DevNull)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err = cmd.Run()
+	return out.String(), err
+}
+
+// lineOrigins maps proto lines of traced elements to their spec pointers.
+func (g *genContext) lineOrigins(content string) map[int]string {
+	lines := protoElementLines(content)
+	out := map[int]string{}
+	for _, e := range g.sourceEntries {
+		if l := lines[e.Name]; l > 0 {
+			out[l] = e.Source + "#" + e.Pointer
+		}
+	}
+	return out
+}
+
+// nearestOrigin returns the origin of the closest traced element at or above
+// line.
+func nearestOrigin(origins map[int]string, line int) string {
+	best := 0
+	for l := range origins {
+		if l <= line && l > best {
+			best = l
+		}
+	}
+	return origins[best]
+}
+
+type protoProblem struct {
+	line int
+	msg  string
+}
+
+// protoChecker performs the checks of -verify=internal on a parsed file:
+// duplicate names and numbers, number ranges, reserved conflicts, proto3
+// enum rules and unresolved type references.
+type protoChecker struct {
+	ast      *protoAST
+	types    map[string]bool // fully-qualified local and well-known types
+	foreign  bool            // imports whose types cannot be checked
+	problems []protoProblem
+}
+
+// checkProto runs the internal verification on proto source.
+func checkProto(content string) []protoProblem {
+	ast, err := parseProto(content)
+	if err != nil {
+		line := 0
+		if m := parseErrorLineRe.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		return []protoProblem{{line, err.Error()}}
+	}
+	c := &protoChecker{ast: ast, types: map[string]bool{}}
+	for _, imp := range ast.imports {
+		names, ok := wellKnownTypes[imp.path]
+		if !ok {
+			c.foreign = true
+		}
+		for _, n := range names {
+			c.types[".google.protobuf."+n] = true
+		}
+	}
+	prefix := ""
+	if ast.pkg != "" {
+		prefix = "." + ast.pkg
+	}
+	c.index(prefix, ast.messages, ast.enums)
+	for _, m := range ast.messages {
+		c.message(prefix, m)
+	}
+	c.enums(prefix, ast.enums)
+	names := map[string]int{}
+	for _, s := range ast.services {
+		c.unique(names, s.name, s.line, "service ")
+		methods := map[string]int{}
+		for _, m := range s.methods {
+			c.unique(methods, m.name, m.line, "rpc "+s.name+".")
+			c.resolve(prefix, m.input, m.line)
+			c.resolve(prefix, m.output, m.line)
+		}
+	}
+	sort.SliceStable(c.problems, func(i, j int) bool { return c.problems[i].line < c.problems[j].line })
+	return c.problems
+}
+
+func (c *protoChecker) errorf(line int, format string, args ...any) {
+	c.problems = append(c.problems, protoProblem{line, fmt.Sprintf(format, args...)})
+}
+
+// unique records name in seen and reports a redefinition.
+func (c *protoChecker) unique(seen map[string]int, name string, line int, what string) {
+	if first, ok := seen[name]; ok {
+		c.errorf(line, "%s%s is already defined (line %d)", what, name, first)
+		return
+	}
+	seen[name] = line
+}
+
+// index collects the types of one scope and reports duplicate names (enum
+// values share the scope of their enum, like in C++).
+func (c *protoChecker) index(prefix string, msgs []*protoMessage, enums []*protoEnum) {
+	seen := map[string]int{}
+	for _, m := range msgs {
+		c.unique(seen, m.name, m.line, "")
+		c.types[prefix+"."+m.name] = true
+		c.index(prefix+"."+m.name, m.messages, m.enums)
+	}
+	for _, e := range enums {
+		c.unique(seen, e.name, e.line, "")
+		c.types[prefix+"."+e.name] = true
+		for _, v := range e.values {
+			c.unique(seen, v.name, v.line, "enum value ")
+		}
+	}
+}
+
+func (c *protoChecker) message(scope string, m *protoMessage) {
+	full := scope + "." + m.name
+	names := map[string]int{}
+	numbers := map[int]string{}
+	for _, f := range m.fields {
+		c.unique(names, f.name, f.line, m.name+".")
+		switch {
+		case f.number < 1 || f.number > maxFieldNumber:
+			c.errorf(f.line, "%s.%s: field number %d out of range 1..%d", m.name, f.name, f.number, maxFieldNumber)
+		case f.number >= 19000 && f.number <= 19999:
+			c.errorf(f.line, "%s.%s: field numbers 19000-19999 are reserved for the protobuf implementation", m.name, f.name)
+		}
+		if other, ok := numbers[f.number]; ok {
+			c.errorf(f.line, "%s.%s: field number %d is already used by %s", m.name, f.name, f.number, other)
+		}
+		numbers[f.number] = f.name
+		for _, r := range m.reserved {
+			if f.number >= r.start && f.number <= r.end {
+				c.errorf(f.line, "%s.%s: field number %d is reserved", m.name, f.name, f.number)
+			}
+		}
+		for _, rn := range m.reservedNames {
+			if rn == f.name {
+				c.errorf(f.line, "%s.%s: field name is reserved", m.name, f.name)
+			}
+		}
+		if f.keyType != "" {
+			c.resolve(full, f.valType, f.line)
+		} else {
+			c.resolve(full, f.typ, f.line)
+		}
+	}
+	for _, nested := range m.messages {
+		c.message(full, nested)
+	}
+	c.enums(full, m.enums)
+}
+
+func (c *protoChecker) enums(scope string, enums []*protoEnum) {
+	for _, e := range enums {
+		if c.ast.syntax == "proto3" && (len(e.values) == 0 || e.values[0].number != 0) {
+			c.errorf(e.line, "%s: the first enum value must be zero in proto3", e.name)
+		}
+		alias := false
+		for _, o := range e.options {
+			alias = alias || (o.name == "allow_alias" && o.value == "true")
+		}
+		numbers := map[int]string{}
+		for _, v := range e.values {
+			if other, ok := numbers[v.number]; ok && !alias {
+				c.errorf(v.line, "%s.%s: value %d is already used by %s (set allow_alias)", e.name, v.name, v.number, other)
+			}
+			numbers[v.number] = v.name
+			for _, r := range e.reserved {
+				if v.number >= r.start && v.number <= r.end {
+					c.errorf(v.line, "%s.%s: value %d is reserved", e.name, v.name, v.number)
+				}
+			}
+		}
+	}
+}
+
+// resolve reports a type reference that neither a local type nor an
+// imported well-known type provides. References into other imports are
+// accepted, their contents being unknown here.
+func (c *protoChecker) resolve(scope, typ string, line int) {
+	if typ == "" || scalarDescriptorTypes[typ] != "" {
+		return
+	}
+	if strings.HasPrefix(typ, ".") {
+		if !c.types[typ] && !c.foreign {
+			c.errorf(line, "%q is not defined", typ)
+		}
+		return
+	}
+	for s := scope; ; {
+		if c.types[s+"."+typ] {
+			return
+		}
+		if s == "" {
+			break
+		}
+		s = s[:strings.LastIndex(s, ".")]
+	}
+	if file := wellKnownFile(typ); file != "" {
+		c.errorf(line, "%q is not defined (missing import %q?)", typ, file)
+		return
+	}
+	if !strings.Contains(typ, ".") || !c.foreign {
+		c.errorf(line, "%q is not defined", typ)
+	}
+}
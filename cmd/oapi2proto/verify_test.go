@@ -0,0 +1,135 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckProto(t *testing.T) {
+	for _, tc := range []struct {
+		name, src string
+		line      int
+		want      string
+	}{
+		{"valid", `syntax = "proto3";
+package api.v1;
+import "google/protobuf/timestamp.proto";
+message Pet {
+  string name = 1;
+  google.protobuf.Timestamp born = 2;
+  reserved 3 to 5;
+}
+`, 0, ""},
+		{"duplicate field name", `syntax = "proto3";
+message Pet {
+  string name = 1;
+  int32 name = 2;
+}
+`, 4, "Pet.name is already defined (line 3)"},
+		{"duplicate field number", `syntax = "proto3";
+message Pet {
+  string a = 1;
+  string b = 1;
+}
+`, 4, "Pet.b: field number 1 is already used by a"},
+		{"implementation range", `syntax = "proto3";
+message Pet {
+  string a = 19001;
+}
+`, 3, "field numbers 19000-19999 are reserved"},
+		{"reserved number", `syntax = "proto3";
+message Pet {
+  reserved 2 to 4;
+  string a = 3;
+}
+`, 4, "Pet.a: field number 3 is reserved"},
+		{"first enum value", `syntax = "proto3";
+enum Kind {
+  KIND_CAT = 1;
+}
+`, 2, "the first enum value must be zero in proto3"},
+		{"enum value scope", `syntax = "proto3";
+enum A {
+  NONE = 0;
+}
+enum B {
+  NONE = 0;
+}
+`, 6, "enum value NONE is already defined (line 3)"},
+		{"undefined type", `syntax = "proto3";
+message Pet {
+  Owner owner = 1;
+}
+`, 3, `"Owner" is not defined`},
+		{"missing well-known import", `syntax = "proto3";
+message Pet {
+  google.protobuf.Timestamp born = 1;
+}
+`, 3, `missing import "google/protobuf/timestamp.proto"?`},
+		{"foreign import", `syntax = "proto3";
+import "shared/v1/api.proto";
+message Pet {
+  shared.v1.Owner owner = 1;
+}
+`, 0, ""},
+		{"parse error", `syntax = "proto3";
+message Pet {
+  string a = ;
+}
+`, 3, "line 3: "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			problems := checkProto(tc.src)
+			if tc.want == "" {
+				if len(problems) > 0 {
+					t.Errorf("unexpected problems %v", problems)
+				}
+				return
+			}
+			if len(problems) != 1 || problems[0].line != tc.line || !strings.Contains(problems[0].msg, tc.want) {
+				t.Errorf("problems = %v, want one at line %d containing %q", problems, tc.line, tc.want)
+			}
+		})
+	}
+}
+
+// TestVerifyOutput checks that -verify errors point at the spec element the
+// failing line was generated from, and that a missing external compiler
+// falls back to the internal checks.
+func TestVerifyOutput(t *testing.T) {
+	for _, mode := range []string{verifyInternal, verifyProtoc} {
+		t.Run(mode, func(t *testing.T) {
+			t.Setenv("PATH", t.TempDir())
+			opts := testOptions(t)
+			opts.verify = mode
+			opts.diags = &diagnostics{}
+			doc := loadSpec(t, opts, "pets.yaml", lockSpec)
+			out, ctx := renderFile(doc, opts, opts.pkg, opts.goPkg, "")
+			outFile := filepath.Join(t.TempDir(), "pets.proto")
+			if err := ctx.verifyOutput(outFile, out); err != nil {
+				t.Fatalf("generated output fails verification: %v", err)
+			}
+			broken := strings.Replace(out, "string old = 2;", "string old = 1;", 1)
+			if broken == out {
+				t.Fatalf("no field old = 2 in\n%s", out)
+			}
+			err := ctx.verifyOutput(outFile, broken)
+			if err == nil {
+				t.Fatal("duplicate field number not reported")
+			}
+			for _, want := range []string{"-verify=internal", "field number 1 is already used by new", "(source: pets.yaml#/components/schemas/Pet/properties/old)"} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("missing %q in %v", want, err)
+				}
+			}
+			fallback := false
+			for _, d := range opts.diags.entries {
+				fallback = fallback || (d.Kind == "verify" && strings.Contains(d.Message, "using -verify=internal"))
+			}
+			if fallback != (mode == verifyProtoc) {
+				t.Errorf("fallback warning = %t for -verify=%s", fallback, mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// generatedMarker heads every generated proto file; an existing output
+// without it (or the "Generated by oapi2proto" sidecar headers) is not
+// overwritten unless -force is given.
+const generatedMarker = "Code generated by oapi2proto. DO NOT EDIT."
+
+// isGenerated reports whether existing file content carries a marker of this
+// tool in its first lines.
+func isGenerated(data []byte) bool {
+	head := strings.ToLower(string(data[:min(len(data), 512)]))
+	return strings.Contains(head, strings.ToLower(generatedMarker)) || strings.Contains(head, "generated by oapi2proto")
+}
+
+// writeGenerated writes a generated file, refusing to replace a file that was
+// not produced by this tool unless -force is set; with -backup the previous
+// content is kept as <file>.bak.
+func (o *genOptions) writeGenerated(path string, data []byte) error {
+	return o.writeOwned(path, data, isGenerated)
+}
+
+// writeOwned is writeGenerated for outputs that cannot carry the marker in
+// their first lines: ours tells whether existing content was written by this
+// tool.
+func (o *genOptions) writeOwned(path string, data []byte, ours func([]byte) bool) error {
+	old, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil && !bytes.Equal(old, data) {
+		if !ours(old) && !o.force {
+			return fmt.Errorf("%s 已存在且不是 oapi2proto 生成的文件 (缺少 %q 标记), 使用 -force 覆盖", path, generatedMarker)
+		}
+		if o.backup {
+			if err := writeFileAtomic(path+".bak", old); err != nil {
+				return err
+			}
+		}
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data through a temporary file renamed over path, so
+// readers never see a half-written file. When path already holds exactly
+// data it is left untouched, keeping its mtime for build systems.
+func writeFileAtomic(path string, data []byte) error {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeGeneratedFrom is writeGenerated for content streamed from r: it is
+// spooled to a temporary file next to path and compared with the existing
+// file chunk by chunk, so neither version is held in memory.
+func (o *genOptions) writeGeneratedFrom(path string, r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	w := bufio.NewWriter(tmp)
+	if _, err := io.Copy(w, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	same, err := sameContent(path, tmp.Name())
+	if err != nil || same {
+		return err
+	}
+	if head, err := readHead(path, 512); err == nil {
+		if !isGenerated(head) && !o.force {
+			return fmt.Errorf("%s 已存在且不是 oapi2proto 生成的文件 (缺少 %q 标记), 使用 -force 覆盖", path, generatedMarker)
+		}
+		if o.backup {
+			if err := copyFileAtomic(path, path+".bak"); err != nil {
+				return err
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readHead returns the first n bytes of a file.
+func readHead(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, n)
+	m, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return head[:m], nil
+}
+
+// sameContent reports whether two files hold the same bytes; a missing
+// first file is simply different.
+func sameContent(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+	if ia, err := fa.Stat(); err != nil {
+		return false, err
+	} else if ib, err := fb.Stat(); err != nil || ia.Size() != ib.Size() {
+		return false, err
+	}
+	ba, bb := make([]byte, 64<<10), make([]byte, 64<<10)
+	for {
+		na, errA := io.ReadFull(fa, ba)
+		nb, errB := io.ReadFull(fb, bb)
+		if !bytes.Equal(ba[:na], bb[:nb]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// copyFileAtomic copies src over dst through a temporary file.
+func copyFileAtomic(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFileAtomicFrom(dst, in)
+}
+
+// writeFileAtomicFrom is writeFileAtomic for content read from r.
+func writeFileAtomicFrom(path string, r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
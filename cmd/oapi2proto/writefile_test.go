@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cstcen/oapi2proto/archive"
+)
+
+func TestOwnedOutputs(t *testing.T) {
+	srcMap, err := json.MarshalIndent(sourceMap{Generated: generatedMarker, Proto: "pets.proto"}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svcConfig, err := json.MarshalIndent(serviceConfig{MethodConfig: []*methodConfig{{Name: []methodName{{Service: "api.v1.PetService"}}, Timeout: "5s"}}}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := fstest.MapFS{"pets.proto": {Data: []byte("// " + generatedMarker + "\n")}}
+	packed := func(name string) []byte {
+		var b bytes.Buffer
+		if err := archive.Pack(&b, name, generatedMarker, fstest.MapFS{"old.proto": {Data: []byte("old")}}); err != nil {
+			t.Fatal(err)
+		}
+		return b.Bytes()
+	}
+	for _, tc := range []struct {
+		name, file string
+		write      func(o *genOptions, path string) error
+		generated  []byte // an earlier, different output of the tool
+	}{
+		{"source map", "pets.map.json", func(o *genOptions, path string) error { return o.writeGenerated(path, srcMap) },
+			[]byte(`{"generated": "` + generatedMarker + `", "proto": "old.proto"}`)},
+		{"service config", "pets_service_config.json", func(o *genOptions, path string) error {
+			return o.writeOwned(path, svcConfig, isGeneratedServiceConfig)
+		}, []byte(`{"methodConfig": []}`)},
+		{"zip", "out.zip", func(o *genOptions, path string) error { return o.writeArchive(path, files) }, packed("out.zip")},
+		{"tar", "out.tar", func(o *genOptions, path string) error { return o.writeArchive(path, files) }, packed("out.tar")},
+		{"tar.gz", "out.tar.gz", func(o *genOptions, path string) error { return o.writeArchive(path, files) }, packed("out.tar.gz")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			opts := testOptions(t)
+			if err := os.WriteFile(path, []byte("hand-written\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.write(opts, path); err == nil {
+				t.Fatal("replaced a hand-written file without -force")
+			}
+			opts.force = true
+			if err := tc.write(opts, path); err != nil {
+				t.Fatalf("-force: %v", err)
+			}
+			opts.force = false
+			if err := os.WriteFile(path, tc.generated, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.write(opts, path); err != nil {
+				t.Errorf("refused to replace its own output: %v", err)
+			}
+		})
+	}
+}